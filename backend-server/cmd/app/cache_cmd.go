@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/service"
+)
+
+// cacheUsage cacheサブコマンドの使い方
+const cacheUsage = `usage:
+  app cache export [-host HOST] [-since DATE] [-until DATE] [-gzip] [-o FILE]
+  app cache import FILE...   (FILEに - を指定すると標準入力から読み込む)`
+
+// runCacheCommand キャッシュをWARCファイルにエクスポート・インポートするサブコマンドを実行する
+// サーバーを起動せずに、設定ファイルと同じキャッシュディレクトリ・メタデータのストアを使う
+func runCacheCommand(ctx context.Context, archiveService *service.CacheArchiveService, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing cache command\n%s", cacheUsage)
+	}
+	switch args[0] {
+	case "export":
+		return runCacheExport(ctx, archiveService, args[1:])
+	case "import":
+		return runCacheImport(ctx, archiveService, args[1:])
+	default:
+		return fmt.Errorf("unknown cache command: %s\n%s", args[0], cacheUsage)
+	}
+}
+
+func runCacheExport(ctx context.Context, archiveService *service.CacheArchiveService, args []string) error {
+	fs := flag.NewFlagSet("cache export", flag.ContinueOnError)
+	host := fs.String("host", "", "export only entries for this host (subdomains included)")
+	since := fs.String("since", "", "export only entries stored at or after this time (RFC3339 or YYYY-MM-DD)")
+	until := fs.String("until", "", "export only entries stored before this time (RFC3339 or YYYY-MM-DD)")
+	compress := fs.Bool("gzip", false, "gzip each record (.warc.gz)")
+	output := fs.String("o", "-", "output file (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter, err := model.NewCacheFilter(*host, *since, *until)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := archiveService.Export(ctx, filter, w, *compress)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d entries exported", count)
+	return nil
+}
+
+func runCacheImport(ctx context.Context, archiveService *service.CacheArchiveService, args []string) error {
+	fs := flag.NewFlagSet("cache import", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no WARC files given\n%s", cacheUsage)
+	}
+
+	for _, name := range fs.Args() {
+		var r io.Reader = os.Stdin
+		if name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", name, err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		result, err := archiveService.Import(ctx, r)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", name, err)
+		}
+		log.Printf("%s: %d entries imported, %d skipped", name, result.Imported, result.Skipped)
+	}
+	return nil
+}
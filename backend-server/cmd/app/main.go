@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 
 	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/cmd/config"
 	gateway_interface "github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/gateway"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
 	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/service"
 	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/handlers"
 	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/gateway"
@@ -32,18 +34,99 @@ func main() {
 	// 設定とインフラストラクチャの初期化
 	// ============================================
 
-	// Redisクライアントの初期化
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", conf.RedisClient.Host, conf.RedisClient.Port),
-		Password: conf.RedisClient.Password,
-		DB:       conf.RedisClient.DB,
-	})
+	// Redisクライアントの初期化（設定に応じてRedisサーバーかプロセス内のストアを使用）
 	redisConfig := plugins.RedisClientConfig{
 		ReservedRequestsKey: conf.RedisKeys.ReservedRequestsKey,
+		PendingRequestsKey:  conf.RedisKeys.PendingRequestsKey,
+		SubscriptionsKey:    conf.RedisKeys.SubscriptionsKey,
 		CacheMetaPattern:    conf.RedisKeys.CacheMetaPattern,
+		CacheAccessKey:      conf.RedisKeys.CacheAccessKey,
+		CacheIndexKey:       conf.RedisKeys.CacheIndexKey,
+		CachePinsKey:        conf.RedisKeys.CachePinsKey,
 		ScanCount:           conf.RedisKeys.ScanCount,
 	}
-	repoClient := plugins.NewRedisClient(redisClient, redisConfig)
+	var repoClient repository.BpRepoClient
+	var embeddedClient *plugins.EmbeddedClient
+	switch conf.RedisClient.Backend {
+	case config.RedisBackend:
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", conf.RedisClient.Host, conf.RedisClient.Port),
+			Password: conf.RedisClient.Password,
+			DB:       conf.RedisClient.DB,
+		})
+		repoClient = plugins.NewRedisClient(redisClient, redisConfig)
+	case config.EmbeddedBackend:
+		log.Printf("Using embedded store (path=%s)", conf.RedisClient.Path)
+		var err error
+		embeddedClient, err = plugins.NewEmbeddedClient(conf.RedisClient.Path, redisConfig)
+		if err != nil {
+			log.Fatalf("Failed to open embedded store: %v", err)
+		}
+		defer embeddedClient.Close()
+		repoClient = embeddedClient
+	default:
+		log.Fatalf("Invalid redis backend: %s (use 'redis' or 'embedded')", conf.RedisClient.Backend)
+	}
+
+	if conf.Cache.Eviction.Mode != model.EvictLRU && conf.Cache.Eviction.Mode != model.EvictLFU {
+		log.Fatalf("Invalid eviction mode: %s (use 'lru' or 'lfu')", conf.Cache.Eviction.Mode)
+	}
+	eviction := &model.EvictionPolicy{
+		MaxBytes: conf.Cache.Eviction.MaxMB * 1024 * 1024,
+		Mode:     conf.Cache.Eviction.Mode,
+		Pins:     conf.Cache.Eviction.Pins,
+	}
+	switch conf.Cache.Integrity.Verify {
+	case model.VerifyAlways, model.VerifySample, model.VerifySize:
+	default:
+		log.Fatalf("Invalid integrity verify mode: %s (use 'always', 'sample' or 'size')", conf.Cache.Integrity.Verify)
+	}
+	integrity := &model.IntegrityPolicy{
+		Verify:     conf.Cache.Integrity.Verify,
+		SampleRate: conf.Cache.Integrity.SampleRate,
+	}
+	bprepo := repository.NewBpRepository(repoClient, conf.Cache.Dir, conf.Cache.MaxStale, conf.Cache.MinFreeMB*1024*1024, eviction,
+		conf.Cache.StreamKB*1024, integrity, conf.Cache.Integrity.QuarantineDir)
+
+	// 管理APIとエクスポートで使うホストごとのインデックスに、インデックスを持たない以前のエントリも登録する
+	// clear_on_startでサーバーを起動する場合はインデックスごと削除するため作り直さない（cacheサブコマンドでは作り直す）
+	cacheCommand := len(os.Args) > 1 && os.Args[1] == "cache"
+	if !conf.Cache.ClearOnStart || cacheCommand {
+		if count, err := bprepo.RebuildCacheIndex(context.Background()); err != nil {
+			log.Printf("Failed to rebuild cache index: %v", err)
+		} else {
+			log.Printf("Cache index rebuilt (%d entries)", count)
+		}
+	}
+
+	// レスポンスのTTLはヘッダーからRFC 9111に従って決める（RequestHandler・ResponseWatcher・WARCの取り込みで共通）
+	freshness := &model.FreshnessPolicy{
+		DefaultTTL:        conf.Cache.DefaultTTL,
+		HeuristicFraction: conf.Cache.Freshness.HeuristicFraction,
+		MinTTL:            conf.Cache.Freshness.MinTTL,
+		MaxTTL:            conf.Cache.Freshness.MaxTTL,
+	}
+	for _, h := range conf.Cache.Freshness.Hosts {
+		freshness.Hosts = append(freshness.Hosts, model.FreshnessHostRule{
+			Match:      h.Match,
+			MinTTL:     h.MinTTL,
+			MaxTTL:     h.MaxTTL,
+			ForceStore: h.ForceStore,
+		})
+	}
+	archivesrv := service.NewCacheArchiveService(bprepo, freshness)
+
+	// cacheサブコマンド: サーバーを起動せずにキャッシュをWARCファイルにエクスポート・インポートする
+	if cacheCommand {
+		err := runCacheCommand(context.Background(), archivesrv, os.Args[2:])
+		if embeddedClient != nil {
+			embeddedClient.Close()
+		}
+		if err != nil {
+			log.Fatalf("cache: %v", err)
+		}
+		return
+	}
 
 	// 依存関係の初期化: トランスポートモードに応じてゲートウェイを選択
 	var bpgw gateway_interface.BpGateway
@@ -78,8 +161,6 @@ func main() {
 		bpgw = gateway.NewLocalGateway(conf.BPGateway.Timeout)
 	}
 
-	bprepo := repository.NewBpRepository(repoClient, conf.Cache.Dir)
-
 	// ============================================
 	// ミドルウェアの初期化
 	// ============================================
@@ -99,6 +180,13 @@ func main() {
 
 	bpsrv := service.NewBpService(bpgw, bprepo, conf.Server.DefaultDir, conf.Server.DefaultFileName)
 	bpHandler := handlers.NewBpHandler(bpsrv, middlwares)
+	subsrv := service.NewSubscriptionService(bpgw, bprepo)
+	subHandler := handlers.NewSubscriptionHandler(subsrv, conf.Server.DefaultDir)
+	mfsrv := service.NewManifestService(bpgw, bprepo, conf.Cache.ManifestTTL)
+	mfHandler := handlers.NewManifestHandler(mfsrv, conf.Server.DefaultDir)
+	archiveHandler := handlers.NewCacheArchiveHandler(archivesrv)
+	adminsrv := service.NewCacheAdminService(bprepo)
+	adminHandler := handlers.NewCacheAdminHandler(adminsrv)
 
 	// ============================================
 	// サーバーのセットアップ
@@ -132,22 +220,53 @@ func main() {
 		)
 	}))
 
-	// 管理用エンドポイント: キャッシュの一括削除
+	// 管理用エンドポイント: キャッシュの一括削除（期限に関係なくすべてのエントリを削除する）
 	r.POST("/system/admin/cache/cleanup", func(c *gin.Context) {
 		ctx := c.Request.Context()
 		err := bprepo.DeleteAllCaches(ctx)
 		if err != nil {
 			c.JSON(500, gin.H{
-				"error":   "Failed to cleanup expired cache",
+				"error":   "Failed to cleanup cache",
 				"message": err.Error(),
 			})
 			return
 		}
 		c.JSON(200, gin.H{
-			"message": "Expired cache cleanup completed successfully",
+			"message": "All cache entries deleted successfully",
 		})
 	})
 
+	// 管理用エンドポイント: キャッシュのエントリの一覧・ホストごとの統計・詳細、URL・ホスト・前方一致での削除と再取得、固定
+	r.GET("/system/admin/cache/entries", adminHandler.List)
+	r.GET("/system/admin/cache/entries/:id", adminHandler.Get)
+	r.DELETE("/system/admin/cache/entries", adminHandler.Delete)
+	r.POST("/system/admin/cache/refresh", adminHandler.Refresh)
+	r.GET("/system/admin/cache/hosts", adminHandler.Hosts)
+	r.GET("/system/admin/cache/pins", adminHandler.Pins)
+	r.POST("/system/admin/cache/pins", adminHandler.Pin)
+	r.DELETE("/system/admin/cache/pins", adminHandler.Unpin)
+
+	// 管理用エンドポイント: キャッシュの整合性の確認、隔離したエントリの一覧と再取得による修復
+	r.POST("/system/admin/cache/scrub", adminHandler.Scrub)
+	r.GET("/system/admin/cache/quarantine", adminHandler.Quarantine)
+	r.POST("/system/admin/cache/repair", adminHandler.Repair)
+
+	// 管理用エンドポイント: キャッシュのWARCファイルへのエクスポートとWARCファイルからのインポート
+	r.GET("/system/admin/cache/export", archiveHandler.Export)
+	r.POST("/system/admin/cache/import", archiveHandler.Import)
+
+	// 購読（Earth側での定期的な再取得）の管理ページとAPI
+	r.GET("/system/subscriptions", subHandler.Page)
+	r.GET("/system/api/subscriptions", subHandler.List)
+	r.POST("/system/api/subscriptions", subHandler.Subscribe)
+	r.DELETE("/system/api/subscriptions", subHandler.Unsubscribe)
+
+	// ページのマニフェスト（サブリソースとリンクの一覧）の表示と、選んだ項目のまとめての取得
+	r.GET("/system/manifests", mfHandler.Page)
+	r.GET("/system/api/manifests", mfHandler.Get)
+	r.POST("/system/api/manifests", mfHandler.Request)
+	r.POST("/system/api/manifests/batch", mfHandler.Batch)
+
 	// CONNECTメソッドを処理するミドルウェアを追加
 	// CONNECTメソッドのリクエストは、パスがhost:port形式になる可能性があるため、
 	// NoRouteの前に処理する必要がある
@@ -168,11 +287,11 @@ func main() {
 	// Worker Poolの起動（非同期リクエスト処理）
 	// ============================================
 	// プラグイン可能なWorker実装を使用
-	reqHandler := scheduler_worker.NewRequestHandler(bprepo, bpgw, conf.Cache.DefaultTTL)
+	reqHandler := scheduler_worker.NewRequestHandler(bprepo, bpgw, freshness, conf.Cache.ErrorTTL)
 	queueWatcher := scheduler_worker.NewQueueWatcher(bprepo, conf.Worker.QueueWatchTimeout)
 	cacheHandler := scheduler_worker.NewCacheHandler(bprepo)
-	responseWatcher := scheduler_worker.NewResponseWatcher(bpgw, bprepo)
-	processor := scheduler.NewRequestProcessor(conf.Worker.Workers, reqHandler, queueWatcher, cacheHandler, responseWatcher, conf.Cache.CleanupInterval) // 5つのworker
+	responseWatcher := scheduler_worker.NewResponseWatcher(bpgw, bprepo, freshness, conf.Cache.ErrorTTL, conf.Cache.ManifestTTL)
+	processor := scheduler.NewRequestProcessor(conf.Worker.Workers, reqHandler, queueWatcher, cacheHandler, responseWatcher, conf.Cache.CleanupInterval, conf.Cache.Integrity.ScrubInterval, conf.Cache.ClearOnStart) // 5つのworker
 	ctx := context.Background()
 	processor.Start(ctx)
 
@@ -34,6 +34,8 @@ func LoadConfig() Config {
 			},
 		},
 		RedisClient: Redis{
+			Backend:  RedisBackend,
+			Path:     "./tmp/bp_store.log",
 			Host:     "localhost",
 			Port:     6379,
 			Password: "",
@@ -42,7 +44,11 @@ func LoadConfig() Config {
 		RedisKeys: RedisKeys{
 			ReservedRequestsKey: "bp:reserved:requests",
 			PendingRequestsKey:  "bp:pending:requests",
+			SubscriptionsKey:    "bp:subscriptions",
 			CacheMetaPattern:    "bp:cache:meta:*",
+			CacheAccessKey:      "bp:cache:access",
+			CacheIndexKey:       "bp:cache:index",
+			CachePinsKey:        "bp:cache:pins",
 			// ScanCount は省略可能（デフォルト値100が使用される）
 			// ScanCount:           100,
 		},
@@ -50,6 +56,23 @@ func LoadConfig() Config {
 			Dir:             "./tmp/bp_cache",
 			DefaultTTL:      24 * time.Hour,
 			CleanupInterval: 5 * time.Minute,
+			ErrorTTL:        5 * time.Minute,
+			ManifestTTL:     time.Hour,
+			MaxStale:        7 * 24 * time.Hour,
+			MinFreeMB:       512,
+			StreamKB:        256,
+			Eviction: EvictionConfig{
+				Mode: "lru",
+			},
+			Freshness: FreshnessConfig{
+				HeuristicFraction: 0.1,
+			},
+			Integrity: IntegrityConfig{
+				Verify:        "always",
+				SampleRate:    0.1,
+				ScrubInterval: 24 * time.Hour,
+				QuarantineDir: "./tmp/bp_quarantine",
+			},
 		},
 		Worker: WorkerConfig{
 			Workers:           10,
@@ -110,6 +133,8 @@ type yamlConfig struct {
 		} `yaml:"bp_socket"`
 	} `yaml:"bp_gateway"`
 	RedisClient struct {
+		Backend  string `yaml:"backend"`
+		Path     string `yaml:"path"`
 		Host     string `yaml:"host"`
 		Port     int    `yaml:"port"`
 		Password string `yaml:"password"`
@@ -118,13 +143,45 @@ type yamlConfig struct {
 	RedisKeys struct {
 		ReservedRequestsKey string `yaml:"reserved_requests_key"`
 		PendingRequestsKey  string `yaml:"pending_requests_key"`
+		SubscriptionsKey    string `yaml:"subscriptions_key"`
 		CacheMetaPattern    string `yaml:"cache_meta_pattern"`
+		CacheAccessKey      string `yaml:"cache_access_key"`
+		CacheIndexKey       string `yaml:"cache_index_key"`
+		CachePinsKey        string `yaml:"cache_pins_key"`
 		ScanCount           int    `yaml:"scan_count"`
 	} `yaml:"redis_keys"`
 	Cache struct {
 		Dir             string `yaml:"dir"`
 		DefaultTTL      string `yaml:"default_ttl"`
 		CleanupInterval string `yaml:"cleanup_interval"`
+		ErrorTTL        string `yaml:"error_ttl"`
+		ManifestTTL     string `yaml:"manifest_ttl"`
+		MaxStale        string `yaml:"max_stale"`
+		MinFreeMB       int64  `yaml:"min_free_mb"`
+		StreamKB        int64  `yaml:"stream_kb"`
+		ClearOnStart    bool   `yaml:"clear_on_start"`
+		Eviction        struct {
+			MaxMB int64    `yaml:"max_mb"`
+			Mode  string   `yaml:"mode"`
+			Pins  []string `yaml:"pins"`
+		} `yaml:"eviction"`
+		Integrity struct {
+			Verify        string  `yaml:"verify"`
+			SampleRate    float64 `yaml:"sample_rate"`
+			ScrubInterval string  `yaml:"scrub_interval"`
+			QuarantineDir string  `yaml:"quarantine_dir"`
+		} `yaml:"integrity"`
+		Freshness struct {
+			HeuristicFraction float64 `yaml:"heuristic_fraction"`
+			MinTTL            string  `yaml:"min_ttl"`
+			MaxTTL            string  `yaml:"max_ttl"`
+			Hosts             []struct {
+				Match      string `yaml:"match"`
+				MinTTL     string `yaml:"min_ttl"`
+				MaxTTL     string `yaml:"max_ttl"`
+				ForceStore bool   `yaml:"force_store"`
+			} `yaml:"hosts"`
+		} `yaml:"freshness"`
 	} `yaml:"cache"`
 	Worker struct {
 		Workers           int    `yaml:"workers"`
@@ -158,6 +215,16 @@ func (yc yamlConfig) toConfig() Config {
 		return d
 	}
 
+	var freshnessHosts []FreshnessHostConfig
+	for _, h := range yc.Cache.Freshness.Hosts {
+		freshnessHosts = append(freshnessHosts, FreshnessHostConfig{
+			Match:      h.Match,
+			MinTTL:     parseDuration(h.MinTTL),
+			MaxTTL:     parseDuration(h.MaxTTL),
+			ForceStore: h.ForceStore,
+		})
+	}
+
 	var mode Mode
 	if yc.Server.Mode == "debug" {
 		mode = DebugMode
@@ -179,6 +246,8 @@ func (yc yamlConfig) toConfig() Config {
 			},
 		},
 		RedisClient: Redis{
+			Backend:  yc.RedisClient.Backend,
+			Path:     yc.RedisClient.Path,
 			Host:     yc.RedisClient.Host,
 			Port:     yc.RedisClient.Port,
 			Password: yc.RedisClient.Password,
@@ -186,13 +255,41 @@ func (yc yamlConfig) toConfig() Config {
 		},
 		RedisKeys: RedisKeys{
 			ReservedRequestsKey: yc.RedisKeys.ReservedRequestsKey,
+			PendingRequestsKey:  yc.RedisKeys.PendingRequestsKey,
+			SubscriptionsKey:    yc.RedisKeys.SubscriptionsKey,
 			CacheMetaPattern:    yc.RedisKeys.CacheMetaPattern,
+			CacheAccessKey:      yc.RedisKeys.CacheAccessKey,
+			CacheIndexKey:       yc.RedisKeys.CacheIndexKey,
+			CachePinsKey:        yc.RedisKeys.CachePinsKey,
 			ScanCount:           yc.RedisKeys.ScanCount,
 		},
 		Cache: CacheConfig{
 			Dir:             yc.Cache.Dir,
 			DefaultTTL:      parseDuration(yc.Cache.DefaultTTL),
 			CleanupInterval: parseDuration(yc.Cache.CleanupInterval),
+			ErrorTTL:        parseDuration(yc.Cache.ErrorTTL),
+			ManifestTTL:     parseDuration(yc.Cache.ManifestTTL),
+			MaxStale:        parseDuration(yc.Cache.MaxStale),
+			MinFreeMB:       yc.Cache.MinFreeMB,
+			StreamKB:        yc.Cache.StreamKB,
+			ClearOnStart:    yc.Cache.ClearOnStart,
+			Eviction: EvictionConfig{
+				MaxMB: yc.Cache.Eviction.MaxMB,
+				Mode:  yc.Cache.Eviction.Mode,
+				Pins:  yc.Cache.Eviction.Pins,
+			},
+			Integrity: IntegrityConfig{
+				Verify:        yc.Cache.Integrity.Verify,
+				SampleRate:    yc.Cache.Integrity.SampleRate,
+				ScrubInterval: parseDuration(yc.Cache.Integrity.ScrubInterval),
+				QuarantineDir: yc.Cache.Integrity.QuarantineDir,
+			},
+			Freshness: FreshnessConfig{
+				HeuristicFraction: yc.Cache.Freshness.HeuristicFraction,
+				MinTTL:            parseDuration(yc.Cache.Freshness.MinTTL),
+				MaxTTL:            parseDuration(yc.Cache.Freshness.MaxTTL),
+				Hosts:             freshnessHosts,
+			},
 		},
 		Worker: WorkerConfig{
 			Workers:           yc.Worker.Workers,
@@ -246,6 +343,12 @@ func mergeConfig(defaultConfig, yamlConfig Config) Config {
 	}
 
 	// RedisClient
+	if yamlConfig.RedisClient.Backend != "" {
+		merged.RedisClient.Backend = yamlConfig.RedisClient.Backend
+	}
+	if yamlConfig.RedisClient.Path != "" {
+		merged.RedisClient.Path = yamlConfig.RedisClient.Path
+	}
 	if yamlConfig.RedisClient.Host != "" {
 		merged.RedisClient.Host = yamlConfig.RedisClient.Host
 	}
@@ -266,9 +369,21 @@ func mergeConfig(defaultConfig, yamlConfig Config) Config {
 	if yamlConfig.RedisKeys.PendingRequestsKey != "" {
 		merged.RedisKeys.PendingRequestsKey = yamlConfig.RedisKeys.PendingRequestsKey
 	}
+	if yamlConfig.RedisKeys.SubscriptionsKey != "" {
+		merged.RedisKeys.SubscriptionsKey = yamlConfig.RedisKeys.SubscriptionsKey
+	}
 	if yamlConfig.RedisKeys.CacheMetaPattern != "" {
 		merged.RedisKeys.CacheMetaPattern = yamlConfig.RedisKeys.CacheMetaPattern
 	}
+	if yamlConfig.RedisKeys.CacheAccessKey != "" {
+		merged.RedisKeys.CacheAccessKey = yamlConfig.RedisKeys.CacheAccessKey
+	}
+	if yamlConfig.RedisKeys.CacheIndexKey != "" {
+		merged.RedisKeys.CacheIndexKey = yamlConfig.RedisKeys.CacheIndexKey
+	}
+	if yamlConfig.RedisKeys.CachePinsKey != "" {
+		merged.RedisKeys.CachePinsKey = yamlConfig.RedisKeys.CachePinsKey
+	}
 	if yamlConfig.RedisKeys.ScanCount != 0 {
 		merged.RedisKeys.ScanCount = yamlConfig.RedisKeys.ScanCount
 	}
@@ -283,6 +398,57 @@ func mergeConfig(defaultConfig, yamlConfig Config) Config {
 	if yamlConfig.Cache.CleanupInterval != 0 {
 		merged.Cache.CleanupInterval = yamlConfig.Cache.CleanupInterval
 	}
+	if yamlConfig.Cache.ErrorTTL != 0 {
+		merged.Cache.ErrorTTL = yamlConfig.Cache.ErrorTTL
+	}
+	if yamlConfig.Cache.ManifestTTL != 0 {
+		merged.Cache.ManifestTTL = yamlConfig.Cache.ManifestTTL
+	}
+	if yamlConfig.Cache.MaxStale != 0 {
+		merged.Cache.MaxStale = yamlConfig.Cache.MaxStale
+	}
+	if yamlConfig.Cache.MinFreeMB != 0 {
+		merged.Cache.MinFreeMB = yamlConfig.Cache.MinFreeMB
+	}
+	if yamlConfig.Cache.StreamKB != 0 {
+		merged.Cache.StreamKB = yamlConfig.Cache.StreamKB
+	}
+	if yamlConfig.Cache.ClearOnStart {
+		merged.Cache.ClearOnStart = true
+	}
+	if yamlConfig.Cache.Eviction.MaxMB != 0 {
+		merged.Cache.Eviction.MaxMB = yamlConfig.Cache.Eviction.MaxMB
+	}
+	if yamlConfig.Cache.Eviction.Mode != "" {
+		merged.Cache.Eviction.Mode = yamlConfig.Cache.Eviction.Mode
+	}
+	if len(yamlConfig.Cache.Eviction.Pins) > 0 {
+		merged.Cache.Eviction.Pins = yamlConfig.Cache.Eviction.Pins
+	}
+	if yamlConfig.Cache.Integrity.Verify != "" {
+		merged.Cache.Integrity.Verify = yamlConfig.Cache.Integrity.Verify
+	}
+	if yamlConfig.Cache.Integrity.SampleRate != 0 {
+		merged.Cache.Integrity.SampleRate = yamlConfig.Cache.Integrity.SampleRate
+	}
+	if yamlConfig.Cache.Integrity.ScrubInterval != 0 {
+		merged.Cache.Integrity.ScrubInterval = yamlConfig.Cache.Integrity.ScrubInterval
+	}
+	if yamlConfig.Cache.Integrity.QuarantineDir != "" {
+		merged.Cache.Integrity.QuarantineDir = yamlConfig.Cache.Integrity.QuarantineDir
+	}
+	if yamlConfig.Cache.Freshness.HeuristicFraction != 0 {
+		merged.Cache.Freshness.HeuristicFraction = yamlConfig.Cache.Freshness.HeuristicFraction
+	}
+	if yamlConfig.Cache.Freshness.MinTTL != 0 {
+		merged.Cache.Freshness.MinTTL = yamlConfig.Cache.Freshness.MinTTL
+	}
+	if yamlConfig.Cache.Freshness.MaxTTL != 0 {
+		merged.Cache.Freshness.MaxTTL = yamlConfig.Cache.Freshness.MaxTTL
+	}
+	if len(yamlConfig.Cache.Freshness.Hosts) > 0 {
+		merged.Cache.Freshness.Hosts = yamlConfig.Cache.Freshness.Hosts
+	}
 
 	// Worker
 	if yamlConfig.Worker.Workers != 0 {
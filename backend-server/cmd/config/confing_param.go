@@ -19,7 +19,16 @@ type BpSocketConfig struct {
 	RemoteServiceNum uint64 `yaml:"remote_service_num"`
 }
 
+// Redisのバックエンド
+const (
+	RedisBackend    = "redis"    // Redisサーバーを使用
+	EmbeddedBackend = "embedded" // プロセス内に保持してファイルに永続化する（Redisサーバーが不要）
+)
+
 type Redis struct {
+	Backend string `yaml:"backend"` // "redis" または "embedded"
+	Path    string `yaml:"path"`    // embeddedの場合に状態を保存するファイル
+
 	// Redisサーバーの接続情報
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
@@ -31,14 +40,57 @@ type RedisKeys struct {
 	// Redis内で使用するキーのパターン
 	ReservedRequestsKey string `yaml:"reserved_requests_key"`
 	PendingRequestsKey  string `yaml:"pending_requests_key"`
+	SubscriptionsKey    string `yaml:"subscriptions_key"`
 	CacheMetaPattern    string `yaml:"cache_meta_pattern"`
-	ScanCount           int    `yaml:"scan_count"` // Redis SCANコマンドのCOUNTパラメータ
+	CacheAccessKey      string `yaml:"cache_access_key"` // キャッシュのアクセス状況（最後にアクセスした時刻と回数）
+	CacheIndexKey       string `yaml:"cache_index_key"`  // ホストごとのキャッシュのインデックス（管理APIでSCANせずに一覧するため）
+	CachePinsKey        string `yaml:"cache_pins_key"`   // 管理APIで固定したURL・ホスト（容量を超えても削除しない）
+	ScanCount           int    `yaml:"scan_count"`       // Redis SCANコマンドのCOUNTパラメータ
 }
 
 type CacheConfig struct {
-	Dir             string        `yaml:"dir"`              // キャッシュファイルを保存するディレクトリ
-	DefaultTTL      time.Duration `yaml:"default_ttl"`      // デフォルトのキャッシュTTL
-	CleanupInterval time.Duration `yaml:"cleanup_interval"` // キャッシュクリーンアップの実行間隔
+	Dir             string          `yaml:"dir"`              // キャッシュファイルを保存するディレクトリ
+	DefaultTTL      time.Duration   `yaml:"default_ttl"`      // 鮮度の情報（Cache-Control・Expires・Last-Modified）が無いレスポンスのTTL
+	CleanupInterval time.Duration   `yaml:"cleanup_interval"` // キャッシュクリーンアップの実行間隔
+	ErrorTTL        time.Duration   `yaml:"error_ttl"`        // Earth側で取得に失敗した理由を保持する時間（この間は再取得しない）
+	ManifestTTL     time.Duration   `yaml:"manifest_ttl"`     // ページのマニフェストを保持する時間
+	Freshness       FreshnessConfig `yaml:"freshness"`        // レスポンスのヘッダーからTTLを決める方法
+	MaxStale        time.Duration   `yaml:"max_stale"`        // 期限切れのエントリを返し続ける猶予期間（この間にバックグラウンドで再取得する）
+	MinFreeMB       int64           `yaml:"min_free_mb"`      // ディスクの空き容量がこれを下回ったら猶予期間内の期限切れのエントリを削除する（0は無効）
+	StreamKB        int64           `yaml:"stream_kb"`        // ボディがこれ以上の大きさのキャッシュは、メモリに読み込まずにファイルから返す
+	Eviction        EvictionConfig  `yaml:"eviction"`         // キャッシュの容量の上限と削除するエントリの選び方
+	Integrity       IntegrityConfig `yaml:"integrity"`        // キャッシュのファイルが保存したものと同じか確認する方法
+	ClearOnStart    bool            `yaml:"clear_on_start"`   // 起動時にすべてのキャッシュを削除する（通常は期限切れのエントリだけを削除する）
+}
+
+// IntegrityConfig キャッシュのファイルの大きさとハッシュの確認の設定
+type IntegrityConfig struct {
+	Verify        string        `yaml:"verify"`         // キャッシュから返す際の確認の方法（"always", "sample", "size"）
+	SampleRate    float64       `yaml:"sample_rate"`    // "sample"の場合に、ハッシュを確認する読み込みの割合（0〜1）
+	ScrubInterval time.Duration `yaml:"scrub_interval"` // すべてのエントリを確認する間隔
+	QuarantineDir string        `yaml:"quarantine_dir"` // 一致しなかったファイルを移すディレクトリ
+}
+
+// EvictionConfig キャッシュの容量の上限を超えた場合の削除の設定
+type EvictionConfig struct {
+	MaxMB int64    `yaml:"max_mb"` // キャッシュのファイルの合計サイズの上限（0は上限なし）
+	Mode  string   `yaml:"mode"`   // "lru" または "lfu"
+	Pins  []string `yaml:"pins"`   // 削除しないURL（スキームを含むもの）またはホスト（".example.com" でサブドメインも対象）
+}
+
+// FreshnessConfig レスポンスのTTLをRFC 9111に従って決める際の設定
+type FreshnessConfig struct {
+	HeuristicFraction float64               `yaml:"heuristic_fraction"` // Last-Modifiedからの経過時間のうち、新しいとみなす割合
+	MinTTL            time.Duration         `yaml:"min_ttl"`            // TTLの下限（0は下限なし）
+	MaxTTL            time.Duration         `yaml:"max_ttl"`            // TTLの上限（0は上限なし）
+	Hosts             []FreshnessHostConfig `yaml:"hosts"`              // ホストごとの上書き
+}
+
+type FreshnessHostConfig struct {
+	Match      string        `yaml:"match"`       // 対象のホスト（".example.com" でサブドメインも対象）
+	MinTTL     time.Duration `yaml:"min_ttl"`     // TTLの下限
+	MaxTTL     time.Duration `yaml:"max_ttl"`     // TTLの上限
+	ForceStore bool          `yaml:"force_store"` // no-store・privateのレスポンスも保存する
 }
 
 type WorkerConfig struct {
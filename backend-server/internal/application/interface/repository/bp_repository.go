@@ -11,9 +11,17 @@ import (
 type BpRepository interface {
 	// GetResponse キャッシュからレスポンスを取得する
 	// ctx: コンテキスト（リクエストのキャンセレーションやタイムアウト制御に使用）
-	// key: キャッシュキー（通常はURLのPath）
+	// req: リクエスト（保存されているレスポンスのVaryに従って、ヘッダーが一致するバリアントを選ぶ）
 	// 戻り値: キャッシュされたレスポンスと、キャッシュが存在するかどうか
-	GetResponse(ctx context.Context, key string) (*model.BpResponse, bool, error)
+	// 大きなボディはBodyStreamとしてファイルから読み込むため、返し終わったらレスポンスのCloseを呼ぶ
+	GetResponse(ctx context.Context, req *model.BpRequest) (*model.BpResponse, bool, error)
+
+	// GetResponseHeaders キャッシュからボディを読み込まずにステータスとヘッダーを取得する
+	// 戻り値: ボディの無いレスポンス（ContentLengthは保存したボディの大きさ）と、キャッシュが存在するかどうか
+	GetResponseHeaders(ctx context.Context, req *model.BpRequest) (*model.BpResponse, bool, error)
+
+	// HasResponse 有効なキャッシュが存在するか確認する（ボディは読み込まない）
+	HasResponse(ctx context.Context, req *model.BpRequest) (bool, error)
 
 	// SetResponseWithURL キャッシュにレスポンスを保存する
 	// ctx: コンテキスト（リクエストのキャンセレーションやタイムアウト制御に使用）
@@ -22,10 +30,71 @@ type BpRepository interface {
 	// ttl: キャッシュの有効期限
 	SetResponseWithURL(ctx context.Context, req *model.BpRequest, response *model.BpResponse, ttl time.Duration) error
 
+	// SetResponses 複数のレスポンスをまとめてキャッシュに保存する（ページアーカイブやリダイレクトの経路）
+	// すべてのレスポンスが保存されるか、1つも保存されないかのどちらかになる
+	// entries: 保存するリクエストとレスポンスとTTLの組（同じファイルに保存される場合は後のものが優先される）
+	SetResponses(ctx context.Context, entries []model.CacheEntry) error
+
+	// SetFetchError Earth側で取得に失敗した理由を一定時間保存する
+	// 同じURLへのリクエストには、再取得せずにこのエラーを返す
+	SetFetchError(ctx context.Context, fetchErr *model.EarthError, ttl time.Duration) error
+
+	// GetFetchError URLに対して保存されている取得失敗の理由を取得する
+	// 戻り値: 取得失敗の理由と、保存されているかどうか
+	GetFetchError(ctx context.Context, url string) (*model.EarthError, bool, error)
+
 	DeleteExpiredCaches(ctx context.Context) error
 
+	// EvictCaches キャッシュの合計サイズが上限を超えている場合に、上限に収まるまでエントリを削除する
+	EvictCaches(ctx context.Context) error
+
 	DeleteAllCaches(ctx context.Context) error
 
+	// ListCacheEntries 条件に一致するキャッシュのエントリのメタデータをURL順に取得する
+	// filter: 絞り込む条件（nilの場合はすべて）
+	ListCacheEntries(ctx context.Context, filter *model.CacheFilter) ([]*model.CacheMetadata, error)
+
+	// ReadCacheBody エントリのボディを読み込む
+	ReadCacheBody(ctx context.Context, metadata *model.CacheMetadata) ([]byte, error)
+
+	// ListCacheInventory 条件に一致するエントリをURL順に、offsetからlimit件まで取得する（limitが0の場合はすべて）
+	// 戻り値: 条件に一致するエントリの総数を含む一覧
+	ListCacheInventory(ctx context.Context, filter *model.CacheFilter, offset, limit int) (*model.CacheInventoryPage, error)
+
+	// GetCacheHostStats ホストごとのエントリ数・合計サイズなどをホスト名順に取得する
+	GetCacheHostStats(ctx context.Context) ([]*model.CacheHostStats, error)
+
+	// GetCacheEntry IDで指定したエントリを、ヘッダーなどの詳細を含めて取得する
+	// 戻り値: エントリと、存在するかどうか
+	GetCacheEntry(ctx context.Context, id string) (*model.CacheInventoryEntry, bool, error)
+
+	// DeleteCacheEntries 条件に一致するエントリを削除する
+	// 戻り値: 削除したエントリの数
+	DeleteCacheEntries(ctx context.Context, filter *model.CacheFilter) (int, error)
+
+	// PinCache URLまたはホストを、容量を超えても削除しない対象に加える
+	PinCache(ctx context.Context, pin string) error
+
+	// UnpinCache 固定したURLまたはホストを外す
+	UnpinCache(ctx context.Context, pin string) error
+
+	// ListPins 管理APIで固定したURL・ホストを取得する（設定ファイルで固定したものは含まない）
+	ListPins(ctx context.Context) ([]string, error)
+
+	// RebuildCacheIndex すべてのメタデータからホストごとのインデックスを作り直す
+	// 戻り値: 登録したエントリの数
+	RebuildCacheIndex(ctx context.Context) (int, error)
+
+	// ScrubCaches すべてのエントリのファイルの大きさとハッシュを確認し、保存したものと一致しないエントリを隔離する
+	// hashBodies: falseの場合はファイルを読み込まずに大きさだけを確認する（起動時など）
+	ScrubCaches(ctx context.Context, hashBodies bool) (*model.ScrubResult, error)
+
+	// ListQuarantine 隔離したエントリを取得する
+	ListQuarantine(ctx context.Context) ([]*model.QuarantinedEntry, error)
+
+	// DeleteQuarantined 隔離したエントリの情報とファイルを削除する
+	DeleteQuarantined(ctx context.Context, id string) error
+
 	// ReserveRequest 非同期処理（Worker Pool）で処理するためにリクエストを予約する
 	// Redisキューに追加して、RequestProcessorが非同期で処理する
 	// req: 予約するリクエスト
@@ -50,4 +119,27 @@ type BpRepository interface {
 
 	// RemovePendingRequest 処理中のリクエストマークを削除する
 	RemovePendingRequest(ctx context.Context, url string) error
+
+	// SaveSubscription 購読を保存する（同じURLの購読は上書きされる）
+	SaveSubscription(ctx context.Context, sub *model.Subscription) error
+
+	// GetSubscription URLで購読を取得する
+	// 戻り値: 購読と、購読が存在するかどうか
+	GetSubscription(ctx context.Context, url string) (*model.Subscription, bool, error)
+
+	// ListSubscriptions すべての購読をURL順に取得する
+	ListSubscriptions(ctx context.Context) ([]*model.Subscription, error)
+
+	// ActivateSubscription Earth側で登録された購読をactiveにする（購読が存在しない場合は何もしない）
+	ActivateSubscription(ctx context.Context, url string) error
+
+	// DeleteSubscription 購読を削除する
+	DeleteSubscription(ctx context.Context, url string) error
+
+	// SaveManifest ページのマニフェストの取得状況を一定時間保存する（同じURLのものは上書きされる）
+	SaveManifest(ctx context.Context, rec *model.ManifestRecord, ttl time.Duration) error
+
+	// GetManifest URLに対して保存されているマニフェストの取得状況を取得する
+	// 戻り値: 取得状況と、保存されているかどうか
+	GetManifest(ctx context.Context, url string) (*model.ManifestRecord, bool, error)
 }
@@ -23,8 +23,15 @@ type CacheHandler interface {
 	// DeleteExpiredCaches 期限切れのキャッシュを削除する
 	DeleteExpiredCaches(ctx context.Context) error
 
+	// EvictCaches 容量の上限を超えている場合にキャッシュを削除する
+	EvictCaches(ctx context.Context) error
+
 	// DeleteAllCaches すべてのキャッシュを削除する
 	DeleteAllCaches(ctx context.Context) error
+
+	// ScrubCaches すべてのキャッシュのファイルを確認し、保存したものと一致しないものを隔離する
+	// hashBodies: falseの場合はファイルを読み込まずに大きさだけを確認する
+	ScrubCaches(ctx context.Context, hashBodies bool) error
 }
 
 // ResponseWatcher Unsolicited Responseを監視するワーカー
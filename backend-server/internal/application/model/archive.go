@@ -0,0 +1,102 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ArchiveHeader Earth側がページアーカイブを送信したことを示すヘッダー（値はパート数）
+const ArchiveHeader = "X-Earth-Archive"
+
+// アーカイブの各パートに付与されるヘッダー
+const (
+	archivePartURLHeader    = "Content-Location"
+	archivePartStatusHeader = "X-Status-Code"
+)
+
+// ArchivePart アーカイブに含まれる1つのリソース
+type ArchivePart struct {
+	// URL リソースのURL
+	URL string
+
+	// Response リソースのレスポンス
+	Response *BpResponse
+}
+
+// IsArchive レスポンスがページアーカイブ（multipart/mixed）かどうかを判定する
+func (br *BpResponse) IsArchive() bool {
+	if http.Header(br.Headers).Get(ArchiveHeader) == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(br.ContentType)
+	return err == nil && mediaType == "multipart/mixed"
+}
+
+// ParseArchive ページアーカイブを各リソースのレスポンスに分解する（domain層のロジック）
+// 先頭のパートがページ本体になる。1つでも不正なパートがあればエラーを返す
+func (br *BpResponse) ParseArchive() ([]ArchivePart, error) {
+	_, params, err := mime.ParseMediaType(br.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive content type: %w", err)
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("archive boundary is missing")
+	}
+
+	var parts []ArchivePart
+	mr := multipart.NewReader(bytes.NewReader(br.Body), boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive part %d: %w", len(parts), err)
+		}
+
+		url := p.Header.Get(archivePartURLHeader)
+		if !strings.HasPrefix(url, "http") {
+			return nil, fmt.Errorf("archive part %d has invalid URL %q", len(parts), url)
+		}
+		statusCode, err := strconv.Atoi(p.Header.Get(archivePartStatusHeader))
+		if err != nil {
+			return nil, fmt.Errorf("archive part %d (%s) has invalid status: %w", len(parts), url, err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive part %d (%s): %w", len(parts), url, err)
+		}
+
+		headers := make(map[string][]string, len(p.Header))
+		for name, values := range p.Header {
+			if name == archivePartURLHeader || name == archivePartStatusHeader {
+				continue
+			}
+			headers[name] = values
+		}
+		headers[OriginalURLHeader] = []string{url}
+
+		parts = append(parts, ArchivePart{
+			URL: url,
+			Response: &BpResponse{
+				StatusCode:    statusCode,
+				Headers:       headers,
+				Body:          body,
+				ContentType:   p.Header.Get("Content-Type"),
+				ContentLength: int64(len(body)),
+			},
+		})
+	}
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("archive has no parts")
+	}
+	return parts, nil
+}
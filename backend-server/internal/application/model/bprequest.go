@@ -7,7 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"sort"
+	"path/filepath"
 	"strings"
 )
 
@@ -137,45 +137,50 @@ func (br *BpRequest) IsUserSpecific() bool {
 	return false
 }
 
-// GenerateCacheKey リクエストからキャッシュキーを生成する
-// メソッド、URL、重要なヘッダーから一意のキーを生成
-// ユーザー固有のコンテンツの場合は、認証情報もキーに含める
+// GenerateCacheKey リクエストからキャッシュの主キーを生成する
+// メソッドとURLだけから生成し、リクエストのヘッダーは含めない
+// ヘッダーによって内容が変わるレスポンスは、レスポンスのVaryに従ってVariantCacheKeyで区別する
 func (br *BpRequest) GenerateCacheKey() string {
 	// 基本的なキー: メソッド + URL
 	baseKey := fmt.Sprintf("%s:%s", br.Method, br.URL)
 
-	// 重要なヘッダーをソートして追加
-	var headerParts []string
-
-	// Authorizationヘッダーがある場合は、ユーザーごとにキャッシュを分けるために含める
-	// Cookieにsession/auth/tokenがある場合はIsCacheable()がfalseになるため、ここには到達しない
-	// if auth, ok := br.Headers["Authorization"]; ok {
-	// 	headerParts = append(headerParts, fmt.Sprintf("auth:%s", strings.Join(auth, ",")))
-	// }
-
-	// その他の重要なヘッダー
-	importantHeaders := []string{"Accept", "Accept-Language"}
-	for _, headerName := range importantHeaders {
-		if values, ok := br.Headers[headerName]; ok {
-			headerParts = append(headerParts, fmt.Sprintf("%s:%s", headerName, strings.Join(values, ",")))
-		}
-	}
-
-	// ヘッダー部分を追加
-	if len(headerParts) > 0 {
-		sort.Strings(headerParts)
-		baseKey += ":" + strings.Join(headerParts, "|")
-	}
-
 	// SHA256ハッシュでキーを短縮（Redisのキー長制限対策）
 	hash := sha256.Sum256([]byte(baseKey))
 	return "bp:cache:" + hex.EncodeToString(hash[:])
 }
 
 // GenerateCachePathInfo レスポンスのContentTypeからキャッシュパス情報を生成する（domain層のロジック）
-func (br *BpRequest) GenerateCachePathInfo(responseContentType string) (*CachePathInfo, error) {
-	cacheKey := br.GenerateCacheKey()
-	return GenerateCachePathInfo(br.URL, responseContentType, cacheKey)
+// vary: レスポンスのVary（空でない場合は、バリアントごとに別のファイルに保存する）
+// ファイル名にはクエリ文字列が含まれないため、クエリ文字列のあるURLもキャッシュキーのハッシュで別のファイルにする
+func (br *BpRequest) GenerateCachePathInfo(responseContentType string, vary []string) (*CachePathInfo, error) {
+	cacheKey := br.VariantCacheKey(vary)
+	info, err := GenerateCachePathInfo(br.URL, responseContentType, cacheKey)
+	if err != nil || (len(vary) == 0 && !strings.Contains(br.URL, "?")) {
+		return info, err
+	}
+	ext := filepath.Ext(info.FileName)
+	info.FileName = strings.TrimSuffix(info.FileName, ext) + "~" + generateHash(cacheKey)[:12] + ext
+	return info, nil
+}
+
+// GenerateRedirectPathInfo リダイレクトのレスポンスを保存するキャッシュパス情報を生成する
+// http→httpsや末尾のスラッシュのリダイレクトはリダイレクト先のページと同じパスになるため、
+// ファイル名をキャッシュキーのハッシュにしてページのファイルと重ならないようにする
+func (br *BpRequest) GenerateRedirectPathInfo(vary []string) (*CachePathInfo, error) {
+	cacheKey := br.VariantCacheKey(vary)
+	info, err := GenerateCachePathInfo(br.URL, "", cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	info.FileName = generateHash(cacheKey) + ".redirect"
+	return info, nil
+}
+
+// WithURL URLだけを置き換えたリクエストを返す（リダイレクト先などを同じヘッダーのキーで保存するため）
+func (br *BpRequest) WithURL(url string) *BpRequest {
+	req := *br
+	req.URL = url
+	return &req
 }
 
 // bodyReader バイト配列をio.Readerとして扱うためのヘルパー
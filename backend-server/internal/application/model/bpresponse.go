@@ -1,6 +1,12 @@
 package model
 
-import "io"
+import (
+	"io"
+	"net/http"
+)
+
+// OriginalURLHeader Earth側がレスポンスの取得元URLを示すヘッダー
+const OriginalURLHeader = "X-Original-URL"
 
 // BpResponse HTTPレスポンスに必要な情報を格納する構造体
 type BpResponse struct {
@@ -18,12 +24,46 @@ type BpResponse struct {
 
 	// ContentLength Content-Lengthヘッダーの値
 	ContentLength int64 `json:"content_length,omitempty"`
+
+	// Stale キャッシュの有効期限を過ぎたレスポンスか（キャッシュから返す場合のみ）
+	Stale bool `json:"-"`
+
+	// BodyStream Bodyの代わりにファイルから読み込んで返すボディ（大きなキャッシュの場合のみ）
+	// 受け取った側は返し終わったらCloseを呼ぶ
+	BodyStream io.ReadCloser `json:"-"`
 }
 
 // GetBodyReader レスポンスボディをio.Readerとして返す
+// BodyStreamがある場合はそれを返す（ファイルのままio.Copyに渡し、sendfileを使えるようにする）
 func (br *BpResponse) GetBodyReader() io.Reader {
+	if br.BodyStream != nil {
+		if s, ok := br.BodyStream.(*streamBody); ok {
+			return s.Reader
+		}
+		return br.BodyStream
+	}
 	if len(br.Body) == 0 {
 		return nil
 	}
 	return &bodyReader{data: br.Body}
 }
+
+// OriginalURL Earth側が付与した取得元URLを返す（ヘッダー名の大文字・小文字は区別しない）
+func (br *BpResponse) OriginalURL() string {
+	return http.Header(br.Headers).Get(OriginalURLHeader)
+}
+
+// Close ファイルから読み込むボディを閉じる（BodyStreamが無い場合は何もしない）
+func (br *BpResponse) Close() error {
+	if br.BodyStream == nil {
+		return nil
+	}
+	return br.BodyStream.Close()
+}
+
+// streamBody ファイルの一部（Rangeの範囲やmultipart/byteranges）を読み込むボディ
+// Closeで元のファイルを閉じる
+type streamBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CacheFilter キャッシュのエントリを絞り込む条件（エクスポートや管理APIでの一覧・削除・再取得用）
+// ゼロ値の条件は使わない（すべてゼロ値の場合はすべてのエントリが一致する）
+type CacheFilter struct {
+	// URL 対象のURL（完全一致、Varyによるバリアントはすべて対象）
+	URL string
+
+	// Host 対象のホスト（".example.com" の形式でサブドメインも対象、空の場合はすべて）
+	Host string
+
+	// Prefix 対象のURLの前方一致（"https://example.com/docs/" のようにスキームから指定する）
+	Prefix string
+
+	// ContentType Content-Typeの前方一致（"image/" など）
+	ContentType string
+
+	// Since この時刻以降に保存されたエントリ（ゼロ値の場合は制限なし）
+	Since time.Time
+
+	// Until この時刻より前に保存されたエントリ（ゼロ値の場合は制限なし）
+	Until time.Time
+
+	// MinSize・MaxSize ボディの大きさの範囲（バイト、0の場合は制限なし）
+	MinSize int64
+	MaxSize int64
+}
+
+// Match エントリが条件に一致するか判定する（URLを記録していないエントリは一致しない）
+func (f *CacheFilter) Match(meta *CacheMetadata) bool {
+	if !f.MatchURL(meta.URL) {
+		return false
+	}
+	if !f.Since.IsZero() && meta.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !meta.CreatedAt.Before(f.Until) {
+		return false
+	}
+	if f.ContentType != "" && !strings.HasPrefix(strings.ToLower(meta.ContentType), strings.ToLower(f.ContentType)) {
+		return false
+	}
+	size := meta.BodySize()
+	if f.MinSize > 0 && size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && size > f.MaxSize {
+		return false
+	}
+	return true
+}
+
+// MatchURL URLだけで判定できる条件（URL・ホスト・前方一致）に一致するか判定する
+// メタデータを読み込む前にインデックスのURLで絞り込むために使う
+func (f *CacheFilter) MatchURL(rawURL string) bool {
+	if rawURL == "" {
+		return false
+	}
+	if f.URL != "" && rawURL != f.URL {
+		return false
+	}
+	if f.Prefix != "" && !strings.HasPrefix(rawURL, f.Prefix) {
+		return false
+	}
+	if f.Host == "" {
+		return true
+	}
+	return f.MatchHost(CacheHost(rawURL))
+}
+
+// MatchHost ホストが条件に一致するか判定する（ホストの条件が無い場合は常に一致する）
+// URLや前方一致が指定されている場合は、それらのホストとも比べる
+func (f *CacheFilter) MatchHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	if f.Host != "" && !matchHost(host, f.Host) {
+		return false
+	}
+	for _, u := range []string{f.URL, f.Prefix} {
+		if h := CacheHost(u); h != "" && h != host {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEmpty 条件が1つも指定されていないか（すべてのエントリが一致する）
+func (f *CacheFilter) IsEmpty() bool {
+	return *f == CacheFilter{}
+}
+
+// CacheHost キャッシュのインデックスや統計で使うURLのホスト（小文字、ポートを除く）を返す
+// URLとして解釈できない、またはホストを含まない場合は空文字列を返す
+func CacheHost(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// NewCacheFilter 文字列で指定された条件からCacheFilterを作成する
+// since・until: RFC 3339の時刻または "2006-01-02" 形式の日付（空の場合は制限なし）
+func NewCacheFilter(host, since, until string) (*CacheFilter, error) {
+	f := &CacheFilter{Host: host}
+	var err error
+	if f.Since, err = parseFilterTime(since); err != nil {
+		return nil, err
+	}
+	if f.Until, err = parseFilterTime(until); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseFilterTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339 or YYYY-MM-DD)", s)
+	}
+	return t, nil
+}
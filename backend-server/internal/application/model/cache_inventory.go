@@ -0,0 +1,119 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CacheInventoryEntry 管理APIで返すキャッシュのエントリの情報
+type CacheInventoryEntry struct {
+	// ID エントリを指定するためのID（キャッシュキーのハッシュ）
+	ID string `json:"id"`
+
+	URL         string    `json:"url"`
+	Host        string    `json:"host"`
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"`
+	Vary        []string  `json:"vary,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	StaleUntil  time.Time `json:"stale_until,omitempty"`
+
+	// Expired 有効期限を過ぎているか（猶予期間内は期限切れとして返される）
+	Expired bool `json:"expired"`
+
+	// Hits・LastAccess キャッシュから返した回数と最後に返した時刻
+	Hits       int64      `json:"hits"`
+	LastAccess *time.Time `json:"last_access,omitempty"`
+
+	// Pinned 容量を超えても削除しないURL・ホストに含まれるか
+	Pinned bool `json:"pinned"`
+
+	// 以下は1つのエントリを取得した場合だけ設定する
+	FilePath       string              `json:"file_path,omitempty"`
+	SHA256         string              `json:"sha256,omitempty"`
+	Headers        map[string][]string `json:"headers,omitempty"`
+	RequestHeaders map[string][]string `json:"request_headers,omitempty"`
+}
+
+// NewCacheInventoryEntry メタデータとアクセス状況から一覧用のエントリの情報を作成する
+func NewCacheInventoryEntry(id string, meta *CacheMetadata, access CacheAccess, pinned bool) *CacheInventoryEntry {
+	entry := &CacheInventoryEntry{
+		ID:          id,
+		URL:         meta.URL,
+		Host:        CacheHost(meta.URL),
+		StatusCode:  meta.StatusCode,
+		ContentType: meta.ContentType,
+		Size:        meta.BodySize(),
+		Vary:        meta.Vary,
+		CreatedAt:   meta.CreatedAt,
+		ExpiresAt:   meta.ExpiresAt,
+		StaleUntil:  meta.StaleUntil,
+		Expired:     meta.IsExpired(),
+		Hits:        access.Hits,
+		Pinned:      pinned,
+	}
+	if !access.LastAccess.IsZero() {
+		lastAccess := access.LastAccess
+		entry.LastAccess = &lastAccess
+	}
+	return entry
+}
+
+// CacheInventoryPage 管理APIで返すエントリの一覧（ページ単位）
+type CacheInventoryPage struct {
+	// Total 条件に一致するエントリの総数
+	Total   int                    `json:"total"`
+	Offset  int                    `json:"offset"`
+	Limit   int                    `json:"limit"`
+	Entries []*CacheInventoryEntry `json:"entries"`
+}
+
+// CacheHostStats ホストごとのキャッシュの統計
+type CacheHostStats struct {
+	Host    string `json:"host"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Expired int    `json:"expired"`
+	Hits    int64  `json:"hits"`
+
+	// Oldest・Newest 最も古い・新しいエントリを保存した時刻
+	Oldest time.Time `json:"oldest"`
+	Newest time.Time `json:"newest"`
+}
+
+// Add エントリを統計に加える
+func (s *CacheHostStats) Add(meta *CacheMetadata, access CacheAccess) {
+	s.Entries++
+	s.Bytes += meta.BodySize()
+	s.Hits += access.Hits
+	if meta.IsExpired() {
+		s.Expired++
+	}
+	if s.Oldest.IsZero() || meta.CreatedAt.Before(s.Oldest) {
+		s.Oldest = meta.CreatedAt
+	}
+	if meta.CreatedAt.After(s.Newest) {
+		s.Newest = meta.CreatedAt
+	}
+}
+
+// ValidatePin 固定するURL・ホストの形式を確認する
+// スキームを含むものはURL、それ以外はホスト（".example.com" の形式でサブドメインも対象）として扱う
+func ValidatePin(pin string) error {
+	if pin == "" {
+		return fmt.Errorf("pin is empty")
+	}
+	if strings.Contains(pin, "://") {
+		if CacheHost(pin) == "" {
+			return fmt.Errorf("invalid URL: %s", pin)
+		}
+		return nil
+	}
+	if strings.ContainsAny(pin, "/ ") {
+		return fmt.Errorf("invalid host: %s (use a URL with a scheme to pin a single page)", pin)
+	}
+	return nil
+}
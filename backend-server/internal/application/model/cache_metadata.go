@@ -1,12 +1,28 @@
 package model
 
-import "time"
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StaleWarning 期限切れのキャッシュを返す場合に付与するWarningヘッダーの値（RFC 7234 5.5.1）
+const StaleWarning = `110 - "Response is Stale"`
 
 // CacheMetadata キャッシュのメタデータ（Redisに保存）
 type CacheMetadata struct {
 	// FilePath ファイルシステム上のファイルパス
 	FilePath string `json:"file_path"`
 
+	// URL キャッシュしたリクエストのURL（容量を超えた場合に削除しないURLの判定に使用）
+	URL string `json:"url,omitempty"`
+
+	// Vary バリアントの選択に使ったリクエストのヘッダー名（レスポンスのVary）
+	Vary []string `json:"vary,omitempty"`
+
+	// RequestHeaders Varyに含まれるリクエストのヘッダーの値（エクスポートしたエントリを同じバリアントとして取り込むため）
+	RequestHeaders map[string][]string `json:"request_headers,omitempty"`
+
 	// StatusCode HTTPステータスコード
 	StatusCode int `json:"status_code"`
 
@@ -19,11 +35,32 @@ type CacheMetadata struct {
 	// ContentLength Content-Lengthヘッダーの値
 	ContentLength int64 `json:"content_length,omitempty"`
 
+	// Size 保存したボディの大きさ（Content-Lengthが無いレスポンスでも正しい値）
+	Size int64 `json:"size,omitempty"`
+
+	// SHA256 保存したボディのSHA-256（16進数。ファイルが書き込んだものと同じか確認するため）
+	SHA256 string `json:"sha256,omitempty"`
+
 	// CreatedAt キャッシュ作成時刻
 	CreatedAt time.Time `json:"created_at"`
 
 	// ExpiresAt キャッシュ有効期限
 	ExpiresAt time.Time `json:"expires_at"`
+
+	// StaleUntil 期限切れの後も返し続ける期限（これを過ぎたエントリは削除する）
+	StaleUntil time.Time `json:"stale_until,omitempty"`
+}
+
+// CacheEntry まとめて保存するリクエストとレスポンスの組
+type CacheEntry struct {
+	// Request キャッシュのキーを生成するためのリクエスト
+	Request *BpRequest
+
+	// Response 保存するレスポンス
+	Response *BpResponse
+
+	// TTL キャッシュの有効期限（レスポンスごとにFreshnessPolicyで決める）
+	TTL time.Duration
 }
 
 // IsExpired キャッシュが有効期限切れかどうかを判定する（domain層のロジック）
@@ -31,3 +68,35 @@ type CacheMetadata struct {
 func (cm *CacheMetadata) IsExpired() bool {
 	return time.Now().After(cm.ExpiresAt)
 }
+
+// CanServeStale 期限切れでも猶予期間内で、まだ返してよいかを判定する
+func (cm *CacheMetadata) CanServeStale() bool {
+	return time.Now().Before(cm.StaleUntil)
+}
+
+// BodySize 保存したボディの大きさを返す（Sizeを記録する前に保存したエントリはContent-Lengthを使う）
+func (cm *CacheMetadata) BodySize() int64 {
+	if cm.Size > 0 || cm.ContentLength < 0 {
+		return cm.Size
+	}
+	return cm.ContentLength
+}
+
+// ResponseHeaders キャッシュから返すレスポンスのヘッダーを生成する
+// 保存してからの経過時間をAgeに加え、期限切れの場合はWarningを付与する
+func (cm *CacheMetadata) ResponseHeaders() map[string][]string {
+	header := http.Header(cm.Headers).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	age, err := strconv.ParseInt(header.Get("Age"), 10, 64)
+	if err != nil || age < 0 {
+		age = 0
+	}
+	age += int64(time.Since(cm.CreatedAt).Seconds())
+	header.Set("Age", strconv.FormatInt(age, 10))
+	if cm.IsExpired() {
+		header.Add("Warning", StaleWarning)
+	}
+	return header
+}
@@ -0,0 +1,315 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// errInvalidRange Rangeヘッダーの形式が正しくない（ヘッダーを無視して全体を返す）
+var errInvalidRange = errors.New("invalid range")
+
+// errNoOverlap Rangeヘッダーのどの範囲もボディに含まれない（416を返す）
+var errNoOverlap = errors.New("range not satisfiable")
+
+// notModifiedHeaders 304で返すヘッダー（RFC 9110 15.4.5で200の場合と同じ値を送るもの、とキャッシュの状態）
+var notModifiedHeaders = []string{
+	"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Vary", "Last-Modified", "Age", "Warning",
+}
+
+// seekableBody Rangeに答えるため、位置を指定して読み込めるボディ（*os.File）
+type seekableBody interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// ByteRange ボディのうちRangeヘッダーで指定された範囲
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange Content-Rangeヘッダーの値を返す
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// AsGet 同じURL・ヘッダーのGETリクエストを返す（HEADをGETのキャッシュで答えるため）
+func (br *BpRequest) AsGet() *BpRequest {
+	get := *br
+	get.Method = http.MethodGet
+	get.Body = nil
+	get.ContentLength = 0
+	return &get
+}
+
+// IsConditional 条件付きリクエスト（If-None-MatchまたはIf-Modified-Since）か判定する
+func (br *BpRequest) IsConditional() bool {
+	header := http.Header(br.Headers)
+	return header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != ""
+}
+
+// NotModified キャッシュしたレスポンスのETag・Last-Modifiedと条件を比べ、ブラウザの持っている内容が最新か判定する
+// If-None-Matchがある場合はIf-Modified-Sinceを使わない（RFC 9110 13.2.2）
+func (br *BpRequest) NotModified(resp *BpResponse) bool {
+	if resp.StatusCode != http.StatusOK || (br.Method != http.MethodGet && br.Method != http.MethodHead) {
+		return false
+	}
+	reqHeader := http.Header(br.Headers)
+	respHeader := http.Header(resp.Headers)
+
+	if inm := reqHeader.Get("If-None-Match"); inm != "" {
+		etag := respHeader.Get("ETag")
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || (etag != "" && weakMatch(tag, etag)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(reqHeader.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(respHeader.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ims)
+}
+
+// CachedResponse キャッシュから返すレスポンスを、リクエストのメソッドと条件に合わせて作る
+// 更新されていない場合は304、Rangeヘッダーがある場合は206（範囲がボディに含まれない場合は416）、HEADの場合はボディの無いレスポンスを返す
+// resp: キャッシュしたレスポンス（HEADの場合や304を返す場合はボディを読み込んでいなくてよい）
+// respのBodyStreamは返したレスポンスに引き継ぐ（ボディを返さない場合は閉じる）
+func (br *BpRequest) CachedResponse(resp *BpResponse) *BpResponse {
+	header := http.Header(resp.Headers).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if resp.StatusCode == http.StatusOK {
+		header.Set("Accept-Ranges", "bytes")
+	}
+
+	if br.NotModified(resp) {
+		notModified := make(http.Header)
+		for _, name := range notModifiedHeaders {
+			if values := header.Values(name); values != nil {
+				notModified[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+		resp.Close()
+		return &BpResponse{StatusCode: http.StatusNotModified, Headers: notModified, Stale: resp.Stale}
+	}
+
+	size := resp.ContentLength
+	if br.Method == http.MethodHead {
+		resp.Close()
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+		return &BpResponse{
+			StatusCode:    resp.StatusCode,
+			Headers:       header,
+			ContentType:   resp.ContentType,
+			ContentLength: size,
+			Stale:         resp.Stale,
+		}
+	}
+
+	// ファイルから読み込む場合はContentLengthがファイルの大きさ
+	body, rangeable := resp.BodyStream.(seekableBody)
+	if resp.BodyStream == nil {
+		size = int64(len(resp.Body))
+		body, rangeable = bytes.NewReader(resp.Body), true
+	}
+	if rangeHeader := http.Header(br.Headers).Get("Range"); rangeHeader != "" && rangeable && resp.StatusCode == http.StatusOK && br.ifRangeMatches(resp) {
+		ranges, err := parseRange(rangeHeader, size)
+		switch {
+		case errors.Is(err, errNoOverlap):
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			header.Del("Content-Type")
+			header.Set("Content-Length", "0")
+			resp.Close()
+			return &BpResponse{StatusCode: http.StatusRequestedRangeNotSatisfiable, Headers: header, Stale: resp.Stale}
+		case err == nil && len(ranges) > 0 && sumRanges(ranges) <= size:
+			return partialResponse(resp, body, header, ranges, size)
+		}
+		// 形式が正しくない、または範囲の合計がボディより大きい場合はRangeを無視して全体を返す
+	}
+
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	return &BpResponse{
+		StatusCode:    resp.StatusCode,
+		Headers:       header,
+		Body:          resp.Body,
+		BodyStream:    resp.BodyStream,
+		ContentType:   resp.ContentType,
+		ContentLength: size,
+		Stale:         resp.Stale,
+	}
+}
+
+// ifRangeMatches If-Rangeが無いか、キャッシュしたレスポンスと一致するか判定する（一致しない場合はRangeを無視する）
+// ETagは強い比較、日付はLast-Modifiedと完全に一致する場合だけ一致とする（RFC 9110 13.1.5）
+func (br *BpRequest) ifRangeMatches(resp *BpResponse) bool {
+	ifRange := http.Header(br.Headers).Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	respHeader := http.Header(resp.Headers)
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		etag := respHeader.Get("ETag")
+		return etag != "" && !strings.HasPrefix(ifRange, "W/") && !strings.HasPrefix(etag, "W/") && ifRange == etag
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(respHeader.Get("Last-Modified"))
+	return err == nil && lastModified.Equal(t)
+}
+
+// partialResponse 範囲のボディを206で返す（複数の範囲の場合はmultipart/byteranges）
+// ファイルから読み込む場合は、範囲だけを読み込むBodyStreamを返す
+func partialResponse(resp *BpResponse, body seekableBody, header http.Header, ranges []ByteRange, size int64) *BpResponse {
+	partial := &BpResponse{
+		StatusCode:  http.StatusPartialContent,
+		Headers:     header,
+		ContentType: resp.ContentType,
+		Stale:       resp.Stale,
+	}
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+		header.Set("Content-Range", r.ContentRange(size))
+		header.Set("Content-Length", strconv.FormatInt(r.Length, 10))
+		partial.ContentLength = r.Length
+		if resp.BodyStream == nil {
+			partial.Body = resp.Body[r.Start : r.Start+r.Length]
+			return partial
+		}
+		// ファイルの位置を移せる場合はio.LimitedReaderにして、sendfileを使えるようにする
+		var reader io.Reader = io.NewSectionReader(body, r.Start, r.Length)
+		if _, err := body.Seek(r.Start, io.SeekStart); err == nil {
+			reader = io.LimitReader(body, r.Length)
+		}
+		partial.BodyStream = &streamBody{Reader: reader, Closer: resp.BodyStream}
+		return partial
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = resp.ContentType
+	}
+	// 各パートのヘッダーを先に作り、範囲のボディと交互に読み込む（ボディ全体をメモリに載せない）
+	var partHeaders bytes.Buffer
+	mw := multipart.NewWriter(&partHeaders)
+	var readers []io.Reader
+	var length int64
+	for _, r := range ranges {
+		partHeader := textproto.MIMEHeader{"Content-Range": {r.ContentRange(size)}}
+		if contentType != "" {
+			partHeader.Set("Content-Type", contentType)
+		}
+		mw.CreatePart(partHeader)
+		readers = append(readers, bytes.NewReader(bytes.Clone(partHeaders.Bytes())), io.NewSectionReader(body, r.Start, r.Length))
+		length += int64(partHeaders.Len()) + r.Length
+		partHeaders.Reset()
+	}
+	mw.Close()
+	readers = append(readers, bytes.NewReader(partHeaders.Bytes()))
+	length += int64(partHeaders.Len())
+
+	multipartType := "multipart/byteranges; boundary=" + mw.Boundary()
+	header.Set("Content-Type", multipartType)
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	header.Del("Content-Range")
+	partial.ContentType = multipartType
+	partial.ContentLength = length
+	if resp.BodyStream == nil {
+		partial.Body, _ = io.ReadAll(io.MultiReader(readers...))
+		return partial
+	}
+	partial.BodyStream = &streamBody{Reader: io.MultiReader(readers...), Closer: resp.BodyStream}
+	return partial
+}
+
+// parseRange Rangeヘッダー（"bytes=0-99,200-"、"bytes=-500" など）をボディの大きさに合わせて解釈する
+// ボディに含まれない範囲は取り除き、1つも残らない場合はerrNoOverlapを返す
+func parseRange(s string, size int64) ([]ByteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, errInvalidRange
+	}
+	var ranges []ByteRange
+	noOverlap := false
+	for _, spec := range strings.Split(s[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+
+		var r ByteRange
+		if start == "" {
+			// 末尾からの長さ（"-500"）
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			n = min(n, size)
+			if n == 0 {
+				noOverlap = true
+				continue
+			}
+			r = ByteRange{Start: size - n, Length: n}
+		} else {
+			first, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || first < 0 {
+				return nil, errInvalidRange
+			}
+			if first >= size {
+				noOverlap = true
+				continue
+			}
+			last := size - 1
+			if end != "" {
+				last, err = strconv.ParseInt(end, 10, 64)
+				if err != nil || last < first {
+					return nil, errInvalidRange
+				}
+				last = min(last, size-1)
+			}
+			r = ByteRange{Start: first, Length: last - first + 1}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+func sumRanges(ranges []ByteRange) int64 {
+	var total int64
+	for _, r := range ranges {
+		total += r.Length
+	}
+	return total
+}
+
+// weakMatch ETagを弱い比較で比べる（W/を除いた値が同じなら一致）
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
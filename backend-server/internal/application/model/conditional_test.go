@@ -0,0 +1,219 @@
+package model
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBody = "abcdefghij"
+
+var testLastModified = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// cachedResponse キャッシュしたレスポンスを作る（stream: ファイルから読み込むBodyStreamにする）
+func cachedResponse(t *testing.T, header http.Header, stream bool) *BpResponse {
+	t.Helper()
+	resp := &BpResponse{
+		StatusCode:    http.StatusOK,
+		Headers:       header,
+		ContentType:   "text/plain",
+		ContentLength: int64(len(testBody)),
+	}
+	if !stream {
+		resp.Body = []byte(testBody)
+		return resp
+	}
+	path := filepath.Join(t.TempDir(), "body")
+	if err := os.WriteFile(path, []byte(testBody), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	resp.BodyStream = file
+	return resp
+}
+
+func readBody(t *testing.T, resp *BpResponse) string {
+	t.Helper()
+	reader := resp.GetBodyReader()
+	if reader == nil {
+		return ""
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	return string(data)
+}
+
+func TestCachedResponseRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		reqHeader http.Header
+		etag      string // キャッシュしたレスポンスのETag（空の場合は"v1"）
+		wantCode  int
+		wantBody  string
+		wantRange string
+	}{
+		{name: "no range", reqHeader: http.Header{}, wantCode: 200, wantBody: testBody},
+		{name: "first bytes", reqHeader: http.Header{"Range": {"bytes=0-3"}}, wantCode: 206, wantBody: "abcd", wantRange: "bytes 0-3/10"},
+		{name: "suffix", reqHeader: http.Header{"Range": {"bytes=-3"}}, wantCode: 206, wantBody: "hij", wantRange: "bytes 7-9/10"},
+		{name: "suffix longer than body", reqHeader: http.Header{"Range": {"bytes=-20"}}, wantCode: 206, wantBody: testBody, wantRange: "bytes 0-9/10"},
+		{name: "open-ended", reqHeader: http.Header{"Range": {"bytes=7-"}}, wantCode: 206, wantBody: "hij", wantRange: "bytes 7-9/10"},
+		{name: "end past EOF", reqHeader: http.Header{"Range": {"bytes=8-100"}}, wantCode: 206, wantBody: "ij", wantRange: "bytes 8-9/10"},
+		{name: "start at EOF", reqHeader: http.Header{"Range": {"bytes=10-"}}, wantCode: 416, wantRange: "bytes */10"},
+		{name: "start past EOF", reqHeader: http.Header{"Range": {"bytes=20-30"}}, wantCode: 416, wantRange: "bytes */10"},
+		{name: "empty suffix", reqHeader: http.Header{"Range": {"bytes=-0"}}, wantCode: 416, wantRange: "bytes */10"},
+		{name: "one range past EOF", reqHeader: http.Header{"Range": {"bytes=20-30, 0-1"}}, wantCode: 206, wantBody: "ab", wantRange: "bytes 0-1/10"},
+		{name: "sum of ranges larger than body", reqHeader: http.Header{"Range": {"bytes=0-9,0-9"}}, wantCode: 200, wantBody: testBody},
+		{name: "other unit", reqHeader: http.Header{"Range": {"items=0-1"}}, wantCode: 200, wantBody: testBody},
+		{name: "reversed range", reqHeader: http.Header{"Range": {"bytes=5-2"}}, wantCode: 200, wantBody: testBody},
+		{name: "If-Range strong match", reqHeader: http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"v1"`}}, wantCode: 206, wantBody: "ab", wantRange: "bytes 0-1/10"},
+		{name: "If-Range mismatch", reqHeader: http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"v2"`}}, wantCode: 200, wantBody: testBody},
+		{name: "If-Range weak", reqHeader: http.Header{"Range": {"bytes=0-1"}, "If-Range": {`W/"v1"`}}, etag: `W/"v1"`, wantCode: 200, wantBody: testBody},
+		{name: "If-Range strong against weak ETag", reqHeader: http.Header{"Range": {"bytes=0-1"}, "If-Range": {`"v1"`}}, etag: `W/"v1"`, wantCode: 200, wantBody: testBody},
+		{name: "If-Range date match", reqHeader: http.Header{"Range": {"bytes=0-1"}, "If-Range": {testLastModified.Format(http.TimeFormat)}}, wantCode: 206, wantBody: "ab", wantRange: "bytes 0-1/10"},
+		{name: "If-Range date mismatch", reqHeader: http.Header{"Range": {"bytes=0-1"}, "If-Range": {testLastModified.Add(time.Second).Format(http.TimeFormat)}}, wantCode: 200, wantBody: testBody},
+	}
+	for _, stream := range []bool{false, true} {
+		for _, tt := range tests {
+			t.Run(tt.name+"/stream="+strconv.FormatBool(stream), func(t *testing.T) {
+				etag := tt.etag
+				if etag == "" {
+					etag = `"v1"`
+				}
+				header := http.Header{"Etag": {etag}, "Last-Modified": {testLastModified.Format(http.TimeFormat)}}
+				req := &BpRequest{Method: http.MethodGet, URL: "https://example.com/", Headers: tt.reqHeader}
+
+				got := req.CachedResponse(cachedResponse(t, header, stream))
+				if got.StatusCode != tt.wantCode {
+					t.Fatalf("status = %d, want %d", got.StatusCode, tt.wantCode)
+				}
+				body := readBody(t, got)
+				if body != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+				if cr := http.Header(got.Headers).Get("Content-Range"); cr != tt.wantRange {
+					t.Errorf("Content-Range = %q, want %q", cr, tt.wantRange)
+				}
+				if cl := http.Header(got.Headers).Get("Content-Length"); cl != strconv.Itoa(len(tt.wantBody)) {
+					t.Errorf("Content-Length = %s, want %d", cl, len(tt.wantBody))
+				}
+			})
+		}
+	}
+}
+
+func TestCachedResponseMultipartLength(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		req := &BpRequest{Method: http.MethodGet, Headers: http.Header{"Range": {"bytes=0-1, 5-6, -2"}}}
+		got := req.CachedResponse(cachedResponse(t, http.Header{"Content-Type": {"text/plain"}}, stream))
+		if got.StatusCode != http.StatusPartialContent {
+			t.Fatalf("stream=%v: status = %d, want 206", stream, got.StatusCode)
+		}
+		body := readBody(t, got)
+		if got.ContentLength != int64(len(body)) {
+			t.Errorf("stream=%v: ContentLength = %d, produced %d bytes", stream, got.ContentLength, len(body))
+		}
+		if cl := http.Header(got.Headers).Get("Content-Length"); cl != strconv.Itoa(len(body)) {
+			t.Errorf("stream=%v: Content-Length = %s, produced %d bytes", stream, cl, len(body))
+		}
+
+		mediaType, params, err := mime.ParseMediaType(http.Header(got.Headers).Get("Content-Type"))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("stream=%v: Content-Type = %q, %v", stream, got.Headers["Content-Type"], err)
+		}
+		want := []struct{ body, contentRange string }{
+			{"ab", "bytes 0-1/10"},
+			{"fg", "bytes 5-6/10"},
+			{"ij", "bytes 8-9/10"},
+		}
+		mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+		for i := 0; ; i++ {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				if i != len(want) {
+					t.Errorf("stream=%v: %d parts, want %d", stream, i, len(want))
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("stream=%v: part %d: %v", stream, i, err)
+			}
+			data, _ := io.ReadAll(part)
+			if i >= len(want) || string(data) != want[i].body || part.Header.Get("Content-Range") != want[i].contentRange ||
+				part.Header.Get("Content-Type") != "text/plain" {
+				t.Errorf("stream=%v: part %d = %q %v", stream, i, data, part.Header)
+			}
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := testLastModified.Format(http.TimeFormat)
+	before := testLastModified.Add(-time.Hour).Format(http.TimeFormat)
+	after := testLastModified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name      string
+		method    string
+		status    int
+		reqHeader http.Header
+		want      bool
+	}{
+		{name: "If-None-Match", reqHeader: http.Header{"If-None-Match": {`"v1"`}}, want: true},
+		{name: "If-None-Match list", reqHeader: http.Header{"If-None-Match": {`"v0", "v1"`}}, want: true},
+		{name: "If-None-Match weak", reqHeader: http.Header{"If-None-Match": {`W/"v1"`}}, want: true},
+		{name: "If-None-Match any", reqHeader: http.Header{"If-None-Match": {"*"}}, want: true},
+		{name: "If-None-Match mismatch", reqHeader: http.Header{"If-None-Match": {`"v2"`}}, want: false},
+		{name: "If-None-Match mismatch wins over If-Modified-Since", reqHeader: http.Header{"If-None-Match": {`"v2"`}, "If-Modified-Since": {after}}, want: false},
+		{name: "If-None-Match match wins over If-Modified-Since", reqHeader: http.Header{"If-None-Match": {`"v1"`}, "If-Modified-Since": {before}}, want: true},
+		{name: "If-Modified-Since equal", reqHeader: http.Header{"If-Modified-Since": {lastModified}}, want: true},
+		{name: "If-Modified-Since later", reqHeader: http.Header{"If-Modified-Since": {after}}, want: true},
+		{name: "If-Modified-Since earlier", reqHeader: http.Header{"If-Modified-Since": {before}}, want: false},
+		{name: "If-Modified-Since invalid", reqHeader: http.Header{"If-Modified-Since": {"yesterday"}}, want: false},
+		{name: "HEAD", method: http.MethodHead, reqHeader: http.Header{"If-None-Match": {`"v1"`}}, want: true},
+		{name: "POST", method: http.MethodPost, reqHeader: http.Header{"If-None-Match": {`"v1"`}}, want: false},
+		{name: "not 200", status: http.StatusNotFound, reqHeader: http.Header{"If-None-Match": {`"v1"`}}, want: false},
+		{name: "unconditional", reqHeader: http.Header{}, want: false},
+	}
+	for _, tt := range tests {
+		method := tt.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		status := tt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		req := &BpRequest{Method: method, Headers: tt.reqHeader}
+		resp := &BpResponse{StatusCode: status, Headers: http.Header{"Etag": {`"v1"`}, "Last-Modified": {lastModified}}}
+		if got := req.NotModified(resp); got != tt.want {
+			t.Errorf("%s: NotModified() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCachedResponseNotModified(t *testing.T) {
+	req := &BpRequest{Method: http.MethodGet, Headers: http.Header{"If-None-Match": {`"v1"`}, "Range": {"bytes=0-1"}}}
+	header := http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=60"}, "Content-Type": {"text/plain"}}
+	got := req.CachedResponse(cachedResponse(t, header, true))
+	if got.StatusCode != http.StatusNotModified || got.BodyStream != nil || len(got.Body) != 0 {
+		t.Fatalf("CachedResponse() = %d with body", got.StatusCode)
+	}
+	want := http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=60"}}
+	if len(got.Headers) != len(want) || http.Header(got.Headers).Get("ETag") != `"v1"` || http.Header(got.Headers).Get("Cache-Control") != "max-age=60" {
+		t.Errorf("304 headers = %v, want %v", got.Headers, want)
+	}
+}
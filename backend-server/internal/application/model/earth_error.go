@@ -0,0 +1,114 @@
+package model
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Earth側のエラーレスポンスに付与されるヘッダー
+const (
+	EarthErrorHeader        = "X-Earth-Error"
+	EarthErrorMessageHeader = "X-Earth-Error-Message"
+)
+
+// Earth側で取得に失敗した理由の分類
+const (
+	EarthErrorDNS      = "dns"
+	EarthErrorConnect  = "connect"
+	EarthErrorTLS      = "tls"
+	EarthErrorTimeout  = "timeout"
+	EarthErrorTooLarge = "too-large"
+	EarthErrorBlocked  = "blocked"
+	EarthErrorInvalid  = "invalid"
+)
+
+// EarthError Earth側でオリジンからの取得に失敗した理由
+type EarthError struct {
+	// Class エラーの分類（dns, connect, tls, timeout, too-large, blocked など）
+	Class string `json:"error_class"`
+
+	// Message エラーの詳細
+	Message string `json:"message"`
+
+	// URL 取得しようとしたURL
+	URL string `json:"url"`
+
+	// ContentType レスポンスのContent-Type（大きさ・種類の制限で中止した場合）
+	ContentType string `json:"content_type,omitempty"`
+
+	// Size レスポンスの大きさ（判明している場合）
+	Size int64 `json:"size,omitempty"`
+
+	// Limit 適用された大きさの上限
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// LargeTransferHeader 上限を超える大きなレスポンスの取得をEarth側に明示的に要求するヘッダー
+const LargeTransferHeader = "X-Earth-Allow-Large"
+
+// AllowsLargeTransfer 大きなレスポンスの取得が明示的に要求されているかを判定する
+func (br *BpRequest) AllowsLargeTransfer() bool {
+	return http.Header(br.Headers).Get(LargeTransferHeader) == "1"
+}
+
+// CanRetryLarge 大きなレスポンスとして明示的に要求すれば取得できる可能性があるか
+func (e *EarthError) CanRetryLarge() bool {
+	return e.Class == EarthErrorTooLarge
+}
+
+// EarthError レスポンスがEarth側のエラーレスポンスであれば、その内容を返す
+func (br *BpResponse) EarthError() (*EarthError, bool) {
+	header := http.Header(br.Headers)
+	class := header.Get(EarthErrorHeader)
+	if class == "" {
+		return nil, false
+	}
+
+	var e EarthError
+	if err := json.Unmarshal(br.Body, &e); err != nil || e.Class == "" {
+		// ボディが読めない場合はヘッダーの情報だけを使う
+		e = EarthError{Class: class, Message: header.Get(EarthErrorMessageHeader)}
+	}
+	if e.URL == "" {
+		e.URL = br.OriginalURL()
+	}
+	return &e, true
+}
+
+// HTTPStatus エラーの分類に対応するHTTPステータスコードを返す（domain層のロジック）
+func (e *EarthError) HTTPStatus() int {
+	switch e.Class {
+	case EarthErrorTimeout:
+		return http.StatusGatewayTimeout
+	case EarthErrorTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case EarthErrorBlocked:
+		return http.StatusForbidden
+	case EarthErrorInvalid:
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// Title ユーザーに表示するエラーの説明を返す
+func (e *EarthError) Title() string {
+	switch e.Class {
+	case EarthErrorDNS:
+		return "サーバーが見つかりませんでした"
+	case EarthErrorConnect:
+		return "サーバーに接続できませんでした"
+	case EarthErrorTLS:
+		return "安全な接続を確立できませんでした"
+	case EarthErrorTimeout:
+		return "サーバーの応答がタイムアウトしました"
+	case EarthErrorTooLarge:
+		return "ページが大きすぎるため取得できませんでした"
+	case EarthErrorBlocked:
+		return "このページへのアクセスは許可されていません"
+	case EarthErrorInvalid:
+		return "リクエストが不正です"
+	default:
+		return "ページを取得できませんでした"
+	}
+}
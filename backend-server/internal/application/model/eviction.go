@@ -0,0 +1,78 @@
+package model
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// キャッシュの容量を超えた場合に削除するエントリの選び方
+const (
+	EvictLRU = "lru" // 最後にアクセスされた時刻が古いものから削除する
+	EvictLFU = "lfu" // アクセスされた回数が少ないものから削除する
+)
+
+// CacheAccess キャッシュのエントリへのアクセス状況
+type CacheAccess struct {
+	// LastAccess 最後にキャッシュから返した時刻（一度も返していない場合は保存した時刻）
+	LastAccess time.Time
+
+	// Hits キャッシュから返した回数
+	Hits int64
+}
+
+// EvictionPolicy キャッシュの容量の上限と、上限を超えた場合に削除するエントリの選び方（domain層のロジック）
+type EvictionPolicy struct {
+	// MaxBytes キャッシュのファイルの合計サイズの上限（0の場合は上限なし）
+	MaxBytes int64
+
+	// Mode 削除するエントリの選び方（EvictLRUまたはEvictLFU）
+	Mode string
+
+	// Pins 削除しないURLまたはホスト
+	// "https://" などのスキームを含むものはURLの完全一致、それ以外はホスト（".example.com" の形式でサブドメインも対象）
+	Pins []string
+}
+
+// IsPinned URLが削除しない対象か判定する
+func (p *EvictionPolicy) IsPinned(rawURL string) bool {
+	if rawURL == "" {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pin := range p.Pins {
+		if strings.Contains(pin, "://") {
+			if pin == rawURL {
+				return true
+			}
+			continue
+		}
+		if matchHost(host, pin) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPins 固定するURL・ホストを追加したEvictionPolicyを返す（元のポリシーは変更しない）
+func (p *EvictionPolicy) WithPins(pins []string) *EvictionPolicy {
+	merged := *p
+	merged.Pins = append(append([]string(nil), p.Pins...), pins...)
+	return &merged
+}
+
+// Before エントリaをエントリbより先に削除するか判定する
+// 期限切れのエントリは常に有効なエントリより先に削除する
+func (p *EvictionPolicy) Before(a, b *CacheMetadata, accessA, accessB CacheAccess) bool {
+	if expiredA, expiredB := a.IsExpired(), b.IsExpired(); expiredA != expiredB {
+		return expiredA
+	}
+	if p.Mode == EvictLFU && accessA.Hits != accessB.Hits {
+		return accessA.Hits < accessB.Hits
+	}
+	return accessA.LastAccess.Before(accessB.LastAccess)
+}
@@ -0,0 +1,236 @@
+package model
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 鮮度の決め方（ログや管理画面での表示用）
+const (
+	FreshnessSMaxAge   = "s-maxage"
+	FreshnessMaxAge    = "max-age"
+	FreshnessExpires   = "expires"
+	FreshnessNoCache   = "no-cache"  // 保存はできるが、毎回の検証が必要（保存した時点で期限切れ）
+	FreshnessHeuristic = "heuristic" // Last-Modifiedからの経過時間による推定
+	FreshnessDefault   = "default"   // 鮮度の情報が無いためデフォルトのTTLを使用
+	FreshnessNone      = "none"      // 推定してはいけないステータスコード
+)
+
+// FreshnessHostRule ホストごとの鮮度の上書き
+type FreshnessHostRule struct {
+	// Match 対象のホスト（".example.com" の形式でサブドメインも対象）
+	Match string
+
+	// MinTTL TTLの下限（0の場合は全体の設定を使用）
+	MinTTL time.Duration
+
+	// MaxTTL TTLの上限（0の場合は全体の設定を使用）
+	MaxTTL time.Duration
+
+	// ForceStore no-storeやprivateのレスポンスも保存するか
+	// 遅延の大きいリンクでは、再取得よりも古い内容を表示する方が望ましい場合がある
+	ForceStore bool
+}
+
+// FreshnessPolicy レスポンスをキャッシュに保存する期間をRFC 9111に従って決める（domain層のロジック）
+// Space側のキャッシュは複数のユーザーが共有するため、共有キャッシュとして扱う（s-maxageを優先し、privateは保存しない）
+type FreshnessPolicy struct {
+	// DefaultTTL 鮮度の情報もLast-Modifiedも無いレスポンスのTTL
+	DefaultTTL time.Duration
+
+	// HeuristicFraction Last-Modifiedからの経過時間のうち、新しいとみなす割合（RFC 9111 4.2.2、通常は0.1）
+	HeuristicFraction float64
+
+	// MinTTL TTLの下限（0の場合は下限なし）
+	// 遅延の大きいリンクでは、max-age=0のレスポンスもしばらく保存する方が望ましい場合がある
+	MinTTL time.Duration
+
+	// MaxTTL TTLの上限（0の場合は上限なし）
+	MaxTTL time.Duration
+
+	// Hosts ホストごとの上書き（先に一致したものを使用）
+	Hosts []FreshnessHostRule
+}
+
+// Freshness レスポンスの鮮度の判定結果
+type Freshness struct {
+	// Store キャッシュに保存するか
+	Store bool
+
+	// TTL 保存する期間（受信時点からの残りの新しさ）
+	TTL time.Duration
+
+	// Source 鮮度の決め方（FreshnessMaxAgeなど）
+	Source string
+
+	// Reason 保存しない理由（Storeがfalseの場合）
+	Reason string
+}
+
+// heuristicStatusCodes 明示的な鮮度が無くても推定してよいステータスコード（RFC 9110 15.1）
+var heuristicStatusCodes = map[int]bool{
+	200: true, 203: true, 204: true, 206: true, 300: true, 301: true,
+	308: true, 404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// Evaluate レスポンスを保存するか、どれだけの期間保存するかを決める
+// now: レスポンスを受信した時刻（Dateヘッダーからの経過時間をAgeとして差し引く）
+func (p *FreshnessPolicy) Evaluate(req *BpRequest, resp *BpResponse, now time.Time) Freshness {
+	header := http.Header(resp.Headers)
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	rule := p.hostRule(req.URL)
+
+	if resp.VariesOnAll() {
+		// どのリクエストにも一致しないため、保存しても返せない（RFC 9111 4.1）
+		return Freshness{Reason: "vary *"}
+	}
+
+	reason := ""
+	switch {
+	case cc.has("no-store"):
+		reason = "no-store"
+	case cc.has("private"):
+		reason = "private"
+	case parseCacheControl(http.Header(req.Headers).Values("Cache-Control")).has("no-store"):
+		reason = "request no-store"
+	}
+	if reason != "" && (rule == nil || !rule.ForceStore) {
+		return Freshness{Reason: reason}
+	}
+
+	lifetime, source := p.lifetime(resp.StatusCode, header, cc, now)
+	ttl := lifetime - currentAge(header, now)
+
+	minTTL, maxTTL := p.MinTTL, p.MaxTTL
+	if rule != nil {
+		if rule.MinTTL > 0 {
+			minTTL = rule.MinTTL
+		}
+		if rule.MaxTTL > 0 {
+			maxTTL = rule.MaxTTL
+		}
+	}
+	if maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+	if ttl <= 0 {
+		// 受信した時点で期限切れのレスポンスは、検証の手段が無いため保存しない
+		return Freshness{Source: source, Reason: "stale on arrival (" + source + ")"}
+	}
+	return Freshness{Store: true, TTL: ttl, Source: source}
+}
+
+// lifetime レスポンスが新しいとみなせる期間（freshness lifetime）を決める（RFC 9111 4.2.1）
+func (p *FreshnessPolicy) lifetime(status int, header http.Header, cc cacheControl, now time.Time) (time.Duration, string) {
+	if cc.has("no-cache") {
+		return 0, FreshnessNoCache
+	}
+	if v, ok := cc["s-maxage"]; ok {
+		return parseDeltaSeconds(v), FreshnessSMaxAge
+	}
+	if v, ok := cc["max-age"]; ok {
+		return parseDeltaSeconds(v), FreshnessMaxAge
+	}
+
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = now
+	}
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			// 不正なExpires（"0"など）はすでに期限切れとみなす
+			return 0, FreshnessExpires
+		}
+		return expires.Sub(date), FreshnessExpires
+	}
+
+	if !heuristicStatusCodes[status] {
+		return 0, FreshnessNone
+	}
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil && p.HeuristicFraction > 0 {
+		if elapsed := date.Sub(lastModified); elapsed > 0 {
+			return time.Duration(float64(elapsed) * p.HeuristicFraction), FreshnessHeuristic
+		}
+	}
+	return p.DefaultTTL, FreshnessDefault
+}
+
+// hostRule URLのホストに一致する上書きを返す
+func (p *FreshnessPolicy) hostRule(rawURL string) *FreshnessHostRule {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for i := range p.Hosts {
+		if matchHost(host, p.Hosts[i].Match) {
+			return &p.Hosts[i]
+		}
+	}
+	return nil
+}
+
+// matchHost ホストが指定に一致するか判定する（".example.com" の形式でサブドメインも対象）
+// host: 小文字のホスト名
+func matchHost(host, match string) bool {
+	match = strings.ToLower(match)
+	return host == strings.TrimPrefix(match, ".") || (strings.HasPrefix(match, ".") && strings.HasSuffix(host, match))
+}
+
+// currentAge レスポンスが生成されてから受信するまでの経過時間（RFC 9111 4.2.3）
+// DTNの遅延はDateヘッダーからの経過時間に含まれる
+func currentAge(header http.Header, now time.Time) time.Duration {
+	age := parseDeltaSeconds(header.Get("Age"))
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		if apparent := now.Sub(date); apparent > age {
+			age = apparent
+		}
+	}
+	return age
+}
+
+// cacheControl Cache-Controlヘッダーのディレクティブ（名前は小文字、値は引用符を外したもの）
+type cacheControl map[string]string
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// parseCacheControl Cache-Controlヘッダーを解析する（同じディレクティブが複数ある場合は最初のものを使用）
+func parseCacheControl(values []string) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := cc[name]; !ok {
+				cc[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+	return cc
+}
+
+// parseDeltaSeconds 秒数の値を解析する（不正な値は0、つまり期限切れとみなす）
+func parseDeltaSeconds(v string) time.Duration {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	// 大きすぎる値はRFC 9111 1.2.2に従い2^31秒に丸める
+	if n > 1<<31 {
+		n = 1 << 31
+	}
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFreshnessPolicyEvaluate(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	date := func(d time.Duration) string { return now.Add(d).Format(http.TimeFormat) }
+	policy := &FreshnessPolicy{
+		DefaultTTL:        time.Hour,
+		HeuristicFraction: 0.1,
+		Hosts: []FreshnessHostRule{
+			{Match: ".forced.example", ForceStore: true},
+			{Match: "clamped.example", MinTTL: 10 * time.Minute, MaxTTL: 20 * time.Minute},
+		},
+	}
+	clamped := &FreshnessPolicy{DefaultTTL: time.Hour, MinTTL: 5 * time.Minute, MaxTTL: 30 * time.Minute}
+
+	tests := []struct {
+		name       string
+		policy     *FreshnessPolicy
+		url        string
+		reqHeader  http.Header
+		status     int
+		header     http.Header
+		wantStore  bool
+		wantTTL    time.Duration
+		wantSource string
+		wantReason string
+	}{
+		{name: "no-store", header: http.Header{"Cache-Control": {"no-store, max-age=60"}}, wantReason: "no-store"},
+		{name: "private", header: http.Header{"Cache-Control": {"private, max-age=60"}}, wantReason: "private"},
+		{name: "request no-store", reqHeader: http.Header{"Cache-Control": {"no-store"}}, header: http.Header{"Cache-Control": {"max-age=60"}}, wantReason: "request no-store"},
+		{name: "vary *", header: http.Header{"Vary": {"Accept, *"}, "Cache-Control": {"max-age=60"}}, wantReason: "vary *"},
+		{name: "s-maxage wins over max-age", header: http.Header{"Cache-Control": {"max-age=10, s-maxage=20"}}, wantStore: true, wantTTL: 20 * time.Second, wantSource: FreshnessSMaxAge},
+		{name: "max-age", header: http.Header{"Cache-Control": {"public, max-age=60"}}, wantStore: true, wantTTL: time.Minute, wantSource: FreshnessMaxAge},
+		{name: "max-age wins over Expires", header: http.Header{"Cache-Control": {"max-age=60"}, "Expires": {date(time.Hour)}}, wantStore: true, wantTTL: time.Minute, wantSource: FreshnessMaxAge},
+		{name: "quoted max-age", header: http.Header{"Cache-Control": {`max-age="60"`}}, wantStore: true, wantTTL: time.Minute, wantSource: FreshnessMaxAge},
+		{name: "invalid max-age", header: http.Header{"Cache-Control": {"max-age=soon"}}, wantSource: FreshnessMaxAge, wantReason: "stale on arrival (max-age)"},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"no-cache, max-age=60"}}, wantSource: FreshnessNoCache, wantReason: "stale on arrival (no-cache)"},
+		{name: "Expires relative to Date", header: http.Header{"Date": {date(0)}, "Expires": {date(time.Hour)}}, wantStore: true, wantTTL: time.Hour, wantSource: FreshnessExpires},
+		{name: "invalid Expires", header: http.Header{"Expires": {"0"}}, wantSource: FreshnessExpires, wantReason: "stale on arrival (expires)"},
+		{name: "Age header", header: http.Header{"Cache-Control": {"max-age=600"}, "Age": {"100"}}, wantStore: true, wantTTL: 500 * time.Second, wantSource: FreshnessMaxAge},
+		{name: "Date older than Age", header: http.Header{"Cache-Control": {"max-age=600"}, "Age": {"100"}, "Date": {date(-200 * time.Second)}}, wantStore: true, wantTTL: 400 * time.Second, wantSource: FreshnessMaxAge},
+		{name: "Age older than Date", header: http.Header{"Cache-Control": {"max-age=600"}, "Age": {"300"}, "Date": {date(-200 * time.Second)}}, wantStore: true, wantTTL: 300 * time.Second, wantSource: FreshnessMaxAge},
+		{name: "expired by Age", header: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"120"}}, wantSource: FreshnessMaxAge, wantReason: "stale on arrival (max-age)"},
+		{name: "heuristic", header: http.Header{"Date": {date(0)}, "Last-Modified": {date(-10 * time.Hour)}}, wantStore: true, wantTTL: time.Hour, wantSource: FreshnessHeuristic},
+		{name: "Last-Modified in the future", header: http.Header{"Date": {date(0)}, "Last-Modified": {date(time.Hour)}}, wantStore: true, wantTTL: time.Hour, wantSource: FreshnessDefault},
+		{name: "default", header: http.Header{}, wantStore: true, wantTTL: time.Hour, wantSource: FreshnessDefault},
+		{name: "no heuristic for status", status: 500, header: http.Header{"Last-Modified": {date(-10 * time.Hour)}}, wantSource: FreshnessNone, wantReason: "stale on arrival (none)"},
+		{name: "explicit freshness for status", status: 500, header: http.Header{"Cache-Control": {"max-age=60"}}, wantStore: true, wantTTL: time.Minute, wantSource: FreshnessMaxAge},
+		{name: "min clamp", policy: clamped, header: http.Header{"Cache-Control": {"max-age=0"}}, wantStore: true, wantTTL: 5 * time.Minute, wantSource: FreshnessMaxAge},
+		{name: "max clamp", policy: clamped, header: http.Header{"Cache-Control": {"max-age=86400"}}, wantStore: true, wantTTL: 30 * time.Minute, wantSource: FreshnessMaxAge},
+		{name: "min clamp of stale response", policy: clamped, header: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"3600"}}, wantStore: true, wantTTL: 5 * time.Minute, wantSource: FreshnessMaxAge},
+		{name: "host min clamp", url: "https://clamped.example/", header: http.Header{"Cache-Control": {"max-age=60"}}, wantStore: true, wantTTL: 10 * time.Minute, wantSource: FreshnessMaxAge},
+		{name: "host max clamp", url: "https://clamped.example/", header: http.Header{"Cache-Control": {"max-age=3600"}}, wantStore: true, wantTTL: 20 * time.Minute, wantSource: FreshnessMaxAge},
+		{name: "host rule does not match subdomain", url: "https://www.clamped.example/", header: http.Header{"Cache-Control": {"max-age=3600"}}, wantStore: true, wantTTL: time.Hour, wantSource: FreshnessMaxAge},
+		{name: "ForceStore no-store", url: "https://www.FORCED.example/", header: http.Header{"Cache-Control": {"no-store, max-age=60"}}, wantStore: true, wantTTL: time.Minute, wantSource: FreshnessMaxAge},
+		{name: "ForceStore private", url: "https://forced.example/", header: http.Header{"Cache-Control": {"private"}}, wantStore: true, wantTTL: time.Hour, wantSource: FreshnessDefault},
+		{name: "ForceStore other host", url: "https://notforced.example/", header: http.Header{"Cache-Control": {"no-store"}}, wantReason: "no-store"},
+	}
+	for _, tt := range tests {
+		p := tt.policy
+		if p == nil {
+			p = policy
+		}
+		url := tt.url
+		if url == "" {
+			url = "https://example.com/"
+		}
+		status := tt.status
+		if status == 0 {
+			status = 200
+		}
+		req := &BpRequest{Method: "GET", URL: url, Headers: tt.reqHeader}
+		resp := &BpResponse{StatusCode: status, Headers: tt.header}
+
+		got := p.Evaluate(req, resp, now)
+		want := Freshness{Store: tt.wantStore, TTL: tt.wantTTL, Source: tt.wantSource, Reason: tt.wantReason}
+		if got != want {
+			t.Errorf("%s: Evaluate() = %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/rand/v2"
+	"time"
+)
+
+// キャッシュから返す際にボディを確認する方法
+const (
+	VerifyAlways = "always" // 読み込むたびにハッシュを確認する
+	VerifySample = "sample" // SampleRateの割合だけハッシュを確認する（大きさは常に確認する）
+	VerifySize   = "size"   // 大きさだけを確認する
+)
+
+// IntegrityPolicy キャッシュのファイルが保存したものと同じか確認する方法（domain層のロジック）
+type IntegrityPolicy struct {
+	// Verify キャッシュから返す際の確認の方法（VerifyAlways, VerifySample, VerifySize）
+	Verify string
+
+	// SampleRate VerifySampleの場合に、ハッシュを確認する読み込みの割合（0〜1）
+	SampleRate float64
+}
+
+// ShouldHash 今回の読み込みでハッシュを確認するか判定する
+func (p *IntegrityPolicy) ShouldHash() bool {
+	if p == nil {
+		return true
+	}
+	switch p.Verify {
+	case VerifySize:
+		return false
+	case VerifySample:
+		return rand.Float64() < p.SampleRate
+	default:
+		return true
+	}
+}
+
+// NewBodyHash ボディのハッシュを計算するためのhash.Hashを返す（CacheMetadata.SHA256と同じ方式）
+func NewBodyHash() hash.Hash {
+	return sha256.New()
+}
+
+// BodySHA256 ボディのSHA-256を16進数で返す
+func BodySHA256(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// CanVerify ハッシュと大きさを記録したエントリか判定する（記録する前に保存したエントリは確認しない）
+func (cm *CacheMetadata) CanVerify() bool {
+	return cm.SHA256 != ""
+}
+
+// VerifySize ファイルの大きさが保存したボディと同じか確認する
+func (cm *CacheMetadata) VerifySize(size int64) error {
+	if !cm.CanVerify() || size == cm.Size {
+		return nil
+	}
+	return fmt.Errorf("size mismatch: expected %d bytes, got %d bytes", cm.Size, size)
+}
+
+// VerifySum ファイルのハッシュ（16進数）が保存したボディと同じか確認する
+func (cm *CacheMetadata) VerifySum(sum string) error {
+	if !cm.CanVerify() || sum == cm.SHA256 {
+		return nil
+	}
+	return fmt.Errorf("sha256 mismatch: expected %s, got %s", cm.SHA256, sum)
+}
+
+// QuarantinedEntry 整合性の確認に失敗して隔離したエントリ（修復でURLを再取得するための情報）
+type QuarantinedEntry struct {
+	// ID 隔離したエントリのID（管理APIのエントリのIDと同じ）
+	ID string `json:"id"`
+
+	URL            string              `json:"url"`
+	RequestHeaders map[string][]string `json:"request_headers,omitempty"`
+
+	// Reason 確認に失敗した理由
+	Reason string `json:"reason"`
+
+	// OriginalPath キャッシュのファイルのパス
+	OriginalPath string `json:"original_path"`
+
+	// File 隔離したファイルのパス（ファイルが無かった場合は空）
+	File string `json:"file,omitempty"`
+
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// ScrubResult キャッシュ全体の確認の結果
+type ScrubResult struct {
+	// Checked ハッシュを確認したエントリの数
+	Checked int `json:"checked"`
+
+	// Skipped ハッシュを記録する前に保存したため確認しなかったエントリの数
+	Skipped int `json:"skipped"`
+
+	// Quarantined 確認に失敗して隔離したエントリの数
+	Quarantined int `json:"quarantined"`
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCacheMetadataVerify(t *testing.T) {
+	body := []byte("hello")
+	sum := BodySHA256(body)
+
+	tests := []struct {
+		name    string
+		meta    CacheMetadata
+		size    int64
+		sum     string
+		sizeErr string
+		sumErr  string
+	}{
+		{name: "match", meta: CacheMetadata{SHA256: sum, Size: 5}, size: 5, sum: sum},
+		{name: "size mismatch", meta: CacheMetadata{SHA256: sum, Size: 5}, size: 4, sum: sum, sizeErr: "size mismatch: expected 5 bytes, got 4 bytes"},
+		{name: "sum mismatch", meta: CacheMetadata{SHA256: sum, Size: 5}, size: 5, sum: BodySHA256([]byte("hellO")), sumErr: "sha256 mismatch"},
+		{name: "empty body", meta: CacheMetadata{SHA256: BodySHA256(nil), Size: 0}, size: 0, sum: BodySHA256([]byte{})},
+		{name: "saved before hashing", meta: CacheMetadata{Size: 5}, size: 4, sum: "anything"},
+	}
+	for _, tt := range tests {
+		if err := tt.meta.VerifySize(tt.size); (err == nil) != (tt.sizeErr == "") || (err != nil && !strings.Contains(err.Error(), tt.sizeErr)) {
+			t.Errorf("%s: VerifySize() = %v, want %q", tt.name, err, tt.sizeErr)
+		}
+		if err := tt.meta.VerifySum(tt.sum); (err == nil) != (tt.sumErr == "") || (err != nil && !strings.Contains(err.Error(), tt.sumErr)) {
+			t.Errorf("%s: VerifySum() = %v, want %q", tt.name, err, tt.sumErr)
+		}
+	}
+}
+
+func TestBodyHashMatchesBodySHA256(t *testing.T) {
+	h := NewBodyHash()
+	h.Write([]byte("hel"))
+	h.Write([]byte("lo"))
+	if got, want := hex.EncodeToString(h.Sum(nil)), BodySHA256([]byte("hello")); got != want {
+		t.Errorf("streamed hash = %s, BodySHA256() = %s", got, want)
+	}
+}
+
+func TestIntegrityPolicyShouldHash(t *testing.T) {
+	const draws = 10000
+	tests := []struct {
+		name     string
+		policy   *IntegrityPolicy
+		min, max int // ハッシュを確認する回数の範囲
+	}{
+		{name: "nil", policy: nil, min: draws, max: draws},
+		{name: "always", policy: &IntegrityPolicy{Verify: VerifyAlways}, min: draws, max: draws},
+		{name: "unknown mode", policy: &IntegrityPolicy{Verify: "bogus"}, min: draws, max: draws},
+		{name: "size", policy: &IntegrityPolicy{Verify: VerifySize, SampleRate: 1}, min: 0, max: 0},
+		{name: "sample none", policy: &IntegrityPolicy{Verify: VerifySample, SampleRate: 0}, min: 0, max: 0},
+		{name: "sample all", policy: &IntegrityPolicy{Verify: VerifySample, SampleRate: 1}, min: draws, max: draws},
+		{name: "sample tenth", policy: &IntegrityPolicy{Verify: VerifySample, SampleRate: 0.1}, min: 700, max: 1300},
+	}
+	for _, tt := range tests {
+		hashed := 0
+		for range draws {
+			if tt.policy.ShouldHash() {
+				hashed++
+			}
+		}
+		if hashed < tt.min || hashed > tt.max {
+			t.Errorf("%s: hashed %d of %d reads, want %d..%d", tt.name, hashed, draws, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Earth側にページのマニフェストとURLのまとめての取得を要求するリクエストのメソッドとヘッダー
+const (
+	MethodManifest = "MANIFEST"
+	MethodBatch    = "BATCH"
+	ManifestHeader = "X-Earth-Manifest" // Earth側の応答がマニフェストであることを示す（値は項目数）
+	BatchHeader    = "X-Earth-Batch"    // BATCHの応答で受け付けられたURLの数
+)
+
+// マニフェストの項目の種類
+const (
+	ManifestKindSubresource = "subresource" // 画像・CSS・スクリプトなど
+	ManifestKindLink        = "link"        // リンクされているページ
+)
+
+// マニフェストの取得状態
+const (
+	ManifestPending = "pending" // Earth側からの応答待ち
+	ManifestReady   = "ready"   // 取得済み
+	ManifestFailed  = "failed"  // Earth側で取得に失敗した
+)
+
+// ManifestItem マニフェストの1項目
+type ManifestItem struct {
+	URL         string `json:"url"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"` // 不明な場合は-1
+	SizeSource  string `json:"size_source,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	// Cached Space側のキャッシュに既にあるか（表示時に設定する）
+	Cached bool `json:"cached"`
+}
+
+// Manifest Earth側で作成されたページのマニフェスト
+type Manifest struct {
+	URL         string         `json:"url"`
+	FinalURL    string         `json:"final_url"`
+	Status      int            `json:"status"`
+	ContentType string         `json:"content_type"`
+	Size        int64          `json:"size"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Truncated   bool           `json:"truncated"`
+	Items       []ManifestItem `json:"items"`
+}
+
+// ManifestRecord Space側に保存するマニフェストの取得状況
+type ManifestRecord struct {
+	// URL マニフェストを要求したページのURL
+	URL string `json:"url"`
+
+	// Status 取得状態（pending, ready, failed）
+	Status string `json:"status"`
+
+	// Manifest 取得したマニフェスト（ready以外はnil）
+	Manifest *Manifest `json:"manifest,omitempty"`
+
+	// Error 取得に失敗した理由
+	Error string `json:"error,omitempty"`
+
+	// RequestedAt 要求した時刻
+	RequestedAt time.Time `json:"requested_at"`
+
+	// UpdatedAt 最終更新時刻
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ManifestRequest Earth側にページのマニフェストを要求するリクエストを生成する
+func ManifestRequest(pageURL string) (*BpRequest, error) {
+	if err := validateHTTPURL(pageURL); err != nil {
+		return nil, err
+	}
+	return &BpRequest{Method: MethodManifest, URL: pageURL}, nil
+}
+
+// BatchRequest マニフェストから選んだURLをまとめて要求するリクエストを生成する
+// 各URLのレスポンスは通常のリクエストと同じようにEarth側から個別に届く
+func BatchRequest(pageURL string, urls []string) (*BpRequest, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs selected")
+	}
+	for _, u := range urls {
+		if err := validateHTTPURL(u); err != nil {
+			return nil, err
+		}
+	}
+	body, err := json.Marshal(struct {
+		URLs []string `json:"urls"`
+	}{URLs: urls})
+	if err != nil {
+		return nil, err
+	}
+	return &BpRequest{
+		Method:        MethodBatch,
+		URL:           pageURL,
+		Body:          body,
+		ContentType:   "application/json",
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+// Manifest Earth側からのマニフェストの応答であれば、その内容を返す（domain層のロジック）
+func (br *BpResponse) Manifest() (*Manifest, bool) {
+	if http.Header(br.Headers).Get(ManifestHeader) == "" || br.StatusCode != http.StatusOK {
+		return nil, false
+	}
+	var m Manifest
+	if err := json.Unmarshal(br.Body, &m); err != nil {
+		return nil, false
+	}
+	return &m, true
+}
+
+// IsBatchAck Earth側がBATCHリクエストを受け付けた応答か判定する
+func (br *BpResponse) IsBatchAck() bool {
+	return http.Header(br.Headers).Get(BatchHeader) != ""
+}
+
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL: %q", raw)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Earth側がリダイレクトの経路を示すヘッダー
+const (
+	RedirectHeader = "X-Earth-Redirect"  // リダイレクトしたレスポンスごとに "<ステータス> <URL>"（経路順）
+	FinalURLHeader = "X-Earth-Final-URL" // リダイレクトをたどった後の最終的なURL
+)
+
+// Redirect リダイレクトの経路の1つ
+type Redirect struct {
+	// StatusCode リダイレクトのステータスコード（301, 302, 303, 307, 308）
+	StatusCode int
+
+	// URL リダイレクトを返したURL
+	URL string
+
+	// Location リダイレクト先のURL
+	Location string
+}
+
+// RedirectChain Earth側がたどったリダイレクトの経路と最終的なURLを返す
+// リダイレクトしていない場合は空のスライスを返す
+func (br *BpResponse) RedirectChain() ([]Redirect, string) {
+	header := http.Header(br.Headers)
+	finalURL := header.Get(FinalURLHeader)
+	values := header.Values(RedirectHeader)
+	if finalURL == "" || len(values) == 0 {
+		return nil, ""
+	}
+
+	redirects := make([]Redirect, 0, len(values))
+	for _, v := range values {
+		status, url, ok := strings.Cut(v, " ")
+		code, err := strconv.Atoi(status)
+		if !ok || err != nil || code < 300 || code > 399 {
+			// 不正な経路は無視して、最終的なURLだけを使う
+			return nil, ""
+		}
+		redirects = append(redirects, Redirect{StatusCode: code, URL: url})
+	}
+	for i := range redirects {
+		if i+1 < len(redirects) {
+			redirects[i].Location = redirects[i+1].URL
+		} else {
+			redirects[i].Location = finalURL
+		}
+	}
+	return redirects, finalURL
+}
+
+// WithoutRedirectChain リダイレクトの経路を示すヘッダーを除いたレスポンスを返す
+func (br *BpResponse) WithoutRedirectChain() *BpResponse {
+	header := http.Header(br.Headers).Clone()
+	header.Del(RedirectHeader)
+	header.Del(FinalURLHeader)
+
+	resp := *br
+	resp.Headers = header
+	return &resp
+}
+
+// IsRedirect リダイレクト先を示すレスポンス（Locationのある3xx）かどうか
+func (br *BpResponse) IsRedirect() bool {
+	return br.StatusCode >= 300 && br.StatusCode <= 399 && http.Header(br.Headers).Get("Location") != ""
+}
+
+// Response リダイレクトをブラウザに返すためのレスポンスを生成する
+func (r Redirect) Response() *BpResponse {
+	return &BpResponse{
+		StatusCode: r.StatusCode,
+		Headers: map[string][]string{
+			"Location": {r.Location},
+		},
+		Body: []byte{},
+	}
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Earth側に購読を登録・解除するリクエストのメソッドとヘッダー
+const (
+	MethodSubscribe          = "SUBSCRIBE"
+	MethodUnsubscribe        = "UNSUBSCRIBE"
+	SubscribeIntervalHeader  = "X-Earth-Subscribe-Interval"
+	SubscribeDepthHeader     = "X-Earth-Subscribe-Depth"
+	SubscriptionStatusHeader = "X-Earth-Subscription" // Earth側の応答に含まれる購読状態
+)
+
+// 購読の状態
+const (
+	SubscriptionPending = "pending" // Earth側からの応答待ち
+	SubscriptionActive  = "active"  // Earth側で登録済み
+	SubscriptionRemoved = "removed" // Earth側で解除済み（Space側では削除される）
+)
+
+// 購読の制約
+const (
+	MinSubscriptionInterval = 5 * time.Minute
+	MaxSubscriptionDepth    = 2
+)
+
+// Subscription 定期的にEarth側で再取得させるURL
+type Subscription struct {
+	// URL 購読するURL
+	URL string `json:"url"`
+
+	// Interval 再取得の間隔
+	Interval time.Duration `json:"interval"`
+
+	// Depth 再帰クロールの深さ
+	Depth int `json:"depth"`
+
+	// Status 購読の状態（pending, active）
+	Status string `json:"status"`
+
+	// CreatedAt 登録時刻
+	CreatedAt time.Time `json:"created_at"`
+
+	// UpdatedAt 最終更新時刻
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate 購読の内容を検証する（domain層のロジック）
+func (s *Subscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL: %q", s.URL)
+	}
+	if s.Interval < MinSubscriptionInterval {
+		return fmt.Errorf("interval must be at least %s (got %s)", MinSubscriptionInterval, s.Interval)
+	}
+	if s.Depth < 0 || s.Depth > MaxSubscriptionDepth {
+		return fmt.Errorf("depth must be between 0 and %d (got %d)", MaxSubscriptionDepth, s.Depth)
+	}
+	return nil
+}
+
+// SubscribeRequest Earth側に購読を登録するリクエストを生成する
+func (s *Subscription) SubscribeRequest() *BpRequest {
+	return &BpRequest{
+		Method: MethodSubscribe,
+		URL:    s.URL,
+		Headers: map[string][]string{
+			SubscribeIntervalHeader: {s.Interval.String()},
+			SubscribeDepthHeader:    {strconv.Itoa(s.Depth)},
+		},
+	}
+}
+
+// UnsubscribeRequest Earth側の購読を解除するリクエストを生成する
+func (s *Subscription) UnsubscribeRequest() *BpRequest {
+	return &BpRequest{
+		Method: MethodUnsubscribe,
+		URL:    s.URL,
+	}
+}
+
+// SubscriptionAck Earth側からの購読の応答であれば、対象のURLと購読状態を返す（domain層のロジック）
+func (br *BpResponse) SubscriptionAck() (url string, state string, ok bool) {
+	state = http.Header(br.Headers).Get(SubscriptionStatusHeader)
+	url = br.OriginalURL()
+	if state == "" || url == "" {
+		return "", "", false
+	}
+	return url, state, true
+}
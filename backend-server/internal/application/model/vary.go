@@ -0,0 +1,79 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Vary レスポンスのVaryヘッダーに含まれるヘッダー名を、正規化して重複を除き、ソートして返す（RFC 9111 4.1）
+// Content-Encodingの無いレスポンスはどのクライアントも受け付けられるため、Accept-Encodingは含めない
+func (br *BpResponse) Vary() []string {
+	header := http.Header(br.Headers)
+	seen := make(map[string]bool)
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" || name == "*" || seen[name] {
+				continue
+			}
+			if name == "Accept-Encoding" && header.Get("Content-Encoding") == "" {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VariesOnAll Varyヘッダーに "*" が含まれるか（どのリクエストにも一致しないため保存しない）
+func (br *BpResponse) VariesOnAll() bool {
+	for _, value := range http.Header(br.Headers).Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VariantCacheKey Varyヘッダーで指定されたリクエストのヘッダーの値を含めたキャッシュキーを生成する
+// vary: 保存されているレスポンスのVary（空の場合はGenerateCacheKeyと同じ）
+// 値は空白とカンマの区切りを正規化して比較する（ヘッダーが無い場合と空の場合は区別する）
+func (br *BpRequest) VariantCacheKey(vary []string) string {
+	if len(vary) == 0 {
+		return br.GenerateCacheKey()
+	}
+
+	header := http.Header(br.Headers)
+	baseKey := fmt.Sprintf("%s:%s", br.Method, br.URL)
+	for _, name := range vary {
+		values := header.Values(name)
+		if values == nil {
+			baseKey += fmt.Sprintf("|%s", name)
+			continue
+		}
+		baseKey += fmt.Sprintf("|%s=%s", name, normalizeHeaderValues(values))
+	}
+
+	hash := sha256.Sum256([]byte(baseKey))
+	return "bp:cache:" + hex.EncodeToString(hash[:])
+}
+
+// normalizeHeaderValues 複数行のヘッダーを1つにまとめ、カンマの前後の空白を取り除く
+func normalizeHeaderValues(values []string) string {
+	var parts []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			parts = append(parts, strings.TrimSpace(part))
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVary(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   []string
+	}{
+		{name: "none", header: http.Header{}, want: nil},
+		{name: "normalized and sorted", header: http.Header{"Vary": {" user-agent ,ACCEPT-LANGUAGE", "Cookie"}}, want: []string{"Accept-Language", "Cookie", "User-Agent"}},
+		{name: "duplicates", header: http.Header{"Vary": {"Accept, accept", "ACCEPT"}}, want: []string{"Accept"}},
+		{name: "empty names", header: http.Header{"Vary": {", ,Accept,"}}, want: []string{"Accept"}},
+		{name: "Accept-Encoding without Content-Encoding", header: http.Header{"Vary": {"Accept-Encoding, Accept"}}, want: []string{"Accept"}},
+		{name: "Accept-Encoding with Content-Encoding", header: http.Header{"Vary": {"accept-encoding"}, "Content-Encoding": {"gzip"}}, want: []string{"Accept-Encoding"}},
+		{name: "star is not a header name", header: http.Header{"Vary": {"*, Accept"}}, want: []string{"Accept"}},
+	}
+	for _, tt := range tests {
+		got := (&BpResponse{Headers: tt.header}).Vary()
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: Vary() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVariesOnAll(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{name: "star", header: http.Header{"Vary": {"*"}}, want: true},
+		{name: "star in list", header: http.Header{"Vary": {"Accept, * "}}, want: true},
+		{name: "star in second line", header: http.Header{"Vary": {"Accept", "*"}}, want: true},
+		{name: "names only", header: http.Header{"Vary": {"Accept, User-Agent"}}, want: false},
+		{name: "none", header: http.Header{}, want: false},
+	}
+	for _, tt := range tests {
+		if got := (&BpResponse{Headers: tt.header}).VariesOnAll(); got != tt.want {
+			t.Errorf("%s: VariesOnAll() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVariantCacheKey(t *testing.T) {
+	key := func(header http.Header, vary ...string) string {
+		req := &BpRequest{Method: http.MethodGet, URL: "https://example.com/", Headers: header}
+		return req.VariantCacheKey(vary)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{
+			name: "no vary is the plain key",
+			a:    key(http.Header{"User-Agent": {"a"}}),
+			b:    (&BpRequest{Method: http.MethodGet, URL: "https://example.com/"}).GenerateCacheKey(),
+			same: true,
+		},
+		{
+			name: "Accept is not part of the plain key",
+			a:    key(http.Header{"Accept": {"text/html"}, "Accept-Language": {"ja"}}),
+			b:    key(http.Header{"Accept": {"image/webp"}, "Accept-Language": {"en"}}),
+			same: true,
+		},
+		{
+			name: "Accept is not part of the key unless listed in Vary",
+			a:    key(http.Header{"Accept": {"text/html"}, "Accept-Language": {"ja"}, "User-Agent": {"x"}}, "User-Agent"),
+			b:    key(http.Header{"Accept": {"image/webp"}, "Accept-Language": {"en"}, "User-Agent": {"x"}}, "User-Agent"),
+			same: true,
+		},
+		{
+			name: "different values",
+			a:    key(http.Header{"Accept-Language": {"ja"}}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {"en"}}, "Accept-Language"),
+		},
+		{
+			name: "header absent vs empty",
+			a:    key(http.Header{}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {""}}, "Accept-Language"),
+		},
+		{
+			name: "headers not listed in Vary are ignored",
+			a:    key(http.Header{"Accept-Language": {"ja"}, "Cookie": {"a=1"}}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {"ja"}, "Cookie": {"a=2"}}, "Accept-Language"),
+			same: true,
+		},
+		{
+			name: "whitespace around commas",
+			a:    key(http.Header{"Accept-Language": {"ja, en;q=0.5"}}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {"ja,en;q=0.5"}}, "Accept-Language"),
+			same: true,
+		},
+		{
+			name: "multiple lines",
+			a:    key(http.Header{"Accept-Language": {"ja", "en"}}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {"ja,en"}}, "Accept-Language"),
+			same: true,
+		},
+		{
+			name: "value order matters",
+			a:    key(http.Header{"Accept-Language": {"ja,en"}}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {"en,ja"}}, "Accept-Language"),
+		},
+		{
+			name: "value case matters",
+			a:    key(http.Header{"Accept-Language": {"ja"}}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {"JA"}}, "Accept-Language"),
+		},
+		{
+			name: "Vary names are normalized before building the key",
+			a:    key(http.Header{"Accept-Language": {"ja"}}, "Accept-Language"),
+			b:    key(http.Header{"Accept-Language": {"ja"}}, (&BpResponse{Headers: http.Header{"Vary": {" accept-language "}}}).Vary()...),
+			same: true,
+		},
+		{
+			name: "absent header differs from no vary",
+			a:    key(http.Header{}, "Accept-Language"),
+			b:    key(http.Header{}),
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.a == tt.b; got != tt.same {
+			t.Errorf("%s: keys equal = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+}
+
+func TestNormalizeHeaderValues(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"ja"}, "ja"},
+		{[]string{" ja ,  en "}, "ja,en"},
+		{[]string{"ja", "en, fr"}, "ja,en,fr"},
+		{[]string{""}, ""},
+		{[]string{"a,,b"}, "a,,b"},
+	}
+	for _, tt := range tests {
+		if got := normalizeHeaderValues(tt.values); got != tt.want {
+			t.Errorf("normalizeHeaderValues(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -35,18 +36,41 @@ func NewBpService(
 }
 
 // ProxyRequest HTTPリクエストを転送する（キャッシュ可能な場合はキャッシュもチェック）
+// キャッシュから返す場合は、条件付きリクエストには304、Rangeには206で答え、HEADにはボディを読まずに答える
 func (bs *BpService) ProxyRequest(ctx context.Context, breq *model.BpRequest) (*model.BpResponse, error) {
+	// HEADはGETのキャッシュのメタデータだけで答える（キャッシュに無い場合は転送する）
+	if breq.Method == http.MethodHead {
+		if cachedResp, found := bs.cachedHeaders(ctx, breq); found {
+			log.Printf("[BpService] HEADにキャッシュから応答: URL=%s", breq.URL)
+			return breq.CachedResponse(cachedResp), nil
+		}
+	}
+
 	// キャッシュ不可の場合は直接転送
 	if !breq.IsCacheable() {
 		log.Printf("[BpService] リクエストはキャッシュ不可: Method=%s, URL=%s", breq.Method, breq.URL)
-		return bs.bpgateway.ProxyRequest(ctx, breq)
+		resp, err := bs.bpgateway.ProxyRequest(ctx, breq)
+		if err != nil {
+			return nil, err
+		}
+		if fetchErr, ok := resp.EarthError(); ok {
+			return bs.errorPageResponse(fetchErr), nil
+		}
+		return resp, nil
 	}
 
 	log.Printf("[BpService] リクエストはキャッシュ可能: URL=%s", breq.URL)
 
-	// キャッシュ可能な場合はキャッシュから取得
-	cacheKey := breq.GenerateCacheKey()
-	cachedResp, found, err := bs.bprepository.GetResponse(ctx, cacheKey)
+	// 条件付きリクエストでブラウザの持っている内容が最新の場合は、ボディを読まずに304を返す
+	if breq.IsConditional() {
+		if cachedResp, found := bs.cachedHeaders(ctx, breq); found && breq.NotModified(cachedResp) {
+			log.Printf("[BpService] 更新されていないため304を返します: URL=%s", breq.URL)
+			return breq.CachedResponse(cachedResp), nil
+		}
+	}
+
+	// キャッシュ可能な場合はキャッシュから取得（リクエストのヘッダーに一致するバリアントを選ぶ）
+	cachedResp, found, err := bs.bprepository.GetResponse(ctx, breq)
 	// found == false の場合はキャッシュミス（エラーではない）
 	if err != nil {
 		log.Printf("[BpService] キャッシュ取得エラー: %v", err)
@@ -54,10 +78,25 @@ func (bs *BpService) ProxyRequest(ctx context.Context, breq *model.BpRequest) (*
 		return bs.bpgateway.ProxyRequest(ctx, breq)
 	}
 
+	if found && cachedResp.Stale {
+		log.Printf("[BpService] 期限切れのキャッシュヒット: URL=%s, バックグラウンドで再取得します", breq.URL)
+		// 期限切れのキャッシュを返しつつ、再取得を予約する
+		bs.refreshStale(ctx, breq)
+		return breq.CachedResponse(cachedResp), nil
+	}
+
 	if found {
 		log.Printf("[BpService] キャッシュヒット: URL=%s", breq.URL)
-		// キャッシュヒット: キャッシュされたレスポンスを返す
-		return cachedResp, nil
+		// キャッシュヒット: キャッシュされたレスポンスを返す（Rangeヘッダーがある場合は範囲だけ）
+		return breq.CachedResponse(cachedResp), nil
+	}
+
+	// 直前にEarth側で取得に失敗している場合は、予約せずに失敗の理由を返す
+	// ただし大きなレスポンスの取得が明示的に要求された場合は、大きさの制限による失敗を無視して再取得する
+	if fetchErr, found, err := bs.bprepository.GetFetchError(ctx, breq.URL); err == nil && found &&
+		!(fetchErr.CanRetryLarge() && breq.AllowsLargeTransfer()) {
+		log.Printf("[BpService] Earth側で取得に失敗したURLです: URL=%s, Class=%s", breq.URL, fetchErr.Class)
+		return bs.errorPageResponse(fetchErr), nil
 	}
 
 	log.Printf("[BpService] キャッシュミス: URL=%s, リクエストを予約します", breq.URL)
@@ -118,3 +157,70 @@ func (bs *BpService) ProxyRequest(ctx context.Context, breq *model.BpRequest) (*
 		ContentLength: int64(len(htmlBytes)),
 	}, nil
 }
+
+// cachedHeaders GETのキャッシュからボディを読まずにステータスとヘッダーを取得する
+// 期限切れの場合は再取得を予約する
+func (bs *BpService) cachedHeaders(ctx context.Context, breq *model.BpRequest) (*model.BpResponse, bool) {
+	get := breq.AsGet()
+	cachedResp, found, err := bs.bprepository.GetResponseHeaders(ctx, get)
+	if err != nil {
+		log.Printf("[BpService] キャッシュ取得エラー: %v", err)
+		return nil, false
+	}
+	if found && cachedResp.Stale {
+		bs.refreshStale(ctx, get)
+	}
+	return cachedResp, found
+}
+
+// refreshStale 期限切れのキャッシュの再取得を予約する
+// 再取得が終わるまでの間に同じURLへのリクエストが続いても、予約は1回だけにする
+func (bs *BpService) refreshStale(ctx context.Context, breq *model.BpRequest) {
+	added, err := bs.bprepository.AddPendingRequest(ctx, breq.URL)
+	if err != nil {
+		log.Printf("[BpService] AddPendingRequest エラー: %v", err)
+		return
+	}
+	if !added {
+		return
+	}
+	if err := bs.bprepository.ReserveRequest(ctx, breq); err != nil {
+		log.Printf("[BpService] ReserveRequest エラー: %v", err)
+		_ = bs.bprepository.RemovePendingRequest(ctx, breq.URL)
+		return
+	}
+	log.Printf("[BpService] ReserveRequest 成功: URL=%s", breq.URL)
+}
+
+// errorPageResponse Earth側で取得に失敗した理由をエラーページとして返す
+func (bs *BpService) errorPageResponse(fetchErr *model.EarthError) *model.BpResponse {
+	status := fetchErr.HTTPStatus()
+	body, err := utils.RenderErrorPage(bs.defaultDir, utils.ErrorPageData{
+		Title:         fetchErr.Title(),
+		Class:         fetchErr.Class,
+		Message:       fetchErr.Message,
+		URL:           fetchErr.URL,
+		Status:        status,
+		ContentType:   fetchErr.ContentType,
+		Size:          fetchErr.Size,
+		Limit:         fetchErr.Limit,
+		CanRetryLarge: fetchErr.CanRetryLarge(),
+	})
+	contentType := "text/html; charset=utf-8"
+	if err != nil {
+		log.Printf("[BpService] Failed to render error page: %v", err)
+		body = []byte(fmt.Sprintf("%d %s: %s", status, fetchErr.Title(), fetchErr.Message))
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	return &model.BpResponse{
+		StatusCode: status,
+		Headers: map[string][]string{
+			"Content-Type":         {contentType},
+			model.EarthErrorHeader: {fetchErr.Class},
+		},
+		Body:          body,
+		ContentType:   contentType,
+		ContentLength: int64(len(body)),
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+)
+
+// 猶予期間内の期限切れのエントリは、AgeとWarningを付けて返し、再取得は1回だけ予約する
+func TestProxyRequestServesStale(t *testing.T) {
+	ctx := context.Background()
+	_, repo, _ := openRepository(t)
+	svc := NewBpService(nil, repo, t.TempDir(), "index.html")
+
+	const url = "https://example.com/news"
+	resp := &model.BpResponse{
+		StatusCode:  200,
+		Headers:     map[string][]string{"Age": {"30"}},
+		Body:        []byte("old news"),
+		ContentType: "text/plain",
+	}
+	if err := repo.SetResponseWithURL(ctx, &model.BpRequest{Method: "GET", URL: url}, resp, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	requests := []*model.BpRequest{
+		{Method: "GET", URL: url},
+		{Method: "GET", URL: url},
+		{Method: "HEAD", URL: url},
+		{Method: "GET", URL: url, Headers: map[string][]string{"If-None-Match": {`"x"`}}},
+	}
+	for _, req := range requests {
+		got, err := svc.ProxyRequest(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := http.Header(got.Headers)
+		if got.StatusCode != 200 || !got.Stale {
+			t.Errorf("%s: status = %d, stale = %v", req.Method, got.StatusCode, got.Stale)
+		}
+		if req.Method == "GET" && string(got.Body) != "old news" {
+			t.Errorf("%s: body = %q", req.Method, got.Body)
+		}
+		if age, err := strconv.Atoi(header.Get("Age")); err != nil || age < 30 {
+			t.Errorf("%s: Age = %q", req.Method, header.Get("Age"))
+		}
+		if header.Get("Warning") != model.StaleWarning {
+			t.Errorf("%s: Warning = %q", req.Method, header.Get("Warning"))
+		}
+	}
+
+	reserved, err := repo.GetReservedRequests(ctx)
+	if err != nil || len(reserved) != 1 || reserved[0].URL != url || reserved[0].Method != "GET" {
+		t.Fatalf("reserved requests = %v, %v", reserved, err)
+	}
+	// 再取得が終わると、次に期限切れになった時に再び予約できる
+	if err := repo.RemovePendingRequest(ctx, url); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ProxyRequest(ctx, &model.BpRequest{Method: "GET", URL: url}); err != nil {
+		t.Fatal(err)
+	}
+	if reserved, err := repo.GetReservedRequests(ctx); err != nil || len(reserved) != 2 {
+		t.Errorf("reserved requests after refresh = %d, %v", len(reserved), err)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+)
+
+// ErrEmptyCacheFilter 削除・再取得の対象が指定されていない（すべてのエントリを対象にする操作はcleanupを使う）
+var ErrEmptyCacheFilter = errors.New("specify url, host or prefix")
+
+// CacheAdminService 管理APIからキャッシュのエントリを一覧・確認・削除・再取得・固定する
+type CacheAdminService struct {
+	bprepository repository.BpRepository
+}
+
+func NewCacheAdminService(bprepository repository.BpRepository) *CacheAdminService {
+	return &CacheAdminService{
+		bprepository: bprepository,
+	}
+}
+
+// List 条件に一致するエントリをURL順に、offsetからlimit件まで返す
+func (as *CacheAdminService) List(ctx context.Context, filter *model.CacheFilter, offset, limit int) (*model.CacheInventoryPage, error) {
+	return as.bprepository.ListCacheInventory(ctx, filter, offset, limit)
+}
+
+// HostStats ホストごとの統計を返す
+func (as *CacheAdminService) HostStats(ctx context.Context) ([]*model.CacheHostStats, error) {
+	return as.bprepository.GetCacheHostStats(ctx)
+}
+
+// Get IDで指定したエントリの詳細を返す
+func (as *CacheAdminService) Get(ctx context.Context, id string) (*model.CacheInventoryEntry, bool, error) {
+	return as.bprepository.GetCacheEntry(ctx, id)
+}
+
+// Delete 条件に一致するエントリを削除し、削除した数を返す
+func (as *CacheAdminService) Delete(ctx context.Context, filter *model.CacheFilter) (int, error) {
+	if filter.IsEmpty() {
+		return 0, ErrEmptyCacheFilter
+	}
+	count, err := as.bprepository.DeleteCacheEntries(ctx, filter)
+	if err != nil {
+		return count, err
+	}
+	log.Printf("[CacheAdminService] %d件のエントリを削除しました", count)
+	return count, nil
+}
+
+// Refresh 条件に一致するエントリの再取得をEarth側に予約し、予約した数を返す
+// 再取得中のURLは予約しない（Varyによるバリアントは、最初のエントリのリクエストのヘッダーで1回だけ再取得する）
+// 再取得が終わるまでは、今のエントリを返し続ける
+func (as *CacheAdminService) Refresh(ctx context.Context, filter *model.CacheFilter) (int, error) {
+	if filter.IsEmpty() {
+		return 0, ErrEmptyCacheFilter
+	}
+	entries, err := as.bprepository.ListCacheEntries(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	reserved := 0
+	for _, entry := range entries {
+		added, err := as.reserveRefetch(ctx, entry.URL, entry.RequestHeaders)
+		if err != nil {
+			return reserved, err
+		}
+		if added {
+			reserved++
+		}
+	}
+	log.Printf("[CacheAdminService] %d件のエントリの再取得を予約しました", reserved)
+	return reserved, nil
+}
+
+// reserveRefetch URLの再取得をEarth側に予約する（再取得中のURLは予約せずにfalseを返す）
+func (as *CacheAdminService) reserveRefetch(ctx context.Context, url string, headers map[string][]string) (bool, error) {
+	added, err := as.bprepository.AddPendingRequest(ctx, url)
+	if err != nil || !added {
+		return false, err
+	}
+	req := &model.BpRequest{
+		Method:  http.MethodGet,
+		URL:     url,
+		Headers: headers,
+	}
+	if err := as.bprepository.ReserveRequest(ctx, req); err != nil {
+		_ = as.bprepository.RemovePendingRequest(ctx, url)
+		return false, err
+	}
+	return true, nil
+}
+
+// Scrub すべてのエントリのファイルを確認し、保存したものと一致しないエントリを隔離する
+func (as *CacheAdminService) Scrub(ctx context.Context) (*model.ScrubResult, error) {
+	return as.bprepository.ScrubCaches(ctx, true)
+}
+
+// Quarantine 整合性の確認に失敗して隔離したエントリを返す
+func (as *CacheAdminService) Quarantine(ctx context.Context) ([]*model.QuarantinedEntry, error) {
+	return as.bprepository.ListQuarantine(ctx)
+}
+
+// Repair 隔離したエントリのURLの再取得をEarth側に予約し、予約した数を返す
+// 予約したエントリ（再取得中のURLのものを含む）は隔離したファイルとともに削除する
+func (as *CacheAdminService) Repair(ctx context.Context) (int, error) {
+	entries, err := as.bprepository.ListQuarantine(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	reserved := 0
+	for _, entry := range entries {
+		if entry.URL == "" {
+			continue
+		}
+		added, err := as.reserveRefetch(ctx, entry.URL, entry.RequestHeaders)
+		if err != nil {
+			return reserved, err
+		}
+		if added {
+			reserved++
+		}
+		if err := as.bprepository.DeleteQuarantined(ctx, entry.ID); err != nil {
+			return reserved, err
+		}
+	}
+	log.Printf("[CacheAdminService] 隔離した%d件のエントリのうち、%d件の再取得を予約しました", len(entries), reserved)
+	return reserved, nil
+}
+
+// Pin URLまたはホストを、容量を超えても削除しない対象に加える
+func (as *CacheAdminService) Pin(ctx context.Context, pin string) error {
+	if err := model.ValidatePin(pin); err != nil {
+		return err
+	}
+	return as.bprepository.PinCache(ctx, pin)
+}
+
+// Unpin 固定したURLまたはホストを外す
+func (as *CacheAdminService) Unpin(ctx context.Context, pin string) error {
+	if err := model.ValidatePin(pin); err != nil {
+		return err
+	}
+	return as.bprepository.UnpinCache(ctx, pin)
+}
+
+// Pins 管理APIで固定したURL・ホストを返す
+func (as *CacheAdminService) Pins(ctx context.Context) ([]string, error) {
+	return as.bprepository.ListPins(ctx)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository/plugins"
+)
+
+func openRepository(t *testing.T) (*plugins.EmbeddedClient, *repository.BpRepository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	client, err := plugins.NewEmbeddedClient(filepath.Join(dir, "store.log"), plugins.RedisClientConfig{
+		ReservedRequestsKey: "bp:reserved:requests",
+		PendingRequestsKey:  "bp:pending:requests",
+		SubscriptionsKey:    "bp:subscriptions",
+		CacheMetaPattern:    "bp:cache:meta:*",
+		CacheAccessKey:      "bp:cache:access",
+		CacheIndexKey:       "bp:cache:index",
+		CachePinsKey:        "bp:cache:pins",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	quarantineDir := filepath.Join(dir, "quarantine")
+	repo := repository.NewBpRepository(client, filepath.Join(dir, "cache"), time.Hour, 0,
+		&model.EvictionPolicy{Mode: model.EvictLRU}, 0, &model.IntegrityPolicy{Verify: model.VerifyAlways}, quarantineDir)
+	return client, repo, quarantineDir
+}
+
+// 隔離したエントリの修復で、保存した時のリクエストのヘッダーで再取得を予約し、隔離した情報を削除する
+func TestRepairReservesQuarantined(t *testing.T) {
+	tests := []struct {
+		name         string
+		pending      bool // 修復の前に再取得中だったか
+		wantReserved int
+	}{
+		{name: "reserve", wantReserved: 1},
+		{name: "already pending", pending: true, wantReserved: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			_, repo, quarantineDir := openRepository(t)
+			svc := NewCacheAdminService(repo)
+
+			req := &model.BpRequest{Method: "GET", URL: "https://example.com/page", Headers: map[string][]string{"Accept-Language": {"ja"}}}
+			resp := &model.BpResponse{StatusCode: 200, Headers: map[string][]string{"Vary": {"Accept-Language"}}, Body: []byte("hello"), ContentType: "text/plain"}
+			if err := repo.SetResponseWithURL(ctx, req, resp, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := repo.ListCacheEntries(ctx, nil)
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("ListCacheEntries() = %v, %v", entries, err)
+			}
+			if err := os.WriteFile(entries[0].FilePath, []byte("HELLO"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if result, err := svc.Scrub(ctx); err != nil || result.Quarantined != 1 {
+				t.Fatalf("Scrub() = %+v, %v", result, err)
+			}
+			if tt.pending {
+				if _, err := repo.AddPendingRequest(ctx, req.URL); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reserved, err := svc.Repair(ctx)
+			if err != nil || reserved != tt.wantReserved {
+				t.Fatalf("Repair() = %d, %v, want %d", reserved, err, tt.wantReserved)
+			}
+			jobs, err := repo.GetReservedRequests(ctx)
+			if err != nil || len(jobs) != tt.wantReserved {
+				t.Fatalf("reserved requests = %v, %v", jobs, err)
+			}
+			if tt.wantReserved > 0 {
+				job := jobs[0]
+				if job.Method != "GET" || job.URL != req.URL || len(job.Headers["Accept-Language"]) != 1 || job.Headers["Accept-Language"][0] != "ja" {
+					t.Errorf("reserved request = %+v", job)
+				}
+			}
+
+			// 予約したかどうかに関わらず、隔離した情報とファイルは削除する
+			if records, err := svc.Quarantine(ctx); err != nil || len(records) != 0 {
+				t.Errorf("Quarantine() after repair = %v, %v", records, err)
+			}
+			if files, _ := os.ReadDir(quarantineDir); len(files) != 0 {
+				t.Errorf("%d files left in quarantine", len(files))
+			}
+			if reserved, err := svc.Repair(ctx); err != nil || reserved != 0 {
+				t.Errorf("second Repair() = %d, %v", reserved, err)
+			}
+		})
+	}
+}
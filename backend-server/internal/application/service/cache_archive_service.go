@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/utils/warc"
+)
+
+// expiresAtField キャッシュの有効期限を記録するWARCの拡張フィールド
+// 取り込む際にこのフィールドがあれば、レスポンスのヘッダーではなくこの期限を使用する
+const expiresAtField = "X-BP-Expires-At"
+
+// warcinfoBlock エクスポートしたファイルの先頭に書き出すwarcinfoレコードの内容
+const warcinfoBlock = "software: ORF-2025-Space backend-server\r\nformat: WARC File Format 1.1\r\n"
+
+// ImportResult WARCファイルの取り込み結果
+type ImportResult struct {
+	Imported int `json:"imported"` // キャッシュに保存したレスポンスの数
+	Skipped  int `json:"skipped"`  // 期限切れ・保存できないなどの理由で保存しなかったレスポンスの数
+}
+
+// CacheArchiveService キャッシュの内容をWARCファイルとしてエクスポート・インポートする
+// 打ち上げ前のキャッシュの準備、ノード間での移動、閲覧した内容の保存に使う
+type CacheArchiveService struct {
+	bprepository repository.BpRepository
+	freshness    *model.FreshnessPolicy
+}
+
+func NewCacheArchiveService(
+	bprepository repository.BpRepository,
+	freshness *model.FreshnessPolicy,
+) *CacheArchiveService {
+	return &CacheArchiveService{
+		bprepository: bprepository,
+		freshness:    freshness,
+	}
+}
+
+// Export 条件に一致するキャッシュのエントリをWARCファイルとして書き出し、書き出したエントリの数を返す
+// エントリごとにresponseレコードを書き出し、Varyで選ばれたバリアントの場合はそのリクエストのヘッダーをrequestレコードとして続ける
+// compress: レコードごとにgzipで圧縮する（.warc.gz）
+func (cs *CacheArchiveService) Export(ctx context.Context, filter *model.CacheFilter, w io.Writer, compress bool) (int, error) {
+	entries, err := cs.bprepository.ListCacheEntries(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+
+	ww := warc.NewWriter(w, compress)
+	if err := ww.Write(&warc.Record{
+		Type:        warc.TypeWarcinfo,
+		ContentType: "application/warc-fields",
+		Block:       []byte(warcinfoBlock),
+	}); err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return exported, err
+		}
+		body, err := cs.bprepository.ReadCacheBody(ctx, entry)
+		if err != nil {
+			// クリーンアップと同時に削除された場合などは読み飛ばす
+			log.Printf("[CacheArchive] ボディを読み込めないため読み飛ばします (URL: %s): %v", entry.URL, err)
+			continue
+		}
+
+		header := http.Header(entry.Headers).Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		if header.Get("Content-Type") == "" && entry.ContentType != "" {
+			header.Set("Content-Type", entry.ContentType)
+		}
+		resp := &warc.Record{
+			Type:        warc.TypeResponse,
+			Date:        entry.CreatedAt,
+			TargetURI:   entry.URL,
+			ContentType: warc.ContentTypeHTTPResponse,
+			Fields:      map[string]string{expiresAtField: entry.ExpiresAt.UTC().Format(time.RFC3339)},
+			Block:       warc.EncodeHTTPResponse(entry.StatusCode, header, body),
+		}
+		if err := ww.Write(resp); err != nil {
+			return exported, err
+		}
+
+		if len(entry.RequestHeaders) > 0 {
+			block, err := warc.EncodeHTTPRequest(http.MethodGet, entry.URL, entry.RequestHeaders)
+			if err == nil {
+				err = ww.Write(&warc.Record{
+					Type:         warc.TypeRequest,
+					Date:         entry.CreatedAt,
+					TargetURI:    entry.URL,
+					ConcurrentTo: resp.ID,
+					ContentType:  warc.ContentTypeHTTPRequest,
+					Block:        block,
+				})
+			}
+			if err != nil {
+				return exported, err
+			}
+		}
+		exported++
+	}
+
+	log.Printf("[CacheArchive] %d件のエントリをエクスポートしました", exported)
+	return exported, nil
+}
+
+// Import WARCファイルのresponseレコードをキャッシュに取り込む
+// TTLはエクスポートした際の有効期限（無い場合はレスポンスのヘッダーからFreshnessPolicyで決める）を使い、期限切れのものは取り込まない
+// 対応するrequestレコード（WARC-Concurrent-Toで関連付けられたもの）があれば、そのヘッダーでバリアントを選ぶ
+func (cs *CacheArchiveService) Import(ctx context.Context, r io.Reader) (*ImportResult, error) {
+	reader, err := warc.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	requests := make(map[string]*warc.Record) // requestレコード（自身のIDと関連付けられたIDの両方で引く）
+	var pending *warc.Record                  // 後に続くrequestレコードを待っているresponseレコード
+
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		rec := pending
+		pending = nil
+		req := requests[rec.ID]
+		if req == nil && rec.ConcurrentTo != "" {
+			req = requests[rec.ConcurrentTo]
+		}
+		return cs.importResponse(ctx, rec, req, result)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		rec, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// 壊れたレコードの前まで読み込んだレスポンスは取り込む
+			if flushErr := flush(); flushErr != nil {
+				return result, flushErr
+			}
+			return result, err
+		}
+
+		switch rec.Type {
+		case warc.TypeRequest:
+			requests[rec.ID] = rec
+			if rec.ConcurrentTo != "" {
+				requests[rec.ConcurrentTo] = rec
+			}
+			if pending != nil && rec.ConcurrentTo == pending.ID {
+				if err := flush(); err != nil {
+					return result, err
+				}
+			}
+		case warc.TypeResponse:
+			if err := flush(); err != nil {
+				return result, err
+			}
+			pending = rec
+		}
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+
+	log.Printf("[CacheArchive] WARCファイルを取り込みました (保存: %d, スキップ: %d)", result.Imported, result.Skipped)
+	return result, nil
+}
+
+// importResponse responseレコードを1つキャッシュに保存する
+// 保存できないレコードはスキップとして数え、保存に失敗した場合だけエラーを返す
+func (cs *CacheArchiveService) importResponse(ctx context.Context, rec, reqRec *warc.Record, result *ImportResult) error {
+	if rec.TargetURI == "" {
+		result.Skipped++
+		return nil
+	}
+	httpResp, body, err := warc.ParseHTTPResponse(rec.Block)
+	if err != nil {
+		log.Printf("[CacheArchive] レスポンスを読み込めないためスキップします (URL: %s): %v", rec.TargetURI, err)
+		result.Skipped++
+		return nil
+	}
+
+	req := &model.BpRequest{Method: http.MethodGet, URL: rec.TargetURI}
+	if reqRec != nil {
+		if httpReq, err := warc.ParseHTTPRequest(reqRec.Block); err == nil {
+			req.Headers = httpReq.Header
+		}
+	}
+
+	now := time.Now()
+	header := httpResp.Header.Clone()
+	header.Del("Content-Length")
+	// 取得してからの経過時間をAgeに加え、キャッシュから返す際のAgeを取得時点からのものにする
+	if !rec.Date.IsZero() && now.After(rec.Date) {
+		age, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+		header.Set("Age", strconv.FormatInt(max(age, 0)+int64(now.Sub(rec.Date).Seconds()), 10))
+	}
+	resp := &model.BpResponse{
+		StatusCode:    httpResp.StatusCode,
+		Headers:       header,
+		Body:          body,
+		ContentType:   header.Get("Content-Type"),
+		ContentLength: int64(len(body)),
+	}
+
+	var ttl time.Duration
+	if v := rec.Field(expiresAtField); v != "" {
+		expiresAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			log.Printf("[CacheArchive] 有効期限を読み込めないためスキップします (URL: %s): %v", rec.TargetURI, err)
+			result.Skipped++
+			return nil
+		}
+		ttl = expiresAt.Sub(now)
+	} else {
+		f := cs.freshness.Evaluate(req, resp, now)
+		if !f.Store {
+			log.Printf("[CacheArchive] キャッシュしません (URL: %s, 理由: %s)", rec.TargetURI, f.Reason)
+			result.Skipped++
+			return nil
+		}
+		ttl = f.TTL
+	}
+	if ttl <= 0 {
+		result.Skipped++
+		return nil
+	}
+
+	if err := cs.bprepository.SetResponseWithURL(ctx, req, resp, ttl); err != nil {
+		return fmt.Errorf("failed to store %s: %w", rec.TargetURI, err)
+	}
+	result.Imported++
+	return nil
+}
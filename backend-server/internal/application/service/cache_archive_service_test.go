@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/utils/warc"
+)
+
+var testFreshness = &model.FreshnessPolicy{DefaultTTL: time.Hour, HeuristicFraction: 0.1}
+
+// cachedURLs 保存されているエントリのURLとリクエストのAccept-Languageを返す
+func cachedURLs(t *testing.T, svc *CacheArchiveService) []string {
+	t.Helper()
+	entries, err := svc.bprepository.ListCacheEntries(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, entry := range entries {
+		url := entry.URL
+		if lang := entry.RequestHeaders["Accept-Language"]; len(lang) > 0 {
+			url += " " + lang[0]
+		}
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestCacheArchiveRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	_, srcRepo, _ := openRepository(t)
+	src := NewCacheArchiveService(srcRepo, testFreshness)
+
+	store := func(url, lang string, ttl time.Duration) {
+		t.Helper()
+		req := &model.BpRequest{Method: "GET", URL: url}
+		headers := map[string][]string{"Content-Type": {"text/plain"}}
+		if lang != "" {
+			req.Headers = map[string][]string{"Accept-Language": {lang}}
+			headers["Vary"] = []string{"Accept-Language"}
+		}
+		resp := &model.BpResponse{StatusCode: 200, Headers: headers, Body: []byte(url + " " + lang), ContentType: "text/plain"}
+		if err := srcRepo.SetResponseWithURL(ctx, req, resp, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store("https://old.example.com/", "", time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	store("https://example.com/a", "ja", time.Hour)
+	store("https://example.com/a", "en", 2*time.Hour)
+	store("https://www.example.com/b", "", time.Hour)
+	store("https://other.example.org/c", "", time.Hour)
+
+	tests := []struct {
+		name     string
+		filter   *model.CacheFilter
+		compress bool
+		want     []string
+	}{
+		{
+			name: "all",
+			want: []string{"https://example.com/a en", "https://example.com/a ja", "https://old.example.com/", "https://other.example.org/c", "https://www.example.com/b"},
+		},
+		{
+			name:     "host with subdomains, compressed",
+			filter:   &model.CacheFilter{Host: ".example.com"},
+			compress: true,
+			want:     []string{"https://example.com/a en", "https://example.com/a ja", "https://old.example.com/", "https://www.example.com/b"},
+		},
+		{
+			name:   "host and date",
+			filter: &model.CacheFilter{Host: ".example.com", Since: since},
+			want:   []string{"https://example.com/a en", "https://example.com/a ja", "https://www.example.com/b"},
+		},
+		{
+			name:   "until",
+			filter: &model.CacheFilter{Until: since},
+			want:   []string{"https://old.example.com/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			exported, err := src.Export(ctx, tt.filter, &buf, tt.compress)
+			if err != nil || exported != len(tt.want) {
+				t.Fatalf("Export() = %d, %v, want %d", exported, err, len(tt.want))
+			}
+
+			_, dstRepo, _ := openRepository(t)
+			dst := NewCacheArchiveService(dstRepo, testFreshness)
+			result, err := dst.Import(ctx, &buf)
+			if err != nil || *result != (ImportResult{Imported: len(tt.want)}) {
+				t.Fatalf("Import() = %+v, %v", result, err)
+			}
+			if got := cachedURLs(t, dst); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("imported = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// バリアントはリクエストのヘッダーで選ばれ、有効期限はエクスポートした時のものを引き継ぐ
+	var buf bytes.Buffer
+	if _, err := src.Export(ctx, &model.CacheFilter{URL: "https://example.com/a"}, &buf, false); err != nil {
+		t.Fatal(err)
+	}
+	_, dstRepo, _ := openRepository(t)
+	if _, err := NewCacheArchiveService(dstRepo, testFreshness).Import(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, lang := range []string{"ja", "en"} {
+		req := &model.BpRequest{Method: "GET", URL: "https://example.com/a", Headers: map[string][]string{"Accept-Language": {lang}}}
+		resp, found, err := dstRepo.GetResponse(ctx, req)
+		if err != nil || !found || string(resp.Body) != "https://example.com/a "+lang {
+			t.Errorf("GetResponse(%s) = %v, %v", lang, found, err)
+		}
+	}
+	entries, _ := dstRepo.ListCacheEntries(ctx, nil)
+	srcEntries, _ := srcRepo.ListCacheEntries(ctx, &model.CacheFilter{URL: "https://example.com/a"})
+	for i := range entries {
+		if d := entries[i].ExpiresAt.Sub(srcEntries[i].ExpiresAt); d < -time.Second || d > time.Second {
+			t.Errorf("%s: expires at %v, exported %v", entries[i].URL, entries[i].ExpiresAt, srcEntries[i].ExpiresAt)
+		}
+	}
+}
+
+// writeResponse エクスポートしたものではないWARCのresponseレコードを書き出す
+func writeResponse(t *testing.T, w *warc.Writer, rec *warc.Record) {
+	t.Helper()
+	if rec.Type == "" {
+		rec.Type = warc.TypeResponse
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheArchiveImport(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	block := func(header http.Header) []byte {
+		return warc.EncodeHTTPResponse(200, header, []byte("body"))
+	}
+
+	tests := []struct {
+		name    string
+		record  *warc.Record
+		wantTTL time.Duration // 0の場合は取り込まない
+	}{
+		{
+			name:    "max-age",
+			record:  &warc.Record{TargetURI: "https://example.com/max-age", Date: now, Block: block(http.Header{"Cache-Control": {"max-age=600"}})},
+			wantTTL: 600 * time.Second,
+		},
+		{
+			name:    "max-age minus time since capture",
+			record:  &warc.Record{TargetURI: "https://example.com/captured", Date: now.Add(-100 * time.Second), Block: block(http.Header{"Cache-Control": {"max-age=600"}})},
+			wantTTL: 500 * time.Second,
+		},
+		{
+			name:    "Age header plus time since capture",
+			record:  &warc.Record{TargetURI: "https://example.com/age", Date: now.Add(-100 * time.Second), Block: block(http.Header{"Cache-Control": {"max-age=600"}, "Age": {"50"}})},
+			wantTTL: 450 * time.Second,
+		},
+		{
+			name:    "default TTL",
+			record:  &warc.Record{TargetURI: "https://example.com/default", Date: now, Block: block(http.Header{})},
+			wantTTL: time.Hour,
+		},
+		{
+			name:    "exported expiry wins over headers",
+			record:  &warc.Record{TargetURI: "https://example.com/exported", Date: now, Fields: map[string]string{expiresAtField: now.Add(2 * time.Hour).UTC().Format(time.RFC3339)}, Block: block(http.Header{"Cache-Control": {"no-store"}})},
+			wantTTL: 2 * time.Hour,
+		},
+		{name: "no-store", record: &warc.Record{TargetURI: "https://example.com/no-store", Date: now, Block: block(http.Header{"Cache-Control": {"no-store"}})}},
+		{name: "stale", record: &warc.Record{TargetURI: "https://example.com/stale", Date: now.Add(-time.Hour), Block: block(http.Header{"Cache-Control": {"max-age=60"}})}},
+		{name: "exported expiry passed", record: &warc.Record{TargetURI: "https://example.com/expired", Date: now, Fields: map[string]string{expiresAtField: now.Add(-time.Minute).UTC().Format(time.RFC3339)}, Block: block(http.Header{})}},
+		{name: "invalid exported expiry", record: &warc.Record{TargetURI: "https://example.com/invalid-expiry", Date: now, Fields: map[string]string{expiresAtField: "tomorrow"}, Block: block(http.Header{})}},
+		{name: "malformed HTTP block", record: &warc.Record{TargetURI: "https://example.com/malformed", Date: now, Block: []byte("not an http response")}},
+		{name: "no target URI", record: &warc.Record{Date: now, Block: block(http.Header{})}},
+		{name: "other record types are ignored", record: &warc.Record{Type: warc.TypeMetadata, TargetURI: "https://example.com/metadata", Block: block(http.Header{})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo, _ := openRepository(t)
+			svc := NewCacheArchiveService(repo, testFreshness)
+			var buf bytes.Buffer
+			writeResponse(t, warc.NewWriter(&buf, false), tt.record)
+
+			result, err := svc.Import(ctx, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ImportResult{Skipped: 1}
+			if tt.wantTTL > 0 {
+				want = ImportResult{Imported: 1}
+			} else if tt.record.Type != warc.TypeResponse {
+				want = ImportResult{}
+			}
+			if *result != want {
+				t.Fatalf("Import() = %+v, want %+v", *result, want)
+			}
+			if tt.wantTTL == 0 {
+				return
+			}
+			entries, err := repo.ListCacheEntries(ctx, nil)
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("ListCacheEntries() = %v, %v", entries, err)
+			}
+			if ttl := entries[0].ExpiresAt.Sub(entries[0].CreatedAt); ttl < tt.wantTTL-2*time.Second || ttl > tt.wantTTL+time.Second {
+				t.Errorf("TTL = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestCacheArchiveImportRejectsMalformedFile(t *testing.T) {
+	ctx := context.Background()
+	_, repo, _ := openRepository(t)
+	svc := NewCacheArchiveService(repo, testFreshness)
+
+	// 壊れたレコードの前に読み込んだレコードは取り込み、壊れたところでエラーを返す
+	var buf bytes.Buffer
+	writeResponse(t, warc.NewWriter(&buf, false), &warc.Record{
+		TargetURI: "https://example.com/ok",
+		Block:     warc.EncodeHTTPResponse(200, http.Header{"Cache-Control": {"max-age=600"}}, []byte("ok")),
+	})
+	buf.WriteString("WARC/1.1\r\nWARC-Type: response\r\nContent-Length: 100\r\n\r\ntruncated")
+
+	result, err := svc.Import(ctx, &buf)
+	if err == nil || !strings.Contains(err.Error(), "truncated record") {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.Imported != 1 {
+		t.Errorf("Import() = %+v, want the record before the broken one", result)
+	}
+	if _, err := svc.Import(ctx, strings.NewReader("not a warc file\r\n")); err == nil {
+		t.Error("Import() accepted a file that is not WARC")
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/gateway"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+)
+
+type ManifestService struct {
+	bpgateway    gateway.BpGateway
+	bprepository repository.BpRepository
+	ttl          time.Duration
+}
+
+func NewManifestService(
+	bpgateway gateway.BpGateway,
+	bprepository repository.BpRepository,
+	ttl time.Duration,
+) *ManifestService {
+	return &ManifestService{
+		bpgateway:    bpgateway,
+		bprepository: bprepository,
+		ttl:          ttl,
+	}
+}
+
+// Request Earth側にページのマニフェストを要求する
+// 取得済みまたは要求中のマニフェストがあれば、refreshを指定しない限り再要求しない
+// Earth側からの応答はバックグラウンドで待ち、届いた時点でreadyになる
+func (ms *ManifestService) Request(ctx context.Context, url string, refresh bool) (*model.ManifestRecord, error) {
+	req, err := model.ManifestRequest(url)
+	if err != nil {
+		return nil, err
+	}
+	if !refresh {
+		if rec, found, err := ms.bprepository.GetManifest(ctx, url); err == nil && found && rec.Status != model.ManifestFailed {
+			return ms.annotate(ctx, rec), nil
+		}
+	}
+
+	now := time.Now()
+	rec := &model.ManifestRecord{
+		URL:         url,
+		Status:      model.ManifestPending,
+		RequestedAt: now,
+		UpdatedAt:   now,
+	}
+	if err := ms.bprepository.SaveManifest(ctx, rec, ms.ttl); err != nil {
+		return nil, fmt.Errorf("failed to save manifest: %w", err)
+	}
+
+	log.Printf("[ManifestService] マニフェストを要求しました: URL=%s", url)
+	go ms.send(req, rec)
+	return rec, nil
+}
+
+// Get 保存されているマニフェストを取得し、各項目がSpace側のキャッシュにあるかを設定する
+func (ms *ManifestService) Get(ctx context.Context, url string) (*model.ManifestRecord, bool, error) {
+	rec, found, err := ms.bprepository.GetManifest(ctx, url)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return ms.annotate(ctx, rec), true, nil
+}
+
+// RequestBatch マニフェストから選んだURLをEarth側にまとめて要求する
+// 各URLのレスポンスは個別に届き、ResponseWatcherでキャッシュに保存される
+func (ms *ManifestService) RequestBatch(ctx context.Context, pageURL string, urls []string) (int, error) {
+	req, err := model.BatchRequest(pageURL, urls)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := ms.bpgateway.ProxyRequest(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("no response to batch request: %w", err)
+	}
+	if !resp.IsBatchAck() {
+		return 0, fmt.Errorf("batch rejected by Earth (status %d): %s", resp.StatusCode, resp.Body)
+	}
+	log.Printf("[ManifestService] まとめて要求しました: URL=%s, 件数=%d", pageURL, len(urls))
+	return len(urls), nil
+}
+
+// send Earth側にマニフェストを要求し、応答を保存する
+// タイムアウトした場合でも、後から届いた応答はResponseWatcherで保存される
+func (ms *ManifestService) send(req *model.BpRequest, rec *model.ManifestRecord) {
+	ctx := context.Background()
+	resp, err := ms.bpgateway.ProxyRequest(ctx, req)
+	if err != nil {
+		log.Printf("[ManifestService] マニフェストの応答がありません (URL: %s): %v", req.URL, err)
+		return
+	}
+
+	rec.UpdatedAt = time.Now()
+	if m, ok := resp.Manifest(); ok {
+		rec.Status = model.ManifestReady
+		rec.Manifest = m
+	} else {
+		rec.Status = model.ManifestFailed
+		rec.Error = fmt.Sprintf("status %d", resp.StatusCode)
+		if fetchErr, ok := resp.EarthError(); ok {
+			rec.Error = fmt.Sprintf("%s: %s", fetchErr.Class, fetchErr.Message)
+		}
+	}
+	if err := ms.bprepository.SaveManifest(ctx, rec, ms.ttl); err != nil {
+		log.Printf("[ManifestService] マニフェストを保存できませんでした (URL: %s): %v", req.URL, err)
+	}
+}
+
+// annotate 各項目がSpace側のキャッシュにあるかを設定する（URLのみのGETリクエストのキーで確認する）
+func (ms *ManifestService) annotate(ctx context.Context, rec *model.ManifestRecord) *model.ManifestRecord {
+	if rec.Manifest == nil {
+		return rec
+	}
+	for i := range rec.Manifest.Items {
+		item := &rec.Manifest.Items[i]
+		item.Cached, _ = ms.bprepository.HasResponse(ctx, &model.BpRequest{Method: "GET", URL: item.URL})
+	}
+	return rec
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/gateway"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+)
+
+type SubscriptionService struct {
+	bpgateway    gateway.BpGateway
+	bprepository repository.BpRepository
+}
+
+func NewSubscriptionService(
+	bpgateway gateway.BpGateway,
+	bprepository repository.BpRepository,
+) *SubscriptionService {
+	return &SubscriptionService{
+		bpgateway:    bpgateway,
+		bprepository: bprepository,
+	}
+}
+
+// Subscribe 購読を登録し、Earth側に登録リクエストを送信する
+// Earth側からの応答はバックグラウンドで待ち、応答が届いた時点でactiveになる
+func (ss *SubscriptionService) Subscribe(ctx context.Context, url string, interval time.Duration, depth int) (*model.Subscription, error) {
+	now := time.Now()
+	sub := &model.Subscription{
+		URL:       url,
+		Interval:  interval,
+		Depth:     depth,
+		Status:    model.SubscriptionPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := sub.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 既存の購読を更新する場合は登録時刻を引き継ぐ
+	if existing, found, err := ss.bprepository.GetSubscription(ctx, url); err == nil && found {
+		sub.CreatedAt = existing.CreatedAt
+	}
+	if err := ss.bprepository.SaveSubscription(ctx, sub); err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %w", err)
+	}
+
+	log.Printf("[SubscriptionService] 購読を登録しました: URL=%s, Interval=%s, Depth=%d", url, interval, depth)
+	go ss.send(sub.SubscribeRequest())
+	return sub, nil
+}
+
+// Unsubscribe 購読を削除し、Earth側に解除リクエストを送信する
+func (ss *SubscriptionService) Unsubscribe(ctx context.Context, url string) error {
+	sub, found, err := ss.bprepository.GetSubscription(ctx, url)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("subscription not found: %s", url)
+	}
+
+	if err := ss.bprepository.DeleteSubscription(ctx, url); err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+
+	log.Printf("[SubscriptionService] 購読を解除しました: URL=%s", url)
+	go ss.send(sub.UnsubscribeRequest())
+	return nil
+}
+
+// ListSubscriptions 購読の一覧を取得する
+func (ss *SubscriptionService) ListSubscriptions(ctx context.Context) ([]*model.Subscription, error) {
+	return ss.bprepository.ListSubscriptions(ctx)
+}
+
+// send Earth側に購読リクエストを送信し、応答があれば購読の状態に反映する
+// タイムアウトした場合でも、後から届いた応答はResponseWatcherで反映される
+func (ss *SubscriptionService) send(req *model.BpRequest) {
+	ctx := context.Background()
+	resp, err := ss.bpgateway.ProxyRequest(ctx, req)
+	if err != nil {
+		log.Printf("[SubscriptionService] %sリクエストの応答がありません (URL: %s): %v", req.Method, req.URL, err)
+		return
+	}
+
+	url, state, ok := resp.SubscriptionAck()
+	if !ok {
+		log.Printf("[SubscriptionService] Earth側が%sリクエストを拒否しました (URL: %s, Status: %d): %s", req.Method, req.URL, resp.StatusCode, resp.Body)
+		return
+	}
+	if state != model.SubscriptionActive {
+		return
+	}
+	if err := ss.bprepository.ActivateSubscription(ctx, url); err != nil {
+		log.Printf("[SubscriptionService] 購読の状態を更新できませんでした (URL: %s): %v", url, err)
+	}
+}
@@ -78,6 +78,12 @@ func (bh *bpHandler) GetContent(c *gin.Context) {
 		ContentLength: r.ContentLength,
 	}
 
+	// エラーページから大きなファイルとしての取得が依頼された場合は、Earth側にヘッダーで伝える
+	if r.URL.Query().Get("allow_large") == "1" {
+		breq.Headers = r.Header.Clone()
+		breq.Headers[model.LargeTransferHeader] = []string{"1"}
+	}
+
 	log.Printf("[BpHandler] Received request: Method=%s, URL=%s", breq.Method, breq.URL)
 
 	// Service層でリクエストを転送（キャッシュ可能な場合はキャッシュもチェック）
@@ -88,6 +94,7 @@ func (bh *bpHandler) GetContent(c *gin.Context) {
 		http.Error(w, "Failed to proxy request", http.StatusBadGateway)
 		return
 	}
+	defer resp.Close()
 
 	// レスポンスヘッダーをコピー
 	for key, values := range resp.Headers {
@@ -96,17 +103,53 @@ func (bh *bpHandler) GetContent(c *gin.Context) {
 		}
 	}
 
+	// リダイレクト先も?url=経由でこのサーバーに向ける
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if location := w.Header().Get("Location"); location != "" {
+			w.Header().Set("Location", proxyLocation(r.URL.Path, parsedURL, location))
+		}
+	}
+
 	// ステータスコードを設定
 	w.WriteHeader(resp.StatusCode)
 
-	// レスポンスボディをコピー
-	_, err = io.Copy(w, resp.GetBodyReader())
+	// レスポンスボディをコピー（HEADや304などボディが無い場合は書き込まない）
+	bodyReader := resp.GetBodyReader()
+	if bodyReader == nil || r.Method == http.MethodHead {
+		return
+	}
+	_, err = io.Copy(streamWriter(c, resp), bodyReader)
 	if err != nil {
 		http.Error(w, "Failed to copy response body", http.StatusInternalServerError)
 		return
 	}
 }
 
+// streamWriter ボディを書き込む先を返す
+// ファイルから返す場合は、ヘッダーを書き込んだ上でnet/httpのResponseWriterに直接書き込み、sendfileを使えるようにする
+// （ginのResponseWriterはio.ReaderFromを実装していないため）
+func streamWriter(c *gin.Context, resp *model.BpResponse) io.Writer {
+	if resp.BodyStream == nil {
+		return c.Writer
+	}
+	unwrapper, ok := c.Writer.(interface{ Unwrap() http.ResponseWriter })
+	if !ok {
+		return c.Writer
+	}
+	c.Writer.WriteHeaderNow()
+	return unwrapper.Unwrap()
+}
+
+// proxyLocation リダイレクト先のURLを、このサーバーの?url=形式のURLに変換する
+// 相対URLはリクエストしたURLを基準に解決する
+func proxyLocation(path string, base *url.URL, location string) string {
+	target, err := base.Parse(location)
+	if err != nil {
+		return location
+	}
+	return path + "?url=" + url.QueryEscape(target.String())
+}
+
 // handleCONNECT CONNECTメソッドのリクエストを処理（HTTPトンネリング）
 func (bh *bpHandler) handleCONNECT(c *gin.Context) {
 	w := c.Writer
@@ -218,6 +261,8 @@ func (bh *bpHandler) handleCONNECT(c *gin.Context) {
 		resp.Write(tlsConn)
 		return // Hijack後はc.Abort()を呼ばない
 	}
+	// ファイルから読み込むボディは、TLS接続に書き込み終わったら閉じる
+	defer resp.Close()
 
 	// GetBodyReader()がnilを返す可能性を考慮
 	bodyReader := resp.GetBodyReader()
@@ -229,6 +274,7 @@ func (bh *bpHandler) handleCONNECT(c *gin.Context) {
 
 	// レスポンスをクライアント（TLS接続）に書き込む
 	// http.Responseを構築してWriteメソッドで書き込む
+	// HEADの場合はボディを書き込まないよう、元のリクエストを設定する
 	httpResp := &http.Response{
 		StatusCode:    resp.StatusCode,
 		ProtoMajor:    1,
@@ -236,6 +282,7 @@ func (bh *bpHandler) handleCONNECT(c *gin.Context) {
 		Header:        make(http.Header),
 		Body:          bodyCloser,
 		ContentLength: resp.ContentLength,
+		Request:       req,
 	}
 	// ヘッダーをコピー
 	for key, values := range resp.Headers {
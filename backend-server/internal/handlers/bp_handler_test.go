@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/service"
+	bprepository "github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository/plugins"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/middleware"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/middleware/module"
+)
+
+const (
+	streamBytes = 1024
+	bigURL      = "https://example.com/big"
+	smallURL    = "https://example.com/small"
+	missURL     = "https://example.com/miss" // キャッシュに無く、転送先から返す
+	etag        = `"v1"`
+)
+
+var bigBody = strings.Repeat("0123456789abcdef", 4096) // 64KiB
+
+// streamCounter 開いたBodyStreamと閉じたBodyStreamの数
+type streamCounter struct {
+	opened, closed atomic.Int32
+}
+
+// trackedFile Closeを数えるファイル（Rangeに答えられるよう*os.Fileのメソッドをそのまま使う）
+type trackedFile struct {
+	*os.File
+	counter *streamCounter
+}
+
+func (f *trackedFile) Close() error {
+	f.counter.closed.Add(1)
+	return f.File.Close()
+}
+
+// trackedStream Closeを数えるボディ（転送先から返すレスポンス用）
+type trackedStream struct {
+	io.Reader
+	counter *streamCounter
+}
+
+func (s *trackedStream) Close() error {
+	s.counter.closed.Add(1)
+	return nil
+}
+
+// trackingRepository ファイルから読み込むボディの開閉を数えるリポジトリ
+type trackingRepository struct {
+	repository.BpRepository
+	counter     *streamCounter
+	headersMiss bool // ボディを読まないヘッダーの取得をキャッシュミスにする（304をGetResponseから返すため）
+}
+
+func (r *trackingRepository) GetResponse(ctx context.Context, req *model.BpRequest) (*model.BpResponse, bool, error) {
+	resp, found, err := r.BpRepository.GetResponse(ctx, req)
+	if found {
+		if f, ok := resp.BodyStream.(*os.File); ok {
+			r.counter.opened.Add(1)
+			resp.BodyStream = &trackedFile{File: f, counter: r.counter}
+		}
+	}
+	return resp, found, err
+}
+
+func (r *trackingRepository) GetResponseHeaders(ctx context.Context, req *model.BpRequest) (*model.BpResponse, bool, error) {
+	if r.headersMiss {
+		return nil, false, nil
+	}
+	return r.BpRepository.GetResponseHeaders(ctx, req)
+}
+
+// fakeGateway キャッシュできないリクエストに、BodyStreamのあるレスポンスか失敗を返す転送先
+type fakeGateway struct {
+	counter *streamCounter
+}
+
+func (g *fakeGateway) ProxyRequest(ctx context.Context, req *model.BpRequest) (*model.BpResponse, error) {
+	if req.URL != missURL {
+		return nil, errors.New("link down")
+	}
+	g.counter.opened.Add(1)
+	return &model.BpResponse{
+		StatusCode:    200,
+		Headers:       map[string][]string{"Content-Type": {"text/plain"}},
+		ContentLength: int64(len(bigBody)),
+		BodyStream:    &trackedStream{Reader: strings.NewReader(bigBody), counter: g.counter},
+	}, nil
+}
+
+func (g *fakeGateway) GetUnsolicitedResponseCh() <-chan *model.BpResponse {
+	return nil
+}
+
+func newTestHandler(t *testing.T, headersMiss bool, mw *middleware.MiddlewarePlugins) (*bpHandler, *streamCounter) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	client, err := plugins.NewEmbeddedClient(filepath.Join(dir, "store.log"), plugins.RedisClientConfig{
+		ReservedRequestsKey: "bp:reserved:requests",
+		PendingRequestsKey:  "bp:pending:requests",
+		SubscriptionsKey:    "bp:subscriptions",
+		CacheMetaPattern:    "bp:cache:meta:*",
+		CacheAccessKey:      "bp:cache:access",
+		CacheIndexKey:       "bp:cache:index",
+		CachePinsKey:        "bp:cache:pins",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	repo := bprepository.NewBpRepository(client, filepath.Join(dir, "cache"), time.Hour, 0,
+		&model.EvictionPolicy{Mode: model.EvictLRU}, streamBytes, &model.IntegrityPolicy{Verify: model.VerifySize}, "")
+
+	ctx := context.Background()
+	for u, body := range map[string]string{bigURL: bigBody, smallURL: "small"} {
+		resp := &model.BpResponse{
+			StatusCode:  200,
+			Headers:     map[string][]string{"Content-Type": {"text/plain"}, "Etag": {etag}},
+			Body:        []byte(body),
+			ContentType: "text/plain",
+		}
+		if err := repo.SetResponseWithURL(ctx, &model.BpRequest{Method: "GET", URL: u}, resp, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counter := &streamCounter{}
+	tracked := &trackingRepository{BpRepository: repo, counter: counter, headersMiss: headersMiss}
+	svc := service.NewBpService(&fakeGateway{counter: counter}, tracked, dir, "index.html")
+	return NewBpHandler(svc, mw), counter
+}
+
+// failingWriter ボディの書き込みに失敗するResponseWriter（クライアントが切断した場合）
+type failingWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *failingWriter) Header() http.Header         { return w.header }
+func (w *failingWriter) WriteHeader(status int)      { w.status = status }
+func (w *failingWriter) Write(p []byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestGetContentStreamsAndClosesBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		header      http.Header
+		headersMiss bool
+		failWrite   bool
+		wantStatus  int
+		wantBody    string
+		wantOpened  int32
+	}{
+		{name: "small body", method: "GET", url: smallURL, wantStatus: 200, wantBody: "small"},
+		{name: "large body", method: "GET", url: bigURL, wantStatus: 200, wantBody: bigBody, wantOpened: 1},
+		{name: "range", method: "GET", url: bigURL, header: http.Header{"Range": {"bytes=16-31"}}, wantStatus: 206, wantBody: "0123456789abcdef", wantOpened: 1},
+		{name: "range not satisfiable", method: "GET", url: bigURL, header: http.Header{"Range": {"bytes=999999-"}}, wantStatus: 416, wantOpened: 1},
+		{name: "not modified", method: "GET", url: bigURL, header: http.Header{"If-None-Match": {etag}}, headersMiss: true, wantStatus: 304, wantOpened: 1},
+		{name: "head from cache", method: "HEAD", url: bigURL, wantStatus: 200},
+		{name: "head forwarded", method: "HEAD", url: missURL, headersMiss: true, wantStatus: 200, wantOpened: 1},
+		{name: "write error", method: "GET", url: bigURL, failWrite: true, wantStatus: 200, wantOpened: 1},
+		{name: "gateway error", method: "POST", url: "https://example.com/form", wantStatus: http.StatusBadGateway, wantBody: "Failed to proxy request\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, counter := newTestHandler(t, tt.headersMiss, nil)
+
+			var w http.ResponseWriter
+			rec := httptest.NewRecorder()
+			failing := &failingWriter{header: make(http.Header)}
+			if tt.failWrite {
+				w = failing
+			} else {
+				w = rec
+			}
+			r := gin.New()
+			r.NoRoute(h.GetContent)
+			req := httptest.NewRequest(tt.method, "/?url="+url.QueryEscape(tt.url), nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			r.ServeHTTP(w, req)
+
+			status := rec.Code
+			if tt.failWrite {
+				status = failing.status
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if !tt.failWrite && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %d bytes, want %d bytes", rec.Body.Len(), len(tt.wantBody))
+			}
+			if got := counter.opened.Load(); got != tt.wantOpened {
+				t.Errorf("opened %d body streams, want %d", got, tt.wantOpened)
+			}
+			if opened, closed := counter.opened.Load(), counter.closed.Load(); closed != opened {
+				t.Errorf("closed %d of %d body streams", closed, opened)
+			}
+		})
+	}
+}
+
+// writeTestCA SSL Bumpに使うCAの証明書と秘密鍵を書き出す
+func writeTestCA(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crtPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	if err := os.WriteFile(crtPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return crtPath, keyPath, pool
+}
+
+func TestConnectStreamsAndClosesBody(t *testing.T) {
+	crtPath, keyPath, pool := writeTestCA(t, t.TempDir())
+	bump, err := module.NewSSLBumpHandler(crtPath, keyPath, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+		wantOpened int32
+	}{
+		{name: "large body", method: "GET", path: "/big", wantStatus: 200, wantBody: bigBody, wantOpened: 1},
+		{name: "small body", method: "GET", path: "/small", wantStatus: 200, wantBody: "small"},
+		{name: "head forwarded", method: "HEAD", path: "/miss", wantStatus: 200, wantOpened: 1},
+		{name: "gateway error", method: "POST", path: "/form", wantStatus: http.StatusBadGateway, wantBody: "Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, counter := newTestHandler(t, true, middleware.NewMiddlewarePlugins(bump))
+			done := make(chan struct{})
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				defer close(done)
+				h.GetContent(c)
+				c.Abort()
+			})
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			fmt.Fprintf(conn, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+			br := bufio.NewReader(conn)
+			connectResp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+			if err != nil || connectResp.StatusCode != 200 {
+				t.Fatalf("CONNECT = %v, %v", connectResp, err)
+			}
+
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.com", RootCAs: pool})
+			req, _ := http.NewRequest(tt.method, "https://example.com"+tt.path, nil)
+			if err := req.Write(tlsConn); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(tlsConn), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Errorf("response = %d, %d bytes, want %d, %d bytes", resp.StatusCode, len(body), tt.wantStatus, len(tt.wantBody))
+			}
+
+			// ハンドラーが終わるまで待ってから、閉じたBodyStreamを数える
+			tlsConn.Close()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler did not return")
+			}
+			if got := counter.opened.Load(); got != tt.wantOpened {
+				t.Errorf("opened %d body streams, want %d", got, tt.wantOpened)
+			}
+			if opened, closed := counter.opened.Load(), counter.closed.Load(); closed != opened {
+				t.Errorf("closed %d of %d body streams", closed, opened)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/service"
+)
+
+// 一覧APIで1回に返すエントリの数
+const (
+	defaultInventoryLimit = 100
+	maxInventoryLimit     = 1000
+)
+
+type cacheAdminHandler struct {
+	adminService *service.CacheAdminService
+}
+
+func NewCacheAdminHandler(adminService *service.CacheAdminService) *cacheAdminHandler {
+	return &cacheAdminHandler{
+		adminService: adminService,
+	}
+}
+
+// pinRequest 固定APIのリクエストボディ
+type pinRequest struct {
+	Pin string `json:"pin"` // URL（スキームを含む）またはホスト（".example.com" の形式でサブドメインも対象）
+}
+
+// parseCacheFilter クエリパラメータからエントリを絞り込む条件を作成する
+// url, host, prefix, content_type, since, until, min_age, max_age（"1h" などの期間）, min_size, max_size（バイト）
+func parseCacheFilter(c *gin.Context) (*model.CacheFilter, error) {
+	filter, err := model.NewCacheFilter(c.Query("host"), c.Query("since"), c.Query("until"))
+	if err != nil {
+		return nil, err
+	}
+	filter.URL = c.Query("url")
+	filter.Prefix = c.Query("prefix")
+	filter.ContentType = c.Query("content_type")
+
+	// 保存してからの経過時間を保存した時刻の範囲に置き換える
+	now := time.Now()
+	if v := c.Query("max_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_age: %w", err)
+		}
+		if since := now.Add(-d); since.After(filter.Since) {
+			filter.Since = since
+		}
+	}
+	if v := c.Query("min_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_age: %w", err)
+		}
+		if until := now.Add(-d); filter.Until.IsZero() || until.Before(filter.Until) {
+			filter.Until = until
+		}
+	}
+	if filter.MinSize, err = parseQueryInt(c, "min_size"); err != nil {
+		return nil, err
+	}
+	if filter.MaxSize, err = parseQueryInt(c, "max_size"); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func parseQueryInt(c *gin.Context, name string) (int64, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return n, nil
+}
+
+// List 条件に一致するエントリをURL順に返す（?offset=と?limit=でページを指定）
+func (ah *cacheAdminHandler) List(c *gin.Context) {
+	filter, err := parseCacheFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "message": err.Error()})
+		return
+	}
+	offset, err := parseQueryInt(c, "offset")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset", "message": err.Error()})
+		return
+	}
+	limit, err := parseQueryInt(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit", "message": err.Error()})
+		return
+	}
+	if limit == 0 {
+		limit = defaultInventoryLimit
+	}
+	limit = min(limit, maxInventoryLimit)
+
+	page, err := ah.adminService.List(c.Request.Context(), filter, int(offset), int(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list cache entries", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// Hosts ホストごとの統計を返す
+func (ah *cacheAdminHandler) Hosts(c *gin.Context) {
+	stats, err := ah.adminService.HostStats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get host statistics", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hosts": stats})
+}
+
+// Get IDで指定したエントリのメタデータとヘッダーを返す
+func (ah *cacheAdminHandler) Get(c *gin.Context) {
+	entry, found, err := ah.adminService.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cache entry", "message": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cache entry not found"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// Delete 条件に一致するエントリを削除する（url・host・prefixなどの条件が必要）
+func (ah *cacheAdminHandler) Delete(c *gin.Context) {
+	filter, err := parseCacheFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "message": err.Error()})
+		return
+	}
+	count, err := ah.adminService.Delete(c.Request.Context(), filter)
+	if err != nil {
+		ah.respondError(c, "Failed to delete cache entries", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cache entries deleted", "count": count})
+}
+
+// Refresh 条件に一致するエントリの再取得を予約する（url・host・prefixなどの条件が必要）
+func (ah *cacheAdminHandler) Refresh(c *gin.Context) {
+	filter, err := parseCacheFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter", "message": err.Error()})
+		return
+	}
+	count, err := ah.adminService.Refresh(c.Request.Context(), filter)
+	if err != nil {
+		ah.respondError(c, "Failed to refresh cache entries", err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Refresh requested", "count": count})
+}
+
+// Pins 管理APIで固定したURL・ホストを返す
+func (ah *cacheAdminHandler) Pins(c *gin.Context) {
+	pins, err := ah.adminService.Pins(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list pins", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pins": pins})
+}
+
+// Pin URLまたはホストを固定する
+func (ah *cacheAdminHandler) Pin(c *gin.Context) {
+	var req pinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "message": err.Error()})
+		return
+	}
+	if err := ah.adminService.Pin(c.Request.Context(), req.Pin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to pin", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Pinned", "pin": req.Pin})
+}
+
+// Unpin 固定したURLまたはホストを外す（?pin=で指定）
+func (ah *cacheAdminHandler) Unpin(c *gin.Context) {
+	pin := c.Query("pin")
+	if err := ah.adminService.Unpin(c.Request.Context(), pin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to unpin", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unpinned", "pin": pin})
+}
+
+// Scrub すべてのエントリのファイルの大きさとハッシュを確認し、一致しないエントリを隔離する
+func (ah *cacheAdminHandler) Scrub(c *gin.Context) {
+	result, err := ah.adminService.Scrub(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scrub cache", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Quarantine 隔離したエントリを返す
+func (ah *cacheAdminHandler) Quarantine(c *gin.Context) {
+	entries, err := ah.adminService.Quarantine(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list quarantined entries", "message": err.Error()})
+		return
+	}
+	if entries == nil {
+		entries = []*model.QuarantinedEntry{}
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// Repair 隔離したエントリのURLの再取得を予約する
+func (ah *cacheAdminHandler) Repair(c *gin.Context) {
+	count, err := ah.adminService.Repair(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to repair cache", "message": err.Error(), "count": count})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Refresh requested", "count": count})
+}
+
+// respondError 条件が指定されていない場合は400、それ以外は500を返す
+func (ah *cacheAdminHandler) respondError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, service.ErrEmptyCacheFilter) {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "message": err.Error()})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/service"
+)
+
+type cacheArchiveHandler struct {
+	archiveService *service.CacheArchiveService
+}
+
+func NewCacheArchiveHandler(archiveService *service.CacheArchiveService) *cacheArchiveHandler {
+	return &cacheArchiveHandler{
+		archiveService: archiveService,
+	}
+}
+
+// Export キャッシュをWARCファイルとして返す
+// ?host=で対象のホスト、?since=と?until=で保存日時の範囲（RFC3339またはYYYY-MM-DD）などを絞り込み（一覧APIと同じ条件）、?gzip=trueで圧縮する
+func (ah *cacheArchiveHandler) Export(c *gin.Context) {
+	filter, err := parseCacheFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid filter",
+			"message": err.Error(),
+		})
+		return
+	}
+	compress := c.Query("gzip") == "true"
+
+	name := fmt.Sprintf("space-cache-%s.warc", time.Now().UTC().Format("20060102T150405Z"))
+	if compress {
+		name += ".gz"
+	}
+	c.Header("Content-Type", "application/warc")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Status(http.StatusOK)
+
+	// 書き出しを始めた後はステータスを変えられないため、失敗はログにだけ残す
+	if _, err := ah.archiveService.Export(c.Request.Context(), filter, c.Writer, compress); err != nil {
+		log.Printf("[CacheArchiveHandler] Failed to export cache: %v", err)
+	}
+}
+
+// Import リクエストボディのWARCファイル（.warc.gzも可）をキャッシュに取り込む
+func (ah *cacheArchiveHandler) Import(c *gin.Context) {
+	result, err := ah.archiveService.Import(c.Request.Context(), c.Request.Body)
+	if err != nil {
+		body := gin.H{
+			"error":   "Failed to import cache",
+			"message": err.Error(),
+		}
+		if result != nil {
+			body["imported"] = result.Imported
+			body["skipped"] = result.Skipped
+		}
+		c.JSON(http.StatusBadRequest, body)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/service"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/utils"
+)
+
+// manifestPageFile マニフェストのページのファイル名（defaultDir内）
+const manifestPageFile = "manifest.html"
+
+type manifestHandler struct {
+	manifestService *service.ManifestService
+	defaultDir      string
+}
+
+func NewManifestHandler(manifestService *service.ManifestService, defaultDir string) *manifestHandler {
+	return &manifestHandler{
+		manifestService: manifestService,
+		defaultDir:      defaultDir,
+	}
+}
+
+// manifestRequest マニフェスト要求APIのリクエストボディ
+type manifestRequest struct {
+	URL     string `json:"url"`
+	Refresh bool   `json:"refresh"` // 保存済みのマニフェストがあっても再要求する
+}
+
+// batchRequest まとめての取得APIのリクエストボディ
+type batchRequest struct {
+	URL  string   `json:"url"`  // マニフェストのページのURL
+	URLs []string `json:"urls"` // 選んだ項目のURL
+}
+
+// Page マニフェストのページを返す
+func (mh *manifestHandler) Page(c *gin.Context) {
+	html, err := utils.LoadDefaultPage(filepath.Join(mh.defaultDir, manifestPageFile))
+	if err != nil {
+		log.Printf("[ManifestHandler] Failed to load manifest page: %v", err)
+		c.String(http.StatusInternalServerError, "Failed to load manifest page")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+}
+
+// Get 保存されているマニフェストを返す（?url=で対象を指定）
+func (mh *manifestHandler) Get(c *gin.Context) {
+	url := c.Query("url")
+	if url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url parameter is required"})
+		return
+	}
+
+	rec, found, err := mh.manifestService.Get(c.Request.Context(), url)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get manifest",
+			"message": err.Error(),
+		})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "manifest not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rec)
+}
+
+// Request Earth側にマニフェストを要求する
+func (mh *manifestHandler) Request(c *gin.Context) {
+	var req manifestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	rec, err := mh.manifestService.Request(c.Request.Context(), req.URL, req.Refresh)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to request manifest",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, rec)
+}
+
+// Batch 選んだ項目をEarth側にまとめて要求する
+func (mh *manifestHandler) Batch(c *gin.Context) {
+	var req batchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	count, err := mh.manifestService.RequestBatch(c.Request.Context(), req.URL, req.URLs)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Failed to request batch",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Batch requested", "count": count})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/service"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/utils"
+)
+
+// subscriptionPageFile 購読管理ページのファイル名（defaultDir内）
+const subscriptionPageFile = "subscriptions.html"
+
+type subscriptionHandler struct {
+	subscriptionService *service.SubscriptionService
+	defaultDir          string
+}
+
+func NewSubscriptionHandler(subscriptionService *service.SubscriptionService, defaultDir string) *subscriptionHandler {
+	return &subscriptionHandler{
+		subscriptionService: subscriptionService,
+		defaultDir:          defaultDir,
+	}
+}
+
+// subscriptionRequest 購読登録APIのリクエストボディ
+type subscriptionRequest struct {
+	URL      string `json:"url"`
+	Interval string `json:"interval"` // "30m", "6h" などの形式
+	Depth    int    `json:"depth"`
+}
+
+// subscriptionView APIで返す購読の表現（間隔を文字列で返す）
+type subscriptionView struct {
+	URL       string    `json:"url"`
+	Interval  string    `json:"interval"`
+	Depth     int       `json:"depth"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newSubscriptionView(sub *model.Subscription) subscriptionView {
+	return subscriptionView{
+		URL:       sub.URL,
+		Interval:  sub.Interval.String(),
+		Depth:     sub.Depth,
+		Status:    sub.Status,
+		CreatedAt: sub.CreatedAt,
+		UpdatedAt: sub.UpdatedAt,
+	}
+}
+
+// Page 購読管理ページを返す
+func (sh *subscriptionHandler) Page(c *gin.Context) {
+	html, err := utils.LoadDefaultPage(filepath.Join(sh.defaultDir, subscriptionPageFile))
+	if err != nil {
+		log.Printf("[SubscriptionHandler] Failed to load subscription page: %v", err)
+		c.String(http.StatusInternalServerError, "Failed to load subscription page")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+}
+
+// List 購読の一覧を返す
+func (sh *subscriptionHandler) List(c *gin.Context) {
+	subs, err := sh.subscriptionService.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list subscriptions",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	views := make([]subscriptionView, 0, len(subs))
+	for _, sub := range subs {
+		views = append(views, newSubscriptionView(sub))
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": views})
+}
+
+// Subscribe 購読を登録する（同じURLの場合は間隔と深さを更新する）
+func (sh *subscriptionHandler) Subscribe(c *gin.Context) {
+	var req subscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+		return
+	}
+	interval, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid interval",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	sub, err := sh.subscriptionService.Subscribe(c.Request.Context(), req.URL, interval, req.Depth)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to subscribe",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, newSubscriptionView(sub))
+}
+
+// Unsubscribe 購読を解除する（?url=で対象を指定）
+func (sh *subscriptionHandler) Unsubscribe(c *gin.Context) {
+	url := c.Query("url")
+	if url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url parameter is required"})
+		return
+	}
+
+	if err := sh.subscriptionService.Unsubscribe(c.Request.Context(), url); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Failed to unsubscribe",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed successfully"})
+}
@@ -2,91 +2,275 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
 )
 
+// metaRetention 猶予期間を過ぎたエントリのファイルをクリーンアップが削除できるよう、メタデータを余分に残す時間
+const metaRetention = 24 * time.Hour
+
 type BpRepository struct {
-	client   BpRepoClient
-	cacheDir string
+	client       BpRepoClient
+	cacheDir     string
+	maxStale     time.Duration // 期限切れのエントリを返し続ける猶予期間
+	minFreeBytes int64         // ディスクの空き容量がこれを下回ったら、猶予期間内でも期限切れのエントリを削除する（0は無効）
+	eviction     *model.EvictionPolicy
+	streamBytes  int64 // ボディがこれ以上の大きさの場合は、メモリに読み込まずにファイルから返す
+	integrity    *model.IntegrityPolicy
+	quarantine   string // 整合性の確認に失敗したファイルを移すディレクトリ
 }
 
-func NewBpRepository(client BpRepoClient, cacheDir string) *BpRepository {
+func NewBpRepository(client BpRepoClient, cacheDir string, maxStale time.Duration, minFreeBytes int64, eviction *model.EvictionPolicy, streamBytes int64, integrity *model.IntegrityPolicy, quarantineDir string) *BpRepository {
 	// キャッシュディレクトリが存在しない場合は作成
 	_ = os.MkdirAll(cacheDir, 0755)
 
 	return &BpRepository{
-		client:   client,
-		cacheDir: cacheDir,
+		client:       client,
+		cacheDir:     cacheDir,
+		maxStale:     maxStale,
+		minFreeBytes: minFreeBytes,
+		eviction:     eviction,
+		streamBytes:  streamBytes,
+		integrity:    integrity,
+		quarantine:   quarantineDir,
 	}
 }
 
 // GetResponse キャッシュからレスポンスを取得
-func (br *BpRepository) GetResponse(ctx context.Context, cacheKey string) (*model.BpResponse, bool, error) {
-	// Redisからメタデータを取得
-	metaKey := _getMetaKey(cacheKey)
-	metaData, err := br.client.GetMetaData(ctx, metaKey)
-	if err != nil {
-		return nil, false, nil // キャッシュミス
+// 有効期限を過ぎても猶予期間内であれば、Staleとしてレスポンスを返す（DTNでは古い内容でも無いよりよい）
+// ボディがstreamBytes以上の場合は、開いたファイルをBodyStreamとして返す（呼び出し側でCloseする）
+// ファイルが保存したボディと一致しない場合は、エントリを隔離してキャッシュミスとする
+func (br *BpRepository) GetResponse(ctx context.Context, req *model.BpRequest) (*model.BpResponse, bool, error) {
+	metaKey, metadata, found := br._getMetadata(ctx, req)
+	if !found {
+		return nil, false, nil
 	}
 
-	// メタデータが空の場合はキャッシュミス
-	if len(metaData) == 0 {
+	// ファイルシステムからボディを開く
+	file, err := os.Open(metadata.FilePath)
+	if err != nil {
+		// ファイルが存在しない場合はRedisからも削除（アクセス時のクリア）
+		if os.IsNotExist(err) {
+			br._deleteEntry(ctx, metaKey, metadata)
+		}
 		return nil, false, nil
 	}
-
-	// メタデータをデコード
-	var metadata model.CacheMetadata
-	err = json.Unmarshal(metaData, &metadata)
+	info, err := file.Stat()
 	if err != nil {
-		// JSONデコードエラーの場合はキャッシュミスとして扱う（破損したキャッシュ）
-		log.Printf("[BpRepository] GetResponse JSONデコードエラー: %v, metaKey=%s", err, metaKey)
+		file.Close()
+		return nil, false, nil
+	}
+	if err := br._verifyFile(file, info.Size(), metadata, br.integrity.ShouldHash()); err != nil {
+		file.Close()
+		br._quarantineEntry(ctx, metaKey, metadata, err)
 		return nil, false, nil
 	}
 
-	// 有効期限チェック
-	if metadata.IsExpired() {
-		// TTLが切れている場合は削除
-		_ = os.Remove(metadata.FilePath)
-		metaKey := _getMetaKey(cacheKey)
-		_ = br.client.DeleteMetaData(ctx, metaKey)
+	// BpResponseを構築
+	response := &model.BpResponse{
+		StatusCode:    metadata.StatusCode,
+		Headers:       metadata.ResponseHeaders(),
+		ContentType:   metadata.ContentType,
+		ContentLength: info.Size(),
+		Stale:         metadata.IsExpired(),
+	}
+	if br.streamBytes > 0 && info.Size() >= br.streamBytes {
+		response.BodyStream = file
+	} else {
+		// 小さいボディはメモリに読み込む
+		response.Body, err = io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, false, nil
+		}
+	}
+
+	br._recordAccess(ctx, metaKey)
+	return response, true, nil
+}
+
+// GetResponseHeaders キャッシュからボディを読み込まずにレスポンスのステータスとヘッダーを取得
+// ContentLengthには保存したボディの大きさを設定する（HEADや304に答えるため）
+func (br *BpRepository) GetResponseHeaders(ctx context.Context, req *model.BpRequest) (*model.BpResponse, bool, error) {
+	metaKey, metadata, found := br._getMetadata(ctx, req)
+	if !found {
 		return nil, false, nil
 	}
 
-	// ファイルシステムからボディを読み込む
-	body, err := os.ReadFile(metadata.FilePath)
+	info, err := os.Stat(metadata.FilePath)
 	if err != nil {
-		// ファイルが存在しない場合はRedisからも削除（アクセス時のクリア）
 		if os.IsNotExist(err) {
-			metaKey := _getMetaKey(cacheKey)
-			_ = br.client.DeleteMetaData(ctx, metaKey)
+			br._deleteEntry(ctx, metaKey, metadata)
 		}
 		return nil, false, nil
 	}
+	// ボディを読み込まないため、大きさだけを確認する
+	if err := metadata.VerifySize(info.Size()); err != nil {
+		br._quarantineEntry(ctx, metaKey, metadata, err)
+		return nil, false, nil
+	}
+
+	br._recordAccess(ctx, metaKey)
 
-	// BpResponseを構築
 	return &model.BpResponse{
 		StatusCode:    metadata.StatusCode,
-		Headers:       metadata.Headers,
-		Body:          body,
+		Headers:       metadata.ResponseHeaders(),
 		ContentType:   metadata.ContentType,
-		ContentLength: metadata.ContentLength,
+		ContentLength: info.Size(),
+		Stale:         metadata.IsExpired(),
 	}, true, nil
 }
 
+// _getMetadata リクエストに一致するバリアントのメタデータを取得する
+// 猶予期間も過ぎたエントリは削除してキャッシュミスとする
+func (br *BpRepository) _getMetadata(ctx context.Context, req *model.BpRequest) (string, *model.CacheMetadata, bool) {
+	// Redisからメタデータを取得（Varyに従ってリクエストに一致するバリアントを選ぶ）
+	metaKey := _getMetaKey(br._lookupKey(ctx, req))
+	metaData, err := br.client.GetMetaData(ctx, metaKey)
+	if err != nil {
+		return "", nil, false // キャッシュミス
+	}
+
+	// メタデータが空の場合はキャッシュミス
+	if len(metaData) == 0 {
+		return "", nil, false
+	}
+
+	// メタデータをデコード
+	var metadata model.CacheMetadata
+	err = json.Unmarshal(metaData, &metadata)
+	if err != nil {
+		// JSONデコードエラーの場合はキャッシュミスとして扱う（破損したキャッシュ）
+		log.Printf("[BpRepository] GetResponse JSONデコードエラー: %v, metaKey=%s", err, metaKey)
+		return "", nil, false
+	}
+
+	// 有効期限チェック
+	if metadata.IsExpired() && !metadata.CanServeStale() {
+		// 猶予期間も過ぎている場合は削除
+		br._deleteEntry(ctx, metaKey, &metadata)
+		return "", nil, false
+	}
+	return metaKey, &metadata, true
+}
+
+// _recordAccess 容量を超えた場合に削除するエントリを選ぶため、キャッシュから返したことを記録する
+func (br *BpRepository) _recordAccess(ctx context.Context, metaKey string) {
+	if err := br.client.RecordAccess(ctx, metaKey, time.Now()); err != nil {
+		log.Printf("[BpRepository] アクセスの記録に失敗しました: %v, metaKey=%s", err, metaKey)
+	}
+}
+
 // SetResponseWithURL レスポンスをキャッシュに保存（URL指定版）
 // BpRequestからキャッシュパス情報を生成してURLベースの階層構造でキャッシュを保存します
 func (br *BpRepository) SetResponseWithURL(ctx context.Context, req *model.BpRequest, response *model.BpResponse, ttl time.Duration) error {
+	// ファイルシステムにボディを保存
+	vary := response.Vary()
+	filePath, err := br._writeBody(req, response, vary)
+	if err != nil {
+		return err
+	}
+
+	// メタデータを作成
+	metaData, err := br._encodeMetadata(filePath, req, response, ttl)
+	if err != nil {
+		// ファイルは保存済みなので削除
+		_ = os.Remove(filePath)
+		return err
+	}
+	varyItem, err := br._varyItem(req, vary, ttl)
+	if err != nil {
+		_ = os.Remove(filePath)
+		return err
+	}
+
+	// Redisにメタデータとバリアントの選び方を保存（期限切れのエントリを返せるよう、猶予期間の分だけ長く保存する）
+	cacheKey := req.VariantCacheKey(vary)
+	err = br.client.SetMetaDataBatch(ctx, []MetaItem{
+		{Key: _getMetaKey(cacheKey), Data: metaData, TTL: br._metaTTL(ttl), Host: model.CacheHost(req.URL), URL: req.URL},
+		varyItem,
+	})
+	if err != nil {
+		// Redis保存に失敗した場合はファイルも削除
+		_ = os.Remove(filePath)
+		return err
+	}
+
+	return nil
+}
+
+// SetResponses 複数のレスポンスをまとめてキャッシュに保存する
+// ファイルをすべて書き込んでからメタデータをまとめて保存し、途中で失敗した場合は書き込んだファイルを削除する
+func (br *BpRepository) SetResponses(ctx context.Context, entries []model.CacheEntry) error {
+	var filePaths []string
+	rollback := func() {
+		for _, filePath := range filePaths {
+			_ = os.Remove(filePath)
+		}
+	}
+
+	items := make([]MetaItem, 0, len(entries)*2)
+	for _, entry := range entries {
+		vary := entry.Response.Vary()
+		filePath, err := br._writeBody(entry.Request, entry.Response, vary)
+		if err != nil {
+			rollback()
+			return fmt.Errorf("cache entry %s: %w", entry.Request.URL, err)
+		}
+		filePaths = append(filePaths, filePath)
+
+		metaData, err := br._encodeMetadata(filePath, entry.Request, entry.Response, entry.TTL)
+		if err != nil {
+			rollback()
+			return fmt.Errorf("cache entry %s: %w", entry.Request.URL, err)
+		}
+		varyItem, err := br._varyItem(entry.Request, vary, entry.TTL)
+		if err != nil {
+			rollback()
+			return fmt.Errorf("cache entry %s: %w", entry.Request.URL, err)
+		}
+		items = append(items, MetaItem{
+			Key:  _getMetaKey(entry.Request.VariantCacheKey(vary)),
+			Data: metaData,
+			TTL:  br._metaTTL(entry.TTL),
+			Host: model.CacheHost(entry.Request.URL),
+			URL:  entry.Request.URL,
+		}, varyItem)
+	}
+
+	if err := br.client.SetMetaDataBatch(ctx, items); err != nil {
+		rollback()
+		return err
+	}
+
+	return nil
+}
+
+// _writeBody レスポンスボディをURLベースの階層構造でファイルに保存し、ファイルパスを返す
+func (br *BpRepository) _writeBody(req *model.BpRequest, response *model.BpResponse, vary []string) (string, error) {
 	// domain層のロジックを使用してキャッシュパス情報を生成
-	pathInfo, err := req.GenerateCachePathInfo(response.ContentType)
+	// リダイレクトはリダイレクト先のページと同じパスにならないよう、キャッシュキーのハッシュで保存する
+	var pathInfo *model.CachePathInfo
+	var err error
+	if response.IsRedirect() {
+		pathInfo, err = req.GenerateRedirectPathInfo(vary)
+	} else {
+		pathInfo, err = req.GenerateCachePathInfo(response.ContentType, vary)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to generate cache path info: %w", err)
+		return "", fmt.Errorf("failed to generate cache path info: %w", err)
 	}
 
 	// ファイルパスを構築
@@ -100,46 +284,99 @@ func (br *BpRepository) SetResponseWithURL(ctx context.Context, req *model.BpReq
 	dir := filepath.Dir(filePath)
 	err = os.MkdirAll(dir, 0755)
 	if err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	// ファイルシステムにボディを保存
-	err = os.WriteFile(filePath, response.Body, 0644)
+	// 一時ファイルに書き込んでから置き換え、読み込み中のファイルが途中まで書き換わらないようにする
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write cache file: %w", err)
+	}
+	_, err = tmp.Write(response.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filePath)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
+		_ = os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write cache file: %w", err)
 	}
 
-	// メタデータを作成
+	return filePath, nil
+}
+
+// _encodeMetadata キャッシュのメタデータを作成してJSONにエンコードする
+func (br *BpRepository) _encodeMetadata(filePath string, req *model.BpRequest, response *model.BpResponse, ttl time.Duration) ([]byte, error) {
 	now := time.Now()
+	vary := response.Vary()
+	var requestHeaders map[string][]string
+	for _, name := range vary {
+		if values := http.Header(req.Headers).Values(name); values != nil {
+			if requestHeaders == nil {
+				requestHeaders = make(map[string][]string)
+			}
+			requestHeaders[name] = values
+		}
+	}
 	metadata := model.CacheMetadata{
-		FilePath:      filePath,
-		StatusCode:    response.StatusCode,
-		Headers:       response.Headers,
-		ContentType:   response.ContentType,
-		ContentLength: response.ContentLength,
-		CreatedAt:     now,
-		ExpiresAt:     now.Add(ttl),
+		FilePath:       filePath,
+		URL:            req.URL,
+		Vary:           vary,
+		RequestHeaders: requestHeaders,
+		StatusCode:     response.StatusCode,
+		Headers:        response.Headers,
+		ContentType:    response.ContentType,
+		ContentLength:  response.ContentLength,
+		Size:           int64(len(response.Body)),
+		SHA256:         model.BodySHA256(response.Body),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+		StaleUntil:     now.Add(ttl + br.maxStale),
 	}
+	return json.Marshal(metadata)
+}
 
-	// メタデータをJSONにエンコード
-	metaData, err := json.Marshal(metadata)
-	if err != nil {
-		// ファイルは保存済みなので削除
-		_ = os.Remove(filePath)
-		return err
+// _metaTTL メタデータをRedisに保存する期間
+func (br *BpRepository) _metaTTL(ttl time.Duration) time.Duration {
+	return ttl + br.maxStale + metaRetention
+}
+
+// _lookupKey リクエストに一致するバリアントのキャッシュキーを返す
+// URLに対して保存されているVaryが無い場合は主キーを返す
+func (br *BpRepository) _lookupKey(ctx context.Context, req *model.BpRequest) string {
+	primary := req.GenerateCacheKey()
+	data, err := br.client.GetMetaData(ctx, _getVaryKey(primary))
+	if err != nil || len(data) == 0 {
+		return primary
+	}
+	var vary []string
+	if err := json.Unmarshal(data, &vary); err != nil {
+		return primary
 	}
+	return req.VariantCacheKey(vary)
+}
 
-	// Redisにメタデータを保存（TTL付き）
-	cacheKey := req.GenerateCacheKey()
-	metaKey := _getMetaKey(cacheKey)
-	err = br.client.SetMetaData(ctx, metaKey, metaData, ttl)
+// _varyItem URLに対してレスポンスのVaryを保存するメタデータを作成する
+// Varyが無いレスポンスでも保存し、以前のレスポンスのVaryを上書きする
+func (br *BpRepository) _varyItem(req *model.BpRequest, vary []string, ttl time.Duration) (MetaItem, error) {
+	if vary == nil {
+		vary = []string{}
+	}
+	data, err := json.Marshal(vary)
 	if err != nil {
-		// Redis保存に失敗した場合はファイルも削除
-		_ = os.Remove(filePath)
-		return err
+		return MetaItem{}, err
 	}
+	return MetaItem{Key: _getVaryKey(req.GenerateCacheKey()), Data: data, TTL: br._metaTTL(ttl)}, nil
+}
 
-	return nil
+// _getVaryKey URLに対して保存されているレスポンスのVaryのRedisキーを生成（主キー単位）
+func _getVaryKey(primaryKey string) string {
+	return "bp:vary:" + strings.TrimPrefix(primaryKey, "bp:cache:")
 }
 
 // _getMetaKey メタデータ用のRedisキーを生成
@@ -147,6 +384,130 @@ func _getMetaKey(cacheKey string) string {
 	return fmt.Sprintf("bp:cache:meta:%s", cacheKey)
 }
 
+// entryIDPrefix メタデータのキーのうち、管理APIのエントリのIDに含めない部分
+const entryIDPrefix = "bp:cache:meta:bp:cache:"
+
+// _entryID メタデータのキーから管理APIのエントリのID（キャッシュキーのハッシュ）を求める
+func _entryID(metaKey string) string {
+	return strings.TrimPrefix(metaKey, entryIDPrefix)
+}
+
+// _metaKeyFromID 管理APIのエントリのIDからメタデータのキーを求める（IDの形式が正しくない場合はfalse）
+func _metaKeyFromID(id string) (string, bool) {
+	if len(id) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", false
+	}
+	return entryIDPrefix + id, true
+}
+
+// _deleteEntry エントリのファイル・メタデータ・インデックスを削除する
+func (br *BpRepository) _deleteEntry(ctx context.Context, metaKey string, metadata *model.CacheMetadata) {
+	if metadata.FilePath != "" {
+		_ = os.Remove(metadata.FilePath)
+	}
+	br._deleteMetadata(ctx, metaKey, metadata)
+}
+
+// _deleteMetadata エントリのメタデータとインデックスだけを削除する（ファイルは残す）
+func (br *BpRepository) _deleteMetadata(ctx context.Context, metaKey string, metadata *model.CacheMetadata) {
+	_ = br.client.DeleteMetaData(ctx, metaKey)
+	if host := model.CacheHost(metadata.URL); host != "" {
+		if err := br.client.RemoveFromIndex(ctx, host, []string{metaKey}); err != nil {
+			log.Printf("[BpRepository] インデックスからの削除に失敗しました: %v, metaKey=%s", err, metaKey)
+		}
+	}
+}
+
+// _getErrorKey 取得失敗の理由を保存するRedisキーを生成（キャッシュキーではなくURL単位）
+func _getErrorKey(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return "bp:error:" + hex.EncodeToString(hash[:])
+}
+
+// SetFetchError Earth側で取得に失敗した理由を保存する（TTLが切れるとRedisから自動的に消える）
+func (br *BpRepository) SetFetchError(ctx context.Context, fetchErr *model.EarthError, ttl time.Duration) error {
+	data, err := json.Marshal(fetchErr)
+	if err != nil {
+		return err
+	}
+	return br.client.SetMetaData(ctx, _getErrorKey(fetchErr.URL), data, ttl)
+}
+
+// GetFetchError URLに対して保存されている取得失敗の理由を取得する
+func (br *BpRepository) GetFetchError(ctx context.Context, url string) (*model.EarthError, bool, error) {
+	data, err := br.client.GetMetaData(ctx, _getErrorKey(url))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+
+	var fetchErr model.EarthError
+	if err := json.Unmarshal(data, &fetchErr); err != nil {
+		return nil, false, nil
+	}
+	return &fetchErr, true, nil
+}
+
+// HasResponse 有効なキャッシュが存在するか確認する（ボディは読み込まない）
+func (br *BpRepository) HasResponse(ctx context.Context, req *model.BpRequest) (bool, error) {
+	metaData, err := br.client.GetMetaData(ctx, _getMetaKey(br._lookupKey(ctx, req)))
+	if err != nil {
+		return false, err
+	}
+	if len(metaData) == 0 {
+		return false, nil
+	}
+
+	var metadata model.CacheMetadata
+	if err := json.Unmarshal(metaData, &metadata); err != nil {
+		return false, nil
+	}
+	if metadata.IsExpired() {
+		return false, nil
+	}
+	if _, err := os.Stat(metadata.FilePath); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// _getManifestKey マニフェストの取得状況を保存するRedisキーを生成（URL単位）
+func _getManifestKey(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return "bp:manifest:" + hex.EncodeToString(hash[:])
+}
+
+// SaveManifest ページのマニフェストの取得状況を保存する（TTLが切れるとRedisから自動的に消える）
+func (br *BpRepository) SaveManifest(ctx context.Context, rec *model.ManifestRecord, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return br.client.SetMetaData(ctx, _getManifestKey(rec.URL), data, ttl)
+}
+
+// GetManifest URLに対して保存されているマニフェストの取得状況を取得する
+func (br *BpRepository) GetManifest(ctx context.Context, url string) (*model.ManifestRecord, bool, error) {
+	data, err := br.client.GetMetaData(ctx, _getManifestKey(url))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+
+	var rec model.ManifestRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, false, nil
+	}
+	return &rec, true, nil
+}
+
 // DeleteExpiredCaches 期限切れキャッシュを削除する
 func (br *BpRepository) DeleteExpiredCaches(ctx context.Context) error {
 	items, err := br.client.ScanExpiredKeys(ctx)
@@ -164,9 +525,408 @@ func (br *BpRepository) DeleteExpiredCaches(ctx context.Context) error {
 		_ = br.client.DeleteMetaData(ctx, item.Key)
 	}
 
+	return br._deleteStaleCaches(ctx)
+}
+
+// _deleteStaleCaches 期限切れのエントリを削除する
+// 猶予期間を過ぎたものは常に、猶予期間内のものはディスクの空き容量が不足している場合にだけ、期限の古い順に削除する
+func (br *BpRepository) _deleteStaleCaches(ctx context.Context) error {
+	items, err := br.client.ScanMetaData(ctx)
+	if err != nil {
+		return err
+	}
+
+	type staleEntry struct {
+		key      string
+		metadata model.CacheMetadata
+	}
+	var stale []staleEntry
+	for _, item := range items {
+		var metadata model.CacheMetadata
+		if err := json.Unmarshal(item.Data, &metadata); err != nil || !metadata.IsExpired() {
+			continue
+		}
+		if !metadata.CanServeStale() {
+			br._deleteEntry(ctx, item.Key, &metadata)
+			continue
+		}
+		stale = append(stale, staleEntry{key: item.Key, metadata: metadata})
+	}
+	if br.minFreeBytes <= 0 || len(stale) == 0 {
+		return nil
+	}
+
+	free, err := _diskFreeBytes(br.cacheDir)
+	if err != nil {
+		log.Printf("[BpRepository] ディスクの空き容量を取得できません: %v", err)
+		return nil
+	}
+	if free >= br.minFreeBytes {
+		return nil
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].metadata.ExpiresAt.Before(stale[j].metadata.ExpiresAt) })
+	removed := 0
+	for _, entry := range stale {
+		if free >= br.minFreeBytes {
+			break
+		}
+		if info, err := os.Stat(entry.metadata.FilePath); err == nil {
+			free += info.Size()
+		}
+		br._deleteEntry(ctx, entry.key, &entry.metadata)
+		removed++
+	}
+	log.Printf("[BpRepository] ディスクの空き容量が不足しているため、期限切れのキャッシュを%d件削除しました", removed)
+	return nil
+}
+
+// EvictCaches キャッシュのファイルの合計サイズが上限を超えている場合、上限に収まるまでエントリを削除する
+// 期限切れのエントリから順に、LRUまたはLFUで選んで削除する（設定と管理APIで固定されたURL・ホストは削除しない）
+func (br *BpRepository) EvictCaches(ctx context.Context) error {
+	if br.eviction == nil || br.eviction.MaxBytes <= 0 {
+		return nil
+	}
+	policy, err := br._evictionPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	items, err := br.client.ScanMetaData(ctx)
+	if err != nil {
+		return err
+	}
+	stats, err := br.client.GetAccessStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	type cacheEntry struct {
+		key      string
+		metadata model.CacheMetadata
+		access   model.CacheAccess
+		size     int64
+	}
+	var total int64
+	var candidates []cacheEntry
+	seen := make(map[string]bool)
+	for _, item := range items {
+		var metadata model.CacheMetadata
+		if err := json.Unmarshal(item.Data, &metadata); err != nil || metadata.FilePath == "" {
+			continue
+		}
+		info, err := os.Stat(metadata.FilePath)
+		if err != nil {
+			continue
+		}
+		// 同じファイルを指すエントリ（リダイレクトの経路など）は一度だけ数える
+		size := info.Size()
+		if seen[metadata.FilePath] {
+			size = 0
+		}
+		seen[metadata.FilePath] = true
+		total += size
+
+		if policy.IsPinned(metadata.URL) {
+			continue
+		}
+		access, ok := stats[item.Key]
+		if !ok || access.LastAccess.IsZero() {
+			access.LastAccess = metadata.CreatedAt
+		}
+		candidates = append(candidates, cacheEntry{key: item.Key, metadata: metadata, access: access, size: size})
+	}
+	if total <= br.eviction.MaxBytes {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return policy.Before(&candidates[i].metadata, &candidates[j].metadata, candidates[i].access, candidates[j].access)
+	})
+	before := total
+	removed := 0
+	for _, entry := range candidates {
+		if total <= br.eviction.MaxBytes {
+			break
+		}
+		br._deleteEntry(ctx, entry.key, &entry.metadata)
+		total -= entry.size
+		removed++
+	}
+	log.Printf("[BpRepository] キャッシュの容量が上限を超えているため、%d件削除しました (%d -> %d bytes, 上限 %d bytes, %s)",
+		removed, before, total, br.eviction.MaxBytes, br.eviction.Mode)
+	if total > br.eviction.MaxBytes {
+		log.Printf("[BpRepository] 固定されたエントリだけで上限を超えています (%d bytes)", total)
+	}
 	return nil
 }
 
+// indexedEntry インデックスから読み込んだエントリ
+type indexedEntry struct {
+	key      string
+	metadata *model.CacheMetadata
+}
+
+// _indexedEntries ホストごとのインデックスから条件に一致するエントリをURL順に読み込む（SCANは使わない）
+// インデックスに残っているがメタデータが消えている（RedisのTTLで削除された）エントリは、インデックスからも削除する
+func (br *BpRepository) _indexedEntries(ctx context.Context, filter *model.CacheFilter) ([]indexedEntry, error) {
+	if filter == nil {
+		filter = &model.CacheFilter{}
+	}
+	hosts, err := br.client.GetIndexedHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []indexedEntry
+	for _, host := range hosts {
+		if !filter.MatchHost(host) {
+			continue
+		}
+		index, err := br.client.GetIndex(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var keys []string
+		for key, url := range index {
+			if filter.MatchURL(url) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		values, err := br.client.GetMetaDataBatch(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		var missing []string
+		for i, data := range values {
+			if data == nil {
+				missing = append(missing, keys[i])
+				continue
+			}
+			var metadata model.CacheMetadata
+			if err := json.Unmarshal(data, &metadata); err != nil || metadata.FilePath == "" {
+				continue
+			}
+			if filter.Match(&metadata) {
+				entries = append(entries, indexedEntry{key: keys[i], metadata: &metadata})
+			}
+		}
+		if len(missing) > 0 {
+			if err := br.client.RemoveFromIndex(ctx, host, missing); err != nil {
+				log.Printf("[BpRepository] インデックスの整理に失敗しました: %v, host=%s", err, host)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].metadata, entries[j].metadata
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return entries, nil
+}
+
+// _evictionPolicy 設定のEvictionPolicyに、管理APIで固定したURL・ホストを加えたものを返す
+func (br *BpRepository) _evictionPolicy(ctx context.Context) (*model.EvictionPolicy, error) {
+	pins, err := br.client.GetPins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if br.eviction == nil {
+		return (&model.EvictionPolicy{}).WithPins(pins), nil
+	}
+	return br.eviction.WithPins(pins), nil
+}
+
+// ListCacheEntries 条件に一致するキャッシュのエントリのメタデータをURL順に返す
+// filter: 絞り込む条件（nilの場合はURLを記録しているすべてのエントリ）
+func (br *BpRepository) ListCacheEntries(ctx context.Context, filter *model.CacheFilter) ([]*model.CacheMetadata, error) {
+	indexed, err := br._indexedEntries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*model.CacheMetadata, 0, len(indexed))
+	for _, entry := range indexed {
+		entries = append(entries, entry.metadata)
+	}
+	return entries, nil
+}
+
+// ListCacheInventory 条件に一致するエントリをURL順に、offsetからlimit件まで返す
+func (br *BpRepository) ListCacheInventory(ctx context.Context, filter *model.CacheFilter, offset, limit int) (*model.CacheInventoryPage, error) {
+	indexed, err := br._indexedEntries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := br.client.GetAccessStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := br._evictionPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.CacheInventoryPage{
+		Total:   len(indexed),
+		Offset:  offset,
+		Limit:   limit,
+		Entries: []*model.CacheInventoryEntry{},
+	}
+	if offset >= len(indexed) {
+		return page, nil
+	}
+	indexed = indexed[offset:]
+	if limit > 0 && limit < len(indexed) {
+		indexed = indexed[:limit]
+	}
+	for _, entry := range indexed {
+		page.Entries = append(page.Entries, model.NewCacheInventoryEntry(
+			_entryID(entry.key), entry.metadata, stats[entry.key], policy.IsPinned(entry.metadata.URL)))
+	}
+	return page, nil
+}
+
+// GetCacheHostStats ホストごとのエントリ数・合計サイズなどをホスト名順に返す
+func (br *BpRepository) GetCacheHostStats(ctx context.Context) ([]*model.CacheHostStats, error) {
+	indexed, err := br._indexedEntries(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := br.client.GetAccessStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byHost := make(map[string]*model.CacheHostStats)
+	for _, entry := range indexed {
+		host := model.CacheHost(entry.metadata.URL)
+		hs, ok := byHost[host]
+		if !ok {
+			hs = &model.CacheHostStats{Host: host}
+			byHost[host] = hs
+		}
+		hs.Add(entry.metadata, stats[entry.key])
+	}
+
+	result := make([]*model.CacheHostStats, 0, len(byHost))
+	for _, hs := range byHost {
+		result = append(result, hs)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Host < result[j].Host })
+	return result, nil
+}
+
+// GetCacheEntry IDで指定したエントリを、ヘッダーなどの詳細を含めて返す
+func (br *BpRepository) GetCacheEntry(ctx context.Context, id string) (*model.CacheInventoryEntry, bool, error) {
+	metaKey, ok := _metaKeyFromID(id)
+	if !ok {
+		return nil, false, nil
+	}
+	data, err := br.client.GetMetaData(ctx, metaKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+	var metadata model.CacheMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, false, nil
+	}
+
+	stats, err := br.client.GetAccessStats(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	policy, err := br._evictionPolicy(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	entry := model.NewCacheInventoryEntry(id, &metadata, stats[metaKey], policy.IsPinned(metadata.URL))
+	entry.FilePath = metadata.FilePath
+	entry.SHA256 = metadata.SHA256
+	entry.Headers = metadata.Headers
+	entry.RequestHeaders = metadata.RequestHeaders
+	return entry, true, nil
+}
+
+// DeleteCacheEntries 条件に一致するエントリを削除し、削除した数を返す
+func (br *BpRepository) DeleteCacheEntries(ctx context.Context, filter *model.CacheFilter) (int, error) {
+	indexed, err := br._indexedEntries(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range indexed {
+		br._deleteEntry(ctx, entry.key, entry.metadata)
+	}
+	return len(indexed), nil
+}
+
+// PinCache URLまたはホストを、容量を超えても削除しない対象に加える
+func (br *BpRepository) PinCache(ctx context.Context, pin string) error {
+	return br.client.AddPin(ctx, pin)
+}
+
+// UnpinCache 管理APIで固定したURLまたはホストを外す（設定ファイルで固定したものは外せない）
+func (br *BpRepository) UnpinCache(ctx context.Context, pin string) error {
+	return br.client.RemovePin(ctx, pin)
+}
+
+// ListPins 管理APIで固定したURL・ホストを返す
+func (br *BpRepository) ListPins(ctx context.Context) ([]string, error) {
+	pins, err := br.client.GetPins(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(pins)
+	return pins, nil
+}
+
+// RebuildCacheIndex すべてのメタデータをSCANして、ホストごとのインデックスに登録し直す
+// インデックスを持たない以前のバージョンで保存したエントリを登録するため、起動時に一度だけ実行する
+func (br *BpRepository) RebuildCacheIndex(ctx context.Context) (int, error) {
+	items, err := br.client.ScanMetaData(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	byHost := make(map[string]map[string]string)
+	count := 0
+	for _, item := range items {
+		var metadata model.CacheMetadata
+		if err := json.Unmarshal(item.Data, &metadata); err != nil || metadata.FilePath == "" {
+			continue
+		}
+		host := model.CacheHost(metadata.URL)
+		if host == "" {
+			continue
+		}
+		if byHost[host] == nil {
+			byHost[host] = make(map[string]string)
+		}
+		byHost[host][item.Key] = metadata.URL
+		count++
+	}
+	for host, entries := range byHost {
+		if err := br.client.AddToIndex(ctx, host, entries); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// ReadCacheBody エントリのボディをファイルから読み込む
+func (br *BpRepository) ReadCacheBody(ctx context.Context, metadata *model.CacheMetadata) ([]byte, error) {
+	return os.ReadFile(metadata.FilePath)
+}
+
 // DeleteAllCaches すべてのキャッシュを削除する
 func (br *BpRepository) DeleteAllCaches(ctx context.Context) error {
 	// Redisのキャッシュを全削除
@@ -278,3 +1038,65 @@ func (br *BpRepository) AddPendingRequest(ctx context.Context, url string) (bool
 func (br *BpRepository) RemovePendingRequest(ctx context.Context, url string) error {
 	return br.client.RemovePendingRequest(ctx, url)
 }
+
+// SaveSubscription 購読を保存する
+func (br *BpRepository) SaveSubscription(ctx context.Context, sub *model.Subscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return br.client.SetSubscription(ctx, sub.URL, data)
+}
+
+// GetSubscription URLで購読を取得する
+func (br *BpRepository) GetSubscription(ctx context.Context, url string) (*model.Subscription, bool, error) {
+	data, err := br.client.GetSubscription(ctx, url)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+
+	var sub model.Subscription
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return nil, false, err
+	}
+	return &sub, true, nil
+}
+
+// ListSubscriptions すべての購読をURL順に取得する
+func (br *BpRepository) ListSubscriptions(ctx context.Context) ([]*model.Subscription, error) {
+	dataList, err := br.client.GetSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subs := make([]*model.Subscription, 0, len(dataList))
+	for _, data := range dataList {
+		var sub model.Subscription
+		if err := json.Unmarshal(data, &sub); err != nil {
+			// 不正なデータはスキップ
+			continue
+		}
+		subs = append(subs, &sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].URL < subs[j].URL })
+	return subs, nil
+}
+
+// ActivateSubscription Earth側で登録された購読をactiveにする
+func (br *BpRepository) ActivateSubscription(ctx context.Context, url string) error {
+	sub, found, err := br.GetSubscription(ctx, url)
+	if err != nil || !found {
+		return err
+	}
+	sub.Status = model.SubscriptionActive
+	sub.UpdatedAt = time.Now()
+	return br.SaveSubscription(ctx, sub)
+}
+
+// DeleteSubscription 購読を削除する
+func (br *BpRepository) DeleteSubscription(ctx context.Context, url string) error {
+	return br.client.DeleteSubscription(ctx, url)
+}
@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
 )
 
 type CacheItem struct {
@@ -10,11 +12,46 @@ type CacheItem struct {
 	FilePath string
 }
 
+// MetaItem まとめて保存するメタデータ
+type MetaItem struct {
+	Key  string
+	Data []byte
+	TTL  time.Duration
+
+	// Host・URL キャッシュのエントリの場合、メタデータと同時にホストごとのインデックスに登録する（空の場合は登録しない）
+	Host string
+	URL  string
+}
+
 type BpRepoClient interface {
 	GetMetaData(ctx context.Context, metaKey string) ([]byte, error)
 	ScanExpiredKeys(ctx context.Context) ([]CacheItem, error)
+	// ScanMetaData キャッシュのメタデータをすべて取得する（TTLは設定しない）
+	ScanMetaData(ctx context.Context) ([]MetaItem, error)
 	SetMetaData(ctx context.Context, metaKey string, data []byte, ttl time.Duration) error
+	// SetMetaDataBatch 複数のメタデータをすべて保存するか、1つも保存しない
+	SetMetaDataBatch(ctx context.Context, items []MetaItem) error
+	// GetMetaDataBatch 複数のメタデータをまとめて取得する（存在しないキーはnil）
+	GetMetaDataBatch(ctx context.Context, metaKeys []string) ([][]byte, error)
+	// DeleteMetaData メタデータとそのアクセス状況を削除する（インデックスからはRemoveFromIndexで削除する）
 	DeleteMetaData(ctx context.Context, metaKey string) error
+	// AddToIndex ホストごとのインデックスにエントリを登録する（entries: メタデータのキー -> URL）
+	AddToIndex(ctx context.Context, host string, entries map[string]string) error
+	// RemoveFromIndex ホストごとのインデックスからエントリを削除する（エントリが無くなったホストも削除する）
+	RemoveFromIndex(ctx context.Context, host string, metaKeys []string) error
+	// GetIndexedHosts インデックスにエントリがあるホストを取得する
+	GetIndexedHosts(ctx context.Context) ([]string, error)
+	// GetIndex ホストのインデックスを取得する（メタデータのキー -> URL）
+	GetIndex(ctx context.Context, host string) (map[string]string, error)
+	// AddPin・RemovePin・GetPins 容量を超えても削除しないURL・ホストを管理する
+	AddPin(ctx context.Context, pin string) error
+	RemovePin(ctx context.Context, pin string) error
+	GetPins(ctx context.Context) ([]string, error)
+	// RecordAccess キャッシュから返したことを記録する（最後にアクセスした時刻と回数）
+	RecordAccess(ctx context.Context, metaKey string, at time.Time) error
+	// GetAccessStats 記録されているアクセス状況をメタデータのキーごとに取得する
+	GetAccessStats(ctx context.Context) (map[string]model.CacheAccess, error)
+	// FlushAllMetaData メタデータ・アクセス状況・インデックスをすべて削除する（固定したURL・ホストは残す）
 	FlushAllMetaData(ctx context.Context) error
 	ReserveRequest(ctx context.Context, job []byte) error
 	GetReservedRequests(ctx context.Context) ([][]byte, error)
@@ -24,4 +61,8 @@ type BpRepoClient interface {
 	RemovePendingRequest(ctx context.Context, url string) error
 	FlushAllReservedRequest(ctx context.Context) error
 	FlushAllCaches(ctx context.Context) error
+	SetSubscription(ctx context.Context, url string, data []byte) error
+	GetSubscription(ctx context.Context, url string) ([]byte, error)
+	GetSubscriptions(ctx context.Context) ([][]byte, error)
+	DeleteSubscription(ctx context.Context, url string) error
 }
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+// disk_other.go - 空き容量を取得できない環境用スタブ（ディスク不足による削除は行わない）
+package repository
+
+import "fmt"
+
+// _diskFreeBytes この環境では空き容量を取得できない
+func _diskFreeBytes(path string) (int64, error) {
+	return 0, fmt.Errorf("free disk space is not available on this platform")
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin
+// +build linux darwin
+
+// disk_unix.go - キャッシュディレクトリのあるファイルシステムの空き容量の取得
+package repository
+
+import "syscall"
+
+// _diskFreeBytes パスのあるファイルシステムで、一般ユーザーが使用できる空き容量を返す
+func _diskFreeBytes(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
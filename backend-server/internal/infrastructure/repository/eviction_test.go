@@ -0,0 +1,100 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+)
+
+// evictionEntry 容量の確認に使うエントリ（ボディはすべて100バイト）
+type evictionEntry struct {
+	url    string
+	access int // 最後にアクセスした時刻（基準からの秒数）
+	hits   int // アクセスした回数
+}
+
+// 最後のアクセスが古い順に a, b, c, d、アクセスの少ない順に b, d, c, a
+var evictionEntries = []evictionEntry{
+	{url: "https://static.example.org/a", access: 1, hits: 5},
+	{url: "https://static.example.org/b", access: 2, hits: 1},
+	{url: "https://example.com/c", access: 3, hits: 3},
+	{url: "https://example.com/d", access: 4, hits: 2},
+}
+
+func TestEvictCaches(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		mode      string
+		pins      []string // 設定で固定するURL・ホスト
+		adminPins []string // 管理APIで固定するURL・ホスト
+		want      []string // 残るエントリ
+	}{
+		{name: "under quota", maxBytes: 400, mode: model.EvictLRU, want: []string{"a", "b", "c", "d"}},
+		{name: "no limit", maxBytes: 0, mode: model.EvictLRU, want: []string{"a", "b", "c", "d"}},
+		{name: "lru", maxBytes: 250, mode: model.EvictLRU, want: []string{"c", "d"}},
+		{name: "lfu", maxBytes: 250, mode: model.EvictLFU, want: []string{"a", "c"}},
+		{name: "lru, one over", maxBytes: 399, mode: model.EvictLRU, want: []string{"b", "c", "d"}},
+		{name: "lfu, one over", maxBytes: 399, mode: model.EvictLFU, want: []string{"a", "c", "d"}},
+		{name: "pinned url", maxBytes: 250, mode: model.EvictLRU, pins: []string{"https://static.example.org/a"}, want: []string{"a", "d"}},
+		{name: "pinned host", maxBytes: 250, mode: model.EvictLFU, pins: []string{"static.example.org"}, want: []string{"a", "b"}},
+		{name: "pinned by admin", maxBytes: 250, mode: model.EvictLRU, adminPins: []string{".example.org"}, want: []string{"a", "b"}},
+		// 固定したエントリだけで上限を超えている場合は、固定していないものをすべて削除して終える
+		{name: "pinned over quota", maxBytes: 150, mode: model.EvictLRU,
+			pins: []string{"static.example.org"}, adminPins: []string{"https://example.com/c"}, want: []string{"a", "b", "c"}},
+		{name: "everything pinned", maxBytes: 100, mode: model.EvictLFU, pins: []string{"example.com", ".example.org"}, want: []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			client := openClient(t, dir)
+			repo := repository.NewBpRepository(client, filepath.Join(dir, "cache"), time.Hour, 0,
+				&model.EvictionPolicy{MaxBytes: tt.maxBytes, Mode: tt.mode, Pins: tt.pins}, 0,
+				&model.IntegrityPolicy{Verify: model.VerifySize}, "")
+
+			base := time.Now().Add(-time.Hour)
+			for _, e := range evictionEntries {
+				req := &model.BpRequest{Method: "GET", URL: e.url}
+				resp := &model.BpResponse{StatusCode: 200, Body: []byte(strings.Repeat("x", 100)), ContentType: "text/plain"}
+				if err := repo.SetResponseWithURL(ctx, req, resp, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+				metaKey := "bp:cache:meta:" + req.GenerateCacheKey()
+				for i := 0; i < e.hits; i++ {
+					if err := client.RecordAccess(ctx, metaKey, base.Add(time.Duration(e.access)*time.Second)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			for _, pin := range tt.adminPins {
+				if err := repo.PinCache(ctx, pin); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := repo.EvictCaches(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := repo.ListCacheEntries(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.URL[strings.LastIndex(entry.URL, "/")+1:])
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("remaining = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+)
+
+// quarantineRecordExt 隔離したエントリの情報を保存するファイルの拡張子（ボディは<ID>.bodyに移す）
+const quarantineRecordExt = ".json"
+
+// _verifyFile 開いたファイルが保存したボディと一致するか確認する
+// hashBody: ハッシュも確認するか（確認した場合はファイルの先頭に戻す）
+func (br *BpRepository) _verifyFile(file *os.File, size int64, metadata *model.CacheMetadata, hashBody bool) error {
+	if err := metadata.VerifySize(size); err != nil {
+		return err
+	}
+	if !metadata.CanVerify() || !hashBody {
+		return nil
+	}
+	h := model.NewBodyHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return fmt.Errorf("failed to read cache file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read cache file: %w", err)
+	}
+	return metadata.VerifySum(hex.EncodeToString(h.Sum(nil)))
+}
+
+// _verifyEntry エントリのファイルを開いて、大きさとハッシュを確認する
+func (br *BpRepository) _verifyEntry(metadata *model.CacheMetadata, hashBody bool) error {
+	file, err := os.Open(metadata.FilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return br._verifyFile(file, info.Size(), metadata, hashBody)
+}
+
+// _quarantineEntry 保存したボディと一致しないエントリのファイルを隔離用のディレクトリに移し、キャッシュから削除する
+// 修復でURLを再取得できるよう、エントリの情報を<ID>.jsonに残す（隔離用のディレクトリが無い場合はファイルを削除する）
+// 同じファイルを別のエントリが保存し直していて、そのエントリとは一致する場合は、古いエントリのメタデータだけを削除してfalseを返す
+func (br *BpRepository) _quarantineEntry(ctx context.Context, metaKey string, metadata *model.CacheMetadata, cause error) bool {
+	if owner := br._fileOwner(ctx, metaKey, metadata.FilePath); owner != "" {
+		log.Printf("[BpRepository] ファイルが別のエントリで保存し直されているため、古いエントリだけを削除します: %v, URL=%s, 保存したURL=%s",
+			cause, metadata.URL, owner)
+		br._deleteMetadata(ctx, metaKey, metadata)
+		return false
+	}
+	log.Printf("[BpRepository] キャッシュのファイルが保存したものと一致しないため隔離します: %v, URL=%s", cause, metadata.URL)
+
+	if br.quarantine != "" {
+		id := _entryID(metaKey)
+		record := &model.QuarantinedEntry{
+			ID:             id,
+			URL:            metadata.URL,
+			RequestHeaders: metadata.RequestHeaders,
+			Reason:         cause.Error(),
+			OriginalPath:   metadata.FilePath,
+			QuarantinedAt:  time.Now(),
+		}
+		if err := os.MkdirAll(br.quarantine, 0755); err != nil {
+			log.Printf("[BpRepository] 隔離用のディレクトリを作成できません: %v", err)
+		} else {
+			dest := filepath.Join(br.quarantine, id+".body")
+			if err := os.Rename(metadata.FilePath, dest); err == nil {
+				record.File = dest
+			}
+			data, err := json.MarshalIndent(record, "", "  ")
+			if err == nil {
+				err = os.WriteFile(filepath.Join(br.quarantine, id+quarantineRecordExt), data, 0644)
+			}
+			if err != nil {
+				log.Printf("[BpRepository] 隔離したエントリの情報を保存できません: %v, URL=%s", err, metadata.URL)
+			}
+		}
+	}
+
+	// ファイルを移した後は、メタデータとインデックスだけが削除される
+	br._deleteEntry(ctx, metaKey, metadata)
+	return true
+}
+
+// _fileOwner 同じファイルを指す別のエントリのうち、ファイルと一致するもののURLを返す（無い場合は空）
+// 隔離は確認に失敗した時だけ行うため、すべてのメタデータを読み込んで探す
+func (br *BpRepository) _fileOwner(ctx context.Context, metaKey, filePath string) string {
+	if filePath == "" {
+		return ""
+	}
+	items, err := br.client.ScanMetaData(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, item := range items {
+		if item.Key == metaKey {
+			continue
+		}
+		var other model.CacheMetadata
+		if err := json.Unmarshal(item.Data, &other); err != nil || other.FilePath != filePath {
+			continue
+		}
+		if br._verifyEntry(&other, true) == nil {
+			return other.URL
+		}
+	}
+	return ""
+}
+
+// ScrubCaches すべてのエントリのファイルを読み込んで大きさとハッシュを確認し、一致しないものを隔離する
+// ハッシュを記録する前に保存したエントリは確認しない
+// hashBodies: falseの場合はファイルを読み込まずに大きさだけを確認する
+func (br *BpRepository) ScrubCaches(ctx context.Context, hashBodies bool) (*model.ScrubResult, error) {
+	items, err := br.client.ScanMetaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.ScrubResult{}
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		var metadata model.CacheMetadata
+		if err := json.Unmarshal(item.Data, &metadata); err != nil || metadata.FilePath == "" {
+			continue
+		}
+		if !metadata.CanVerify() {
+			result.Skipped++
+			continue
+		}
+		result.Checked++
+		verifyErr := br._verifyEntry(&metadata, hashBodies)
+		if verifyErr == nil {
+			continue
+		}
+		// 確認している間にエントリが保存し直された場合は、新しいファイルを隔離しない
+		current, err := br.client.GetMetaData(ctx, item.Key)
+		if err != nil || !bytes.Equal(current, item.Data) {
+			continue
+		}
+		if br._quarantineEntry(ctx, item.Key, &metadata, verifyErr) {
+			result.Quarantined++
+		}
+	}
+	log.Printf("[BpRepository] キャッシュの整合性を確認しました (確認 %d件, 隔離 %d件, ハッシュの無いエントリ %d件)",
+		result.Checked, result.Quarantined, result.Skipped)
+	return result, nil
+}
+
+// ListQuarantine 隔離したエントリを隔離した順に返す
+func (br *BpRepository) ListQuarantine(ctx context.Context) ([]*model.QuarantinedEntry, error) {
+	if br.quarantine == "" {
+		return nil, nil
+	}
+	files, err := os.ReadDir(br.quarantine)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []*model.QuarantinedEntry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), quarantineRecordExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(br.quarantine, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var entry model.QuarantinedEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("[BpRepository] 隔離したエントリの情報を読み込めません: %v, file=%s", err, file.Name())
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].QuarantinedAt.Before(entries[j].QuarantinedAt) })
+	return entries, nil
+}
+
+// DeleteQuarantined 隔離したエントリの情報とファイルを削除する（修復で再取得を予約した後に呼ぶ）
+func (br *BpRepository) DeleteQuarantined(ctx context.Context, id string) error {
+	if _, ok := _metaKeyFromID(id); !ok || br.quarantine == "" {
+		return fmt.Errorf("invalid quarantine id: %s", id)
+	}
+	_ = os.Remove(filepath.Join(br.quarantine, id+".body"))
+	if err := os.Remove(filepath.Join(br.quarantine, id+quarantineRecordExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository/plugins"
+)
+
+const testBody = "hello, cache"
+
+// testRequest Varyで選ぶバリアントのエントリ（修復でリクエストのヘッダーを引き継ぐか確認するため）
+var testRequest = &model.BpRequest{
+	Method:  "GET",
+	URL:     "https://example.com/page",
+	Headers: map[string][]string{"Accept-Language": {"ja"}},
+}
+
+// openClient 一時ディレクトリに組み込みのストアを開く
+func openClient(t *testing.T, dir string) *plugins.EmbeddedClient {
+	t.Helper()
+	client, err := plugins.NewEmbeddedClient(filepath.Join(dir, "store.log"), plugins.RedisClientConfig{
+		ReservedRequestsKey: "bp:reserved:requests",
+		PendingRequestsKey:  "bp:pending:requests",
+		SubscriptionsKey:    "bp:subscriptions",
+		CacheMetaPattern:    "bp:cache:meta:*",
+		CacheAccessKey:      "bp:cache:access",
+		CacheIndexKey:       "bp:cache:index",
+		CachePinsKey:        "bp:cache:pins",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func openRepository(t *testing.T, integrity *model.IntegrityPolicy, quarantine bool) (*plugins.EmbeddedClient, *repository.BpRepository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	client := openClient(t, dir)
+
+	quarantineDir := ""
+	if quarantine {
+		quarantineDir = filepath.Join(dir, "quarantine")
+	}
+	repo := repository.NewBpRepository(client, filepath.Join(dir, "cache"), time.Hour, 0,
+		&model.EvictionPolicy{Mode: model.EvictLRU}, 0, integrity, quarantineDir)
+	return client, repo, quarantineDir
+}
+
+// storeEntry テスト用のエントリを保存し、管理APIのエントリの情報を返す
+func storeEntry(t *testing.T, repo *repository.BpRepository) *model.CacheInventoryEntry {
+	t.Helper()
+	ctx := context.Background()
+	resp := &model.BpResponse{
+		StatusCode:  200,
+		Headers:     map[string][]string{"Vary": {"Accept-Language"}},
+		Body:        []byte(testBody),
+		ContentType: "text/plain",
+	}
+	if err := repo.SetResponseWithURL(ctx, testRequest, resp, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	page, err := repo.ListCacheInventory(ctx, nil, 0, 10)
+	if err != nil || len(page.Entries) != 1 {
+		t.Fatalf("ListCacheInventory() = %+v, %v", page, err)
+	}
+	entry, found, err := repo.GetCacheEntry(ctx, page.Entries[0].ID)
+	if err != nil || !found {
+		t.Fatalf("GetCacheEntry() = %v, %v", found, err)
+	}
+	return entry
+}
+
+// 壊し方
+var (
+	keepFile    = func(path string) error { return nil }
+	flipByte    = func(path string) error { return os.WriteFile(path, []byte("Hello, cache"), 0644) }
+	truncate    = func(path string) error { return os.Truncate(path, 3) }
+	appendBytes = func(path string) error { return os.WriteFile(path, []byte(testBody+"!"), 0644) }
+	removeFile  = func(path string) error { return os.Remove(path) }
+)
+
+// assertQuarantined エントリが隔離され、キャッシュ・インデックスから削除されたか確認する
+func assertQuarantined(t *testing.T, client *plugins.EmbeddedClient, repo *repository.BpRepository, entry *model.CacheInventoryEntry, quarantineDir, reason string, wantFile bool) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := os.Stat(entry.FilePath); !os.IsNotExist(err) {
+		t.Errorf("cache file left in place: %v", err)
+	}
+	if _, found, _ := repo.GetCacheEntry(ctx, entry.ID); found {
+		t.Error("metadata left after quarantine")
+	}
+	if hosts, _ := client.GetIndexedHosts(ctx); len(hosts) != 0 {
+		t.Errorf("index left after quarantine: %v", hosts)
+	}
+
+	records, err := repo.ListQuarantine(ctx)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ListQuarantine() = %v, %v", records, err)
+	}
+	record := records[0]
+	if record.ID != entry.ID || record.URL != testRequest.URL || record.OriginalPath != entry.FilePath ||
+		!strings.Contains(record.Reason, reason) || record.QuarantinedAt.IsZero() {
+		t.Errorf("quarantine record = %+v", record)
+	}
+	if got := record.RequestHeaders["Accept-Language"]; len(got) != 1 || got[0] != "ja" {
+		t.Errorf("request headers = %v", record.RequestHeaders)
+	}
+	wantPath := ""
+	if wantFile {
+		wantPath = filepath.Join(quarantineDir, entry.ID+".body")
+		if _, err := os.Stat(wantPath); err != nil {
+			t.Errorf("quarantined body: %v", err)
+		}
+	}
+	if record.File != wantPath {
+		t.Errorf("quarantined file = %q, want %q", record.File, wantPath)
+	}
+}
+
+func TestScrubCaches(t *testing.T) {
+	tests := []struct {
+		name       string
+		corrupt    func(path string) error
+		hashBodies bool
+		legacy     bool // ハッシュを記録する前に保存したエントリ
+		want       model.ScrubResult
+		reason     string
+		wantFile   bool
+	}{
+		{name: "intact", corrupt: keepFile, hashBodies: true, want: model.ScrubResult{Checked: 1}},
+		{name: "content changed", corrupt: flipByte, hashBodies: true, want: model.ScrubResult{Checked: 1, Quarantined: 1}, reason: "sha256 mismatch", wantFile: true},
+		{name: "content changed, size only", corrupt: flipByte, want: model.ScrubResult{Checked: 1}},
+		{name: "truncated, size only", corrupt: truncate, want: model.ScrubResult{Checked: 1, Quarantined: 1}, reason: "size mismatch", wantFile: true},
+		{name: "appended", corrupt: appendBytes, hashBodies: true, want: model.ScrubResult{Checked: 1, Quarantined: 1}, reason: "size mismatch", wantFile: true},
+		{name: "file missing", corrupt: removeFile, hashBodies: true, want: model.ScrubResult{Checked: 1, Quarantined: 1}, reason: "no such file"},
+		{name: "saved before hashing", corrupt: flipByte, hashBodies: true, legacy: true, want: model.ScrubResult{Skipped: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client, repo, quarantineDir := openRepository(t, &model.IntegrityPolicy{Verify: model.VerifyAlways}, true)
+			entry := storeEntry(t, repo)
+			if tt.legacy {
+				metaKey := "bp:cache:meta:bp:cache:" + entry.ID
+				data, err := client.GetMetaData(ctx, metaKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var metadata model.CacheMetadata
+				if err := json.Unmarshal(data, &metadata); err != nil {
+					t.Fatal(err)
+				}
+				metadata.SHA256 = ""
+				data, _ = json.Marshal(&metadata)
+				if err := client.SetMetaData(ctx, metaKey, data, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tt.corrupt(entry.FilePath); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := repo.ScrubCaches(ctx, tt.hashBodies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *result != tt.want {
+				t.Errorf("ScrubCaches() = %+v, want %+v", *result, tt.want)
+			}
+			if tt.want.Quarantined > 0 {
+				assertQuarantined(t, client, repo, entry, quarantineDir, tt.reason, tt.wantFile)
+				return
+			}
+			if _, found, _ := repo.GetCacheEntry(ctx, entry.ID); !found {
+				t.Error("entry removed without quarantine")
+			}
+			if records, _ := repo.ListQuarantine(ctx); len(records) != 0 {
+				t.Errorf("unexpected quarantine records: %v", records)
+			}
+		})
+	}
+}
+
+func TestGetResponseVerifiesBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		verify    string
+		corrupt   func(path string) error
+		headers   bool // ボディを読み込まないGetResponseHeadersで取得する
+		wantFound bool
+		reason    string
+	}{
+		{name: "always, intact", verify: model.VerifyAlways, corrupt: keepFile, wantFound: true},
+		{name: "always, content changed", verify: model.VerifyAlways, corrupt: flipByte, reason: "sha256 mismatch"},
+		{name: "size, content changed", verify: model.VerifySize, corrupt: flipByte, wantFound: true},
+		{name: "size, truncated", verify: model.VerifySize, corrupt: truncate, reason: "size mismatch"},
+		{name: "sample none, content changed", verify: model.VerifySample, corrupt: flipByte, wantFound: true},
+		{name: "headers, content changed", verify: model.VerifyAlways, corrupt: flipByte, headers: true, wantFound: true},
+		{name: "headers, truncated", verify: model.VerifyAlways, corrupt: truncate, headers: true, reason: "size mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client, repo, quarantineDir := openRepository(t, &model.IntegrityPolicy{Verify: tt.verify}, true)
+			entry := storeEntry(t, repo)
+			if err := tt.corrupt(entry.FilePath); err != nil {
+				t.Fatal(err)
+			}
+
+			get := repo.GetResponse
+			if tt.headers {
+				get = repo.GetResponseHeaders
+			}
+			_, found, err := get(ctx, testRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.wantFound {
+				t.Fatalf("found = %v, want %v", found, tt.wantFound)
+			}
+			if !found {
+				assertQuarantined(t, client, repo, entry, quarantineDir, tt.reason, true)
+			}
+		})
+	}
+}
+
+func TestQuarantineWithoutDirectory(t *testing.T) {
+	ctx := context.Background()
+	client, repo, _ := openRepository(t, &model.IntegrityPolicy{Verify: model.VerifyAlways}, false)
+	entry := storeEntry(t, repo)
+	if err := flipByte(entry.FilePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := repo.GetResponse(ctx, testRequest); found {
+		t.Fatal("corrupted entry returned")
+	}
+	// 隔離用のディレクトリが無い場合はファイルを削除し、記録も残さない
+	if _, err := os.Stat(entry.FilePath); !os.IsNotExist(err) {
+		t.Errorf("cache file left in place: %v", err)
+	}
+	if hosts, _ := client.GetIndexedHosts(ctx); len(hosts) != 0 {
+		t.Errorf("index left after quarantine: %v", hosts)
+	}
+	if records, err := repo.ListQuarantine(ctx); err != nil || len(records) != 0 {
+		t.Errorf("ListQuarantine() = %v, %v", records, err)
+	}
+}
+
+func TestSharedFileIsNotQuarantined(t *testing.T) {
+	ctx := context.Background()
+	client, repo, _ := openRepository(t, &model.IntegrityPolicy{Verify: model.VerifyAlways}, true)
+
+	// 末尾のスラッシュだけが異なるURLは、同じファイルに保存される
+	stale := &model.BpRequest{Method: "GET", URL: "https://example.com"}
+	owner := &model.BpRequest{Method: "GET", URL: "https://example.com/"}
+	for _, e := range []struct {
+		req  *model.BpRequest
+		body string
+	}{{stale, "old page"}, {owner, "new page, longer"}} {
+		resp := &model.BpResponse{StatusCode: 200, Body: []byte(e.body), ContentType: "text/html"}
+		if err := repo.SetResponseWithURL(ctx, e.req, resp, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, err := repo.ListCacheInventory(ctx, nil, 0, 10)
+	if err != nil || len(page.Entries) != 2 {
+		t.Fatalf("ListCacheInventory() = %+v, %v", page, err)
+	}
+	var paths []string
+	for _, e := range page.Entries {
+		entry, found, err := repo.GetCacheEntry(ctx, e.ID)
+		if err != nil || !found {
+			t.Fatalf("GetCacheEntry() = %v, %v", found, err)
+		}
+		paths = append(paths, entry.FilePath)
+	}
+	if paths[0] != paths[1] {
+		t.Fatalf("file paths = %v, want a shared file", paths)
+	}
+	path := paths[0]
+
+	// 古いエントリはキャッシュから外れるが、ファイルは別のエントリのために残す
+	if _, found, _ := repo.GetResponse(ctx, stale); found {
+		t.Fatal("stale entry returned")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "new page, longer" {
+		t.Fatalf("shared file = %q, %v", data, err)
+	}
+	resp, found, err := repo.GetResponse(ctx, owner)
+	if err != nil || !found || string(resp.Body) != "new page, longer" {
+		t.Fatalf("GetResponse(owner) = %v, %v", found, err)
+	}
+	if records, err := repo.ListQuarantine(ctx); err != nil || len(records) != 0 {
+		t.Errorf("ListQuarantine() = %v, %v", records, err)
+	}
+	if hosts, _ := client.GetIndexedHosts(ctx); len(hosts) != 1 {
+		t.Errorf("indexed hosts = %v", hosts)
+	}
+
+	// スクラブでも古いエントリだけを削除し、隔離には数えない
+	if err := repo.SetResponseWithURL(ctx, stale, &model.BpResponse{StatusCode: 200, Body: []byte("old page"), ContentType: "text/html"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetResponseWithURL(ctx, owner, &model.BpResponse{StatusCode: 200, Body: []byte("new page, longer"), ContentType: "text/html"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	result, err := repo.ScrubCaches(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Quarantined != 0 || result.Checked != 2 {
+		t.Errorf("ScrubCaches() = %+v", result)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("shared file removed: %v", err)
+	}
+}
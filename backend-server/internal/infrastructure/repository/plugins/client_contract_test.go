@@ -0,0 +1,363 @@
+// client_contract_test.go - BpRepoClientの実装が満たすべき振る舞いのテスト（RedisClientとEmbeddedClientで共通）
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+)
+
+// testConfig テストごとに重ならないキーの設定を返す
+func testConfig(prefix string) RedisClientConfig {
+	return RedisClientConfig{
+		ReservedRequestsKey: prefix + "reserved",
+		PendingRequestsKey:  prefix + "pending",
+		SubscriptionsKey:    prefix + "subscriptions",
+		CacheMetaPattern:    prefix + "meta:*",
+		CacheAccessKey:      prefix + "access",
+		CacheIndexKey:       prefix + "index",
+		CachePinsKey:        prefix + "pins",
+	}
+}
+
+func TestEmbeddedClientContract(t *testing.T) {
+	runClientContract(t, func(t *testing.T) (repository.BpRepoClient, string) {
+		ec, err := NewEmbeddedClient(filepath.Join(t.TempDir(), "store.log"), testConfig(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ec.Close() })
+		return ec, ""
+	})
+}
+
+// TestRedisClientContract REDIS_ADDR（例: localhost:6379）が設定されている場合だけ実行する
+func TestRedisClientContract(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	runClientContract(t, func(t *testing.T) (repository.BpRepoClient, string) {
+		rclient := redis.NewClient(&redis.Options{Addr: addr})
+		if err := rclient.Ping(context.Background()).Err(); err != nil {
+			t.Skipf("Redis is not available: %v", err)
+		}
+		prefix := fmt.Sprintf("bp-test:%d:", time.Now().UnixNano())
+		t.Cleanup(func() {
+			ctx := context.Background()
+			keys, _ := rclient.Keys(ctx, prefix+"*").Result()
+			if len(keys) > 0 {
+				rclient.Del(ctx, keys...)
+			}
+			rclient.Close()
+		})
+		return NewRedisClient(rclient, testConfig(prefix)), prefix
+	})
+}
+
+// runClientContract すべての実装で同じ結果になるべき操作を確認する
+// newClient: 空の状態のクライアントと、メタデータのキーに付ける接頭辞を返す
+func runClientContract(t *testing.T, newClient func(t *testing.T) (repository.BpRepoClient, string)) {
+	ctx := context.Background()
+
+	t.Run("MetaDataTTL", func(t *testing.T) {
+		c, prefix := newClient(t)
+		if data, err := c.GetMetaData(ctx, prefix+"meta:missing"); data != nil || err != nil {
+			t.Errorf("GetMetaData(missing) = %q, %v", data, err)
+		}
+		c.SetMetaData(ctx, prefix+"meta:short", []byte(`{"file_path":"/short"}`), time.Second)
+		c.SetMetaData(ctx, prefix+"meta:long", []byte(`{"file_path":"/long"}`), time.Hour)
+		c.SetMetaData(ctx, prefix+"other", []byte("x"), time.Hour)
+		if data, _ := c.GetMetaData(ctx, prefix+"meta:short"); string(data) != `{"file_path":"/short"}` {
+			t.Errorf("GetMetaData(short) = %q", data)
+		}
+
+		time.Sleep(1500 * time.Millisecond)
+		if data, _ := c.GetMetaData(ctx, prefix+"meta:short"); data != nil {
+			t.Errorf("GetMetaData(short) after TTL = %q, want nil", data)
+		}
+		items, err := c.ScanMetaData(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].Key != prefix+"meta:long" {
+			t.Errorf("ScanMetaData = %+v, want only the long-lived entry", items)
+		}
+
+		c.DeleteMetaData(ctx, prefix+"meta:long")
+		if data, _ := c.GetMetaData(ctx, prefix+"meta:long"); data != nil {
+			t.Errorf("GetMetaData after DeleteMetaData = %q", data)
+		}
+	})
+
+	t.Run("ScanExpiredKeys", func(t *testing.T) {
+		c, prefix := newClient(t)
+		c.SetMetaData(ctx, prefix+"meta:forever", []byte(`{"file_path":"/forever"}`), 0)
+		c.SetMetaData(ctx, prefix+"meta:fresh", []byte(`{"file_path":"/fresh"}`), time.Hour)
+		items, err := c.ScanExpiredKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// TTLの無いメタデータは期限切れとして扱う
+		if len(items) != 1 || items[0].Key != prefix+"meta:forever" || items[0].FilePath != "/forever" {
+			t.Errorf("ScanExpiredKeys = %+v", items)
+		}
+	})
+
+	t.Run("MetaDataBatch", func(t *testing.T) {
+		c, prefix := newClient(t)
+		err := c.SetMetaDataBatch(ctx, []repository.MetaItem{
+			{Key: prefix + "meta:a", Data: []byte("a"), TTL: time.Hour},
+			{Key: prefix + "meta:b", Data: []byte("b"), TTL: time.Hour},
+			{Key: prefix + "meta:a", Data: []byte("a2"), TTL: time.Hour},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, _ := c.GetMetaData(ctx, prefix+"meta:a")
+		b, _ := c.GetMetaData(ctx, prefix+"meta:b")
+		if string(a) != "a2" || string(b) != "b" {
+			t.Errorf("after batch: a=%q b=%q (later items should win)", a, b)
+		}
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		c, prefix := newClient(t)
+		a, b, other := prefix+"meta:a", prefix+"meta:b", prefix+"meta:other"
+		err := c.SetMetaDataBatch(ctx, []repository.MetaItem{
+			{Key: a, Data: []byte("a"), TTL: time.Hour, Host: "example.com", URL: "https://example.com/a"},
+			{Key: b, Data: []byte("b"), TTL: time.Hour, Host: "example.com", URL: "https://example.com/b"},
+			{Key: prefix + "vary", Data: []byte("[]"), TTL: time.Hour},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AddToIndex(ctx, "other.example", map[string]string{other: "https://other.example/"})
+
+		hosts, _ := c.GetIndexedHosts(ctx)
+		sort.Strings(hosts)
+		if fmt.Sprint(hosts) != "[example.com other.example]" {
+			t.Errorf("GetIndexedHosts = %v", hosts)
+		}
+		if index, _ := c.GetIndex(ctx, "example.com"); len(index) != 2 || index[a] != "https://example.com/a" {
+			t.Errorf("GetIndex(example.com) = %v", index)
+		}
+		values, err := c.GetMetaDataBatch(ctx, []string{a, prefix + "meta:missing", b})
+		if err != nil || len(values) != 3 || string(values[0]) != "a" || values[1] != nil || string(values[2]) != "b" {
+			t.Errorf("GetMetaDataBatch = %q, %v", values, err)
+		}
+
+		// 一部を削除してもホストは残り、すべて削除するとホストも消える
+		c.RemoveFromIndex(ctx, "example.com", []string{a})
+		if index, _ := c.GetIndex(ctx, "example.com"); len(index) != 1 {
+			t.Errorf("GetIndex after removing one = %v", index)
+		}
+		c.RemoveFromIndex(ctx, "example.com", []string{b, prefix + "meta:missing"})
+		if hosts, _ := c.GetIndexedHosts(ctx); fmt.Sprint(hosts) != "[other.example]" {
+			t.Errorf("GetIndexedHosts after removing all = %v", hosts)
+		}
+	})
+
+	t.Run("Pins", func(t *testing.T) {
+		c, _ := newClient(t)
+		c.AddPin(ctx, "example.com")
+		c.AddPin(ctx, "https://other.example/page")
+		c.AddPin(ctx, "example.com")
+		pins, err := c.GetPins(ctx)
+		sort.Strings(pins)
+		if err != nil || fmt.Sprint(pins) != "[example.com https://other.example/page]" {
+			t.Errorf("GetPins = %v, %v", pins, err)
+		}
+		c.RemovePin(ctx, "example.com")
+		if pins, _ := c.GetPins(ctx); fmt.Sprint(pins) != "[https://other.example/page]" {
+			t.Errorf("GetPins after RemovePin = %v", pins)
+		}
+	})
+
+	t.Run("AccessStats", func(t *testing.T) {
+		c, prefix := newClient(t)
+		key := prefix + "meta:page"
+		c.SetMetaData(ctx, key, []byte("x"), time.Hour)
+		at := time.Unix(1700000000, 0)
+		c.RecordAccess(ctx, key, at.Add(-time.Minute))
+		c.RecordAccess(ctx, key, at)
+		stats, err := c.GetAccessStats(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stats[key]; got.Hits != 2 || !got.LastAccess.Equal(at) {
+			t.Errorf("GetAccessStats[%s] = %+v", key, got)
+		}
+
+		c.DeleteMetaData(ctx, key)
+		stats, _ = c.GetAccessStats(ctx)
+		if _, ok := stats[key]; ok {
+			t.Errorf("access stats should be removed with the metadata")
+		}
+	})
+
+	t.Run("ReservationList", func(t *testing.T) {
+		c, _ := newClient(t)
+		for _, job := range []string{"a", "b", "c"} {
+			if err := c.ReserveRequest(ctx, []byte(job)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if jobs, _ := c.GetReservedRequests(ctx); fmt.Sprintf("%s", jobs) != "[c b a]" {
+			t.Errorf("GetReservedRequests = %s, want [c b a]", jobs)
+		}
+		c.RemoveReservedRequest(ctx, []byte("b"))
+		if job, err := c.BLPopReservedRequest(ctx, time.Second); string(job) != "c" || err != nil {
+			t.Errorf("BLPopReservedRequest = %q, %v, want c", job, err)
+		}
+		if job, _ := c.BLPopReservedRequest(ctx, time.Second); string(job) != "a" {
+			t.Errorf("BLPopReservedRequest = %q, want a", job)
+		}
+
+		// 空の場合はタイムアウトでnilを返す
+		if job, err := c.BLPopReservedRequest(ctx, time.Second); job != nil || err != nil {
+			t.Errorf("BLPopReservedRequest on empty list = %q, %v", job, err)
+		}
+
+		// 待っている間に追加されたリクエストを受け取る
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			c.ReserveRequest(ctx, []byte("late"))
+		}()
+		if job, err := c.BLPopReservedRequest(ctx, 5*time.Second); string(job) != "late" || err != nil {
+			t.Errorf("BLPopReservedRequest while waiting = %q, %v", job, err)
+		}
+	})
+
+	t.Run("PendingSet", func(t *testing.T) {
+		c, _ := newClient(t)
+		if added, err := c.AddPendingRequest(ctx, "https://example.com/"); !added || err != nil {
+			t.Errorf("first AddPendingRequest = %v, %v", added, err)
+		}
+		if added, _ := c.AddPendingRequest(ctx, "https://example.com/"); added {
+			t.Error("second AddPendingRequest should report an existing member")
+		}
+		c.RemovePendingRequest(ctx, "https://example.com/")
+		if added, _ := c.AddPendingRequest(ctx, "https://example.com/"); !added {
+			t.Error("AddPendingRequest after removal should add again")
+		}
+	})
+
+	t.Run("Subscriptions", func(t *testing.T) {
+		c, _ := newClient(t)
+		c.SetSubscription(ctx, "https://a.example/", []byte("a"))
+		c.SetSubscription(ctx, "https://b.example/", []byte("b"))
+		c.SetSubscription(ctx, "https://a.example/", []byte("a2"))
+		if data, _ := c.GetSubscription(ctx, "https://a.example/"); string(data) != "a2" {
+			t.Errorf("GetSubscription = %q", data)
+		}
+		if data, err := c.GetSubscription(ctx, "https://missing.example/"); data != nil || err != nil {
+			t.Errorf("GetSubscription(missing) = %q, %v", data, err)
+		}
+		c.DeleteSubscription(ctx, "https://b.example/")
+		subs, _ := c.GetSubscriptions(ctx)
+		if len(subs) != 1 || string(subs[0]) != "a2" {
+			t.Errorf("GetSubscriptions = %q", subs)
+		}
+	})
+
+	t.Run("FlushAllCaches", func(t *testing.T) {
+		c, prefix := newClient(t)
+		c.SetMetaData(ctx, prefix+"meta:x", []byte("x"), time.Hour)
+		c.SetMetaData(ctx, prefix+"other", []byte("y"), time.Hour)
+		c.RecordAccess(ctx, prefix+"meta:x", time.Now())
+		c.ReserveRequest(ctx, []byte("job"))
+		c.SetSubscription(ctx, "https://a.example/", []byte("a"))
+		c.AddToIndex(ctx, "a.example", map[string]string{prefix + "meta:x": "https://a.example/"})
+		c.AddPin(ctx, "a.example")
+		if err := c.FlushAllCaches(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if data, _ := c.GetMetaData(ctx, prefix+"meta:x"); data != nil {
+			t.Error("metadata should be flushed")
+		}
+		if jobs, _ := c.GetReservedRequests(ctx); len(jobs) != 0 {
+			t.Errorf("reservations should be flushed, got %q", jobs)
+		}
+		if stats, _ := c.GetAccessStats(ctx); len(stats) != 0 {
+			t.Errorf("access stats should be flushed, got %v", stats)
+		}
+		if hosts, _ := c.GetIndexedHosts(ctx); len(hosts) != 0 {
+			t.Errorf("index should be flushed, got %v", hosts)
+		}
+		if index, _ := c.GetIndex(ctx, "a.example"); len(index) != 0 {
+			t.Errorf("host index should be flushed, got %v", index)
+		}
+		if pins, _ := c.GetPins(ctx); len(pins) != 1 {
+			t.Errorf("pins should be kept, got %v", pins)
+		}
+		// メタデータのパターンに一致しないキーと購読は残る
+		if data, _ := c.GetMetaData(ctx, prefix+"other"); string(data) != "y" {
+			t.Error("keys outside the metadata pattern should be kept")
+		}
+		if data, _ := c.GetSubscription(ctx, "https://a.example/"); string(data) != "a" {
+			t.Error("subscriptions should be kept")
+		}
+	})
+}
+
+func TestEmbeddedClientPersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.log")
+	c, err := NewEmbeddedClient(path, testConfig(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetMetaData(ctx, "meta:kept", []byte("kept"), time.Hour)
+	c.SetMetaData(ctx, "meta:gone", []byte("gone"), time.Hour)
+	c.DeleteMetaData(ctx, "meta:gone")
+	c.ReserveRequest(ctx, []byte("a"))
+	c.ReserveRequest(ctx, []byte("b"))
+	c.BLPopReservedRequest(ctx, time.Second)
+	c.AddPendingRequest(ctx, "https://example.com/")
+	c.SetSubscription(ctx, "https://example.com/", []byte("sub"))
+	c.RecordAccess(ctx, "meta:kept", time.Unix(1700000000, 0))
+	c.Close()
+
+	// 書き込み中に停止して最後の行が途中で切れた状態
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"op":"set","key":"meta:torn","da`)
+	f.Close()
+
+	c, err = NewEmbeddedClient(path, testConfig(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	items, _ := c.ScanMetaData(ctx)
+	var keys []string
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != "[meta:kept]" {
+		t.Errorf("metadata after restart = %v", keys)
+	}
+	if jobs, _ := c.GetReservedRequests(ctx); fmt.Sprintf("%s", jobs) != "[a]" {
+		t.Errorf("reservations after restart = %s", jobs)
+	}
+	if added, _ := c.AddPendingRequest(ctx, "https://example.com/"); added {
+		t.Error("pending set should survive a restart")
+	}
+	if data, _ := c.GetSubscription(ctx, "https://example.com/"); string(data) != "sub" {
+		t.Errorf("subscription after restart = %q", data)
+	}
+	// アクセス状況はディスクへの書き込みを待たないが、正常に閉じた場合は残る
+	if stats, _ := c.GetAccessStats(ctx); stats["meta:kept"].Hits != 1 {
+		t.Errorf("access stats after restart = %+v", stats)
+	}
+}
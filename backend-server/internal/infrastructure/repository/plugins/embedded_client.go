@@ -0,0 +1,305 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+)
+
+// EmbeddedClient Redisを使わずにプロセス内でメタデータや予約キューを保持するBpRepoClient
+// キーの名前はRedisClientと同じ設定を使い、ファイルに永続化するため再起動後も状態が残る
+type EmbeddedClient struct {
+	store  *embeddedStore
+	config RedisClientConfig
+}
+
+// NewEmbeddedClient ファイルから状態を復元してEmbeddedClientを作成する
+// path: 状態を保存するファイルのパス（存在しない場合は作成する）
+func NewEmbeddedClient(path string, config RedisClientConfig) (*EmbeddedClient, error) {
+	store, err := openEmbeddedStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return &EmbeddedClient{
+		store:  store,
+		config: config,
+	}, nil
+}
+
+// Close バッファを書き出してファイルを閉じる
+func (ec *EmbeddedClient) Close() error {
+	return ec.store.close()
+}
+
+func (ec *EmbeddedClient) GetMetaData(ctx context.Context, metaKey string) ([]byte, error) {
+	return ec.store.get(metaKey), nil
+}
+
+// ScanExpiredKeys TTLの切れたメタデータ（またはTTLの無いメタデータ）を返す
+// Redisと異なり、期限切れの値も書き直すまでは読めるため、ファイルパスも返す
+func (ec *EmbeddedClient) ScanExpiredKeys(ctx context.Context) ([]repository.CacheItem, error) {
+	ec.store.mu.Lock()
+	defer ec.store.mu.Unlock()
+
+	var expiredItems []repository.CacheItem
+	for key, v := range ec.store.values {
+		if v.expires != 0 && !ec.store.expired(v) {
+			continue
+		}
+		if ok, _ := matchPattern(ec.config.CacheMetaPattern, key); !ok {
+			continue
+		}
+		var filePath string
+		var metadata model.CacheMetadata
+		if err := json.Unmarshal(v.data, &metadata); err == nil {
+			filePath = metadata.FilePath
+		}
+		expiredItems = append(expiredItems, repository.CacheItem{
+			Key:      key,
+			FilePath: filePath,
+		})
+	}
+	return expiredItems, nil
+}
+
+func (ec *EmbeddedClient) ScanMetaData(ctx context.Context) ([]repository.MetaItem, error) {
+	var items []repository.MetaItem
+	for _, key := range ec.store.scan(ec.config.CacheMetaPattern, false) {
+		if data := ec.store.get(key); data != nil {
+			items = append(items, repository.MetaItem{Key: key, Data: data})
+		}
+	}
+	return items, nil
+}
+
+func (ec *EmbeddedClient) SetMetaData(ctx context.Context, metaKey string, data []byte, ttl time.Duration) error {
+	return ec.store.do(&storeOp{Op: opSet, Key: metaKey, Data: data, Expires: ec.store.expiresAt(ttl)}, true)
+}
+
+// SetMetaDataBatch 複数のメタデータとインデックスを1つの記録として書き込む（一部だけが保存されることはない）
+func (ec *EmbeddedClient) SetMetaDataBatch(ctx context.Context, items []repository.MetaItem) error {
+	batch := make([]*storeOp, 0, len(items))
+	for _, item := range items {
+		batch = append(batch, &storeOp{Op: opSet, Key: item.Key, Data: item.Data, Expires: ec.store.expiresAt(item.TTL)})
+		if item.Host != "" {
+			batch = append(batch,
+				&storeOp{Op: opHSet, Key: ec._indexHostKey(item.Host), Field: item.Key, Data: []byte(item.URL)},
+				&storeOp{Op: opSAdd, Key: ec._indexHostsKey(), Field: item.Host},
+			)
+		}
+	}
+	return ec.store.do(&storeOp{Op: opBatch, Batch: batch}, true)
+}
+
+func (ec *EmbeddedClient) GetMetaDataBatch(ctx context.Context, metaKeys []string) ([][]byte, error) {
+	result := make([][]byte, len(metaKeys))
+	for i, key := range metaKeys {
+		result[i] = ec.store.get(key)
+	}
+	return result, nil
+}
+
+func (ec *EmbeddedClient) DeleteMetaData(ctx context.Context, metaKey string) error {
+	return ec.store.do(&storeOp{Op: opBatch, Batch: []*storeOp{
+		{Op: opDel, Key: metaKey},
+		{Op: opHDel, Key: ec._accessLastKey(), Field: metaKey},
+		{Op: opHDel, Key: ec._accessHitsKey(), Field: metaKey},
+	}}, true)
+}
+
+func (ec *EmbeddedClient) RecordAccess(ctx context.Context, metaKey string, at time.Time) error {
+	err := ec.store.do(&storeOp{Op: opHSet, Key: ec._accessLastKey(), Field: metaKey, Data: []byte(strconv.FormatInt(at.Unix(), 10))}, false)
+	if err != nil {
+		return err
+	}
+	return ec.store.hincr(ec._accessHitsKey(), metaKey)
+}
+
+func (ec *EmbeddedClient) GetAccessStats(ctx context.Context) (map[string]model.CacheAccess, error) {
+	stats := make(map[string]model.CacheAccess)
+	for key, value := range ec.store.hash(ec._accessLastKey()) {
+		access := stats[key]
+		if sec, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			access.LastAccess = time.Unix(sec, 0)
+		}
+		stats[key] = access
+	}
+	for key, value := range ec.store.hash(ec._accessHitsKey()) {
+		access := stats[key]
+		access.Hits, _ = strconv.ParseInt(string(value), 10, 64)
+		stats[key] = access
+	}
+	return stats, nil
+}
+
+func (ec *EmbeddedClient) AddToIndex(ctx context.Context, host string, entries map[string]string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	batch := make([]*storeOp, 0, len(entries)+1)
+	for key, url := range entries {
+		batch = append(batch, &storeOp{Op: opHSet, Key: ec._indexHostKey(host), Field: key, Data: []byte(url)})
+	}
+	batch = append(batch, &storeOp{Op: opSAdd, Key: ec._indexHostsKey(), Field: host})
+	return ec.store.do(&storeOp{Op: opBatch, Batch: batch}, true)
+}
+
+// RemoveFromIndex インデックスからエントリを削除する（空になったホストの判定と削除はロックしたまま行う）
+func (ec *EmbeddedClient) RemoveFromIndex(ctx context.Context, host string, metaKeys []string) error {
+	ec.store.mu.Lock()
+	defer ec.store.mu.Unlock()
+
+	hostKey := ec._indexHostKey(host)
+	remaining := len(ec.store.hashes[hostKey])
+	batch := make([]*storeOp, 0, len(metaKeys)+1)
+	for _, key := range metaKeys {
+		if _, ok := ec.store.hashes[hostKey][key]; ok {
+			remaining--
+		}
+		batch = append(batch, &storeOp{Op: opHDel, Key: hostKey, Field: key})
+	}
+	if remaining <= 0 {
+		batch = append(batch, &storeOp{Op: opDel, Key: hostKey}, &storeOp{Op: opSRem, Key: ec._indexHostsKey(), Field: host})
+	}
+	return ec.store.doLocked(&storeOp{Op: opBatch, Batch: batch}, true)
+}
+
+func (ec *EmbeddedClient) GetIndexedHosts(ctx context.Context) ([]string, error) {
+	return ec.store.members(ec._indexHostsKey()), nil
+}
+
+func (ec *EmbeddedClient) GetIndex(ctx context.Context, host string) (map[string]string, error) {
+	hash := ec.store.hash(ec._indexHostKey(host))
+	index := make(map[string]string, len(hash))
+	for key, url := range hash {
+		index[key] = string(url)
+	}
+	return index, nil
+}
+
+func (ec *EmbeddedClient) AddPin(ctx context.Context, pin string) error {
+	_, err := ec.store.sadd(ec.config.CachePinsKey, pin)
+	return err
+}
+
+func (ec *EmbeddedClient) RemovePin(ctx context.Context, pin string) error {
+	return ec.store.do(&storeOp{Op: opSRem, Key: ec.config.CachePinsKey, Field: pin}, true)
+}
+
+func (ec *EmbeddedClient) GetPins(ctx context.Context) ([]string, error) {
+	return ec.store.members(ec.config.CachePinsKey), nil
+}
+
+func (ec *EmbeddedClient) _indexHostsKey() string {
+	return ec.config.CacheIndexKey + ":hosts"
+}
+
+func (ec *EmbeddedClient) _indexHostKey(host string) string {
+	return ec.config.CacheIndexKey + ":host:" + host
+}
+
+func (ec *EmbeddedClient) _accessLastKey() string {
+	return ec.config.CacheAccessKey + ":last"
+}
+
+func (ec *EmbeddedClient) _accessHitsKey() string {
+	return ec.config.CacheAccessKey + ":hits"
+}
+
+func (ec *EmbeddedClient) FlushAllMetaData(ctx context.Context) error {
+	var batch []*storeOp
+	for _, key := range ec.store.scan(ec.config.CacheMetaPattern, true) {
+		batch = append(batch, &storeOp{Op: opDel, Key: key})
+	}
+	// アクセス状況とインデックスも削除
+	batch = append(batch,
+		&storeOp{Op: opDel, Key: ec._accessLastKey()},
+		&storeOp{Op: opDel, Key: ec._accessHitsKey()},
+		&storeOp{Op: opDel, Key: ec._indexHostsKey()},
+	)
+	for _, host := range ec.store.members(ec._indexHostsKey()) {
+		batch = append(batch, &storeOp{Op: opDel, Key: ec._indexHostKey(host)})
+	}
+	return ec.store.do(&storeOp{Op: opBatch, Batch: batch}, true)
+}
+
+func (ec *EmbeddedClient) GetReservedRequests(ctx context.Context) ([][]byte, error) {
+	return ec.store.list(ec.config.ReservedRequestsKey), nil
+}
+
+func (ec *EmbeddedClient) ReserveRequest(ctx context.Context, job []byte) error {
+	return ec.store.lpush(ec.config.ReservedRequestsKey, job)
+}
+
+// BLPopReservedRequest 予約されたリクエストを先頭から取り出す（空の場合は追加されるかタイムアウトまで待つ）
+func (ec *EmbeddedClient) BLPopReservedRequest(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		job, pushed, err := ec.store.lpop(ec.config.ReservedRequestsKey)
+		if err != nil || job != nil {
+			return job, err
+		}
+		select {
+		case <-pushed:
+		case <-deadline:
+			// タイムアウト
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (ec *EmbeddedClient) RemoveReservedRequest(ctx context.Context, job []byte) error {
+	return ec.store.do(&storeOp{Op: opLRem, Key: ec.config.ReservedRequestsKey, Data: job}, true)
+}
+
+func (ec *EmbeddedClient) FlushAllReservedRequest(ctx context.Context) error {
+	return ec.store.do(&storeOp{Op: opDel, Key: ec.config.ReservedRequestsKey}, true)
+}
+
+func (ec *EmbeddedClient) FlushAllCaches(ctx context.Context) error {
+	if err := ec.FlushAllMetaData(ctx); err != nil {
+		return err
+	}
+	return ec.FlushAllReservedRequest(ctx)
+}
+
+func (ec *EmbeddedClient) AddPendingRequest(ctx context.Context, url string) (bool, error) {
+	return ec.store.sadd(ec.config.PendingRequestsKey, url)
+}
+
+func (ec *EmbeddedClient) RemovePendingRequest(ctx context.Context, url string) error {
+	return ec.store.do(&storeOp{Op: opSRem, Key: ec.config.PendingRequestsKey, Field: url}, true)
+}
+
+func (ec *EmbeddedClient) SetSubscription(ctx context.Context, url string, data []byte) error {
+	return ec.store.do(&storeOp{Op: opHSet, Key: ec.config.SubscriptionsKey, Field: url, Data: data}, true)
+}
+
+func (ec *EmbeddedClient) GetSubscription(ctx context.Context, url string) ([]byte, error) {
+	return ec.store.hget(ec.config.SubscriptionsKey, url), nil
+}
+
+func (ec *EmbeddedClient) GetSubscriptions(ctx context.Context) ([][]byte, error) {
+	hash := ec.store.hash(ec.config.SubscriptionsKey)
+	result := make([][]byte, 0, len(hash))
+	for _, v := range hash {
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+func (ec *EmbeddedClient) DeleteSubscription(ctx context.Context, url string) error {
+	return ec.store.do(&storeOp{Op: opHDel, Key: ec.config.SubscriptionsKey, Field: url}, true)
+}
@@ -0,0 +1,465 @@
+package plugins
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// minCompactBytes ログがこの大きさを超えるまでは書き直さない
+const minCompactBytes = 4 * 1024 * 1024
+
+// storeOp ログの1行（操作の種類ごとに使うフィールドが異なる）
+type storeOp struct {
+	Op      string     `json:"op"`
+	Key     string     `json:"key,omitempty"`
+	Field   string     `json:"field,omitempty"`
+	Data    []byte     `json:"data,omitempty"`
+	Expires int64      `json:"exp,omitempty"` // 有効期限（Unixナノ秒、0は無期限）
+	Batch   []*storeOp `json:"batch,omitempty"`
+}
+
+// 操作の種類
+const (
+	opSet   = "set"   // 値を保存する
+	opDel   = "del"   // キーを削除する（値・リスト・集合・ハッシュのいずれも）
+	opBatch = "batch" // 複数の操作をまとめて反映する（1行で書き込むため、一部だけが反映されることはない）
+	opLPush = "lpush" // リストの先頭に追加する
+	opLPop  = "lpop"  // リストの先頭を取り出す
+	opLRem  = "lrem"  // リストから一致する最初の要素を削除する
+	opSAdd  = "sadd"  // 集合に追加する
+	opSRem  = "srem"  // 集合から削除する
+	opHSet  = "hset"  // ハッシュのフィールドを保存する
+	opHDel  = "hdel"  // ハッシュのフィールドを削除する
+)
+
+type storeValue struct {
+	data    []byte
+	expires int64
+}
+
+// embeddedStore Redisの一部のデータ型（値・リスト・集合・ハッシュ）をプロセス内に保持し、追記型のログで永続化する
+//
+// 起動時にログを再生して状態を復元し、ログが大きくなったら現在の状態だけを書き出して置き換える。
+// 有効期限の切れた値は読み込み時に見えなくなり、書き直しの際に取り除かれる。
+type embeddedStore struct {
+	mu          sync.Mutex
+	path        string
+	file        *os.File
+	w           *bufio.Writer
+	size        int64
+	compactSize int64 // 前回書き直した直後のログの大きさ
+	now         func() time.Time
+
+	values map[string]*storeValue
+	lists  map[string][][]byte
+	sets   map[string]map[string]bool
+	hashes map[string]map[string][]byte
+
+	// pushed リストに追加されたことを待っているBLPOPに知らせる（追加のたびに閉じて作り直す）
+	pushed chan struct{}
+}
+
+func openEmbeddedStore(filePath string) (*embeddedStore, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+	s := &embeddedStore{
+		path:   filePath,
+		now:    time.Now,
+		values: make(map[string]*storeValue),
+		lists:  make(map[string][][]byte),
+		sets:   make(map[string]map[string]bool),
+		hashes: make(map[string]map[string][]byte),
+		pushed: make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// 読み込んだ時点で書き直し、期限切れの値や途中で切れた行を取り除く
+	if err := s.compactLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load ログを先頭から再生する（書き込み中に停止した場合の最後の不完全な行は無視する）
+func (s *embeddedStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		var op storeOp
+		if err := json.Unmarshal(sc.Bytes(), &op); err != nil {
+			log.Printf("[EmbeddedStore] Skipping corrupt record at line %d: %v", line, err)
+			continue
+		}
+		s.apply(&op)
+	}
+	if err := sc.Err(); err != nil {
+		log.Printf("[EmbeddedStore] Stopped reading at line %d: %v", line, err)
+	}
+	return nil
+}
+
+// apply 1つの操作を状態に反映する
+func (s *embeddedStore) apply(op *storeOp) {
+	switch op.Op {
+	case opSet:
+		s.values[op.Key] = &storeValue{data: op.Data, expires: op.Expires}
+	case opDel:
+		delete(s.values, op.Key)
+		delete(s.lists, op.Key)
+		delete(s.sets, op.Key)
+		delete(s.hashes, op.Key)
+	case opBatch:
+		for _, child := range op.Batch {
+			s.apply(child)
+		}
+	case opLPush:
+		s.lists[op.Key] = append([][]byte{op.Data}, s.lists[op.Key]...)
+	case opLPop:
+		if list := s.lists[op.Key]; len(list) > 0 {
+			s.lists[op.Key] = list[1:]
+		}
+	case opLRem:
+		list := s.lists[op.Key]
+		for i, item := range list {
+			if string(item) == string(op.Data) {
+				s.lists[op.Key] = append(list[:i:i], list[i+1:]...)
+				break
+			}
+		}
+	case opSAdd:
+		if s.sets[op.Key] == nil {
+			s.sets[op.Key] = make(map[string]bool)
+		}
+		s.sets[op.Key][op.Field] = true
+	case opSRem:
+		delete(s.sets[op.Key], op.Field)
+	case opHSet:
+		if s.hashes[op.Key] == nil {
+			s.hashes[op.Key] = make(map[string][]byte)
+		}
+		s.hashes[op.Key][op.Field] = op.Data
+	case opHDel:
+		delete(s.hashes[op.Key], op.Field)
+	}
+}
+
+// do 操作をログに書き込んでから状態に反映する
+// sync: ディスクへの書き込みを待つか（アクセス状況のように失っても困らない操作はfalse）
+func (s *embeddedStore) do(op *storeOp, sync bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.doLocked(op, sync)
+}
+
+func (s *embeddedStore) doLocked(op *storeOp, sync bool) error {
+	if s.file == nil {
+		return fmt.Errorf("embedded store is closed")
+	}
+	line, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := s.w.Write(line); err != nil {
+		return fmt.Errorf("embedded store write error: %w", err)
+	}
+	if sync {
+		if err := s.w.Flush(); err != nil {
+			return fmt.Errorf("embedded store write error: %w", err)
+		}
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("embedded store sync error: %w", err)
+		}
+	}
+	s.size += int64(len(line))
+	s.apply(op)
+
+	if s.size > minCompactBytes && s.size > 2*s.compactSize {
+		if err := s.compactLocked(); err != nil {
+			log.Printf("[EmbeddedStore] Compaction error: %v", err)
+		}
+	}
+	return nil
+}
+
+// expired 値の有効期限が切れているか
+func (s *embeddedStore) expired(v *storeValue) bool {
+	return v.expires != 0 && s.now().UnixNano() >= v.expires
+}
+
+// expiresAt TTLから有効期限を求める（0以下は無期限）
+func (s *embeddedStore) expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return s.now().Add(ttl).UnixNano()
+}
+
+// get 有効期限内の値を返す（存在しない場合はnil）
+func (s *embeddedStore) get(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	if !ok {
+		return nil
+	}
+	if s.expired(v) {
+		// 再生しても期限切れになるため、ログには書かずに取り除く
+		delete(s.values, key)
+		return nil
+	}
+	return v.data
+}
+
+// scan パターンに一致する値のキーをソートして返す
+// includeExpired: 有効期限の切れた値も含めるか
+func (s *embeddedStore) scan(pattern string, includeExpired bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key, v := range s.values {
+		if !includeExpired && s.expired(v) {
+			continue
+		}
+		if ok, _ := matchPattern(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lpop リストの先頭を取り出す（空の場合は、次に追加されたことを知らせるチャネルを返す）
+func (s *embeddedStore) lpop(key string) ([]byte, <-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.lists[key]
+	if len(list) == 0 {
+		return nil, s.pushed, nil
+	}
+	item := list[0]
+	if err := s.doLocked(&storeOp{Op: opLPop, Key: key}, true); err != nil {
+		return nil, nil, err
+	}
+	return item, nil, nil
+}
+
+// lpush リストの先頭に追加し、待っているBLPOPに知らせる
+func (s *embeddedStore) lpush(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.doLocked(&storeOp{Op: opLPush, Key: key, Data: data}, true); err != nil {
+		return err
+	}
+	close(s.pushed)
+	s.pushed = make(chan struct{})
+	return nil
+}
+
+// sadd 集合に追加する（すでに含まれていた場合はfalse）
+func (s *embeddedStore) sadd(key, member string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sets[key][member] {
+		return false, nil
+	}
+	if err := s.doLocked(&storeOp{Op: opSAdd, Key: key, Field: member}, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// members 集合の要素をソートして返す
+func (s *embeddedStore) members(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.sets[key]))
+	for member := range s.sets[key] {
+		out = append(out, member)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// hincr ハッシュのフィールドを整数として1増やす
+func (s *embeddedStore) hincr(key, field string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, _ := strconv.ParseInt(string(s.hashes[key][field]), 10, 64)
+	return s.doLocked(&storeOp{Op: opHSet, Key: key, Field: field, Data: []byte(strconv.FormatInt(n+1, 10))}, false)
+}
+
+// list リストの全要素を先頭から返す
+func (s *embeddedStore) list(key string) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.lists[key]...)
+}
+
+// hash ハッシュの全フィールドのコピーを返す
+func (s *embeddedStore) hash(key string) map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]byte, len(s.hashes[key]))
+	for field, data := range s.hashes[key] {
+		out[field] = data
+	}
+	return out
+}
+
+// hget ハッシュのフィールドを返す（存在しない場合はnil）
+func (s *embeddedStore) hget(key, field string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hashes[key][field]
+}
+
+// close バッファを書き出してログを閉じる
+func (s *embeddedStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.w.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
+
+// compactLocked 現在の状態だけを一時ファイルに書き出し、ログを置き換える
+func (s *embeddedStore) compactLocked() error {
+	if s.file != nil {
+		s.w.Flush()
+		s.file.Close()
+		s.file = nil
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return s.reopen(err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	var werr error
+	write := func(op *storeOp) {
+		if werr == nil {
+			werr = enc.Encode(op)
+		}
+	}
+
+	for key, v := range s.values {
+		if s.expired(v) {
+			delete(s.values, key)
+			continue
+		}
+		write(&storeOp{Op: opSet, Key: key, Data: v.data, Expires: v.expires})
+	}
+	for key, list := range s.lists {
+		// 先頭に追加していくため、末尾から書き出す
+		for i := len(list) - 1; i >= 0; i-- {
+			write(&storeOp{Op: opLPush, Key: key, Data: list[i]})
+		}
+	}
+	for key, set := range s.sets {
+		for member := range set {
+			write(&storeOp{Op: opSAdd, Key: key, Field: member})
+		}
+	}
+	for key, hash := range s.hashes {
+		for field, data := range hash {
+			write(&storeOp{Op: opHSet, Key: key, Field: field, Data: data})
+		}
+	}
+	if werr == nil {
+		werr = w.Flush()
+	}
+	if werr == nil {
+		werr = f.Sync()
+	}
+	f.Close()
+	if werr != nil {
+		os.Remove(tmp)
+		return s.reopen(werr)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return s.reopen(err)
+	}
+	if err := s.reopen(nil); err != nil {
+		return err
+	}
+	s.compactSize = s.size
+	return nil
+}
+
+// reopen ログを追記用に開き直す（書き直しに失敗した場合は元のログに追記を続ける）
+func (s *embeddedStore) reopen(cause error) error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.w = bufio.NewWriter(f)
+	s.size = info.Size()
+	return cause
+}
+
+// matchPattern RedisのSCANのMATCHと同じようにキーを照合する
+// "*" は "/" を含む任意の文字列、"?" は任意の1文字に一致する（"[...]" などには対応しない）
+func matchPattern(pattern, key string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	p, k := 0, 0
+	star, mark := -1, 0
+	for k < len(key) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == key[k]):
+			p++
+			k++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, k
+			p++
+		case star >= 0:
+			// 直前の "*" に1文字多く一致させてやり直す
+			mark++
+			p, k = star+1, mark
+		default:
+			return false, nil
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern), nil
+}
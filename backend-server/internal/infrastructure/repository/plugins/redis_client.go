@@ -3,6 +3,7 @@ package plugins
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,10 +14,27 @@ import (
 type RedisClientConfig struct {
 	ReservedRequestsKey string
 	PendingRequestsKey  string // 追加
+	SubscriptionsKey    string // 購読の一覧（URL -> JSONのハッシュ）
 	CacheMetaPattern    string
+	CacheAccessKey      string // キャッシュのアクセス状況（<key>:last と <key>:hits のハッシュ）
+	CacheIndexKey       string // ホストごとのインデックス（<key>:hosts の集合と <key>:host:<ホスト> のハッシュ）
+	CachePinsKey        string // 固定したURL・ホストの集合
 	ScanCount           int
 }
 
+// removeFromIndexScript インデックスからエントリを削除し、空になったホストを集合から取り除く
+// 同時に登録されたエントリのホストを取り除かないよう、スクリプトで不可分に行う
+// KEYS[1]: ホストの集合, KEYS[2]: ホストのハッシュ, ARGV[1]: ホスト, ARGV[2:]: メタデータのキー
+var removeFromIndexScript = redis.NewScript(`
+for i = 2, #ARGV do
+	redis.call('HDEL', KEYS[2], ARGV[i])
+end
+if redis.call('HLEN', KEYS[2]) == 0 then
+	redis.call('SREM', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
 type RedisClient struct {
 	rclient *redis.Client
 	config  RedisClientConfig
@@ -98,6 +116,46 @@ func (rc *RedisClient) ScanExpiredKeys(ctx context.Context) ([]repository.CacheI
 	return expiredItems, nil
 }
 
+// ScanMetaData キャッシュのメタデータのキーをSCANで列挙し、値をまとめて取得する
+func (rc *RedisClient) ScanMetaData(ctx context.Context) ([]repository.MetaItem, error) {
+	var cursor uint64
+	var items []repository.MetaItem
+	pattern := rc.config.CacheMetaPattern
+
+	// ScanCountが0の場合はデフォルト値100を使用
+	scanCount := rc.config.ScanCount
+	if scanCount == 0 {
+		scanCount = 100
+	}
+
+	for {
+		keys, nextCursor, err := rc.rclient.Scan(ctx, cursor, pattern, int64(scanCount)).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) > 0 {
+			values, err := rc.rclient.MGet(ctx, keys...).Result()
+			if err != nil {
+				return nil, err
+			}
+			for i, value := range values {
+				// SCANとMGETの間に削除されたキーはnilになる
+				if s, ok := value.(string); ok {
+					items = append(items, repository.MetaItem{Key: keys[i], Data: []byte(s)})
+				}
+			}
+		}
+
+		cursor = nextCursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return items, nil
+}
+
 func (rc *RedisClient) SetMetaData(ctx context.Context, metaKey string, data []byte, ttl time.Duration) error {
 	err := rc.rclient.Set(ctx, metaKey, data, ttl).Err()
 	if err != nil {
@@ -106,14 +164,143 @@ func (rc *RedisClient) SetMetaData(ctx context.Context, metaKey string, data []b
 	return nil
 }
 
+// SetMetaDataBatch MULTI/EXECで複数のメタデータとインデックスをまとめて保存する
+func (rc *RedisClient) SetMetaDataBatch(ctx context.Context, items []repository.MetaItem) error {
+	_, err := rc.rclient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			pipe.Set(ctx, item.Key, item.Data, item.TTL)
+			if item.Host != "" {
+				pipe.HSet(ctx, rc._indexHostKey(item.Host), item.Key, item.URL)
+				pipe.SAdd(ctx, rc._indexHostsKey(), item.Host)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// GetMetaDataBatch MGETで複数のメタデータをまとめて取得する
+func (rc *RedisClient) GetMetaDataBatch(ctx context.Context, metaKeys []string) ([][]byte, error) {
+	if len(metaKeys) == 0 {
+		return nil, nil
+	}
+	values, err := rc.rclient.MGet(ctx, metaKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]byte, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			result[i] = []byte(s)
+		}
+	}
+	return result, nil
+}
+
 func (rc *RedisClient) DeleteMetaData(ctx context.Context, metaKey string) error {
-	// Redisからメタデータを削除
-	if err := rc.rclient.Del(ctx, metaKey).Err(); err != nil {
+	// Redisからメタデータとアクセス状況を削除
+	pipe := rc.rclient.TxPipeline()
+	pipe.Del(ctx, metaKey)
+	pipe.HDel(ctx, rc._accessLastKey(), metaKey)
+	pipe.HDel(ctx, rc._accessHitsKey(), metaKey)
+	if _, err := pipe.Exec(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
+// RecordAccess 最後にアクセスした時刻（Unix秒）と回数をハッシュに記録する
+func (rc *RedisClient) RecordAccess(ctx context.Context, metaKey string, at time.Time) error {
+	pipe := rc.rclient.Pipeline()
+	pipe.HSet(ctx, rc._accessLastKey(), metaKey, at.Unix())
+	pipe.HIncrBy(ctx, rc._accessHitsKey(), metaKey, 1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (rc *RedisClient) GetAccessStats(ctx context.Context) (map[string]model.CacheAccess, error) {
+	last, err := rc.rclient.HGetAll(ctx, rc._accessLastKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	hits, err := rc.rclient.HGetAll(ctx, rc._accessHitsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]model.CacheAccess, len(last))
+	for key, value := range last {
+		access := stats[key]
+		if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+			access.LastAccess = time.Unix(sec, 0)
+		}
+		stats[key] = access
+	}
+	for key, value := range hits {
+		access := stats[key]
+		access.Hits, _ = strconv.ParseInt(value, 10, 64)
+		stats[key] = access
+	}
+	return stats, nil
+}
+
+func (rc *RedisClient) AddToIndex(ctx context.Context, host string, entries map[string]string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	pipe := rc.rclient.TxPipeline()
+	pipe.HSet(ctx, rc._indexHostKey(host), entries)
+	pipe.SAdd(ctx, rc._indexHostsKey(), host)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (rc *RedisClient) RemoveFromIndex(ctx context.Context, host string, metaKeys []string) error {
+	args := make([]interface{}, 0, len(metaKeys)+1)
+	args = append(args, host)
+	for _, key := range metaKeys {
+		args = append(args, key)
+	}
+	keys := []string{rc._indexHostsKey(), rc._indexHostKey(host)}
+	return removeFromIndexScript.Run(ctx, rc.rclient, keys, args...).Err()
+}
+
+func (rc *RedisClient) GetIndexedHosts(ctx context.Context) ([]string, error) {
+	return rc.rclient.SMembers(ctx, rc._indexHostsKey()).Result()
+}
+
+func (rc *RedisClient) GetIndex(ctx context.Context, host string) (map[string]string, error) {
+	return rc.rclient.HGetAll(ctx, rc._indexHostKey(host)).Result()
+}
+
+func (rc *RedisClient) AddPin(ctx context.Context, pin string) error {
+	return rc.rclient.SAdd(ctx, rc.config.CachePinsKey, pin).Err()
+}
+
+func (rc *RedisClient) RemovePin(ctx context.Context, pin string) error {
+	return rc.rclient.SRem(ctx, rc.config.CachePinsKey, pin).Err()
+}
+
+func (rc *RedisClient) GetPins(ctx context.Context) ([]string, error) {
+	return rc.rclient.SMembers(ctx, rc.config.CachePinsKey).Result()
+}
+
+func (rc *RedisClient) _indexHostsKey() string {
+	return rc.config.CacheIndexKey + ":hosts"
+}
+
+func (rc *RedisClient) _indexHostKey(host string) string {
+	return rc.config.CacheIndexKey + ":host:" + host
+}
+
+func (rc *RedisClient) _accessLastKey() string {
+	return rc.config.CacheAccessKey + ":last"
+}
+
+func (rc *RedisClient) _accessHitsKey() string {
+	return rc.config.CacheAccessKey + ":hits"
+}
+
 func (rc *RedisClient) FlushAllMetaData(ctx context.Context) error {
 	// 1. Redis上の関連キーを削除
 	// メタデータをスキャンして削除
@@ -144,7 +331,16 @@ func (rc *RedisClient) FlushAllMetaData(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	// アクセス状況とインデックスも削除
+	hosts, err := rc.GetIndexedHosts(ctx)
+	if err != nil {
+		return err
+	}
+	keys := []string{rc._accessLastKey(), rc._accessHitsKey(), rc._indexHostsKey()}
+	for _, host := range hosts {
+		keys = append(keys, rc._indexHostKey(host))
+	}
+	return rc.rclient.Del(ctx, keys...).Err()
 }
 
 func (rc *RedisClient) GetReservedRequests(ctx context.Context) ([][]byte, error) {
@@ -246,3 +442,33 @@ func (rc *RedisClient) RemovePendingRequest(ctx context.Context, url string) err
 	key := rc.config.PendingRequestsKey
 	return rc.rclient.SRem(ctx, key, url).Err()
 }
+
+func (rc *RedisClient) SetSubscription(ctx context.Context, url string, data []byte) error {
+	return rc.rclient.HSet(ctx, rc.config.SubscriptionsKey, url, data).Err()
+}
+
+func (rc *RedisClient) GetSubscription(ctx context.Context, url string) ([]byte, error) {
+	data, err := rc.rclient.HGet(ctx, rc.config.SubscriptionsKey, url).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (rc *RedisClient) GetSubscriptions(ctx context.Context) ([][]byte, error) {
+	values, err := rc.rclient.HVals(ctx, rc.config.SubscriptionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// 生のバイトデータのリストを返す（JSONデコードはrepository層で行う）
+	result := make([][]byte, 0, len(values))
+	for _, v := range values {
+		result = append(result, []byte(v))
+	}
+	return result, nil
+}
+
+func (rc *RedisClient) DeleteSubscription(ctx context.Context, url string) error {
+	return rc.rclient.HDel(ctx, rc.config.SubscriptionsKey, url).Err()
+}
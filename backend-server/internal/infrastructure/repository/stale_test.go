@@ -0,0 +1,70 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+)
+
+// 期限切れのエントリは、猶予期間を過ぎたかディスクの空き容量が不足している場合にだけ削除する
+func TestDeleteExpiredCachesKeepsServableStale(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxStale     time.Duration
+		minFreeBytes int64
+		wantStale    bool // 期限切れのエントリが残るか
+	}{
+		{name: "within max stale", maxStale: time.Hour, wantStale: true},
+		{name: "within max stale, enough disk", maxStale: time.Hour, minFreeBytes: 1, wantStale: true},
+		{name: "within max stale, disk pressure", maxStale: time.Hour, minFreeBytes: 1 << 62, wantStale: false},
+		{name: "past stale until", maxStale: time.Millisecond, wantStale: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			client := openClient(t, dir)
+			repo := repository.NewBpRepository(client, filepath.Join(dir, "cache"), tt.maxStale, tt.minFreeBytes,
+				&model.EvictionPolicy{Mode: model.EvictLRU}, 0, &model.IntegrityPolicy{Verify: model.VerifySize}, "")
+
+			stale := &model.BpRequest{Method: "GET", URL: "https://example.com/stale"}
+			fresh := &model.BpRequest{Method: "GET", URL: "https://example.com/fresh"}
+			for req, ttl := range map[*model.BpRequest]time.Duration{stale: 10 * time.Millisecond, fresh: time.Hour} {
+				resp := &model.BpResponse{StatusCode: 200, Body: []byte("body of " + req.URL), ContentType: "text/plain"}
+				if err := repo.SetResponseWithURL(ctx, req, resp, ttl); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entries, err := repo.ListCacheEntries(ctx, &model.CacheFilter{URL: stale.URL})
+			if err != nil || len(entries) != 1 {
+				t.Fatalf("ListCacheEntries() = %v, %v", entries, err)
+			}
+			stalePath := entries[0].FilePath
+			time.Sleep(30 * time.Millisecond)
+
+			if err := repo.DeleteExpiredCaches(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = os.Stat(stalePath)
+			if gotFile := err == nil; gotFile != tt.wantStale {
+				t.Errorf("stale file left = %v, want %v", gotFile, tt.wantStale)
+			}
+			resp, found, err := repo.GetResponseHeaders(ctx, stale)
+			if err != nil || found != tt.wantStale {
+				t.Fatalf("GetResponseHeaders(stale) = %v, %v, want %v", found, err, tt.wantStale)
+			}
+			if found && !resp.Stale {
+				t.Error("expired entry is not marked stale")
+			}
+			if resp, found, err := repo.GetResponseHeaders(ctx, fresh); err != nil || !found || resp.Stale {
+				t.Errorf("GetResponseHeaders(fresh) = %+v, %v, %v", resp, found, err)
+			}
+		})
+	}
+}
@@ -21,6 +21,17 @@ func (ch *CacheHandler) DeleteExpiredCaches(ctx context.Context) error {
 	return ch.bprepo.DeleteExpiredCaches(ctx)
 }
 
+// EvictCaches 容量の上限を超えている場合にキャッシュを削除する
+func (ch *CacheHandler) EvictCaches(ctx context.Context) error {
+	return ch.bprepo.EvictCaches(ctx)
+}
+
+// ScrubCaches すべてのキャッシュのファイルを確認し、保存したものと一致しないものを隔離する
+func (ch *CacheHandler) ScrubCaches(ctx context.Context, hashBodies bool) error {
+	_, err := ch.bprepo.ScrubCaches(ctx, hashBodies)
+	return err
+}
+
 // DeleteAllCaches すべてのキャッシュを削除する
 func (ch *CacheHandler) DeleteAllCaches(ctx context.Context) error {
 	return ch.bprepo.DeleteAllCaches(ctx)
@@ -11,20 +11,23 @@ import (
 )
 
 type RequestHandler struct {
-	bprepo     repository.BpRepository
-	bpgateway  gateway.BpGateway
-	defaultTTL time.Duration
+	bprepo    repository.BpRepository
+	bpgateway gateway.BpGateway
+	freshness *model.FreshnessPolicy
+	errorTTL  time.Duration
 }
 
 func NewRequestHandler(
 	bprepo repository.BpRepository,
 	bpgateway gateway.BpGateway,
-	defaultTTL time.Duration,
+	freshness *model.FreshnessPolicy,
+	errorTTL time.Duration,
 ) *RequestHandler {
 	return &RequestHandler{
-		bprepo:     bprepo,
-		bpgateway:  bpgateway,
-		defaultTTL: defaultTTL,
+		bprepo:    bprepo,
+		bpgateway: bpgateway,
+		freshness: freshness,
+		errorTTL:  errorTTL,
 	}
 }
 
@@ -33,8 +36,8 @@ func (rh *RequestHandler) HandleRequest(ctx context.Context, req *model.BpReques
 	log.Printf("[Worker %d] リクエスト処理開始: %s", workerID, req.URL)
 
 	// // レスポンスのキャッシュが既に存在しないかをチェックする
-	cacheKey := req.GenerateCacheKey()
-	_, found, err := rh.bprepo.GetResponse(ctx, cacheKey)
+	// 期限切れのエントリは再取得のために予約されるため、有効なキャッシュだけを確認する
+	found, err := rh.bprepo.HasResponse(ctx, req)
 	if err != nil {
 		log.Printf("[Worker %d] キャッシュ確認中にエラーが発生しました (URL: %s): %v", workerID, req.URL, err)
 		// エラーがあっても実行を継続する
@@ -55,6 +58,19 @@ func (rh *RequestHandler) HandleRequest(ctx context.Context, req *model.BpReques
 		// return nil
 	}
 
+	// Earth側で取得に失敗した場合は、その理由を保存してユーザーに表示できるようにする
+	if fetchErr, ok := resp.EarthError(); ok {
+		log.Printf("[Worker %d] Earth側で取得に失敗しました (URL: %s, Class: %s): %s", workerID, req.URL, fetchErr.Class, fetchErr.Message)
+		if fetchErr.URL == "" {
+			fetchErr.URL = req.URL
+		}
+		if err := rh.bprepo.SetFetchError(ctx, fetchErr, rh.errorTTL); err != nil {
+			log.Printf("[Worker %d] 取得失敗の理由を保存できませんでした (URL: %s): %v", workerID, req.URL, err)
+		}
+		_ = rh._removeReservedRequest(ctx, req, workerID)
+		return nil
+	}
+
 	// 追加: ステータスコードが200以外（特にリダイレクトやエラー）はキャッシュしない
 	if resp.StatusCode != 200 {
 		log.Printf("[Worker %d] ステータスコードが200ではないためキャッシュしません (URL: %s, Status: %d)", workerID, req.URL, resp.StatusCode)
@@ -63,11 +79,9 @@ func (rh *RequestHandler) HandleRequest(ctx context.Context, req *model.BpReques
 		return nil
 	}
 
-	// レスポンスをキャッシュに保存（URLベースの階層構造で保存）
-	cache_ttl := rh.defaultTTL // 設定値を使用
-
-	// SetResponseWithURLを使用してURLベースの階層構造でキャッシュを保存
-	err = rh.bprepo.SetResponseWithURL(ctx, req, resp, cache_ttl)
+	// URLベースの階層構造でキャッシュを保存（ページアーカイブの場合は全リソースを展開して保存）
+	// TTLはCache-Control・Expires・AgeからRFC 9111に従って決める
+	err = storeResponse(ctx, rh.bprepo, req, resp, rh.freshness)
 	if err != nil {
 		log.Printf("[Worker %d] キャッシュの保存に失敗 (URL: %s): %v", workerID, req.URL, err)
 
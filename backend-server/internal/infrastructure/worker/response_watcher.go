@@ -12,17 +12,26 @@ import (
 )
 
 type ResponseWatcher struct {
-	bpgateway gateway.BpGateway
-	bprepo    repository.BpRepository
+	bpgateway   gateway.BpGateway
+	bprepo      repository.BpRepository
+	freshness   *model.FreshnessPolicy
+	errorTTL    time.Duration
+	manifestTTL time.Duration
 }
 
 func NewResponseWatcher(
 	bpgateway gateway.BpGateway,
 	bprepo repository.BpRepository,
+	freshness *model.FreshnessPolicy,
+	errorTTL time.Duration,
+	manifestTTL time.Duration,
 ) *ResponseWatcher {
 	return &ResponseWatcher{
-		bpgateway: bpgateway,
-		bprepo:    bprepo,
+		bpgateway:   bpgateway,
+		bprepo:      bprepo,
+		freshness:   freshness,
+		errorTTL:    errorTTL,
+		manifestTTL: manifestTTL,
 	}
 }
 
@@ -48,12 +57,48 @@ func (rw *ResponseWatcher) Start(ctx context.Context) {
 
 func (rw *ResponseWatcher) handleResponse(ctx context.Context, resp *model.BpResponse) {
 	// X-Original-URL ヘッダーからURLを取得
-	urls, ok := resp.Headers["X-Original-URL"]
-	if !ok || len(urls) == 0 {
+	url := resp.OriginalURL()
+	if url == "" {
 		log.Printf("[ResponseWatcher] X-Original-URL ヘッダーが見つかりません (Status: %d)", resp.StatusCode)
 		return
 	}
-	url := urls[0]
+
+	// 購読の応答（タイムアウト後に届いたもの）は購読の状態に反映する
+	if _, state, ok := resp.SubscriptionAck(); ok {
+		if state == model.SubscriptionActive {
+			if err := rw.bprepo.ActivateSubscription(ctx, url); err != nil {
+				log.Printf("[ResponseWatcher] 購読の状態を更新できませんでした (URL: %s): %v", url, err)
+			}
+		}
+		return
+	}
+
+	// マニフェストの応答（タイムアウト後に届いたもの）は保存して管理ページに表示する
+	if m, ok := resp.Manifest(); ok {
+		rec := &model.ManifestRecord{URL: url, Status: model.ManifestReady, Manifest: m, UpdatedAt: time.Now()}
+		if existing, found, err := rw.bprepo.GetManifest(ctx, url); err == nil && found {
+			rec.RequestedAt = existing.RequestedAt
+		}
+		if err := rw.bprepo.SaveManifest(ctx, rec, rw.manifestTTL); err != nil {
+			log.Printf("[ResponseWatcher] マニフェストを保存できませんでした (URL: %s): %v", url, err)
+		}
+		return
+	}
+
+	// BATCHの受け付けの応答は何もしない（各URLのレスポンスは個別に届く）
+	if resp.IsBatchAck() {
+		return
+	}
+
+	// Earth側で取得に失敗した場合は、その理由を保存してユーザーに表示できるようにする
+	if fetchErr, ok := resp.EarthError(); ok {
+		log.Printf("[ResponseWatcher] Earth側で取得に失敗しました (URL: %s, Class: %s): %s", url, fetchErr.Class, fetchErr.Message)
+		if err := rw.bprepo.SetFetchError(ctx, fetchErr, rw.errorTTL); err != nil {
+			log.Printf("[ResponseWatcher] 取得失敗の理由を保存できませんでした (URL: %s): %v", url, err)
+		}
+		_ = rw.bprepo.RemovePendingRequest(ctx, url)
+		return
+	}
 
 	// エラーレスポンスはキャッシュしない
 	if resp.StatusCode != 200 {
@@ -78,18 +123,13 @@ func (rw *ResponseWatcher) handleResponse(ctx context.Context, resp *model.BpRes
 		log.Printf("[ResponseWatcher] URLの形式が不正です: %s", url)
 	}
 
-	// キャッシュ保存（内部でRemovePendingRequestも呼ばれる）
-	// TTLはデフォルト値を使用したいが、ここではハードコードするか、設定から渡す必要がある
-	// 簡易的に24時間とする（またはConfigから渡すように修正する）
-	// TODO: TTLをConfigから注入する
-	ttl := 24 * 60 * 60 * time.Second // 24h
-
-	err := rw.bprepo.SetResponseWithURL(ctx, req, resp, ttl)
+	// キャッシュ保存（TTLはRequestHandlerと同じくレスポンスのヘッダーから決める）
+	err := storeResponse(ctx, rw.bprepo, req, resp, rw.freshness)
 	if err != nil {
 		log.Printf("[ResponseWatcher] キャッシュ保存エラー (URL: %s): %v", url, err)
-		// 失敗してもPendingは解除する（SetResponseWithURL内で呼ばれているはずだが、念のため）
-		_ = rw.bprepo.RemovePendingRequest(ctx, url)
 	} else {
-		log.Printf("[ResponseWatcher] キャッシュを保存しました (URL: %s)", url)
+		log.Printf("[ResponseWatcher] レスポンスを処理しました (URL: %s)", url)
 	}
+	// no-storeなどで保存しなかった場合も再びリクエストできるよう、Pendingは解除する
+	_ = rw.bprepo.RemovePendingRequest(ctx, url)
 }
@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/interface/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+)
+
+// storeResponse レスポンスをキャッシュに保存する
+// 保存する期間はレスポンスごとにFreshnessPolicyで決め、no-storeなど保存できないレスポンスは保存しない
+// ページアーカイブの場合は分解してすべてのリソースをまとめて保存する（一部だけが保存されることはない）
+// Earth側でリダイレクトをたどった場合は、経路の各URLにリダイレクトを、最終的なURLにページ本体を保存する
+func storeResponse(ctx context.Context, bprepo repository.BpRepository, req *model.BpRequest, resp *model.BpResponse, policy *model.FreshnessPolicy) error {
+	now := time.Now()
+	redirects, finalURL := resp.RedirectChain()
+	if !resp.IsArchive() && len(redirects) == 0 {
+		f := policy.Evaluate(req, resp, now)
+		if !f.Store {
+			log.Printf("[Freshness] キャッシュしません (URL: %s, 理由: %s)", req.URL, f.Reason)
+			return nil
+		}
+		log.Printf("[Freshness] キャッシュします (URL: %s, TTL: %s, 根拠: %s)", req.URL, f.TTL, f.Source)
+		return bprepo.SetResponseWithURL(ctx, req, resp, f.TTL)
+	}
+
+	pageReq := req
+	if len(redirects) > 0 {
+		pageReq = req.WithURL(finalURL)
+		resp = resp.WithoutRedirectChain()
+	}
+
+	var parts []model.ArchivePart
+	var pages []model.CacheEntry
+	if resp.IsArchive() {
+		var err error
+		parts, err = resp.ParseArchive()
+		if err != nil {
+			return fmt.Errorf("failed to parse archive: %w", err)
+		}
+		// 先頭のパート（ページ本体）は元のリクエストのキーで保存し、それ以外はURLのみのGETリクエストとして保存する
+		pages = append(pages, model.CacheEntry{Request: pageReq, Response: parts[0].Response})
+		for _, part := range parts[1:] {
+			pages = append(pages, model.CacheEntry{
+				Request:  &model.BpRequest{Method: "GET", URL: part.URL},
+				Response: part.Response,
+			})
+		}
+	} else {
+		pages = append(pages, model.CacheEntry{Request: pageReq, Response: resp})
+	}
+
+	// Earth側はリダイレクトのヘッダーを送らないため、経路はページ本体と同じ期間保存する
+	// リダイレクトはページ本体とは別のファイルに保存されるため、経路のエントリを削除してもページは残る
+	var entries []model.CacheEntry
+	page := policy.Evaluate(pages[0].Request, pages[0].Response, now)
+	if page.Store {
+		for _, r := range redirects {
+			entries = append(entries, model.CacheEntry{Request: req.WithURL(r.URL), Response: r.Response(), TTL: page.TTL})
+		}
+	}
+	for _, entry := range pages {
+		f := policy.Evaluate(entry.Request, entry.Response, now)
+		if !f.Store {
+			log.Printf("[Freshness] キャッシュしません (URL: %s, 理由: %s)", entry.Request.URL, f.Reason)
+			continue
+		}
+		entry.TTL = f.TTL
+		entries = append(entries, entry)
+	}
+	if len(entries) > 0 {
+		if err := bprepo.SetResponses(ctx, entries); err != nil {
+			return err
+		}
+	}
+
+	// アーカイブで届いたサブリソースやリダイレクト先は個別にリクエスト中であっても完了扱いにする
+	if len(redirects) > 0 {
+		_ = bprepo.RemovePendingRequest(ctx, finalURL)
+		log.Printf("[Redirect] リダイレクトを保存しました (URL: %s -> %s, 経路: %d)", req.URL, finalURL, len(redirects))
+	}
+	if len(parts) > 0 {
+		for _, part := range parts[1:] {
+			_ = bprepo.RemovePendingRequest(ctx, part.URL)
+		}
+		log.Printf("[Archive] アーカイブを展開しました (URL: %s, パート数: %d)", req.URL, len(parts))
+	}
+	return nil
+}
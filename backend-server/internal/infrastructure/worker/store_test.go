@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository/plugins"
+)
+
+func openRepository(t *testing.T) *repository.BpRepository {
+	t.Helper()
+	dir := t.TempDir()
+	client, err := plugins.NewEmbeddedClient(filepath.Join(dir, "store.log"), plugins.RedisClientConfig{
+		ReservedRequestsKey: "bp:reserved:requests",
+		PendingRequestsKey:  "bp:pending:requests",
+		SubscriptionsKey:    "bp:subscriptions",
+		CacheMetaPattern:    "bp:cache:meta:*",
+		CacheAccessKey:      "bp:cache:access",
+		CacheIndexKey:       "bp:cache:index",
+		CachePinsKey:        "bp:cache:pins",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return repository.NewBpRepository(client, filepath.Join(dir, "cache"), time.Hour, 0,
+		&model.EvictionPolicy{Mode: model.EvictLRU}, 0, &model.IntegrityPolicy{Verify: model.VerifyAlways}, filepath.Join(dir, "quarantine"))
+}
+
+func TestStoreResponseRedirectChain(t *testing.T) {
+	const body = "<html>docs</html>"
+	tests := []struct {
+		name     string
+		chain    []model.Redirect // 経路（Locationは次のURLか最終的なURL）
+		finalURL string
+	}{
+		{
+			name:     "http to https",
+			chain:    []model.Redirect{{StatusCode: 301, URL: "http://example.com/"}},
+			finalURL: "https://example.com/",
+		},
+		{
+			name:     "trailing slash",
+			chain:    []model.Redirect{{StatusCode: 301, URL: "https://example.com/docs"}},
+			finalURL: "https://example.com/docs/",
+		},
+		{
+			name: "http to https, then trailing slash",
+			chain: []model.Redirect{
+				{StatusCode: 301, URL: "http://example.com/docs"},
+				{StatusCode: 308, URL: "https://example.com/docs"},
+			},
+			finalURL: "https://example.com/docs/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := openRepository(t)
+			policy := &model.FreshnessPolicy{DefaultTTL: time.Hour}
+
+			header := http.Header{"Content-Type": {"text/html"}}
+			header.Set(model.FinalURLHeader, tt.finalURL)
+			for _, r := range tt.chain {
+				header.Add(model.RedirectHeader, strconv.Itoa(r.StatusCode)+" "+r.URL)
+			}
+			req := &model.BpRequest{Method: "GET", URL: tt.chain[0].URL}
+			resp := &model.BpResponse{StatusCode: 200, Headers: header, Body: []byte(body), ContentType: "text/html"}
+			if err := storeResponse(ctx, repo, req, resp, policy); err != nil {
+				t.Fatal(err)
+			}
+
+			assertPage := func() {
+				t.Helper()
+				got, found, err := repo.GetResponse(ctx, req.WithURL(tt.finalURL))
+				if err != nil || !found || string(got.Body) != body {
+					t.Fatalf("GetResponse(%s) = %v, %v", tt.finalURL, found, err)
+				}
+			}
+			for i, r := range tt.chain {
+				location := tt.finalURL
+				if i+1 < len(tt.chain) {
+					location = tt.chain[i+1].URL
+				}
+				got, found, err := repo.GetResponse(ctx, req.WithURL(r.URL))
+				if err != nil || !found {
+					t.Fatalf("GetResponse(%s) = %v, %v", r.URL, found, err)
+				}
+				if got.StatusCode != r.StatusCode || http.Header(got.Headers).Get("Location") != location {
+					t.Errorf("redirect %s = %d %q, want %d %q", r.URL, got.StatusCode, http.Header(got.Headers).Get("Location"), r.StatusCode, location)
+				}
+			}
+			assertPage()
+
+			// 経路のエントリを削除してもページ本体は残る
+			for _, r := range tt.chain {
+				if _, err := repo.DeleteCacheEntries(ctx, &model.CacheFilter{URL: r.URL}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			assertPage()
+
+			result, err := repo.ScrubCaches(ctx, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Checked != 1 || result.Quarantined != 0 {
+				t.Errorf("ScrubCaches() = %+v", result)
+			}
+		})
+	}
+}
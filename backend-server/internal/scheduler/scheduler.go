@@ -17,6 +17,8 @@ type RequestProcessor struct {
 	cacheHandler    worker.CacheHandler
 	responseWatcher worker.ResponseWatcher // 修正: ポインタではなくインターフェース
 	cleanupInterval time.Duration
+	scrubInterval   time.Duration // キャッシュのファイルの整合性を確認する間隔（0は確認しない）
+	clearOnStart    bool          // 起動時にすべてのキャッシュを削除するか
 }
 
 func NewRequestProcessor(
@@ -26,6 +28,8 @@ func NewRequestProcessor(
 	cacheHandler worker.CacheHandler,
 	responseWatcher worker.ResponseWatcher, // 修正: ポインタではなくインターフェース
 	cleanupInterval time.Duration,
+	scrubInterval time.Duration,
+	clearOnStart bool,
 ) *RequestProcessor {
 	return &RequestProcessor{
 		workers:         workers,
@@ -35,14 +39,27 @@ func NewRequestProcessor(
 		cacheHandler:    cacheHandler,
 		responseWatcher: responseWatcher,
 		cleanupInterval: cleanupInterval,
+		scrubInterval:   scrubInterval,
+		clearOnStart:    clearOnStart,
 	}
 }
 
 func (rp *RequestProcessor) Start(ctx context.Context) {
-	// 0. すべてのキャッシュを削除（サーバ起動時のみ）
-	if err := rp.cacheHandler.DeleteAllCaches(ctx); err != nil {
-		log.Printf("[RequestProcessor] サーバ起動時のキャッシュ削除エラー: %v", err)
-		return
+	// 0. サーバ起動時のキャッシュの整理
+	// 取り込んだキャッシュや別のノードから移したキャッシュを使えるよう、通常は期限切れのエントリと
+	// ファイルの大きさが一致しないエントリだけを整理する（clearOnStartの場合はすべて削除する）
+	if rp.clearOnStart {
+		if err := rp.cacheHandler.DeleteAllCaches(ctx); err != nil {
+			log.Printf("[RequestProcessor] サーバ起動時のキャッシュ削除エラー: %v", err)
+			return
+		}
+	} else {
+		if err := rp.cacheHandler.DeleteExpiredCaches(ctx); err != nil {
+			log.Printf("[RequestProcessor] サーバ起動時の期限切れキャッシュ削除エラー: %v", err)
+		}
+		if err := rp.cacheHandler.ScrubCaches(ctx, false); err != nil {
+			log.Printf("[RequestProcessor] サーバ起動時の整合性の確認エラー: %v", err)
+		}
 	}
 
 	// 1. Worker Poolを起動(リクエスト処理)
@@ -59,7 +76,13 @@ func (rp *RequestProcessor) Start(ctx context.Context) {
 	go rp.startCacheCleanup(ctx)
 	log.Printf("[RequestProcessor] キャッシュクリーンアップを起動しました")
 
-	// 4. ResponseWatcherを起動
+	// 4. キャッシュの整合性の確認を起動
+	if rp.scrubInterval > 0 {
+		go rp.startCacheScrub(ctx)
+		log.Printf("[RequestProcessor] キャッシュの整合性の確認を起動しました")
+	}
+
+	// 5. ResponseWatcherを起動
 	go rp.responseWatcher.Start(ctx)
 	log.Printf("[RequestProcessor] ResponseWatcherを起動しました")
 }
@@ -127,6 +150,30 @@ func (rp *RequestProcessor) startCacheCleanup(ctx context.Context) {
 			} else {
 				log.Printf("[Cache Cleanup] 期限切れキャッシュを削除しました")
 			}
+			if err := rp.cacheHandler.EvictCaches(ctx); err != nil {
+				log.Printf("[Cache Cleanup] 容量超過キャッシュ削除エラー: %v", err)
+			}
+		}
+	}
+}
+
+// startCacheScrub scrubIntervalごとにすべてのキャッシュのファイルを確認する
+// ファイルをすべて読み込むため、クリーンアップより長い間隔で実行する
+func (rp *RequestProcessor) startCacheScrub(ctx context.Context) {
+	log.Printf("[Cache Scrub] キャッシュの整合性の確認を開始しました")
+	defer log.Printf("[Cache Scrub] キャッシュの整合性の確認を終了しました")
+
+	ticker := time.NewTicker(rp.scrubInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rp.cacheHandler.ScrubCaches(ctx, true); err != nil {
+				log.Printf("[Cache Scrub] 整合性の確認エラー: %v", err)
+			}
 		}
 	}
 }
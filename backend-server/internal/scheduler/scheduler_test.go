@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/application/model"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository"
+	"github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/repository/plugins"
+	scheduler_worker "github.com/watanabetatsumi/ORF-2025-Space/backend-server/internal/infrastructure/worker"
+)
+
+type idleRequestHandler struct{}
+
+func (idleRequestHandler) HandleRequest(ctx context.Context, req *model.BpRequest, workerID int) error {
+	return nil
+}
+
+// idleQueueWatcher キューからジョブを取り出さない（予約したリクエストが残っているか確認するため）
+type idleQueueWatcher struct{}
+
+func (idleQueueWatcher) WatchQueue(ctx context.Context) (*model.BpRequest, error) {
+	<-ctx.Done()
+	return nil, nil
+}
+
+type idleResponseWatcher struct{}
+
+func (idleResponseWatcher) Start(ctx context.Context) {}
+
+func storeConfig() plugins.RedisClientConfig {
+	return plugins.RedisClientConfig{
+		ReservedRequestsKey: "bp:reserved:requests",
+		PendingRequestsKey:  "bp:pending:requests",
+		SubscriptionsKey:    "bp:subscriptions",
+		CacheMetaPattern:    "bp:cache:meta:*",
+		CacheAccessKey:      "bp:cache:access",
+		CacheIndexKey:       "bp:cache:index",
+		CachePinsKey:        "bp:cache:pins",
+	}
+}
+
+func openRepository(t *testing.T, dir string) (*plugins.EmbeddedClient, *repository.BpRepository) {
+	t.Helper()
+	client, err := plugins.NewEmbeddedClient(filepath.Join(dir, "store.log"), storeConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewBpRepository(client, filepath.Join(dir, "cache"), time.Hour, 0,
+		&model.EvictionPolicy{Mode: model.EvictLRU}, 0, &model.IntegrityPolicy{Verify: model.VerifyAlways}, filepath.Join(dir, "quarantine"))
+	return client, repo
+}
+
+// 起動した後にembeddedのストアを開き直しても、clear_on_startでなければキャッシュ・インデックス・予約が残る
+func TestStartKeepsEmbeddedStore(t *testing.T) {
+	tests := []struct {
+		name         string
+		clearOnStart bool
+		wantKept     bool
+	}{
+		{name: "keep", clearOnStart: false, wantKept: true},
+		{name: "clear on start", clearOnStart: true, wantKept: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx := context.Background()
+			fresh := &model.BpRequest{Method: "GET", URL: "https://example.com/fresh"}
+			expired := &model.BpRequest{Method: "GET", URL: "https://example.com/expired"}
+			resp := func(body string) *model.BpResponse {
+				return &model.BpResponse{StatusCode: 200, Headers: map[string][]string{}, Body: []byte(body), ContentType: "text/plain"}
+			}
+
+			client, repo := openRepository(t, dir)
+			if err := repo.SetResponseWithURL(ctx, fresh, resp("fresh"), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.SetResponseWithURL(ctx, expired, resp("expired"), -2*time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.ReserveRequest(ctx, &model.BpRequest{Method: "GET", URL: "https://example.com/queued"}); err != nil {
+				t.Fatal(err)
+			}
+
+			runCtx, cancel := context.WithCancel(ctx)
+			processor := NewRequestProcessor(1, idleRequestHandler{}, idleQueueWatcher{}, scheduler_worker.NewCacheHandler(repo),
+				idleResponseWatcher{}, time.Hour, 0, tt.clearOnStart)
+			processor.Start(runCtx)
+			cancel()
+			client.Close()
+
+			client, repo = openRepository(t, dir)
+			defer client.Close()
+			if _, found, _ := repo.GetResponse(ctx, fresh); found != tt.wantKept {
+				t.Errorf("fresh entry found = %v, want %v", found, tt.wantKept)
+			}
+			if _, found, _ := repo.GetResponse(ctx, expired); found {
+				t.Error("entry past max_stale survived startup")
+			}
+			hosts, _ := client.GetIndexedHosts(ctx)
+			if (len(hosts) == 1) != tt.wantKept {
+				t.Errorf("indexed hosts = %v", hosts)
+			}
+			jobs, _ := client.GetReservedRequests(ctx)
+			if (len(jobs) == 1) != tt.wantKept {
+				t.Errorf("reserved requests = %d", len(jobs))
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// errorPageFile エラーページのテンプレートファイル名（defaultDir内）
+const errorPageFile = "error.html"
+
+// fallbackErrorPage テンプレートファイルが存在しない場合に使用するエラーページ
+const fallbackErrorPage = `<!DOCTYPE html>
+<html lang="ja"><head><meta charset="UTF-8"><title>{{.Title}}</title></head>
+<body><h1>{{.Title}}</h1><p>{{.URL}}</p><p>{{.Message}} ({{.Class}})</p></body></html>`
+
+// ErrorPageData エラーページに埋め込む値
+type ErrorPageData struct {
+	Title   string // ユーザー向けの説明
+	Class   string // エラーの分類
+	Message string // エラーの詳細
+	URL     string // 取得しようとしたURL
+	Status  int    // HTTPステータスコード
+
+	ContentType   string // レスポンスのContent-Type（大きさ・種類の制限で中止した場合）
+	Size          int64  // レスポンスの大きさ（不明な場合は0）
+	Limit         int64  // 適用された大きさの上限
+	CanRetryLarge bool   // 大きなレスポンスとして明示的に要求できるか
+}
+
+// SizeText レスポンスの大きさを読みやすい形式で返す
+func (d ErrorPageData) SizeText() string {
+	return formatBytes(d.Size)
+}
+
+// LimitText 大きさの上限を読みやすい形式で返す
+func (d ErrorPageData) LimitText() string {
+	return formatBytes(d.Limit)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// RenderErrorPage defaultDir内のテンプレートからエラーページを生成する
+// テンプレートファイルが存在しない場合はコードで生成する
+func RenderErrorPage(defaultDir string, data ErrorPageData) ([]byte, error) {
+	text := fallbackErrorPage
+	if html, err := LoadDefaultPage(filepath.Join(defaultDir, errorPageFile)); err == nil {
+		text = string(html)
+	}
+
+	tmpl, err := template.New(errorPageFile).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
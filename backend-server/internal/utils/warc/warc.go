@@ -0,0 +1,281 @@
+// Package warc reads and writes WARC 1.1 files (ISO 28500) used to export and import the space cache
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// レコードの種類（WARC-Type）
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeResponse = "response"
+	TypeRequest  = "request"
+	TypeMetadata = "metadata"
+)
+
+// HTTPのレスポンス・リクエストを格納するレコードのContent-Type
+const (
+	ContentTypeHTTPResponse = "application/http;msgtype=response"
+	ContentTypeHTTPRequest  = "application/http;msgtype=request"
+)
+
+// Record WARCのレコード
+type Record struct {
+	// Type レコードの種類（TypeResponseなど）
+	Type string
+
+	// ID レコードのID（空の場合は書き込み時に生成する）
+	ID string
+
+	// Date 内容を取得した時刻
+	Date time.Time
+
+	// TargetURI 内容を取得したURL
+	TargetURI string
+
+	// ConcurrentTo 同時に取得したレコードのID（リクエストのレコードから対応するレスポンスを指す）
+	ConcurrentTo string
+
+	// ContentType ブロックのContent-Type
+	ContentType string
+
+	// Fields その他のヘッダー（拡張フィールドを含む、名前はそのまま書き出す）
+	Fields map[string]string
+
+	// Block レコードの内容
+	Block []byte
+}
+
+// Field その他のヘッダーを名前の大文字・小文字を区別せずに取得する
+func (r *Record) Field(name string) string {
+	for k, v := range r.Fields {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Writer WARCのレコードを順に書き出す
+type Writer struct {
+	w        io.Writer
+	compress bool
+}
+
+// NewWriter Writerを作成する
+// compress: レコードごとにgzipで圧縮する（.warc.gzの形式）
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress}
+}
+
+// Write レコードを1つ書き出す
+func (w *Writer) Write(r *Record) error {
+	if r.ID == "" {
+		id, err := NewRecordID()
+		if err != nil {
+			return err
+		}
+		r.ID = id
+	}
+	if r.Date.IsZero() {
+		r.Date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("WARC/1.1\r\n")
+	writeField(&buf, "WARC-Type", r.Type)
+	writeField(&buf, "WARC-Record-ID", r.ID)
+	writeField(&buf, "WARC-Date", r.Date.UTC().Format(time.RFC3339))
+	writeField(&buf, "WARC-Target-URI", r.TargetURI)
+	writeField(&buf, "WARC-Concurrent-To", r.ConcurrentTo)
+	writeField(&buf, "Content-Type", r.ContentType)
+	for name, value := range r.Fields {
+		writeField(&buf, name, value)
+	}
+	writeField(&buf, "Content-Length", strconv.Itoa(len(r.Block)))
+	buf.WriteString("\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		_, err := w.w.Write(buf.Bytes())
+		return err
+	}
+	gz := gzip.NewWriter(w.w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeField(buf *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	// 改行を含む値はヘッダーを壊すため空白に置き換える
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+}
+
+// Reader WARCのレコードを順に読み込む（gzipで圧縮されたファイルにも対応する）
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader Readerを作成する（先頭がgzipのマジックナンバーの場合は展開しながら読み込む）
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next 次のレコードを読み込む（終わりに達した場合はio.EOF）
+func (r *Reader) Next() (*Record, error) {
+	// 前のレコードの末尾の空行を読み飛ばす
+	var version string
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("warc: unexpected end of file")
+		}
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			version = line
+			break
+		}
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("warc: invalid record version line %q", version)
+	}
+
+	rec := &Record{Fields: make(map[string]string)}
+	length := -1
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("warc: unexpected end of header")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("warc: invalid header line %q", line)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "warc-type":
+			rec.Type = value
+		case "warc-record-id":
+			rec.ID = value
+		case "warc-date":
+			rec.Date, _ = time.Parse(time.RFC3339Nano, value)
+		case "warc-target-uri":
+			// WARC 1.0では "<...>" で囲まれている場合がある
+			rec.TargetURI = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "warc-concurrent-to":
+			rec.ConcurrentTo = value
+		case "content-type":
+			rec.ContentType = value
+		case "content-length":
+			length, err = strconv.Atoi(value)
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("warc: invalid Content-Length %q", value)
+			}
+		default:
+			rec.Fields[strings.TrimSpace(name)] = value
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("warc: record %s has no Content-Length", rec.ID)
+	}
+	rec.Block = make([]byte, length)
+	if _, err := io.ReadFull(r.r, rec.Block); err != nil {
+		return nil, fmt.Errorf("warc: truncated record %s: %w", rec.ID, err)
+	}
+	return rec, nil
+}
+
+// NewRecordID ランダムなUUIDからレコードのIDを生成する
+func NewRecordID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // バージョン4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122のバリアント
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// EncodeHTTPResponse HTTPのレスポンスをresponseレコードのブロックの形式にする
+// ボディはすでにデコードされているため、Transfer-EncodingとContent-Lengthは書き直す
+func EncodeHTTPResponse(statusCode int, header http.Header, body []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	h := header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// EncodeHTTPRequest HTTPのGETリクエストをrequestレコードのブロックの形式にする
+func EncodeHTTPRequest(method, targetURL string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(method, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", method, req.URL.RequestURI())
+	h := header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Set("Host", req.URL.Host)
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
+
+// ParseHTTPResponse responseレコードのブロックからHTTPのレスポンスとボディを読み込む
+func ParseHTTPResponse(block []byte) (*http.Response, []byte, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// ParseHTTPRequest requestレコードのブロックからHTTPのリクエストを読み込む
+func ParseHTTPRequest(block []byte) (*http.Request, error) {
+	return http.ReadRequest(bufio.NewReader(bytes.NewReader(block)))
+}
@@ -0,0 +1,140 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	date := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{"Content-Type": {"text/html"}, "Etag": {`"v1"`}, "Transfer-Encoding": {"chunked"}}
+	body := []byte("<html>hello\r\n\r\nWARC/1.1</html>")
+	reqBlock, err := EncodeHTTPRequest(http.MethodGet, "https://example.com/page?q=1", http.Header{"Accept-Language": {"ja"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []*Record{
+		{Type: TypeWarcinfo, ContentType: "application/warc-fields", Block: []byte("software: test\r\n")},
+		{
+			Type:        TypeResponse,
+			Date:        date,
+			TargetURI:   "https://example.com/page?q=1",
+			ContentType: ContentTypeHTTPResponse,
+			Fields:      map[string]string{"X-BP-Expires-At": "2025-01-02T12:00:00Z", "X-Multi": "a\r\nb"},
+			Block:       EncodeHTTPResponse(200, header, body),
+		},
+		{Type: TypeRequest, Date: date, TargetURI: "https://example.com/page?q=1", ContentType: ContentTypeHTTPRequest, Block: reqBlock},
+		{Type: TypeMetadata, TargetURI: "https://example.com/empty"},
+	}
+	records[2].ConcurrentTo = "<urn:uuid:00000000-0000-4000-8000-000000000000>"
+	records[1].ID = records[2].ConcurrentTo
+
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, compress)
+		for _, rec := range records {
+			if err := w.Write(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if compress && !bytes.HasPrefix(buf.Bytes(), []byte{0x1f, 0x8b}) {
+			t.Fatal("compressed output is not gzip")
+		}
+
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range records {
+			got, err := r.Next()
+			if err != nil {
+				t.Fatalf("compress=%v: record %d: %v", compress, i, err)
+			}
+			if got.Type != want.Type || got.ID != want.ID || !got.Date.Equal(want.Date.Truncate(time.Second)) ||
+				got.TargetURI != want.TargetURI || got.ConcurrentTo != want.ConcurrentTo || got.ContentType != want.ContentType ||
+				!bytes.Equal(got.Block, want.Block) {
+				t.Errorf("compress=%v: record %d = %+v, want %+v", compress, i, got, want)
+			}
+			if !strings.HasPrefix(got.ID, "<urn:uuid:") {
+				t.Errorf("compress=%v: record %d ID = %q", compress, i, got.ID)
+			}
+		}
+		if _, err := r.Next(); !errors.Is(err, io.EOF) {
+			t.Errorf("compress=%v: Next() after last record = %v, want io.EOF", compress, err)
+		}
+	}
+
+	// 拡張フィールドは大文字・小文字を区別せずに取得でき、改行は空白に置き換えられる
+	var buf bytes.Buffer
+	NewWriter(&buf, false).Write(records[1])
+	got, err := mustReader(t, &buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Field("x-bp-expires-at"); v != "2025-01-02T12:00:00Z" {
+		t.Errorf("Field() = %q", v)
+	}
+	if v := got.Field("X-Multi"); v != "a  b" {
+		t.Errorf("multi-line field = %q", v)
+	}
+
+	// HTTPのブロックを読み込むと元のヘッダーとボディに戻る（Transfer-Encodingは取り除く）
+	resp, respBody, err := ParseHTTPResponse(got.Block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || !bytes.Equal(respBody, body) || resp.Header.Get("Etag") != `"v1"` || resp.TransferEncoding != nil {
+		t.Errorf("ParseHTTPResponse() = %d %v %q", resp.StatusCode, resp.Header, respBody)
+	}
+	req, err := ParseHTTPRequest(reqBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != http.MethodGet || req.RequestURI != "/page?q=1" || req.Host != "example.com" || req.Header.Get("Accept-Language") != "ja" {
+		t.Errorf("ParseHTTPRequest() = %s %s %s %v", req.Method, req.RequestURI, req.Host, req.Header)
+	}
+}
+
+func mustReader(t *testing.T, r io.Reader) *Reader {
+	t.Helper()
+	reader, err := NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func TestReaderRejectsMalformedRecords(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "version line", input: "HTTP/1.1 200 OK\r\n\r\n", want: "invalid record version line"},
+		{name: "header line", input: "WARC/1.1\r\nWARC-Type response\r\n\r\n", want: "invalid header line"},
+		{name: "no Content-Length", input: "WARC/1.1\r\nWARC-Type: response\r\n\r\n", want: "has no Content-Length"},
+		{name: "invalid Content-Length", input: "WARC/1.1\r\nContent-Length: ten\r\n\r\n", want: "invalid Content-Length"},
+		{name: "negative Content-Length", input: "WARC/1.1\r\nContent-Length: -1\r\n\r\n", want: "invalid Content-Length"},
+		{name: "truncated header", input: "WARC/1.1\r\nWARC-Type: response\r\n", want: "unexpected end of header"},
+		{name: "truncated block", input: "WARC/1.1\r\nContent-Length: 10\r\n\r\nabc", want: "truncated record"},
+		{name: "truncated version line", input: "WARC/1.", want: "unexpected end of file"},
+	}
+	for _, tt := range tests {
+		_, err := mustReader(t, strings.NewReader(tt.input)).Next()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Next() = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte{0x1f, 0x8b, 0x00})); err == nil {
+		t.Error("NewReader() accepted a broken gzip header")
+	}
+	if _, _, err := ParseHTTPResponse([]byte("not http")); err == nil {
+		t.Error("ParseHTTPResponse() accepted a malformed block")
+	}
+}
@@ -0,0 +1,147 @@
+// Package archive packages a page and its subresources into a single multipart bundle
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ArchiveHeader アーカイブであることを示すレスポンスヘッダー（値はパート数）
+const ArchiveHeader = "X-Earth-Archive"
+
+// RequestHeader リクエストでアーカイブ化を指定するヘッダー
+const RequestHeader = "X-Earth-Archive"
+
+// パートごとのヘッダー
+const (
+	partURLHeader    = "Content-Location"
+	partStatusHeader = "X-Status-Code"
+)
+
+// ContentType アーカイブのメディアタイプ
+const ContentType = "multipart/mixed"
+
+// Part アーカイブに含める1つのリソース
+type Part struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// skipHeaders パートに含めないヘッダー（ボディの長さや転送方式はアーカイブ内で意味を持たない）
+var skipHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+}
+
+// Write パートをmultipart/mixed形式で書き出し、Content-Typeとボディを返す
+// 先頭のパートがページ本体になる
+func Write(parts []Part) (string, []byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	for _, p := range parts {
+		h := make(textproto.MIMEHeader)
+		for name, values := range p.Header {
+			if skipHeaders[name] {
+				continue
+			}
+			h[name] = values
+		}
+		h.Set(partURLHeader, p.URL)
+		h.Set(partStatusHeader, strconv.Itoa(p.StatusCode))
+
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to create part for %s: %w", p.URL, err)
+		}
+		if _, err := w.Write(p.Body); err != nil {
+			return "", nil, fmt.Errorf("failed to write part for %s: %w", p.URL, err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%s; boundary=%s", ContentType, mw.Boundary()), buf.Bytes(), nil
+}
+
+// EncodedSize パートをアーカイブに含めた場合のおおよそのサイズ（ヘッダー分を含む）
+func EncodedSize(p Part) int {
+	size := len(p.Body) + len(p.URL) + 128
+	for name, values := range p.Header {
+		for _, v := range values {
+			size += len(name) + len(v) + 4
+		}
+	}
+	return size
+}
+
+// Discover HTMLからページの表示に必要なサブリソース（画像・CSS・スクリプト・アイコン）のURLを抽出する
+func Discover(body []byte, baseURL *url.URL) []string {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var urls []string
+	add := func(ref string) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "data:") {
+			return
+		}
+		u, err := baseURL.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		s := u.String()
+		if !seen[s] && s != baseURL.String() {
+			seen[s] = true
+			urls = append(urls, s)
+		}
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Img, atom.Script, atom.Source:
+				add(attr(n, "src"))
+			case atom.Link:
+				rel := strings.ToLower(attr(n, "rel"))
+				if strings.Contains(rel, "stylesheet") || strings.Contains(rel, "icon") {
+					add(attr(n, "href"))
+				}
+			case atom.Video:
+				add(attr(n, "poster"))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return urls
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	page := []byte(`<html><head>
+<link rel="stylesheet" href="/css/site.css">
+<link rel="canonical" href="/other">
+<link rel="icon" href="favicon.ico">
+<script src="https://cdn.example.net/app.js"></script>
+</head><body>
+<img src="img/a.png"><img src="img/a.png"><img src="data:image/png;base64,AAAA">
+<a href="/next">next</a>
+</body></html>`)
+	base, _ := url.Parse("https://example.com/dir/index.html")
+
+	got := Discover(page, base)
+	want := []string{
+		"https://example.com/css/site.css",
+		"https://example.com/dir/favicon.ico",
+		"https://cdn.example.net/app.js",
+		"https://example.com/dir/img/a.png",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover() = %v, want %v", got, want)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	parts := []Part{
+		{URL: "https://example.com/", StatusCode: 200, Header: http.Header{"Content-Type": {"text/html"}, "Content-Length": {"5"}}, Body: []byte("<p>hi")},
+		{URL: "https://example.com/a.png", StatusCode: 200, Header: http.Header{"Content-Type": {"image/png"}}, Body: []byte{0x89, 'P', 'N', 'G', 0, 1, 2}},
+	}
+	contentType, body, err := Write(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != ContentType {
+		t.Fatalf("unexpected content type %q: %v", contentType, err)
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for i, want := range parts {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if got := p.Header.Get(partURLHeader); got != want.URL {
+			t.Errorf("part %d URL = %q, want %q", i, got, want.URL)
+		}
+		if got := p.Header.Get(partStatusHeader); got != "200" {
+			t.Errorf("part %d status = %q", i, got)
+		}
+		if p.Header.Get("Content-Length") != "" {
+			t.Errorf("part %d should not carry Content-Length", i)
+		}
+		data, _ := io.ReadAll(p)
+		if !bytes.Equal(data, want.Body) {
+			t.Errorf("part %d body mismatch", i)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected end of archive, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// Package bpsocket provides IPN endpoint identifiers used to address bundles
+package bpsocket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EID IPNスキームのエンドポイントID（ipn:ノード番号.サービス番号）
+type EID struct {
+	NodeNum uint64
+	SvcNum  uint64
+}
+
+// ParseEID "ipn:149.1" の形式の文字列をパースする
+func ParseEID(s string) (EID, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(s), "ipn:")
+	if !ok {
+		return EID{}, fmt.Errorf("unsupported EID scheme: %q", s)
+	}
+	node, svc, ok := strings.Cut(rest, ".")
+	if !ok {
+		return EID{}, fmt.Errorf("invalid EID: %q", s)
+	}
+	nodeNum, err := strconv.ParseUint(node, 10, 32)
+	if err != nil || nodeNum == 0 {
+		return EID{}, fmt.Errorf("invalid EID node number: %q", s)
+	}
+	svcNum, err := strconv.ParseUint(svc, 10, 32)
+	if err != nil {
+		return EID{}, fmt.Errorf("invalid EID service number: %q", s)
+	}
+	return EID{NodeNum: nodeNum, SvcNum: svcNum}, nil
+}
+
+// IsZero 宛先が指定されていないか
+func (e EID) IsZero() bool {
+	return e.NodeNum == 0
+}
+
+func (e EID) String() string {
+	return fmt.Sprintf("ipn:%d.%d", e.NodeNum, e.SvcNum)
+}
+
+// EID 受信したバンドルの送信元アドレスをEIDに変換する
+func (sa *SockaddrBP) EID() EID {
+	return EID{NodeNum: uint64(sa.NodeNum), SvcNum: uint64(sa.SvcNum)}
+}
@@ -10,10 +10,16 @@ import (
 
 const maxBundleSize = 4 * 1024 * 1024
 
+// Bundle 受信したバンドルとその送信元
+type Bundle struct {
+	Data []byte
+	From EID // 送信元のEID（取得できない場合はゼロ値）
+}
+
 // BpReceiver handles continuous bundle reception from BP Socket
 type BpReceiver struct {
 	socket   *BpSocket
-	dataChan chan []byte
+	dataChan chan Bundle
 	stopChan chan struct{}
 }
 
@@ -31,7 +37,7 @@ func NewBpReceiver(localNodeNum, localSvcNum uint64) (*BpReceiver, error) {
 
 	return &BpReceiver{
 		socket:   socket,
-		dataChan: make(chan []byte, 100),
+		dataChan: make(chan Bundle, 100),
 		stopChan: make(chan struct{}),
 	}, nil
 }
@@ -40,7 +46,7 @@ func (r *BpReceiver) Start() {
 	go r.receiveLoop()
 }
 
-func (r *BpReceiver) GetDataChannel() <-chan []byte {
+func (r *BpReceiver) GetDataChannel() <-chan Bundle {
 	return r.dataChan
 }
 
@@ -81,28 +87,40 @@ func (r *BpReceiver) receiveLoop() {
 		data := make([]byte, n)
 		copy(data, buf[:n])
 
+		// パイプラインが詰まっている間は受信を止める（バンドルはカーネル側のキューに残る）
 		select {
-		case r.dataChan <- data:
+		case r.dataChan <- Bundle{Data: data, From: fromAddr.EID()}:
 			log.Printf("[BpReceiver] Bundle dispatched to processing pipeline")
-		default:
-			log.Printf("[BpReceiver] WARNING: Data channel full, dropping bundle")
+		case <-r.stopChan:
+			log.Println("[BpReceiver] Receive loop stopped")
+			close(r.dataChan)
+			return
 		}
 	}
 }
 
-func ParseDTNRequest(data []byte) (url string, reqID string, err error) {
-	var req struct {
-		RequestID string `json:"request_id"`
-		URL       string `json:"url"`
-	}
+// DTNRequest Space側から受信するリクエスト
+type DTNRequest struct {
+	RequestID string              `json:"request_id"`
+	Method    string              `json:"method"`
+	URL       string              `json:"url"`
+	Headers   map[string][]string `json:"headers"`
+	Body      string              `json:"body,omitempty"`     // Base64エンコード（BATCHリクエストのURL一覧など）
+	ReplyTo   string              `json:"reply_to,omitempty"` // 応答の宛先EID（省略時は送信元に返す）
+}
+
+// ParseDTNRequest 受信したバンドルをリクエストとして解釈する
+// URLが空の場合もRequestIDは分かるので、エラーと共に解析済みの値を返す
+func ParseDTNRequest(data []byte) (*DTNRequest, error) {
+	var req DTNRequest
 
 	if err := json.Unmarshal(data, &req); err != nil {
-		return "", "", fmt.Errorf("JSON parse error: %w", err)
+		return &req, fmt.Errorf("JSON parse error: %w", err)
 	}
 
 	if req.URL == "" {
-		return "", "", fmt.Errorf("URL is empty")
+		return &req, fmt.Errorf("URL is empty")
 	}
 
-	return req.URL, req.RequestID, nil
+	return &req, nil
 }
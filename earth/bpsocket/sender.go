@@ -37,18 +37,36 @@ func NewBpSender(localNodeNum, localSvcNum, remoteNodeNum, remoteSvcNum uint64)
 }
 
 func (s *BpSender) Send(ctx context.Context, data interface{}) error {
+	return s.SendTo(ctx, data, EID{})
+}
+
+// DefaultRemote 宛先を指定しない場合の送信先
+func (s *BpSender) DefaultRemote() EID {
+	return EID{NodeNum: s.remoteNodeNum, SvcNum: s.remoteSvcNum}
+}
+
+// SendTo 指定したEIDにバンドルを送信する（ゼロ値の場合はデフォルトの送信先）
+func (s *BpSender) SendTo(ctx context.Context, data interface{}, to EID) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("JSON marshal error: %w", err)
 	}
+	return s.SendBytes(ctx, jsonData, to)
+}
+
+// SendBytes エンコード済みのデータをそのまま1つのバンドルとして送信する
+func (s *BpSender) SendBytes(ctx context.Context, data []byte, to EID) error {
+	if to.IsZero() {
+		to = s.DefaultRemote()
+	}
 
-	if len(jsonData) > maxBundleSize {
-		return fmt.Errorf("bundle size %d exceeds max %d", len(jsonData), maxBundleSize)
+	if len(data) > maxBundleSize {
+		return fmt.Errorf("bundle size %d exceeds max %d", len(data), maxBundleSize)
 	}
 
-	log.Printf("[BpSender] Sending %d bytes to ipn:%d.%d", len(jsonData), s.remoteNodeNum, s.remoteSvcNum)
+	log.Printf("[BpSender] Sending %d bytes to %s", len(data), to)
 
-	if err := s.socket.Send(jsonData, s.remoteNodeNum, s.remoteSvcNum); err != nil {
+	if err := s.socket.Send(data, to.NodeNum, to.SvcNum); err != nil {
 		return fmt.Errorf("socket send error: %w", err)
 	}
 
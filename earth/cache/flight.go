@@ -0,0 +1,41 @@
+package cache
+
+import "sync"
+
+// call 実行中の呼び出し
+type call struct {
+	wg  sync.WaitGroup
+	val any
+	err error
+}
+
+// flightGroup 同一キーの同時実行を1回にまとめる
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+func (g *flightGroup) do(key string, fn func() (any, error)) (any, error, bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := &call{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.val, c.err, false
+}
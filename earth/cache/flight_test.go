@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoCollapsesConcurrentCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		val  any
+		err  error
+	}{
+		{name: "value", val: "body"},
+		{name: "error", err: errors.New("fetch failed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Store{}
+			const callers = 8
+			var calls, entered atomic.Int32
+			var once sync.Once
+			release := make(chan struct{})
+			started := make(chan struct{})
+
+			type result struct {
+				val    any
+				err    error
+				shared bool
+			}
+			results := make(chan result, callers)
+			var wg sync.WaitGroup
+			run := func() {
+				defer wg.Done()
+				entered.Add(1)
+				v, err, shared := s.Do("key", func() (any, error) {
+					calls.Add(1)
+					once.Do(func() { close(started) })
+					<-release
+					return tt.val, tt.err
+				})
+				results <- result{v, err, shared}
+			}
+
+			// 先行する呼び出しが実行中になってから、残りを呼び出す
+			wg.Add(1)
+			go run()
+			<-started
+			for i := 1; i < callers; i++ {
+				wg.Add(1)
+				go run()
+			}
+			// 後から来た呼び出しが待機に入るまで待つ
+			for entered.Load() < callers {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(results)
+
+			if n := calls.Load(); n != 1 {
+				t.Errorf("fn called %d times, want 1", n)
+			}
+			shared := 0
+			for r := range results {
+				if r.val != tt.val || r.err != tt.err {
+					t.Errorf("Do() = %v, %v, want %v, %v", r.val, r.err, tt.val, tt.err)
+				}
+				if r.shared {
+					shared++
+				}
+			}
+			// 先行した呼び出し以外は結果を共有する
+			if shared != callers-1 {
+				t.Errorf("%d calls shared the result, want %d", shared, callers-1)
+			}
+		})
+	}
+}
+
+func TestDoRunsAgainAfterCompletion(t *testing.T) {
+	s := &Store{}
+	for i := range 2 {
+		v, err, shared := s.Do("key", func() (any, error) { return i, nil })
+		if v != i || err != nil || shared {
+			t.Errorf("call %d: Do() = %v, %v, %v", i, v, err, shared)
+		}
+	}
+	v, _, _ := s.Do("other", func() (any, error) { return "other", nil })
+	if v != "other" {
+		t.Errorf("Do(other) = %v", v)
+	}
+}
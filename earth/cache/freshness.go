@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heuristicFraction Last-Modifiedからのヒューリスティック鮮度の係数 (RFC 9111 4.2.2)
+const heuristicFraction = 10
+
+// heuristicMax ヒューリスティック鮮度の上限
+const heuristicMax = 24 * time.Hour
+
+// heuristicStatuses 明示的な鮮度情報が無くてもキャッシュ可能なステータス (RFC 9110 15.1)
+var heuristicStatuses = map[int]bool{
+	200: true, 203: true, 204: true, 206: false, 300: true, 301: true,
+	308: true, 404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// CacheControl Cache-Controlヘッダーをディレクティブ名 -> 値のマップに分解する
+func CacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(part, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return directives
+}
+
+// Storable 共有キャッシュとしてレスポンスを保存してよいかを判定する
+func Storable(method string, status int, h http.Header) bool {
+	if method != http.MethodGet {
+		return false
+	}
+	cc := CacheControl(h)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	// Earthは複数ノードで共有されるキャッシュなので private は保存しない
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	if h.Get("Vary") == "*" {
+		return false
+	}
+	if hasExplicitFreshness(h, cc) {
+		return true
+	}
+	return heuristicStatuses[status]
+}
+
+func hasExplicitFreshness(h http.Header, cc map[string]string) bool {
+	if _, ok := cc["s-maxage"]; ok {
+		return true
+	}
+	if _, ok := cc["max-age"]; ok {
+		return true
+	}
+	if _, ok := cc["public"]; ok {
+		return true
+	}
+	return h.Get("Expires") != ""
+}
+
+// FreshnessLifetime レスポンスの鮮度寿命を計算する (RFC 9111 4.2.1)
+// s-maxage > max-age > Expires - Date > Last-Modifiedからのヒューリスティック の順に評価する
+func FreshnessLifetime(h http.Header) time.Duration {
+	cc := CacheControl(h)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if v, ok := cc["s-maxage"]; ok {
+		return parseSeconds(v)
+	}
+	if v, ok := cc["max-age"]; ok {
+		return parseSeconds(v)
+	}
+
+	date := parseHTTPDate(h.Get("Date"), time.Now())
+	if expires := h.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// 不正なExpiresは「既に期限切れ」として扱う
+			return 0
+		}
+		if lifetime := t.Sub(date); lifetime > 0 {
+			return lifetime
+		}
+		return 0
+	}
+
+	if lm := h.Get("Last-Modified"); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil && date.After(t) {
+			lifetime := date.Sub(t) / heuristicFraction
+			if lifetime > heuristicMax {
+				lifetime = heuristicMax
+			}
+			return lifetime
+		}
+	}
+	return 0
+}
+
+// CurrentAge レスポンスの現在の経過時間を計算する (RFC 9111 4.2.3)
+func CurrentAge(h http.Header, requestTime, responseTime, now time.Time) time.Duration {
+	date := parseHTTPDate(h.Get("Date"), responseTime)
+	apparentAge := responseTime.Sub(date)
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	ageValue := parseSeconds(h.Get("Age"))
+	correctedAge := ageValue + responseTime.Sub(requestTime)
+	initialAge := apparentAge
+	if correctedAge > initialAge {
+		initialAge = correctedAge
+	}
+	return initialAge + now.Sub(responseTime)
+}
+
+func parseSeconds(v string) time.Duration {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+func parseHTTPDate(v string, fallback time.Time) time.Time {
+	if v == "" {
+		return fallback
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return fallback
+	}
+	return t
+}
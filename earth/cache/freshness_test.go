@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFreshnessLifetime(t *testing.T) {
+	date := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"s-maxage wins", http.Header{"Cache-Control": {"max-age=10, s-maxage=20"}}, 20 * time.Second},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=60"}}, 60 * time.Second},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache, max-age=60"}}, 0},
+		{"expires", http.Header{
+			"Date":    {date.Format(http.TimeFormat)},
+			"Expires": {date.Add(time.Hour).Format(http.TimeFormat)},
+		}, time.Hour},
+		{"invalid expires", http.Header{"Expires": {"0"}}, 0},
+		{"heuristic", http.Header{
+			"Date":          {date.Format(http.TimeFormat)},
+			"Last-Modified": {date.Add(-10 * time.Hour).Format(http.TimeFormat)},
+		}, time.Hour},
+		{"none", http.Header{}, 0},
+	}
+	for _, tt := range tests {
+		if got := FreshnessLifetime(tt.header); got != tt.want {
+			t.Errorf("%s: FreshnessLifetime() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStorable(t *testing.T) {
+	if Storable("GET", 200, http.Header{"Cache-Control": {"no-store"}}) {
+		t.Error("no-store response must not be stored")
+	}
+	if Storable("GET", 200, http.Header{"Cache-Control": {"private, max-age=60"}}) {
+		t.Error("private response must not be stored in a shared cache")
+	}
+	if Storable("POST", 200, http.Header{"Cache-Control": {"max-age=60"}}) {
+		t.Error("POST response must not be stored")
+	}
+	if !Storable("GET", 200, http.Header{}) {
+		t.Error("200 response should be heuristically storable")
+	}
+	if Storable("GET", 500, http.Header{}) {
+		t.Error("500 response without explicit freshness must not be stored")
+	}
+}
+
+func TestKeyUsesOnlyKeyHeaders(t *testing.T) {
+	// キーに含めるヘッダーが同じなら、順序や他のヘッダーに関係なく同じキーになる
+	a := Key("GET", "https://example.com/", map[string][]string{"Accept-Language": {"ja"}, "Accept": {"text/html"}})
+	b := Key("GET", "https://example.com/", map[string][]string{"Accept": {"text/html"}, "Accept-Language": {"ja"}, "User-Agent": {"x"}})
+	if a != b {
+		t.Errorf("keys differ: %s != %s", a, b)
+	}
+	// キーに含めるヘッダーが異なれば別のキーになる
+	c := Key("GET", "https://example.com/", map[string][]string{"Accept": {"text/html"}, "Accept-Language": {"en"}})
+	if a == c {
+		t.Errorf("keys for different Accept-Language should differ: %s", a)
+	}
+}
@@ -0,0 +1,52 @@
+// Package cache provides the ground-side HTTP response cache of the Earth station
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyHeaders キーに含めるリクエストヘッダー
+// レスポンスのVaryは見ずに、内容が変わりやすいヘッダーを常にキーに含める
+var keyHeaders = []string{"Accept", "Accept-Language"}
+
+// Key Earth側のキャッシュのキーを生成する
+// メソッド + URL + 重要なヘッダーをSHA256でハッシュ化し、"bp:cache:"を前置する
+// Space側のキー（URLだけの主キーとVaryによるバリアント）とは一致しないため、Earth側のキャッシュの中でだけ使う
+func Key(method, url string, headers map[string][]string) string {
+	baseKey := fmt.Sprintf("%s:%s", method, url)
+
+	var headerParts []string
+	for _, headerName := range keyHeaders {
+		if values, ok := headers[headerName]; ok {
+			headerParts = append(headerParts, fmt.Sprintf("%s:%s", headerName, strings.Join(values, ",")))
+		}
+	}
+	if len(headerParts) > 0 {
+		sort.Strings(headerParts)
+		baseKey += ":" + strings.Join(headerParts, "|")
+	}
+
+	hash := sha256.Sum256([]byte(baseKey))
+	return "bp:cache:" + hex.EncodeToString(hash[:])
+}
+
+// KeyHeaders キーの計算に使われるヘッダーだけを抜き出す
+// オリジンへ転送するヘッダーとキーを一致させるために使う
+func KeyHeaders(headers map[string][]string) map[string][]string {
+	out := make(map[string][]string)
+	for _, name := range keyHeaders {
+		if values, ok := headers[name]; ok && len(values) > 0 {
+			out[name] = values
+		}
+	}
+	return out
+}
+
+// fileName キャッシュキーからファイル名に使えるハッシュ部分を取り出す
+func fileName(key string) string {
+	return strings.TrimPrefix(key, "bp:cache:")
+}
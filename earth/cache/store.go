@@ -0,0 +1,280 @@
+package cache
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry キャッシュされたレスポンス（メタデータ部分）
+type Entry struct {
+	Key          string      `json:"key"`
+	URL          string      `json:"url"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"headers"`
+	Size         int64       `json:"size"`
+	RequestTime  time.Time   `json:"request_time"`
+	ResponseTime time.Time   `json:"response_time"`
+}
+
+// Age 現在の経過時間
+func (e *Entry) Age(now time.Time) time.Duration {
+	return CurrentAge(e.Header, e.RequestTime, e.ResponseTime, now)
+}
+
+// IsFresh 鮮度寿命内かどうか
+func (e *Entry) IsFresh(now time.Time) bool {
+	return e.Age(now) < FreshnessLifetime(e.Header)
+}
+
+// Staleness 鮮度寿命を超過した時間（新鮮な場合は0）
+func (e *Entry) Staleness(now time.Time) time.Duration {
+	if over := e.Age(now) - FreshnessLifetime(e.Header); over > 0 {
+		return over
+	}
+	return 0
+}
+
+// HasValidator 条件付きリクエストで再検証できるかどうか
+func (e *Entry) HasValidator() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// Store サイズ上限付きのディスクキャッシュ（LRUで追い出し）
+type Store struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // key -> lru element (Value: *Entry)
+	lru     *list.List               // 先頭が最近使われたもの
+	size    int64
+
+	flights flightGroup
+}
+
+// Open キャッシュディレクトリを開き、既存のエントリからインデックスを再構築する
+func Open(dir string, maxBytes int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	s := &Store{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	log.Printf("[Cache] Opened %s (%d entries, %d/%d bytes)", dir, s.lru.Len(), s.size, s.maxBytes)
+	return s, nil
+}
+
+// load ディスク上のメタデータを読み込む（古いアクセス順に並べるためmtimeでソート）
+func (s *Store) load() error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.meta"))
+	if err != nil {
+		return err
+	}
+
+	type loaded struct {
+		entry *Entry
+		mtime time.Time
+	}
+	var items []loaded
+	for _, metaPath := range matches {
+		info, err := os.Stat(metaPath)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil || e.Key == "" {
+			// 破損したエントリは削除
+			s.removeFiles(strings.TrimSuffix(filepath.Base(metaPath), ".meta"))
+			continue
+		}
+		if _, err := os.Stat(s.bodyPath(e.Key)); err != nil {
+			s.removeFiles(fileName(e.Key))
+			continue
+		}
+		items = append(items, loaded{entry: &e, mtime: info.ModTime()})
+	}
+
+	// 新しいものから順にPushBackする（古いものほど後ろ＝追い出し対象）
+	sort.Slice(items, func(i, j int) bool { return items[i].mtime.After(items[j].mtime) })
+	for _, it := range items {
+		s.entries[it.entry.Key] = s.lru.PushBack(it.entry)
+		s.size += it.entry.Size
+	}
+	s.evictLocked()
+	return nil
+}
+
+// Get エントリのメタデータを取得する（鮮度は問わない）
+func (s *Store) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	e := *elem.Value.(*Entry)
+	e.Header = e.Header.Clone()
+	now := time.Now()
+	_ = os.Chtimes(s.metaPath(key), now, now)
+	return &e, true
+}
+
+// ReadBody エントリのボディを読み込む
+func (s *Store) ReadBody(key string) ([]byte, error) {
+	return os.ReadFile(s.bodyPath(key))
+}
+
+// Put レスポンスを保存する
+// 上限を超える場合は最も使われていないエントリから追い出す
+func (s *Store) Put(e *Entry, body []byte) error {
+	e.Size = int64(len(body))
+	if s.maxBytes > 0 && e.Size > s.maxBytes {
+		return fmt.Errorf("entry size %d exceeds cache capacity %d", e.Size, s.maxBytes)
+	}
+
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// ボディ -> メタデータの順に書き込み、rename で置き換える（途中で落ちても壊れたエントリを残さない）
+	if err := writeFileAtomic(s.bodyPath(e.Key), body); err != nil {
+		return fmt.Errorf("failed to write cache body: %w", err)
+	}
+	if err := writeFileAtomic(s.metaPath(e.Key), meta); err != nil {
+		_ = os.Remove(s.bodyPath(e.Key))
+		return fmt.Errorf("failed to write cache metadata: %w", err)
+	}
+
+	if elem, ok := s.entries[e.Key]; ok {
+		s.size -= elem.Value.(*Entry).Size
+		elem.Value = e
+		s.lru.MoveToFront(elem)
+	} else {
+		s.entries[e.Key] = s.lru.PushFront(e)
+	}
+	s.size += e.Size
+	s.evictLocked()
+	return nil
+}
+
+// UpdateHeaders 304 Not Modified で再検証されたエントリのヘッダーと取得時刻を更新する
+func (s *Store) UpdateHeaders(key string, h http.Header, requestTime, responseTime time.Time) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, fmt.Errorf("cache entry %s not found", key)
+	}
+	e := *elem.Value.(*Entry)
+	e.Header = e.Header.Clone()
+	for name, values := range h {
+		// ボディに関わるヘッダーは保存済みのものを維持する
+		if name == "Content-Length" || name == "Content-Encoding" || name == "Transfer-Encoding" {
+			continue
+		}
+		e.Header[name] = values
+	}
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+
+	meta, err := json.Marshal(&e)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.metaPath(key), meta); err != nil {
+		return nil, err
+	}
+	elem.Value = &e
+	s.lru.MoveToFront(elem)
+
+	out := e
+	out.Header = e.Header.Clone()
+	return &out, nil
+}
+
+// Delete エントリを削除する
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteLocked(key)
+}
+
+// Do 同じキーに対する同時実行を1つにまとめる（重複リクエストの抑制）
+// 後から来た呼び出しは先行する呼び出しの結果を共有する
+func (s *Store) Do(key string, fn func() (any, error)) (v any, err error, shared bool) {
+	return s.flights.do(key, fn)
+}
+
+func (s *Store) evictLocked() {
+	if s.maxBytes <= 0 {
+		return
+	}
+	for s.size > s.maxBytes {
+		back := s.lru.Back()
+		if back == nil {
+			return
+		}
+		e := back.Value.(*Entry)
+		log.Printf("[Cache] Evicting %s (%d bytes)", e.URL, e.Size)
+		s.deleteLocked(e.Key)
+	}
+}
+
+func (s *Store) deleteLocked(key string) {
+	elem, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	s.size -= elem.Value.(*Entry).Size
+	s.lru.Remove(elem)
+	delete(s.entries, key)
+	s.removeFiles(fileName(key))
+}
+
+func (s *Store) removeFiles(name string) {
+	_ = os.Remove(filepath.Join(s.dir, name+".meta"))
+	_ = os.Remove(filepath.Join(s.dir, name+".body"))
+}
+
+func (s *Store) metaPath(key string) string {
+	return filepath.Join(s.dir, fileName(key)+".meta")
+}
+
+func (s *Store) bodyPath(key string) string {
+	return filepath.Join(s.dir, fileName(key)+".body")
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func putEntry(t *testing.T, s *Store, key string, size int) {
+	t.Helper()
+	e := &Entry{Key: key, URL: "https://example.com/" + key, StatusCode: 200, Header: http.Header{}}
+	if err := s.Put(e, []byte(strings.Repeat("x", size))); err != nil {
+		t.Fatalf("Put(%s): %v", key, err)
+	}
+}
+
+func storedKeys(s *Store) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*Entry).Key)
+	}
+	return keys
+}
+
+func TestStoreEviction(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		ops      func(t *testing.T, s *Store)
+		want     []string // 最近使われた順
+		wantSize int64
+	}{
+		{
+			name:     "least recently put is evicted",
+			maxBytes: 30,
+			ops: func(t *testing.T, s *Store) {
+				putEntry(t, s, "a", 10)
+				putEntry(t, s, "b", 10)
+				putEntry(t, s, "c", 10)
+				putEntry(t, s, "d", 10)
+			},
+			want:     []string{"d", "c", "b"},
+			wantSize: 30,
+		},
+		{
+			name:     "get refreshes recency",
+			maxBytes: 30,
+			ops: func(t *testing.T, s *Store) {
+				putEntry(t, s, "a", 10)
+				putEntry(t, s, "b", 10)
+				putEntry(t, s, "c", 10)
+				s.Get("a")
+				putEntry(t, s, "d", 10)
+			},
+			want:     []string{"d", "a", "c"},
+			wantSize: 30,
+		},
+		{
+			name:     "replacing an entry updates its size",
+			maxBytes: 30,
+			ops: func(t *testing.T, s *Store) {
+				putEntry(t, s, "a", 10)
+				putEntry(t, s, "b", 10)
+				putEntry(t, s, "a", 20)
+			},
+			want:     []string{"a", "b"},
+			wantSize: 30,
+		},
+		{
+			name:     "large entry evicts several",
+			maxBytes: 30,
+			ops: func(t *testing.T, s *Store) {
+				putEntry(t, s, "a", 10)
+				putEntry(t, s, "b", 10)
+				putEntry(t, s, "c", 10)
+				putEntry(t, s, "d", 25)
+			},
+			want:     []string{"d"},
+			wantSize: 25,
+		},
+		{
+			name:     "entry larger than capacity is rejected",
+			maxBytes: 30,
+			ops: func(t *testing.T, s *Store) {
+				putEntry(t, s, "a", 10)
+				e := &Entry{Key: "big", Header: http.Header{}}
+				if err := s.Put(e, make([]byte, 31)); err == nil {
+					t.Error("Put() of an entry larger than the cache succeeded")
+				}
+			},
+			want:     []string{"a"},
+			wantSize: 10,
+		},
+		{
+			name:     "unbounded",
+			maxBytes: 0,
+			ops: func(t *testing.T, s *Store) {
+				putEntry(t, s, "a", 100)
+				putEntry(t, s, "b", 100)
+			},
+			want:     []string{"b", "a"},
+			wantSize: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(dir, tt.maxBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.ops(t, s)
+
+			got := storedKeys(s)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+			if s.size != tt.wantSize {
+				t.Errorf("size = %d, want %d", s.size, tt.wantSize)
+			}
+			// 追い出したエントリのファイルも削除されている
+			files, _ := os.ReadDir(dir)
+			if len(files) != 2*len(tt.want) {
+				t.Errorf("%d files in cache directory, want %d", len(files), 2*len(tt.want))
+			}
+		})
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putEntry(t, s, "a", 10)
+	putEntry(t, s, "b", 10)
+	putEntry(t, s, "c", 10)
+	// 再読み込み時のアクセス順はメタデータの更新時刻で決まる（b, a, cの順に古い）
+	base := time.Now().Add(-time.Hour)
+	for i, key := range []string{"b", "a", "c"} {
+		at := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(s.metaPath(key), at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 壊れたメタデータとボディの無いエントリは読み込まない
+	if err := os.WriteFile(s.metaPath("broken"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	putEntry(t, s, "nobody", 10)
+	if err := os.Remove(s.bodyPath("nobody")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上限を下げて開き直すと、古いものから追い出される
+	s, err = Open(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(storedKeys(s), ","); got != "c,a" {
+		t.Errorf("entries after reopen = %s, want c,a", got)
+	}
+	if s.size != 20 {
+		t.Errorf("size after reopen = %d, want 20", s.size)
+	}
+	e, ok := s.Get("a")
+	if !ok || e.URL != "https://example.com/a" || e.Size != 10 {
+		t.Fatalf("Get(a) after reopen = %+v, %v", e, ok)
+	}
+	body, err := s.ReadBody("a")
+	if err != nil || len(body) != 10 {
+		t.Errorf("ReadBody(a) = %d bytes, %v", len(body), err)
+	}
+	for _, key := range []string{"b", "broken", "nobody"} {
+		if _, err := os.Stat(s.metaPath(key)); !os.IsNotExist(err) {
+			t.Errorf("metadata of %s left on disk: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"earth/archive"
+	"earth/transform"
+)
+
+// archiver ページ本体とサブリソースを1つのアーカイブにまとめる
+type archiver struct {
+	fetcher      *fetcher
+	transformers transform.Pipeline
+	enabled      bool
+	hosts        []string
+	maxBytes     int
+	maxParts     int
+	concurrency  int
+}
+
+// wants このリクエストのページをアーカイブとして送信するか判定する
+// リクエストヘッダーでの指定が設定より優先される
+func (a *archiver) wants(targetURL string, headers http.Header) bool {
+	if v := headers.Get(archive.RequestHeader); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	if a.enabled {
+		return true
+	}
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return false
+	}
+	return transform.MatchHost(u.Hostname(), a.hosts)
+}
+
+// build 変換済みのページ本体からサブリソースを取得し、アーカイブを組み立てる
+// 上限に収まらないサブリソースは含めない（Space側で個別にリクエストされる）
+func (a *archiver) build(page archive.Part, opts transform.Options) (contentType string, body []byte, parts int, err error) {
+	baseURL, err := url.Parse(page.URL)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	urls := archive.Discover(page.Body, baseURL)
+	if len(urls) > a.maxParts-1 {
+		log.Printf("📦 Archive %s: %d subresources found, keeping first %d", page.URL, len(urls), a.maxParts-1)
+		urls = urls[:a.maxParts-1]
+	}
+
+	// サブリソースを並行して取得・変換する（順序はページ内の出現順を維持）
+	fetched := make([]*archive.Part, len(urls))
+	sem := make(chan struct{}, a.concurrency)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, u string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fetched[i] = a.fetchPart(u, opts)
+		}(i, u)
+	}
+	wg.Wait()
+
+	included := []archive.Part{page}
+	size := archive.EncodedSize(page)
+	skipped := 0
+	for _, p := range fetched {
+		if p == nil {
+			continue
+		}
+		if n := archive.EncodedSize(*p); size+n <= a.maxBytes {
+			included = append(included, *p)
+			size += n
+		} else {
+			skipped++
+		}
+	}
+	if skipped > 0 {
+		log.Printf("📦 Archive %s: %d subresources skipped (max %d bytes)", page.URL, skipped, a.maxBytes)
+	}
+
+	contentType, body, err = archive.Write(included)
+	return contentType, body, len(included), err
+}
+
+// fetchPart サブリソースを取得して変換する。取得できなかった場合はnilを返す
+func (a *archiver) fetchPart(targetURL string, opts transform.Options) *archive.Part {
+	res, err := a.fetcher.Fetch(context.Background(), targetURL, nil)
+	if err != nil {
+		log.Printf("⚠️  Archive fetch error (%s): %v", targetURL, err)
+		return nil
+	}
+	if res.StatusCode != http.StatusOK {
+		log.Printf("⚠️  Archive fetch %s: status %d", targetURL, res.StatusCode)
+		return nil
+	}
+
+	tr := &transform.Response{URL: targetURL, Header: res.Header.Clone(), Body: res.Body}
+	applied, errs := a.transformers.Apply(tr, opts)
+	for _, err := range errs {
+		log.Printf("⚠️  Transform error: %v", err)
+	}
+	if len(applied) > 0 {
+		log.Printf("🗜️  Transformed %s [%s]: %d -> %d bytes", targetURL, strings.Join(applied, ","), len(res.Body), len(tr.Body))
+	}
+	return &archive.Part{URL: targetURL, StatusCode: res.StatusCode, Header: tr.Header, Body: tr.Body}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"earth/cache"
+	"earth/egress"
+	"earth/fetcherror"
+	"earth/sizelimit"
+)
+
+// キャッシュの利用状況を示すレスポンスヘッダー
+const cacheStatusHeader = "X-Earth-Cache"
+
+const (
+	cacheStatusMiss        = "MISS"        // オリジンから取得した
+	cacheStatusHit         = "HIT"         // 新鮮なエントリを返した
+	cacheStatusRevalidated = "REVALIDATED" // 条件付きリクエストで304を受け、保存済みのボディを返した
+	cacheStatusStale       = "STALE"       // オリジンに到達できず、期限切れのエントリを返した
+)
+
+// リダイレクトの経路を示すレスポンスヘッダー
+const (
+	redirectHeader = "X-Earth-Redirect"  // リダイレクトしたレスポンスごとに "<ステータス> <URL>"（経路順）
+	finalURLHeader = "X-Earth-Final-URL" // リダイレクトをたどった後の最終的なURL
+)
+
+// maxRedirects たどるリダイレクトの最大回数
+const maxRedirects = 10
+
+// fetchResult オリジンまたはキャッシュから取得したレスポンス
+type fetchResult struct {
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	CacheStatus string
+}
+
+// fetcher オリジンへのHTTPリクエストとEarth側キャッシュをまとめたもの
+type fetcher struct {
+	client     *http.Client
+	store      *cache.Store // nilの場合はキャッシュを使用しない
+	serveStale bool
+	maxStale   time.Duration
+	policy     *egress.Policy    // 接続先の制限（nilの場合は制限しない）
+	limits     *sizelimit.Policy // レスポンスの大きさと種類の制限（nilの場合は制限しない）
+}
+
+func newFetcher(timeout time.Duration, store *cache.Store, serveStale bool, maxStale time.Duration, policy *egress.Policy, limits *sizelimit.Policy) *fetcher {
+	client := &http.Client{Timeout: timeout}
+	if policy != nil {
+		client.Transport = policy.Transport()
+	}
+	return &fetcher{
+		client:     client,
+		store:      store,
+		serveStale: serveStale,
+		maxStale:   maxStale,
+		policy:     policy,
+		limits:     limits,
+	}
+}
+
+// Fetch URLのレスポンスを取得する
+// キャッシュが有効な場合、同じキーへの同時リクエストは1回のオリジンアクセスにまとめられる
+func (f *fetcher) Fetch(ctx context.Context, targetURL string, headers map[string][]string) (*fetchResult, error) {
+	// 拒否する接続先はキャッシュも返さない（ポリシーを変更した場合にすぐ反映するため）
+	if err := f.checkURL(targetURL); err != nil {
+		return nil, err
+	}
+
+	reqHeaders := cache.KeyHeaders(headers)
+	large := sizelimit.Requested(http.Header(headers))
+
+	if f.store == nil {
+		return f.fetchOrigin(ctx, targetURL, reqHeaders, nil, large)
+	}
+
+	key := cache.Key(http.MethodGet, targetURL, reqHeaders)
+	v, err, shared := f.store.Do(key, func() (any, error) {
+		return f.fetchCached(ctx, key, targetURL, reqHeaders, large)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := *v.(*fetchResult)
+	// キャッシュや同時リクエストの結果は別の上限で取得されている場合があるため、改めて検証する
+	if err := f.checkStored(targetURL, &res, large); err != nil {
+		return nil, err
+	}
+	res.Header = res.Header.Clone()
+	if shared {
+		// 先行リクエストの結果を共有した場合はHITとして扱う
+		log.Printf("🔁 Coalesced duplicate fetch: %s", targetURL)
+		res.CacheStatus = cacheStatusHit
+	}
+	res.Header.Set(cacheStatusHeader, res.CacheStatus)
+	return &res, nil
+}
+
+func (f *fetcher) fetchCached(ctx context.Context, key, targetURL string, reqHeaders http.Header, large bool) (*fetchResult, error) {
+	now := time.Now()
+	entry, found := f.store.Get(key)
+
+	var body []byte
+	if found {
+		var err error
+		body, err = f.store.ReadBody(key)
+		if err != nil {
+			// メタデータはあるがボディが読めない（追い出し直後など）はミス扱い
+			f.store.Delete(key)
+			found = false
+		}
+	}
+
+	if found && entry.IsFresh(now) {
+		log.Printf("💾 Cache HIT: %s (age %s)", targetURL, entry.Age(now).Truncate(time.Second))
+		return entryResult(entry, body, now, cacheStatusHit), nil
+	}
+
+	// 期限切れでもバリデータがあれば条件付きリクエストで再検証する
+	var validators http.Header
+	if found && entry.HasValidator() {
+		validators = make(http.Header)
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			validators.Set("If-None-Match", etag)
+		}
+		if lm := entry.Header.Get("Last-Modified"); lm != "" {
+			validators.Set("If-Modified-Since", lm)
+		}
+	}
+
+	requestTime := time.Now()
+	res, err := f.fetchOrigin(ctx, targetURL, reqHeaders, validators, large)
+	responseTime := time.Now()
+	if err != nil {
+		if found && f.serveStale && staleEligible(err) && (f.maxStale == 0 || entry.Staleness(now) <= f.maxStale) {
+			log.Printf("🥫 Serving stale cache for %s (origin error: %v)", targetURL, err)
+			stale := entryResult(entry, body, now, cacheStatusStale)
+			stale.Header.Add("Warning", `111 - "Revalidation Failed"`)
+			return stale, nil
+		}
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && found {
+		updated, err := f.store.UpdateHeaders(key, res.Header, requestTime, responseTime)
+		if err != nil {
+			log.Printf("⚠️  Cache update error (%s): %v", targetURL, err)
+			updated = entry
+		}
+		log.Printf("💾 Cache REVALIDATED: %s", targetURL)
+		return entryResult(updated, body, responseTime, cacheStatusRevalidated), nil
+	}
+
+	if cache.Storable(http.MethodGet, res.StatusCode, res.Header) {
+		e := &cache.Entry{
+			Key:          key,
+			URL:          targetURL,
+			StatusCode:   res.StatusCode,
+			Header:       res.Header.Clone(),
+			RequestTime:  requestTime,
+			ResponseTime: responseTime,
+		}
+		if err := f.store.Put(e, res.Body); err != nil {
+			log.Printf("⚠️  Cache store error (%s): %v", targetURL, err)
+		}
+	} else if found {
+		// 保存できないレスポンスに置き換わった場合は古いエントリを捨てる
+		f.store.Delete(key)
+	}
+	return res, nil
+}
+
+// fetchOrigin オリジンにGETリクエストを送信する
+// エラーは分類付きの*fetcherror.Errorとして返す
+// large: 大きなレスポンスの取得が明示的に要求されているか
+func (f *fetcher) fetchOrigin(ctx context.Context, targetURL string, reqHeaders, validators http.Header, large bool) (*fetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, fetcherror.New(fetcherror.ClassInvalid, targetURL, fmt.Errorf("request creation error: %w", err))
+	}
+	for name, values := range reqHeaders {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	for name, values := range validators {
+		req.Header[name] = values
+	}
+
+	// リダイレクトの経路を記録する（クライアントは共有しているのでリクエストごとにコピーする）
+	var chain []string
+	client := *f.client
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if f.policy != nil {
+			if err := f.policy.CheckURL(next.URL); err != nil {
+				return err
+			}
+		}
+		chain = append(chain, fmt.Sprintf("%d %s", next.Response.StatusCode, via[len(via)-1].URL))
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if errors.Is(err, egress.ErrBlocked) {
+		return nil, fetcherror.New(fetcherror.ClassBlocked, targetURL, err)
+	}
+	if err != nil {
+		return nil, fetcherror.Wrap(targetURL, fmt.Errorf("HTTP request error: %w", err))
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := f.readBody(targetURL, resp, large)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chain) > 0 {
+		resp.Header[redirectHeader] = chain
+		resp.Header.Set(finalURLHeader, resp.Request.URL.String())
+	}
+
+	return &fetchResult{
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		Body:        bodyBytes,
+		CacheStatus: cacheStatusMiss,
+	}, nil
+}
+
+// readBody 大きさと種類の制限に従ってボディを読み込む
+// Content-Lengthが上限を超える場合は読み込まずに、それ以外は上限を超えた時点で中止する
+func (f *fetcher) readBody(targetURL string, resp *http.Response, large bool) ([]byte, error) {
+	var body []byte
+	var err error
+	if f.limits == nil {
+		body, err = io.ReadAll(resp.Body)
+	} else {
+		var limit int64
+		limit, err = f.limits.Check(resp.Header, large)
+		if err == nil {
+			body, err = sizelimit.ReadAll(resp.Body, limit, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	var se *sizelimit.Error
+	if errors.As(err, &se) {
+		log.Printf("📏 Fetch aborted for %s: %v", targetURL, se)
+		return nil, limitError(targetURL, se)
+	}
+	if err != nil {
+		return nil, fetcherror.Wrap(targetURL, fmt.Errorf("body read error: %w", err))
+	}
+	return body, nil
+}
+
+// checkStored キャッシュから返すレスポンスが制限に収まっているか検証する
+func (f *fetcher) checkStored(targetURL string, res *fetchResult, large bool) error {
+	if f.limits == nil {
+		return nil
+	}
+	limit, err := f.limits.Check(res.Header, large)
+	if err == nil && limit > 0 && int64(len(res.Body)) > limit {
+		err = &sizelimit.Error{Err: sizelimit.ErrTooLarge, ContentType: res.Header.Get("Content-Type"), Size: int64(len(res.Body)), Limit: limit}
+	}
+	var se *sizelimit.Error
+	if errors.As(err, &se) {
+		return limitError(targetURL, se)
+	}
+	return err
+}
+
+// limitError 制限により中止した理由を、大きさと種類の情報付きの取得エラーにする
+func limitError(targetURL string, se *sizelimit.Error) *fetcherror.Error {
+	class := fetcherror.ClassTooLarge
+	if errors.Is(se, sizelimit.ErrDeniedType) {
+		class = fetcherror.ClassBlocked
+	}
+	fe := fetcherror.New(class, targetURL, se)
+	fe.ContentType = se.ContentType
+	fe.Size = se.Size
+	fe.Limit = se.Limit
+	return fe
+}
+
+// staleEligible 取得エラーの代わりに期限切れのエントリを返してよいか
+// ポリシーによる拒否や大きさの制限は、オリジンに到達できない場合とは異なるため対象外とする
+func staleEligible(err error) bool {
+	switch fetcherror.Classify(err) {
+	case fetcherror.ClassBlocked, fetcherror.ClassTooLarge:
+		return false
+	}
+	return true
+}
+
+// checkURL 接続先の制限に従ってURLを検証する
+func (f *fetcher) checkURL(targetURL string) error {
+	if f.policy == nil {
+		return nil
+	}
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return fetcherror.New(fetcherror.ClassInvalid, targetURL, err)
+	}
+	if err := f.policy.CheckURL(u); err != nil {
+		return fetcherror.New(fetcherror.ClassBlocked, targetURL, err)
+	}
+	return nil
+}
+
+// finalURL リダイレクト後の最終的なURLを返す（リダイレクトしていない場合はrequestURL）
+func finalURL(header http.Header, requestURL string) string {
+	if u := header.Get(finalURLHeader); u != "" {
+		return u
+	}
+	return requestURL
+}
+
+// entryResult キャッシュエントリからレスポンスを組み立てる（Ageヘッダーを付与）
+func entryResult(e *cache.Entry, body []byte, now time.Time, status string) *fetchResult {
+	h := e.Header.Clone()
+	h.Set("Age", fmt.Sprintf("%d", int64(e.Age(now).Seconds())))
+	return &fetchResult{
+		StatusCode:  e.StatusCode,
+		Header:      h,
+		Body:        body,
+		CacheStatus: status,
+	}
+}
+
+// Cached Earth側キャッシュに保存されているURLのエントリを返す（ボディは読み込まない）
+func (f *fetcher) Cached(targetURL string) (*cache.Entry, bool) {
+	if f.store == nil {
+		return nil, false
+	}
+	return f.store.Get(cache.Key(http.MethodGet, targetURL, cache.KeyHeaders(nil)))
+}
+
+// Head オリジンにHEADリクエストを送信し、ステータスコードとヘッダーを返す
+// マニフェストの項目の大きさと種類を、ボディを取得せずに調べるために使う
+func (f *fetcher) Head(ctx context.Context, targetURL string) (int, http.Header, error) {
+	if err := f.checkURL(targetURL); err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, targetURL, nil)
+	if err != nil {
+		return 0, nil, fetcherror.New(fetcherror.ClassInvalid, targetURL, fmt.Errorf("request creation error: %w", err))
+	}
+
+	client := *f.client
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if f.policy != nil {
+			return f.policy.CheckURL(next.URL)
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if errors.Is(err, egress.ErrBlocked) {
+		return 0, nil, fetcherror.New(fetcherror.ClassBlocked, targetURL, err)
+	}
+	if err != nil {
+		return 0, nil, fetcherror.Wrap(targetURL, fmt.Errorf("HTTP request error: %w", err))
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"earth/bpsocket"
+	"earth/journal"
+	"earth/sendqueue"
+	"earth/transport"
+)
+
+// journaledResponse ジャーナルに記録するレスポンス
+// 宛先・優先度・購読の情報はBpResponseのJSONに含まれないため、一緒に記録する
+type journaledResponse struct {
+	Response         BpResponse `json:"response"`
+	ReplyTo          string     `json:"reply_to,omitempty"`
+	Priority         int        `json:"priority"`
+	Subscription     string     `json:"subscription,omitempty"`      // 再送後に内容のハッシュを記録する購読
+	SubscriptionHash string     `json:"subscription_hash,omitempty"` // 再送後に記録するハッシュ
+}
+
+// jobTracker 受信したリクエストごとに、まだレスポンスを記録していない作業の数を数える
+//
+// リクエストを受信すると1、BATCHのURLやクロールで見つけたリンクを投入するとその数だけ増やし、
+// レスポンスを送信キューに入れるか、送信せずに終えると1減らす。0になったリクエストは完了として記録する。
+// 作業の数とクロールで訪問したURLはジャーナルが無効でも追跡し、完了したリクエストの訪問済みのURLは破棄する
+type jobTracker struct {
+	journal *journal.Journal // nilの場合はジャーナルに記録しない
+
+	mu      sync.Mutex
+	pending map[string]int
+	visited map[string]map[string]bool // 作業のIDごとの訪問済みのURL（visitedKey）
+	nextID  uint64                     // request_idの無いリクエストに割り当てるIDの通し番号
+}
+
+func newJobTracker(j *journal.Journal) *jobTracker {
+	return &jobTracker{journal: j, pending: make(map[string]int), visited: make(map[string]map[string]bool)}
+}
+
+// accept 受信したリクエストを記録し、作業を追跡するIDを返す
+// request_idの無いリクエストはジャーナルに記録せず、内部で割り当てたIDで追跡する
+// 処理中または完了済みのリクエストの再送の場合はfalseを返す
+// replayed: 起動時にジャーナルから再実行するリクエスト（すでに記録されている）
+func (t *jobTracker) accept(req *bpsocket.DTNRequest, bundle bpsocket.Bundle, replayed bool) (string, bool) {
+	if req.RequestID == "" {
+		t.mu.Lock()
+		t.nextID++
+		jobID := fmt.Sprintf("#%d", t.nextID)
+		t.mu.Unlock()
+		return t.start(jobID), true
+	}
+	if t.journal != nil && !replayed {
+		from := ""
+		if !bundle.From.IsZero() {
+			from = bundle.From.String()
+		}
+		ok, err := t.journal.AddRequest(req.RequestID, from, bundle.Data)
+		if err != nil {
+			// 記録できなくても処理は続ける（再起動した場合は再実行されない）
+			log.Printf("⚠️  Journal error (ID: %s): %v", req.RequestID, err)
+		} else if !ok {
+			return "", false
+		}
+	}
+	return t.start(req.RequestID), true
+}
+
+// start ジャーナルに記録しない作業（購読による再取得など）を追跡し、そのIDを返す
+func (t *jobTracker) start(jobID string) string {
+	t.add(jobID, 1)
+	return jobID
+}
+
+// add 作業をn個増やす
+func (t *jobTracker) add(jobID string, n int) {
+	if jobID == "" || n == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.pending[jobID] += n
+	t.mu.Unlock()
+}
+
+// finish 作業を1つ終える
+// 作業が残っていなければ、訪問済みのURLを破棄してリクエストの完了を記録する
+func (t *jobTracker) finish(jobID string) {
+	if jobID == "" {
+		return
+	}
+	t.mu.Lock()
+	t.pending[jobID]--
+	done := t.pending[jobID] <= 0
+	if done {
+		delete(t.pending, jobID)
+		delete(t.visited, jobID)
+	}
+	t.mu.Unlock()
+
+	if done && t.journal != nil {
+		if err := t.journal.CompleteRequest(jobID); err != nil {
+			log.Printf("⚠️  Journal error (ID: %s): %v", jobID, err)
+		}
+	}
+}
+
+// visit 作業の中でURLを訪問したことを記録する（すでに訪問していた場合はfalseを返す）
+func (t *jobTracker) visit(jobID, key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen := t.visited[jobID]
+	if seen == nil {
+		seen = make(map[string]bool)
+		t.visited[jobID] = seen
+	}
+	if seen[key] {
+		return false
+	}
+	seen[key] = true
+	return true
+}
+
+// unvisited 作業の中でまだ訪問していないURLだけを返す
+func (t *jobTracker) unvisited(jobID, reqID string, links []string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []string
+	for _, link := range links {
+		if !t.visited[jobID][visitedKey(reqID, link)] {
+			out = append(out, link)
+		}
+	}
+	return out
+}
+
+// record Send Stageのキューに入れる前にレスポンスを記録し、そのレスポンスを生成した作業を終える
+func (t *jobTracker) record(bpRes *BpResponse, priority int) {
+	defer t.finish(bpRes.JobID)
+	if t.journal == nil {
+		return
+	}
+	entry := journaledResponse{
+		Response:         *bpRes,
+		Priority:         priority,
+		Subscription:     bpRes.Subscription,
+		SubscriptionHash: bpRes.SubscriptionHash,
+	}
+	if !bpRes.ReplyTo.IsZero() {
+		entry.ReplyTo = bpRes.ReplyTo.String()
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		bpRes.JournalSeq, err = t.journal.AddResponse(bpRes.RequestID, data)
+	}
+	if err != nil {
+		log.Printf("⚠️  Journal error (ID: %s): %v", bpRes.RequestID, err)
+	}
+}
+
+// sent 送信したレスポンスを記録から取り除く
+func (t *jobTracker) sent(bpRes BpResponse) {
+	if t.journal == nil || bpRes.JournalSeq == 0 {
+		return
+	}
+	if err := t.journal.Ack(bpRes.JournalSeq); err != nil {
+		log.Printf("⚠️  Journal error (ID: %s): %v", bpRes.RequestID, err)
+	}
+}
+
+// replay 前回の起動で送信できなかったレスポンスをSend Stageのキューに入れる
+// 読み込めない記録は送信できないため、送信済みとして取り除く
+func (t *jobTracker) replay(pending []journal.Response, queue *sendqueue.Queue[BpResponse], tr transport.Transport) {
+	for _, p := range pending {
+		var entry journaledResponse
+		err := json.Unmarshal(p.Data, &entry)
+		if err == nil && entry.ReplyTo != "" {
+			entry.Response.ReplyTo, err = bpsocket.ParseEID(entry.ReplyTo)
+		}
+		if err != nil {
+			log.Printf("⚠️  Dropping unreadable journaled response #%d: %v", p.Seq, err)
+			t.journal.Ack(p.Seq)
+			continue
+		}
+		bpRes := entry.Response
+		bpRes.JournalSeq = p.Seq
+		bpRes.Subscription = entry.Subscription
+		bpRes.SubscriptionHash = entry.SubscriptionHash
+		queue.Push(replyKey(bpRes.ReplyTo, tr), entry.Priority, len(bpRes.Body), bpRes)
+	}
+}
+
+// replayBundle ジャーナルに記録されていたリクエストを受信したバンドルとして復元する
+func replayBundle(req journal.Request) bpsocket.Bundle {
+	bundle := bpsocket.Bundle{Data: req.Data}
+	if req.From != "" {
+		eid, err := bpsocket.ParseEID(req.From)
+		if err != nil {
+			log.Printf("⚠️  Ignoring invalid sender %q of journaled request %s: %v", req.From, req.ID, err)
+		}
+		bundle.From = eid
+	}
+	return bundle
+}
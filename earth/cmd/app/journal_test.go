@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"earth/bpsocket"
+	"earth/journal"
+)
+
+func TestJobTrackerDropsVisitedOnCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal bool
+		reqID   string
+	}{
+		{name: "journal disabled", reqID: "req-1"},
+		{name: "journal enabled", journal: true, reqID: "req-1"},
+		{name: "no request id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var j *journal.Journal
+			if tt.journal {
+				var err error
+				j, err = journal.Open(filepath.Join(t.TempDir(), "journal.log"), time.Hour, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer j.Close()
+			}
+			jobs := newJobTracker(j)
+
+			jobID, ok := jobs.accept(&bpsocket.DTNRequest{RequestID: tt.reqID, URL: "http://example.com/"}, bpsocket.Bundle{}, false)
+			if !ok || jobID == "" {
+				t.Fatalf("accept() = %q, %v", jobID, ok)
+			}
+			if !jobs.visit(jobID, visitedKey(tt.reqID, "http://example.com/")) {
+				t.Fatal("first visit reported as duplicate")
+			}
+			if jobs.visit(jobID, visitedKey(tt.reqID, "http://example.com/")) {
+				t.Fatal("second visit not reported as duplicate")
+			}
+			links := jobs.unvisited(jobID, tt.reqID, []string{"http://example.com/", "http://example.com/a"})
+			if len(links) != 1 || links[0] != "http://example.com/a" {
+				t.Fatalf("unvisited() = %v", links)
+			}
+			jobs.add(jobID, len(links))
+
+			jobs.finish(jobID)
+			if len(jobs.visited) != 1 {
+				t.Fatalf("visited set dropped while work is pending")
+			}
+			jobs.finish(jobID)
+			if len(jobs.visited) != 0 || len(jobs.pending) != 0 {
+				t.Fatalf("visited = %v, pending = %v after completion", jobs.visited, jobs.pending)
+			}
+			if tt.journal {
+				if reqs, _ := j.Pending(); len(reqs) != 0 {
+					t.Fatalf("request not completed in journal: %v", reqs)
+				}
+			}
+		})
+	}
+}
@@ -3,17 +3,31 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"earth/archive"
 	"earth/bpsocket"
+	"earth/cache"
+	"earth/cmd/config"
+	"earth/egress"
+	"earth/fetcherror"
+	"earth/journal"
+	"earth/manifest"
+	"earth/sendqueue"
+	"earth/sizelimit"
+	"earth/subscription"
+	"earth/transform"
+	"earth/transport"
 )
 
 // DTNJsonRequest DTN経由で受信するリクエスト構造体
@@ -30,258 +44,618 @@ type DTNJsonRequest struct {
 type CrawlRequest struct {
 	RequestID string
 	URL       string
+	Headers   map[string][]string // Space側から受け取ったリクエストヘッダー（クロール時はnil）
 	Depth     int
+	MaxDepth  int               // 再帰クロールの最大深さ（購読ごとに異なる）
+	Options   transform.Options // 変換オプション（クロール時は元のリクエストから引き継ぐ）
+	Archive   bool              // HTMLページをアーカイブとして送信するか（クロール時は元のリクエストから引き継ぐ）
+	ReplyTo   bpsocket.EID      // 応答の宛先（ゼロ値はデフォルトの送信先、クロール時は元のリクエストから引き継ぐ）
+
+	Subscription string // 購読による再取得の場合は購読のURL（内容が変化した場合のみ送信する）
+	JobID        string // 作業を追跡するID（受信したリクエストのID、クロール時は元のリクエストから引き継ぐ）
 }
 
 // BpResponse HTTPレスポンスに必要な情報を格納する構造体
 type BpResponse struct {
-	RequestID     string              `json:"request_id"`
-	StatusCode    int                 `json:"status_code"`
-	Headers       map[string][]string `json:"headers"`
-	Body          string              `json:"body"` // Base64エンコード
-	ContentType   string              `json:"content_type,omitempty"`
-	ContentLength int64               `json:"content_length,omitempty"`
-	Depth         int                 `json:"-"` // 内部管理用 (JSONには含めない)
+	RequestID        string              `json:"request_id"`
+	StatusCode       int                 `json:"status_code"`
+	Headers          map[string][]string `json:"headers"`
+	Body             string              `json:"body"` // Base64エンコード
+	ContentType      string              `json:"content_type,omitempty"`
+	ContentLength    int64               `json:"content_length,omitempty"`
+	Depth            int                 `json:"-"` // 内部管理用 (JSONには含めない)
+	MaxDepth         int                 `json:"-"` // 内部管理用 (JSONには含めない)
+	Subscription     string              `json:"-"` // 内部管理用 (JSONには含めない)
+	SubscriptionHash string              `json:"-"` // 購読による取得の場合、送信後に記録するボディのハッシュ
+	Options          transform.Options   `json:"-"` // 内部管理用 (JSONには含めない)
+	Archive          bool                `json:"-"` // 内部管理用 (JSONには含めない)
+	ReplyTo          bpsocket.EID        `json:"-"` // 内部管理用 (JSONには含めない)
+	JobID            string              `json:"-"` // 内部管理用 (JSONには含めない)
+	JournalSeq       uint64              `json:"-"` // ジャーナルでの通し番号（送信後に記録から取り除くため、0は記録していない）
+	Err              *fetcherror.Error   `json:"-"` // 取得に失敗した理由を伝えるエラーレスポンスの場合の失敗の内容
 }
 
 // 共通リソース
+// maxRetryBackoff 送信の再送間隔の上限
+const maxRetryBackoff = time.Minute
+
 var (
-	visitedURLs  = make(map[string]bool)
-	visitedMutex sync.Mutex
-	linkRegex    = regexp.MustCompile(`(?i)<a\s+(?:[^>]*?\s+)?href=["']?([^"'>\s]+)["']?`)
-	maxDepth     = 2
+	linkRegex = regexp.MustCompile(`(?i)<a\s+(?:[^>]*?\s+)?href=["']?([^"'>\s]+)["']?`)
 )
 
 func main() {
 	log.Println("=== Earth Station with BP Socket Gateway ===")
 
-	// BP Socket設定
-	const (
-		localNodeNum   = 150 // Earth node
-		localSvcNum    = 1   // Receive on ipn:150.1 (use 3 if conflict with ION)
-		sendFromSvcNum = 2   // Send from ipn:150.2 (use 4 if conflict)
-		remoteNodeNum  = 149 // Space node
-		remoteSvcNum   = 1   // Send to ipn:149.1
-	)
-
-	// BP Socket Receiverの初期化
-	receiver, err := bpsocket.NewBpReceiver(localNodeNum, localSvcNum)
+	// ============================================
+	// 設定の読み込み
+	// ============================================
+	conf, err := config.LoadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	conf.Print(log.Writer())
+
+	// トランスポート（bp_socket / ion_cli / tcp / udp）の初期化
+	tr, err := openTransport(conf)
 	if err != nil {
-		log.Fatalf("Failed to create BP receiver: %v", err)
+		log.Fatalf("Failed to open %s transport: %v", conf.Transport.Mode, err)
 	}
-	defer receiver.Close()
+	defer tr.Close()
 
-	// BP Socket Senderの初期化
-	sender, err := bpsocket.NewBpSender(localNodeNum, sendFromSvcNum, remoteNodeNum, remoteSvcNum)
+	// Earth側キャッシュの初期化
+	var store *cache.Store
+	if conf.Cache.Enabled {
+		store, err = cache.Open(conf.Cache.Dir, conf.Cache.MaxSizeMB*1024*1024)
+		if err != nil {
+			log.Fatalf("Failed to open cache: %v", err)
+		}
+	}
+	// 接続先の制限（SSRF対策）
+	allowCIDRs, err := egress.ParsePrefixes(conf.Egress.AllowCIDRs)
 	if err != nil {
-		log.Fatalf("Failed to create BP sender: %v", err)
+		log.Fatalf("Invalid egress.allow_cidrs: %v", err)
+	}
+	denyCIDRs, err := egress.ParsePrefixes(conf.Egress.DenyCIDRs)
+	if err != nil {
+		log.Fatalf("Invalid egress.deny_cidrs: %v", err)
+	}
+	policy := &egress.Policy{
+		AllowPrivate: conf.Egress.AllowPrivate,
+		AllowCIDRs:   allowCIDRs,
+		DenyCIDRs:    denyCIDRs,
+		AllowHosts:   conf.Egress.AllowHosts,
+		DenyHosts:    conf.Egress.DenyHosts,
+		Ports:        conf.Egress.Ports,
+	}
+	if policy.AllowPrivate {
+		log.Printf("⚠️  Egress policy allows private and loopback addresses")
 	}
-	defer sender.Close()
+
+	// レスポンスの大きさと種類の制限
+	limits := &sizelimit.Policy{
+		MaxBytes:      conf.Fetch.MaxBytes,
+		LargeMaxBytes: conf.Fetch.LargeMaxBytes,
+		DenyTypes:     conf.Fetch.DenyTypes,
+	}
+	for _, rule := range conf.Fetch.Limits {
+		limits.Rules = append(limits.Rules, sizelimit.Rule{Type: rule.Type, MaxBytes: rule.MaxBytes})
+	}
+	f := newFetcher(conf.Fetch.Timeout, store, conf.Cache.ServeStaleOnError, conf.Cache.MaxStale, policy, limits)
 
 	// パイプライン用チャネルの作成
-	urlChan := make(chan CrawlRequest, 100)
-	bpResChan := make(chan BpResponse, 100)
-	sendChan := make(chan BpResponse, 100)
+	urlChan := make(chan CrawlRequest, conf.Pipeline.QueueSize)
+	bpResChan := make(chan BpResponse, conf.Pipeline.QueueSize)
+	transformChan := make(chan BpResponse, conf.Pipeline.QueueSize)
+	sendChan := make(chan BpResponse, conf.Pipeline.QueueSize)
+
+	// 送信前に適用する変換
+	var transformers transform.Pipeline
+	if conf.Transform.Image.Enabled {
+		transformers = append(transformers, &transform.ImageTranscoder{
+			MaxDimension: conf.Transform.Image.MaxDimension,
+			MaxPixels:    conf.Transform.Image.MaxPixels,
+			Quality:      conf.Transform.Image.Quality,
+			ExcludeHosts: conf.Transform.Image.ExcludeHosts,
+		})
+	}
+	liteRules := make([]transform.LiteHostRule, 0, len(conf.Transform.Lite.Hosts))
+	for _, rule := range conf.Transform.Lite.Hosts {
+		liteRules = append(liteRules, transform.LiteHostRule{Match: rule.Match, Mode: rule.Mode})
+	}
+	transformers = append(transformers, &transform.LiteRewriter{
+		DefaultMode:       conf.Transform.Lite.DefaultMode,
+		HostRules:         liteRules,
+		TrackerHosts:      conf.Transform.Lite.TrackerHosts,
+		InlineCSSMaxBytes: conf.Transform.Lite.InlineCSSMaxBytes,
+		FetchCSS: func(cssURL string) ([]byte, error) {
+			res, err := f.Fetch(context.Background(), cssURL, nil)
+			if err != nil {
+				return nil, err
+			}
+			if res.StatusCode != 200 {
+				return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+			}
+			return res.Body, nil
+		},
+	})
+
+	// ページアーカイブの組み立て
+	arc := &archiver{
+		fetcher:      f,
+		transformers: transformers,
+		enabled:      conf.Archive.Enabled,
+		hosts:        conf.Archive.Hosts,
+		maxBytes:     conf.Archive.MaxBytes,
+		maxParts:     conf.Archive.MaxParts,
+		concurrency:  conf.Archive.Concurrency,
+	}
+
+	// 処理中の作業の記録（再起動後に未完了のリクエストと未送信のレスポンスを再実行する）
+	var jr *journal.Journal
+	var pendingReqs []journal.Request
+	var pendingResps []journal.Response
+	if conf.Journal.Enabled {
+		jr, err = journal.Open(conf.Journal.File, conf.Journal.DedupeWindow, conf.Journal.CompactBytes)
+		if err != nil {
+			log.Fatalf("Failed to open journal: %v", err)
+		}
+		defer jr.Close()
+		pendingReqs, pendingResps = jr.Pending()
+		log.Printf("📒 Journal: %d unfinished requests and %d unsent responses to replay", len(pendingReqs), len(pendingResps))
+	}
+	jobs := newJobTracker(jr)
+
+	// 購読の読み込み
+	subs, err := subscription.Open(conf.Subscription.File)
+	if err != nil {
+		log.Fatalf("Failed to open subscriptions: %v", err)
+	}
+	log.Printf("🔔 %d subscriptions loaded", len(subs.List()))
+
+	// ページのマニフェストの作成
+	mf := &manifester{
+		fetcher:     f,
+		maxItems:    conf.Manifest.MaxItems,
+		concurrency: conf.Manifest.Concurrency,
+	}
 
 	var wg sync.WaitGroup
 
 	// 受信ループを開始
-	receiver.Start()
+	if err := tr.Start(); err != nil {
+		log.Fatalf("Failed to start %s transport: %v", conf.Transport.Mode, err)
+	}
 
-	// --- 1. Recv Stage (BP Socketから連続受信) ---
+	// --- 1. Recv Stage (トランスポートから連続受信) ---
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		recvStageBpSocket(receiver.GetDataChannel(), urlChan)
+		stage := &recvStage{urlChan: urlChan, sendChan: sendChan, arc: arc, mf: mf, subs: subs, jobs: jobs, conf: conf}
+		stage.run(tr.Bundles(), pendingReqs)
 	}()
 
+	// 購読の定期的な再取得
+	go subscriptionScheduler(subs, urlChan, jobs, conf.Subscription.CheckInterval)
+
 	// --- 2. Fetch Stage (HTTPリクエスト実行) ---
-	const fetchWorkers = 5
-	for i := 0; i < fetchWorkers; i++ {
+	for i := 0; i < conf.Fetch.Workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			fetchWorkerBpSocket(urlChan, bpResChan)
+			fetchWorkerBpSocket(urlChan, bpResChan, f, jobs)
 		}()
 	}
 
-	// --- 3. Save & Recurse Stage (再帰処理とsendChanへの転送) ---
+	// --- 3. Save & Recurse Stage (再帰処理とtransformChanへの転送) ---
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		saveAndRecurseWorkerBpSocket(bpResChan, urlChan, sendChan)
+		saveAndRecurseWorkerBpSocket(bpResChan, urlChan, transformChan, subs, jobs)
 	}()
 
-	// --- 4. Send Stage (BP Socketで送信) ---
-	const sendWorkers = 3
-	for i := 0; i < sendWorkers; i++ {
+	// --- 4. Transform Stage (画像の縮小などの変換とアーカイブ化) ---
+	var transformWg sync.WaitGroup
+	for i := 0; i < conf.Transform.Workers; i++ {
+		transformWg.Add(1)
+		go func() {
+			defer transformWg.Done()
+			transformWorkerBpSocket(transformChan, sendChan, transformers, arc)
+		}()
+	}
+	go func() {
+		transformWg.Wait()
+		close(sendChan)
+	}()
+
+	// --- 5. Send Stage (BP Socketで送信) ---
+	// 宛先のノードごとにキューを分け、順番に送信する（1つのノードの大量のクロールで他のノードが待たされないように）
+	// 同じノードの中では、要求されたページ本体、CSS・JavaScript、画像、クロールしたページの順に、小さいものを先に送信する
+	// キューに入れる前にジャーナルに記録し、送信に成功したら記録から取り除く
+	sendQueue := sendqueue.New[BpResponse](conf.Pipeline.QueueSize, conf.Send.PriorityAging)
+	go func() {
+		jobs.replay(pendingResps, sendQueue, tr)
+		for bpRes := range sendChan {
+			priority := sendPriority(bpRes)
+			jobs.record(&bpRes, priority)
+			sendQueue.Push(replyKey(bpRes.ReplyTo, tr), priority, len(bpRes.Body), bpRes)
+		}
+		sendQueue.Close()
+	}()
+	for i := 0; i < conf.Send.Workers; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
-			sendWorkerBpSocket(sendChan, sender, workerID)
+			sendWorkerBpSocket(sendQueue, tr, jobs, subs, workerID, conf.Send)
 		}(i)
 	}
 
-	log.Println("Earth Station is running with BP Socket... (Ctrl+C to exit)")
+	log.Printf("Earth Station is running with %s transport... (Ctrl+C to exit)", conf.Transport.Mode)
 	wg.Wait()
 }
 
-// recvStageBpSocket: BP Socketから連続的にバンドルを受信してURLを抽出
-func recvStageBpSocket(dataChan <-chan []byte, urlChan chan<- CrawlRequest) {
-	for data := range dataChan {
-		log.Printf(">>> Recv Stage: Received bundle (%d bytes)", len(data))
+// recvStage: トランスポートから連続的にバンドルを受信してURLを抽出
+// 購読の登録・解除リクエストはここで処理し、応答を直接Send Stageに渡す
+// マニフェストは受信を止めないよう別のgoroutineで作成し、BATCHのURLはFetch Stageに投入する
+// 応答はリクエストを送信したノード（reply_toが指定されていればそのEID）に返す
+// request_idのあるリクエストはジャーナルに記録し、処理中または完了済みのリクエストの再送は無視する
+type recvStage struct {
+	urlChan  chan<- CrawlRequest
+	sendChan chan<- BpResponse
+	arc      *archiver
+	mf       *manifester
+	subs     *subscription.Store
+	jobs     *jobTracker
+	conf     config.Config
+}
 
-		// JSONをパース
-		targetURL, reqID, err := bpsocket.ParseDTNRequest(data)
-		if err != nil {
-			log.Printf("⚠️  Parse error: %v", err)
-			// エラーレスポンスを生成
-			errorURL := fmt.Sprintf("error://invalid-request/%s", url.QueryEscape(err.Error()))
-			urlChan <- CrawlRequest{RequestID: reqID, URL: errorURL, Depth: 0}
-			continue
+// run 前回の起動で完了していなかったリクエストを再実行してから、受信を開始する
+func (s *recvStage) run(dataChan <-chan bpsocket.Bundle, pending []journal.Request) {
+	for _, req := range pending {
+		log.Printf(">>> Recv Stage: Replaying journaled request (ID: %s)", req.ID)
+		s.handle(replayBundle(req), true)
+	}
+	for bundle := range dataChan {
+		log.Printf(">>> Recv Stage: Received bundle (%d bytes from %s)", len(bundle.Data), bundle.From)
+		s.handle(bundle, false)
+	}
+}
+
+func (s *recvStage) handle(bundle bpsocket.Bundle, replayed bool) {
+	// JSONをパース
+	dtnReq, err := bpsocket.ParseDTNRequest(bundle.Data)
+	replyTo := replyAddress(dtnReq, bundle.From)
+	if err != nil {
+		log.Printf("⚠️  Parse error: %v", err)
+		// 取得は行わず、エラーレスポンスを直接Send Stageに渡す
+		errRes := errorResponse(dtnReq.RequestID, fetcherror.New(fetcherror.ClassInvalid, dtnReq.URL, err))
+		errRes.ReplyTo = replyTo
+		s.sendChan <- errRes
+		log.Printf("❌ Sent 400 Bad Request (ID: %s)", dtnReq.RequestID)
+		return
+	}
+
+	jobID, ok := s.jobs.accept(dtnReq, bundle, replayed)
+	if !ok {
+		log.Printf("⏭️  Duplicate request ignored: %s (ID: %s)", dtnReq.URL, dtnReq.RequestID)
+		return
+	}
+
+	if isSubscriptionRequest(dtnReq.Method) {
+		res := handleSubscriptionRequest(dtnReq, replyTo, s.subs, s.conf.Subscription)
+		res.JobID = jobID
+		s.sendChan <- res
+		return
+	}
+
+	if dtnReq.Method == manifest.MethodManifest {
+		log.Printf("📋 MANIFEST REQUEST: %s (ID: %s, reply to %s)", dtnReq.URL, dtnReq.RequestID, replyTo)
+		go func() {
+			res := s.mf.handle(dtnReq, replyTo)
+			res.JobID = jobID
+			s.sendChan <- res
+		}()
+		return
+	}
+	if dtnReq.Method == manifest.MethodBatch {
+		handleBatchRequest(dtnReq, replyTo, jobID, s.jobs, s.urlChan, s.sendChan, s.conf.Manifest.MaxItems)
+		return
+	}
+
+	log.Printf("🔄 NEW REQUEST: %s (ID: %s, reply to %s)", dtnReq.URL, dtnReq.RequestID, replyTo)
+	s.urlChan <- CrawlRequest{
+		RequestID: dtnReq.RequestID,
+		URL:       dtnReq.URL,
+		Headers:   dtnReq.Headers,
+		Depth:     0,
+		MaxDepth:  s.conf.Crawl.MaxDepth,
+		Options:   transform.ParseOptions(dtnReq.Headers),
+		Archive:   s.arc.wants(dtnReq.URL, dtnReq.Headers),
+		ReplyTo:   replyTo,
+		JobID:     jobID,
+	}
+}
+
+// replyAddress 応答の宛先を決める
+// reply_toが正しいEIDであればそれを、そうでなければバンドルの送信元を使う
+func replyAddress(req *bpsocket.DTNRequest, from bpsocket.EID) bpsocket.EID {
+	if req != nil && req.ReplyTo != "" {
+		eid, err := bpsocket.ParseEID(req.ReplyTo)
+		if err == nil {
+			return eid
 		}
+		log.Printf("⚠️  Ignoring invalid reply_to %q: %v", req.ReplyTo, err)
+	}
+	return from
+}
 
-		log.Printf("🔄 NEW REQUEST: %s (ID: %s)", targetURL, reqID)
-		urlChan <- CrawlRequest{RequestID: reqID, URL: targetURL, Depth: 0}
+// replyKey Send Stageのキューを分ける宛先のキー
+func replyKey(to bpsocket.EID, tr transport.Transport) string {
+	if to.IsZero() {
+		to = tr.DefaultRemote()
 	}
+	return to.String()
 }
 
 // fetchWorkerBpSocket: HTTPリクエストを実行
-func fetchWorkerBpSocket(urlChan <-chan CrawlRequest, bpResChan chan<- BpResponse) {
-	client := http.Client{Timeout: 30 * time.Second}
-
+func fetchWorkerBpSocket(urlChan <-chan CrawlRequest, bpResChan chan<- BpResponse, f *fetcher, jobs *jobTracker) {
 	for reqInfo := range urlChan {
 		targetURL := reqInfo.URL
 		reqID := reqInfo.RequestID
 		depth := reqInfo.Depth
 
-		// エラーURLの検出
-		if strings.HasPrefix(targetURL, "error://") {
-			errRes := BpResponse{
-				RequestID:     reqID,
-				StatusCode:    400,
-				Headers:       map[string][]string{"Content-Type": {"text/plain"}},
-				Body:          base64.StdEncoding.EncodeToString([]byte("Error: Invalid or incomplete HTTP request")),
-				ContentType:   "text/plain",
-				ContentLength: int64(len("Error: Invalid or incomplete HTTP request")),
-				Depth:         0,
-			}
-			bpResChan <- errRes
-			log.Printf("❌ Sent 400 Bad Request for: %s", targetURL)
-			continue
-		}
-
-		// 再訪問チェック
-		visitedMutex.Lock()
-		if visitedURLs[targetURL] {
-			visitedMutex.Unlock()
+		// 再訪問チェック（同じリクエストのクロール内でのみ重複を除外）
+		if !jobs.visit(reqInfo.JobID, visitedKey(reqID, targetURL)) {
+			jobs.finish(reqInfo.JobID)
 			continue
 		}
-		visitedURLs[targetURL] = true
-		visitedMutex.Unlock()
 
 		log.Printf("🕸️  Fetching: %s", targetURL)
 
-		// HTTPリクエストの実行
-		req, err := http.NewRequestWithContext(context.Background(), "GET", targetURL, nil)
-		if err != nil {
-			log.Printf("⚠️  Request creation error (%s): %v", targetURL, err)
-			continue
-		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("⚠️  HTTP request error (%s): %v", targetURL, err)
-			continue
-		}
-
-		bodyBytes, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
+		// HTTPリクエストの実行（Earth側キャッシュを経由）
+		res, err := f.Fetch(context.Background(), targetURL, reqInfo.Headers)
 		if err != nil {
-			log.Printf("⚠️  Body read error (%s): %v", targetURL, err)
+			fe := fetcherror.Wrap(targetURL, err)
+			log.Printf("⚠️  Fetch error (%s) [%s]: %v", targetURL, fe.Class, err)
+			// Space側から要求されたURLは、失敗した理由を返す（クロールで見つけたリンクは返さない）
+			if depth == 0 {
+				errRes := errorResponse(reqID, fe)
+				errRes.Subscription = reqInfo.Subscription
+				errRes.ReplyTo = reqInfo.ReplyTo
+				errRes.JobID = reqInfo.JobID
+				bpResChan <- errRes
+			} else {
+				jobs.finish(reqInfo.JobID)
+			}
 			continue
 		}
 
 		bpRes := BpResponse{
 			RequestID:     reqID,
-			StatusCode:    resp.StatusCode,
-			Headers:       resp.Header,
-			Body:          base64.StdEncoding.EncodeToString(bodyBytes),
-			ContentType:   resp.Header.Get("Content-Type"),
-			ContentLength: resp.ContentLength,
+			StatusCode:    res.StatusCode,
+			Headers:       res.Header,
+			Body:          base64.StdEncoding.EncodeToString(res.Body),
+			ContentType:   res.Header.Get("Content-Type"),
+			ContentLength: int64(len(res.Body)),
 			Depth:         depth,
+			MaxDepth:      reqInfo.MaxDepth,
+			Subscription:  reqInfo.Subscription,
+			Options:       reqInfo.Options,
+			Archive:       reqInfo.Archive,
+			ReplyTo:       reqInfo.ReplyTo,
+			JobID:         reqInfo.JobID,
 		}
 		bpRes.Headers["X-Original-URL"] = []string{targetURL}
 
 		bpResChan <- bpRes
-		log.Printf("✅ Fetched: %s (Status: %d, Size: %d bytes)", targetURL, bpRes.StatusCode, len(bodyBytes))
+		log.Printf("✅ Fetched: %s (Status: %d, Size: %d bytes, Cache: %s)", targetURL, bpRes.StatusCode, len(res.Body), res.CacheStatus)
 	}
 }
 
-// saveAndRecurseWorkerBpSocket: 再帰リンクの処理とsendChanへの転送
-func saveAndRecurseWorkerBpSocket(bpResChan <-chan BpResponse, urlChan chan<- CrawlRequest, sendChan chan<- BpResponse) {
+// saveAndRecurseWorkerBpSocket: 再帰リンクの処理とtransformChanへの転送
+// リンクの抽出は変換前のボディに対して行う
+// 購読による再取得は、内容が変化していない場合は送信せずにリンクだけをたどる
+// リクエストの完了を早まって記録しないよう、見つけたリンクの数を追跡に加えてからレスポンスを転送する
+func saveAndRecurseWorkerBpSocket(bpResChan <-chan BpResponse, urlChan chan<- CrawlRequest, transformChan chan<- BpResponse, subs *subscription.Store, jobs *jobTracker) {
 	for bpRes := range bpResChan {
 		originalURL := bpRes.Headers["X-Original-URL"][0]
 
-		// エラーレスポンスでも送信キューに追加
-		sendChan <- bpRes
+		// 再帰リンクの処理
+		var links []string
+		if bpRes.Err != nil {
+			// エラーレスポンスの場合、再帰処理は行わない
+			log.Printf("⚠️  Skipping recursion for error response [%s]", bpRes.Err.Class)
+		} else if bpRes.Depth < bpRes.MaxDepth {
+			// 相対リンクはリダイレクト後のURLを基準に解決する
+			links = jobs.unvisited(bpRes.JobID, bpRes.RequestID, extractLinksBpSocket(bpRes, finalURL(http.Header(bpRes.Headers), originalURL)))
+		}
+		jobs.add(bpRes.JobID, len(links))
+
+		if bpRes.Subscription == "" {
+			// エラーレスポンスでも送信キューに追加
+			transformChan <- bpRes
+		} else if bpRes.Err != nil {
+			log.Printf("⚠️  Subscription fetch %s failed [%s], not sent", originalURL, bpRes.Err.Class)
+			jobs.finish(bpRes.JobID)
+		} else if bpRes.StatusCode != 200 {
+			log.Printf("⚠️  Subscription fetch %s: status %d, not sent", originalURL, bpRes.StatusCode)
+			jobs.finish(bpRes.JobID)
+		} else if body, err := base64.StdEncoding.DecodeString(bpRes.Body); err != nil {
+			log.Printf("⚠️  Base64 decode error: %v", err)
+			jobs.finish(bpRes.JobID)
+		} else if hash, changed := subscriptionChanged(subs, bpRes, body); !changed {
+			log.Printf("⏭️  Unchanged: %s", originalURL)
+			jobs.finish(bpRes.JobID)
+		} else {
+			log.Printf("🆕 Changed: %s", originalURL)
+			bpRes.SubscriptionHash = hash
+			transformChan <- bpRes
+		}
 
-		// エラーレスポンスの場合、再帰処理は行わない
-		if bpRes.StatusCode == 400 {
-			log.Printf("⚠️  Skipping recursion for error response")
+		for _, link := range links {
+			urlChan <- CrawlRequest{
+				RequestID:    bpRes.RequestID,
+				URL:          link,
+				Depth:        bpRes.Depth + 1,
+				MaxDepth:     bpRes.MaxDepth,
+				Options:      bpRes.Options,
+				Archive:      bpRes.Archive,
+				ReplyTo:      bpRes.ReplyTo,
+				Subscription: bpRes.Subscription,
+				JobID:        bpRes.JobID,
+			}
+			log.Printf("🔗 Link Found (Depth %d): %s", bpRes.Depth+1, link)
+		}
+	}
+	close(transformChan)
+}
+
+// transformWorkerBpSocket: 送信前にレスポンスボディを変換する
+// アーカイブ指定のHTMLページは変換後にサブリソースとまとめて1つのレスポンスにする
+func transformWorkerBpSocket(transformChan <-chan BpResponse, sendChan chan<- BpResponse, transformers transform.Pipeline, arc *archiver) {
+	for bpRes := range transformChan {
+		isArchive := bpRes.Archive && strings.HasPrefix(bpRes.ContentType, "text/html")
+		if (len(transformers) == 0 && !isArchive) || bpRes.StatusCode != 200 {
+			sendChan <- bpRes
 			continue
 		}
 
-		// 再帰リンクの処理
-		currentDepth := bpRes.Depth
-		if currentDepth < maxDepth {
-			links := extractLinksBpSocket(bpRes, originalURL)
-			for _, link := range links {
-				visitedMutex.Lock()
-				if !visitedURLs[link] {
-					visitedMutex.Unlock()
-					urlChan <- CrawlRequest{RequestID: bpRes.RequestID, URL: link, Depth: currentDepth + 1}
-					log.Printf("🔗 Link Found (Depth %d): %s", currentDepth+1, link)
-				} else {
-					visitedMutex.Unlock()
+		body, err := base64.StdEncoding.DecodeString(bpRes.Body)
+		if err != nil {
+			log.Printf("⚠️  Base64 decode error: %v", err)
+			sendChan <- bpRes
+			continue
+		}
+
+		// 再帰処理のステージとヘッダーを共有しないようにコピーしてから変換する
+		res := &transform.Response{
+			URL:    finalURL(http.Header(bpRes.Headers), bpRes.Headers["X-Original-URL"][0]),
+			Header: http.Header(bpRes.Headers).Clone(),
+			Body:   body,
+		}
+		applied, errs := transformers.Apply(res, bpRes.Options)
+		for _, err := range errs {
+			log.Printf("⚠️  Transform error: %v", err)
+		}
+		if len(applied) > 0 {
+			log.Printf("🗜️  Transformed %s [%s]: %d -> %d bytes", res.URL, strings.Join(applied, ","), len(body), len(res.Body))
+			bpRes.Headers = res.Header
+			bpRes.Body = base64.StdEncoding.EncodeToString(res.Body)
+			bpRes.ContentType = res.Header.Get("Content-Type")
+			bpRes.ContentLength = int64(len(res.Body))
+		}
+
+		if isArchive {
+			// リダイレクトの経路はアーカイブ全体のヘッダーで伝える
+			pageHeader := res.Header.Clone()
+			pageHeader.Del(redirectHeader)
+			pageHeader.Del(finalURLHeader)
+			page := archive.Part{URL: res.URL, StatusCode: bpRes.StatusCode, Header: pageHeader, Body: res.Body}
+			contentType, archiveBody, parts, err := arc.build(page, bpRes.Options)
+			if err != nil {
+				// アーカイブ化に失敗した場合はページ本体だけを送信する
+				log.Printf("⚠️  Archive error (%s): %v", res.URL, err)
+			} else {
+				log.Printf("📦 Archived %s: %d parts, %d bytes", res.URL, parts, len(archiveBody))
+				header := http.Header{
+					"Content-Type":        {contentType},
+					archive.ArchiveHeader: {strconv.Itoa(parts)},
 				}
+				if chain := res.Header.Values(redirectHeader); len(chain) > 0 {
+					header[redirectHeader] = chain
+					header.Set(finalURLHeader, res.URL)
+				}
+				header["X-Original-URL"] = bpRes.Headers["X-Original-URL"]
+				bpRes.Headers = header
+				bpRes.Body = base64.StdEncoding.EncodeToString(archiveBody)
+				bpRes.ContentType = contentType
+				bpRes.ContentLength = int64(len(archiveBody))
 			}
 		}
+		sendChan <- bpRes
 	}
-	close(sendChan)
 }
 
-// sendWorkerBpSocket: BP Socketでレスポンスを送信
-func sendWorkerBpSocket(bpResChan <-chan BpResponse, sender *bpsocket.BpSender, workerID int) {
-	for bpRes := range bpResChan {
-		log.Printf("🚀 [Worker %d] Sending response (ID: %s, Status: %d)", workerID, bpRes.RequestID, bpRes.StatusCode)
+// errorResponse: 取得に失敗した理由をSpace側に伝えるエラーレスポンスを生成
+func errorResponse(reqID string, fe *fetcherror.Error) BpResponse {
+	status, header, body := fe.Response()
+	header["X-Original-URL"] = []string{fe.URL} // 他のステージと同じキーで参照できるよう正規化しない
+	return BpResponse{
+		RequestID:     reqID,
+		StatusCode:    status,
+		Headers:       header,
+		Body:          base64.StdEncoding.EncodeToString(body),
+		ContentType:   header.Get("Content-Type"),
+		ContentLength: int64(len(body)),
+		Err:           fe,
+	}
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		err := sender.Send(ctx, bpRes)
-		cancel()
+// visitedKey: 再訪問チェック用のキー
+func visitedKey(reqID, targetURL string) string {
+	return reqID + " " + targetURL
+}
+
+// sendWorkerBpSocket: トランスポートでレスポンスを要求元のノードに送信
+// 送信に失敗した場合は間隔を倍にしながら再送し、それでも失敗したレスポンスはジャーナルに残して次の起動時に再送する
+// 購読の内容は送信に成功してからハッシュを記録する（失敗した場合は次の再取得で再び送信する）
+func sendWorkerBpSocket(queue *sendqueue.Queue[BpResponse], tr transport.Transport, jobs *jobTracker, subs *subscription.Store, workerID int, conf config.SendConfig) {
+	for {
+		bpRes, ok := queue.Pop()
+		if !ok {
+			return
+		}
+		log.Printf("🚀 [Worker %d] Sending response (ID: %s, Status: %d, To: %s)", workerID, bpRes.RequestID, bpRes.StatusCode, replyKey(bpRes.ReplyTo, tr))
 
+		data, err := json.Marshal(bpRes)
 		if err != nil {
-			log.Printf("❌ [Worker %d] Send error: %v", workerID, err)
+			log.Printf("❌ [Worker %d] JSON marshal error: %v", workerID, err)
+			jobs.sent(bpRes) // 再送しても同じ結果になる
+			continue
+		}
+
+		if err := sendWithRetry(tr, data, bpRes, conf, workerID); err != nil {
+			log.Printf("❌ [Worker %d] Send error, giving up until restart (ID: %s): %v", workerID, bpRes.RequestID, err)
 		} else {
 			log.Printf("✅ [Worker %d] Response sent successfully (ID: %s)", workerID, bpRes.RequestID)
+			commitSubscription(subs, bpRes)
+			jobs.sent(bpRes)
+		}
+	}
+}
+
+// sendWithRetry 送信に失敗した場合、conf.RetryBackoffから間隔を倍にしながら（maxRetryBackoffまで）conf.Retries回まで再送する
+func sendWithRetry(tr transport.Transport, data []byte, bpRes BpResponse, conf config.SendConfig, workerID int) error {
+	backoff := conf.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+		err := tr.Send(ctx, data, bpRes.ReplyTo)
+		cancel()
+		if err == nil || attempt >= conf.Retries {
+			return err
 		}
+		log.Printf("⚠️  [Worker %d] Send error, retrying in %s (ID: %s, retry %d/%d): %v", workerID, backoff, bpRes.RequestID, attempt+1, conf.Retries, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRetryBackoff)
 	}
 }
 
 // extractLinksBpSocket: BpResponseからHTMLリンクを抽出
 func extractLinksBpSocket(bpRes BpResponse, baseURLStr string) []string {
-	var links []string
-
 	if !strings.HasPrefix(bpRes.ContentType, "text/html") {
-		return links
+		return nil
 	}
 
 	bodyBytes, err := base64.StdEncoding.DecodeString(bpRes.Body)
 	if err != nil {
 		log.Printf("⚠️  Base64 decode error: %v", err)
-		return links
+		return nil
 	}
-	htmlContent := string(bodyBytes)
+	return extractLinks(bodyBytes, baseURLStr)
+}
+
+// extractLinks: HTMLから同じホストへのリンクを抽出（クエリとフラグメントは除く）
+func extractLinks(body []byte, baseURLStr string) []string {
+	var links []string
 
 	baseURL, err := url.Parse(baseURLStr)
 	if err != nil {
@@ -289,7 +663,7 @@ func extractLinksBpSocket(bpRes BpResponse, baseURLStr string) []string {
 		return links
 	}
 
-	matches := linkRegex.FindAllStringSubmatch(htmlContent, -1)
+	matches := linkRegex.FindAllStringSubmatch(string(body), -1)
 	for _, match := range matches {
 		if len(match) > 1 {
 			relativeURL := match[1]
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"earth/bpsocket"
+	"earth/cmd/config"
+	"earth/fetcherror"
+	"earth/journal"
+	"earth/sendqueue"
+	"earth/subscription"
+)
+
+// fakeTransport 送信したデータを記録し、failsの回数だけ送信に失敗するトランスポート
+type fakeTransport struct {
+	mu    sync.Mutex
+	fails int
+	sent  [][]byte
+}
+
+func (f *fakeTransport) Start() error                    { return nil }
+func (f *fakeTransport) Bundles() <-chan bpsocket.Bundle { return nil }
+func (f *fakeTransport) DefaultRemote() bpsocket.EID     { return bpsocket.EID{} }
+func (f *fakeTransport) Close() error                    { return nil }
+
+func (f *fakeTransport) Send(ctx context.Context, data []byte, to bpsocket.EID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fails > 0 {
+		f.fails--
+		return errors.New("link down")
+	}
+	f.sent = append(f.sent, data)
+	return nil
+}
+
+func TestSaveAndRecurseSkipsErrorResponses(t *testing.T) {
+	page := func(status int) BpResponse {
+		body := `<a href="/next">next</a>`
+		return BpResponse{
+			RequestID:   "req-1",
+			StatusCode:  status,
+			Headers:     map[string][]string{"X-Original-URL": {"http://example.com/"}},
+			Body:        base64.StdEncoding.EncodeToString([]byte(body)),
+			ContentType: "text/html",
+			MaxDepth:    1,
+			JobID:       "req-1",
+		}
+	}
+	errRes := errorResponse("req-1", fetcherror.New(fetcherror.ClassTimeout, "http://example.com/", errors.New("timeout")))
+	errRes.MaxDepth = 1
+	errRes.JobID = "req-1"
+
+	tests := []struct {
+		name      string
+		res       BpResponse
+		subscribe bool
+		wantLinks int
+		wantSent  int
+	}{
+		{name: "page", res: page(200), wantLinks: 1, wantSent: 1},
+		{name: "origin error page", res: page(400), wantLinks: 1, wantSent: 1},
+		{name: "error response", res: errRes, wantLinks: 0, wantSent: 1},
+		// 購読による再取得のエラーレスポンスは送信せず、内容の変化も確認しない（購読のストアを使わない）
+		{name: "subscription error response", res: errRes, subscribe: true, wantLinks: 0, wantSent: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tt.res
+			if tt.subscribe {
+				res.Subscription = "http://example.com/"
+			}
+			jobs := newJobTracker(nil)
+			jobs.start("req-1")
+
+			bpResChan := make(chan BpResponse, 1)
+			urlChan := make(chan CrawlRequest, 10)
+			transformChan := make(chan BpResponse, 10)
+			bpResChan <- res
+			close(bpResChan)
+			saveAndRecurseWorkerBpSocket(bpResChan, urlChan, transformChan, nil, jobs)
+
+			if len(urlChan) != tt.wantLinks {
+				t.Errorf("%d links queued, want %d", len(urlChan), tt.wantLinks)
+			}
+			sent := 0
+			for range transformChan {
+				sent++
+			}
+			if sent != tt.wantSent {
+				t.Errorf("%d responses forwarded, want %d", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestSubscriptionHashCommittedAfterSend(t *testing.T) {
+	const subURL = "http://example.com/"
+	body := []byte("news")
+
+	tests := []struct {
+		name        string
+		fails       int
+		retries     int
+		wantChanged bool // 送信後も内容が変化したと判定されるか
+	}{
+		{name: "sent", fails: 0, wantChanged: false},
+		{name: "sent after retry", fails: 1, retries: 1, wantChanged: false},
+		{name: "send failed", fails: 2, retries: 1, wantChanged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs, err := subscription.Open(filepath.Join(t.TempDir(), "subs.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := subs.Add(subURL, time.Hour, 0, ""); err != nil {
+				t.Fatal(err)
+			}
+			res := BpResponse{
+				RequestID:    "req-1",
+				StatusCode:   200,
+				Headers:      map[string][]string{"X-Original-URL": {subURL}},
+				Body:         base64.StdEncoding.EncodeToString(body),
+				Subscription: subURL,
+			}
+			hash, changed := subscriptionChanged(subs, res, body)
+			if !changed {
+				t.Fatal("first fetch should be reported as changed")
+			}
+			res.SubscriptionHash = hash
+
+			tr := &fakeTransport{fails: tt.fails}
+			queue := sendqueue.New[BpResponse](1, 0)
+			queue.Push("", 0, len(res.Body), res)
+			queue.Close()
+			sendWorkerBpSocket(queue, tr, newJobTracker(nil), subs, 0, config.SendConfig{Timeout: time.Second, Retries: tt.retries})
+
+			if _, changed := subscriptionChanged(subs, res, body); changed != tt.wantChanged {
+				t.Errorf("changed after send = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestSendWorkerRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		fails       int
+		retries     int
+		wantSent    int
+		wantPending int // ジャーナルに残り、次の起動時に再送されるレスポンスの数
+	}{
+		{name: "sent", fails: 0, retries: 2, wantSent: 1, wantPending: 0},
+		{name: "sent after retries", fails: 2, retries: 2, wantSent: 1, wantPending: 0},
+		{name: "retries exhausted", fails: 3, retries: 2, wantSent: 0, wantPending: 1},
+		{name: "no retries", fails: 1, retries: 0, wantSent: 0, wantPending: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := journal.Open(filepath.Join(t.TempDir(), "journal.log"), time.Hour, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.Close()
+			jobs := newJobTracker(j)
+
+			res := BpResponse{RequestID: "req-1", StatusCode: 200, Body: base64.StdEncoding.EncodeToString([]byte("ok"))}
+			jobs.record(&res, 0)
+
+			tr := &fakeTransport{fails: tt.fails}
+			queue := sendqueue.New[BpResponse](1, 0)
+			queue.Push("", 0, len(res.Body), res)
+			queue.Close()
+			sendWorkerBpSocket(queue, tr, jobs, nil, 0, config.SendConfig{Timeout: time.Second, Retries: tt.retries, RetryBackoff: time.Millisecond})
+
+			if len(tr.sent) != tt.wantSent {
+				t.Errorf("%d responses sent, want %d", len(tr.sent), tt.wantSent)
+			}
+			if _, pending := j.Pending(); len(pending) != tt.wantPending {
+				t.Errorf("%d responses left in the journal, want %d", len(pending), tt.wantPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"earth/archive"
+	"earth/bpsocket"
+	"earth/fetcherror"
+	"earth/manifest"
+	"earth/transform"
+)
+
+// manifester ページのマニフェスト（サブリソースとリンクの一覧）を作成する
+type manifester struct {
+	fetcher     *fetcher
+	maxItems    int
+	concurrency int
+}
+
+// handle ページを取得してマニフェストを作成し、Space側への応答を返す
+// 項目の大きさはEarth側キャッシュにあればその大きさを、無ければHEADリクエストで調べる
+func (m *manifester) handle(req *bpsocket.DTNRequest, replyTo bpsocket.EID) BpResponse {
+	res, err := m.fetcher.Fetch(context.Background(), req.URL, req.Headers)
+	if err != nil {
+		fe := fetcherror.Wrap(req.URL, err)
+		log.Printf("⚠️  Manifest fetch error (%s) [%s]: %v", req.URL, fe.Class, err)
+		errRes := errorResponse(req.RequestID, fe)
+		errRes.ReplyTo = replyTo
+		return errRes
+	}
+
+	mf := m.build(req.URL, res)
+	body, err := json.Marshal(mf)
+	if err != nil {
+		errRes := errorResponse(req.RequestID, fetcherror.New(fetcherror.ClassUnknown, req.URL, err))
+		errRes.ReplyTo = replyTo
+		return errRes
+	}
+	log.Printf("📋 Manifest %s: %d items (truncated: %v)", req.URL, len(mf.Items), mf.Truncated)
+
+	return BpResponse{
+		RequestID:  req.RequestID,
+		StatusCode: http.StatusOK,
+		Headers: map[string][]string{
+			"Content-Type":   {manifest.ContentType},
+			manifest.Header:  {strconv.Itoa(len(mf.Items))},
+			"X-Original-URL": {req.URL},
+		},
+		Body:          base64.StdEncoding.EncodeToString(body),
+		ContentType:   manifest.ContentType,
+		ContentLength: int64(len(body)),
+		ReplyTo:       replyTo,
+	}
+}
+
+// build 取得したページからマニフェストを組み立てる
+func (m *manifester) build(pageURL string, res *fetchResult) *manifest.Manifest {
+	final := finalURL(res.Header, pageURL)
+	mf := &manifest.Manifest{
+		URL:         pageURL,
+		FinalURL:    final,
+		Status:      res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        int64(len(res.Body)),
+		GeneratedAt: time.Now().UTC(),
+		Items:       []manifest.Item{},
+	}
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(mf.ContentType, "text/html") {
+		return mf
+	}
+	baseURL, err := url.Parse(final)
+	if err != nil {
+		return mf
+	}
+	mf.Items, mf.Truncated = manifest.Collect(archive.Discover(res.Body, baseURL), extractLinks(res.Body, final), m.maxItems)
+
+	sem := make(chan struct{}, m.concurrency)
+	var wg sync.WaitGroup
+	for i := range mf.Items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *manifest.Item) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			m.probe(item)
+		}(&mf.Items[i])
+	}
+	wg.Wait()
+	return mf
+}
+
+// probe 項目の種類と大きさを調べる
+func (m *manifester) probe(item *manifest.Item) {
+	if e, ok := m.fetcher.Cached(item.URL); ok {
+		item.Status = e.StatusCode
+		item.ContentType = e.Header.Get("Content-Type")
+		item.Size = e.Size
+		item.SizeSource = manifest.SizeFromCache
+		return
+	}
+
+	status, header, err := m.fetcher.Head(context.Background(), item.URL)
+	if err != nil {
+		item.Error = string(fetcherror.Wrap(item.URL, err).Class)
+		return
+	}
+	item.Status = status
+	item.ContentType = header.Get("Content-Type")
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && n >= 0 {
+		item.Size = n
+		item.SizeSource = manifest.SizeFromHead
+	}
+}
+
+// handleBatchRequest BATCHリクエストのURLを個別のリクエストとしてFetch Stageに投入する
+// 受け付けた旨の応答を先に返し、各URLのレスポンスは通常のリクエストと同じように送信される
+// 各URLは受信したリクエストの作業として追跡し、すべてのURLのレスポンスを記録した時点で完了とする
+func handleBatchRequest(req *bpsocket.DTNRequest, replyTo bpsocket.EID, jobID string, jobs *jobTracker, urlChan chan<- CrawlRequest, sendChan chan<- BpResponse, maxItems int) {
+	reply := func(status int, count int, message string) BpResponse {
+		headers := map[string][]string{
+			"Content-Type":   {"text/plain"},
+			"X-Original-URL": {req.URL},
+		}
+		if count > 0 {
+			headers[manifest.BatchHeader] = []string{strconv.Itoa(count)}
+		}
+		return BpResponse{
+			RequestID:     req.RequestID,
+			StatusCode:    status,
+			Headers:       headers,
+			Body:          base64.StdEncoding.EncodeToString([]byte(message)),
+			ContentType:   "text/plain",
+			ContentLength: int64(len(message)),
+			ReplyTo:       replyTo,
+			JobID:         jobID,
+		}
+	}
+
+	body, err := base64.StdEncoding.DecodeString(req.Body)
+	if err != nil {
+		sendChan <- reply(400, 0, fmt.Sprintf("invalid batch body: %v", err))
+		return
+	}
+	urls, err := manifest.ParseBatch(body, maxItems)
+	if err != nil {
+		sendChan <- reply(400, 0, err.Error())
+		return
+	}
+
+	log.Printf("📋 Batch for %s: %d URLs (ID: %s, reply to %s)", req.URL, len(urls), req.RequestID, replyTo)
+	jobs.add(jobID, len(urls))
+	sendChan <- reply(202, len(urls), fmt.Sprintf("%d URLs accepted", len(urls)))
+
+	// 選ばれたURLだけを送信するため、リンクはたどらず、アーカイブにもしない
+	opts := transform.ParseOptions(req.Headers)
+	for i, u := range urls {
+		urlChan <- CrawlRequest{
+			RequestID: fmt.Sprintf("%s-%d", req.RequestID, i),
+			URL:       u,
+			Headers:   req.Headers,
+			Depth:     0,
+			MaxDepth:  0,
+			Options:   opts,
+			ReplyTo:   replyTo,
+			JobID:     jobID,
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"mime"
+	"strings"
+
+	"earth/manifest"
+)
+
+// 送信の優先度（小さいほど先に送信する）
+const (
+	priorityDocument       = iota // Space側から要求されたページ本体・エラー・購読やマニフェストの応答
+	priorityRenderBlocking        // 描画を止めるCSS・JavaScript
+	priorityMedia                 // 画像・フォントなど
+	priorityCrawl                 // 再帰クロールや購読の再取得で見つけたページ
+)
+
+// sendPriority レスポンスの送信の優先度を決める
+func sendPriority(bpRes BpResponse) int {
+	// ユーザーが待っていないレスポンスは最後にする
+	if bpRes.Depth > 0 || bpRes.Subscription != "" {
+		return priorityCrawl
+	}
+	if bpRes.StatusCode != 200 || len(bpRes.Headers[manifest.Header]) > 0 {
+		return priorityDocument
+	}
+
+	mediaType, _, err := mime.ParseMediaType(bpRes.ContentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(bpRes.ContentType, ";")
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case mediaType == "text/html", mediaType == "application/xhtml+xml", mediaType == "text/plain",
+		strings.HasPrefix(mediaType, "multipart/"): // ページアーカイブ
+		return priorityDocument
+	case mediaType == "text/css", strings.Contains(mediaType, "javascript"), strings.Contains(mediaType, "ecmascript"),
+		mediaType == "application/json":
+		return priorityRenderBlocking
+	default:
+		return priorityMedia
+	}
+}
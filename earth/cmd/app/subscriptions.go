@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"earth/bpsocket"
+	"earth/cmd/config"
+	"earth/subscription"
+)
+
+// isSubscriptionRequest 購読の登録・解除リクエストか判定する
+func isSubscriptionRequest(method string) bool {
+	return method == subscription.MethodSubscribe || method == subscription.MethodUnsubscribe
+}
+
+// handleSubscriptionRequest 購読の登録・解除を行い、Space側への応答を返す
+// 購読による再取得の内容は、登録したノード（replyTo）に送信する
+func handleSubscriptionRequest(req *bpsocket.DTNRequest, replyTo bpsocket.EID, subs *subscription.Store, conf config.SubscriptionConfig) BpResponse {
+	reply := func(status int, state, message string) BpResponse {
+		headers := map[string][]string{
+			"Content-Type":   {"text/plain"},
+			"X-Original-URL": {req.URL},
+		}
+		if state != "" {
+			headers[subscription.StatusHeader] = []string{state}
+		}
+		return BpResponse{
+			RequestID:     req.RequestID,
+			StatusCode:    status,
+			Headers:       headers,
+			Body:          base64.StdEncoding.EncodeToString([]byte(message)),
+			ContentType:   "text/plain",
+			ContentLength: int64(len(message)),
+			ReplyTo:       replyTo,
+		}
+	}
+
+	if req.Method == subscription.MethodUnsubscribe {
+		if err := subs.Remove(req.URL); err != nil {
+			log.Printf("⚠️  Unsubscribe error (%s): %v", req.URL, err)
+			return reply(500, "", err.Error())
+		}
+		log.Printf("🔕 Unsubscribed: %s", req.URL)
+		return reply(202, "removed", "unsubscribed")
+	}
+
+	headers := make(map[string]string)
+	for _, name := range []string{subscription.IntervalHeader, subscription.DepthHeader} {
+		if v := req.Headers[name]; len(v) > 0 {
+			headers[name] = v[0]
+		}
+	}
+
+	interval, err := time.ParseDuration(headers[subscription.IntervalHeader])
+	if err != nil || interval < conf.MinInterval {
+		msg := fmt.Sprintf("invalid %s %q (minimum %s)", subscription.IntervalHeader, headers[subscription.IntervalHeader], conf.MinInterval)
+		return reply(400, "", msg)
+	}
+	depth := 0
+	if v := headers[subscription.DepthHeader]; v != "" {
+		depth, err = strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			return reply(400, "", fmt.Sprintf("invalid %s %q", subscription.DepthHeader, v))
+		}
+	}
+	depth = min(depth, conf.MaxDepth)
+
+	var replyEID string
+	if !replyTo.IsZero() {
+		replyEID = replyTo.String()
+	}
+	if err := subs.Add(req.URL, interval, depth, replyEID); err != nil {
+		log.Printf("⚠️  Subscribe error (%s): %v", req.URL, err)
+		return reply(500, "", err.Error())
+	}
+	log.Printf("🔔 Subscribed: %s (every %s, depth %d, reply to %s)", req.URL, interval, depth, replyTo)
+	return reply(202, "active", "subscribed")
+}
+
+// subscriptionScheduler 再取得の時刻になった購読をFetch Stageに投入する
+func subscriptionScheduler(subs *subscription.Store, urlChan chan<- CrawlRequest, jobs *jobTracker, checkInterval time.Duration) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		due, err := subs.TakeDue(now)
+		if err != nil {
+			log.Printf("⚠️  Subscription save error: %v", err)
+		}
+		for _, sub := range due {
+			reqID := fmt.Sprintf("sub-%d-%s", now.Unix(), urlHash(sub.URL)[:8])
+			log.Printf("🔁 Refreshing subscription: %s (ID: %s)", sub.URL, reqID)
+			var replyTo bpsocket.EID
+			if sub.ReplyTo != "" {
+				if eid, err := bpsocket.ParseEID(sub.ReplyTo); err == nil {
+					replyTo = eid
+				}
+			}
+			urlChan <- CrawlRequest{
+				RequestID:    reqID,
+				URL:          sub.URL,
+				Depth:        0,
+				MaxDepth:     sub.Depth,
+				ReplyTo:      replyTo,
+				Subscription: sub.URL,
+				JobID:        jobs.start(reqID),
+			}
+		}
+	}
+}
+
+// subscriptionChanged 購読による取得で、前回送信時から内容が変化したか判定し、送信後に記録するハッシュを返す
+func subscriptionChanged(subs *subscription.Store, bpRes BpResponse, body []byte) (string, bool) {
+	hash := sha256.Sum256(body)
+	h := hex.EncodeToString(hash[:])
+	return h, subs.Changed(bpRes.Subscription, bpRes.Headers["X-Original-URL"][0], h)
+}
+
+// commitSubscription 送信した購読の内容のハッシュを記録する
+func commitSubscription(subs *subscription.Store, bpRes BpResponse) {
+	if bpRes.Subscription == "" || bpRes.SubscriptionHash == "" {
+		return
+	}
+	if err := subs.Commit(bpRes.Subscription, bpRes.Headers["X-Original-URL"][0], bpRes.SubscriptionHash); err != nil {
+		log.Printf("⚠️  Subscription save error: %v", err)
+	}
+}
+
+func urlHash(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
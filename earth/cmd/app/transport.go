@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"earth/bpsocket"
+	"earth/cmd/config"
+	"earth/transport"
+)
+
+// openTransport 設定に従ってSpace側とバンドルを交換するトランスポートを作成する
+func openTransport(conf config.Config) (transport.Transport, error) {
+	bp := conf.BpSocket
+	local := bpsocket.EID{NodeNum: bp.LocalNodeNum, SvcNum: bp.LocalServiceNum}
+	source := bpsocket.EID{NodeNum: bp.LocalNodeNum, SvcNum: bp.SendFromSvcNum}
+	remote := bpsocket.EID{NodeNum: bp.RemoteNodeNum, SvcNum: bp.RemoteServiceNum}
+
+	switch conf.Transport.Mode {
+	case config.TransportBpSocket:
+		log.Printf("📡 Using bp-socket transport (%s, send from %s, default remote %s)", local, source, remote)
+		return transport.NewBpSocket(bp.LocalNodeNum, bp.LocalServiceNum, bp.SendFromSvcNum, remote)
+	case config.TransportIonCLI:
+		log.Printf("📡 Using ION CLI transport (%s, send from %s, default remote %s)", local, source, remote)
+		return transport.NewIonCLI(transport.IonCLIConfig{
+			RecvCommand: conf.Transport.IonCLI.RecvCommand,
+			SendCommand: conf.Transport.IonCLI.SendCommand,
+			WorkDir:     conf.Transport.IonCLI.WorkDir,
+			Local:       local,
+			Source:      source,
+			Remote:      remote,
+		})
+	case config.TransportTCP, config.TransportUDP:
+		peers := make(map[bpsocket.EID]string, len(conf.Transport.Net.Peers))
+		for s, addr := range conf.Transport.Net.Peers {
+			eid, err := bpsocket.ParseEID(s)
+			if err != nil {
+				return nil, err
+			}
+			peers[eid] = addr
+		}
+		log.Printf("📡 Using %s transport (listen %s, default remote %s)", conf.Transport.Mode, conf.Transport.Net.Listen, remote)
+		return transport.NewNet(transport.NetConfig{
+			Network: conf.Transport.Mode,
+			Listen:  conf.Transport.Net.Listen,
+			Local:   source,
+			Remote:  remote,
+			Peers:   peers,
+		})
+	default:
+		return nil, fmt.Errorf("unknown transport mode: %q", conf.Transport.Mode)
+	}
+}
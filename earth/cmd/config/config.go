@@ -0,0 +1,495 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"earth/bpsocket"
+	"earth/egress"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	BpSocket     BpSocketConfig     `yaml:"bp_socket"`
+	Transport    TransportConfig    `yaml:"transport"`
+	Fetch        FetchConfig        `yaml:"fetch"`
+	Crawl        CrawlConfig        `yaml:"crawl"`
+	Send         SendConfig         `yaml:"send"`
+	Pipeline     PipelineConfig     `yaml:"pipeline"`
+	Cache        CacheConfig        `yaml:"cache"`
+	Transform    TransformConfig    `yaml:"transform"`
+	Archive      ArchiveConfig      `yaml:"archive"`
+	Subscription SubscriptionConfig `yaml:"subscription"`
+	Manifest     ManifestConfig     `yaml:"manifest"`
+	Journal      JournalConfig      `yaml:"journal"`
+	Egress       EgressConfig       `yaml:"egress"`
+}
+
+// maxBodyBytes 1つのバンドルで送信できるボディの最大サイズ
+// Base64化すると約4/3倍になるため、バンドルの上限(4MB)に収まる大きさに制限する
+const maxBodyBytes = 3 * 1024 * 1024
+
+// DefaultConfig デフォルト設定を返す
+func DefaultConfig() Config {
+	return Config{
+		BpSocket: BpSocketConfig{
+			LocalNodeNum:     150, // Earth node
+			LocalServiceNum:  1,   // Receive on ipn:150.1 (use 3 if conflict with ION)
+			SendFromSvcNum:   2,   // Send from ipn:150.2 (use 4 if conflict)
+			RemoteNodeNum:    149, // Space node
+			RemoteServiceNum: 1,   // Send to ipn:149.1
+		},
+		Transport: TransportConfig{
+			Mode: TransportBpSocket,
+			IonCLI: IonCLIConfig{
+				RecvCommand: "bprecvfile",
+				SendCommand: "bpsendfile",
+				WorkDir:     "./tmp/earth_ion",
+			},
+			Net: NetConfig{
+				Listen: ":4556",
+			},
+		},
+		Fetch: FetchConfig{
+			Workers:       5,
+			Timeout:       30 * time.Second,
+			MaxBytes:      2 * 1024 * 1024,
+			LargeMaxBytes: maxBodyBytes,
+			Limits: []SizeLimitRule{
+				{Type: "image/*", MaxBytes: 1024 * 1024},
+			},
+			DenyTypes: []string{
+				"video/*",
+				"audio/*",
+				"application/vnd.apple.mpegurl",
+				"application/x-mpegurl",
+				"application/dash+xml",
+			},
+		},
+		Crawl: CrawlConfig{
+			MaxDepth: 2,
+		},
+		Send: SendConfig{
+			Workers:       3,
+			Timeout:       10 * time.Second,
+			PriorityAging: 5 * time.Second,
+			Retries:       3,
+			RetryBackoff:  2 * time.Second,
+		},
+		Pipeline: PipelineConfig{
+			QueueSize: 100,
+		},
+		Cache: CacheConfig{
+			Enabled:           true,
+			Dir:               "./tmp/earth_cache",
+			MaxSizeMB:         1024,
+			ServeStaleOnError: true,
+			MaxStale:          7 * 24 * time.Hour,
+		},
+		Transform: TransformConfig{
+			Workers: 2,
+			Image: ImageConfig{
+				Enabled:      false,
+				MaxDimension: 1280,
+				MaxPixels:    40_000_000,
+				Quality:      60,
+			},
+			Lite: LiteConfig{
+				DefaultMode:       "off",
+				InlineCSSMaxBytes: 8 * 1024,
+			},
+		},
+		Archive: ArchiveConfig{
+			Enabled:     false,
+			MaxBytes:    2 * 1024 * 1024,
+			MaxParts:    64,
+			Concurrency: 4,
+		},
+		Subscription: SubscriptionConfig{
+			File:          "./tmp/earth_subscriptions.json",
+			CheckInterval: time.Minute,
+			MinInterval:   5 * time.Minute,
+			MaxDepth:      2,
+		},
+		Manifest: ManifestConfig{
+			MaxItems:    200,
+			Concurrency: 8,
+		},
+		Journal: JournalConfig{
+			Enabled:      true,
+			File:         "./tmp/earth_journal.log",
+			DedupeWindow: 24 * time.Hour,
+			CompactBytes: 64 * 1024 * 1024,
+		},
+		Egress: EgressConfig{
+			Ports: []int{80, 443},
+		},
+	}
+}
+
+// LoadConfig 設定を読み込む
+// 優先順位: コマンドラインフラグ > 環境変数 > YAMLファイル > デフォルト値
+// 不正な値が含まれている場合はエラーを返す（起動時に即座に失敗させるため）
+func LoadConfig(args []string) (Config, error) {
+	conf := DefaultConfig()
+
+	fs := flag.NewFlagSet("earth", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to YAML config file (env: CONFIG_PATH)")
+	flagValues := make(map[string]*string, len(overrides))
+	for _, o := range overrides {
+		flagValues[o.flag] = fs.String(o.flag, "", fmt.Sprintf("%s (env: %s)", o.usage, o.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return conf, err
+	}
+
+	// YAMLファイルから設定を読み込む（存在する場合）
+	path := getConfigPath(*configPath)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		// 未指定の項目はデフォルト値のまま残る
+		if err := yaml.Unmarshal(data, &conf); err != nil {
+			return conf, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case os.IsNotExist(err) && *configPath == "" && os.Getenv("CONFIG_PATH") == "":
+		// 明示的に指定されていないconfig.yamlが無い場合はデフォルト値を使用
+	default:
+		return conf, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	// 環境変数による上書き
+	for _, o := range overrides {
+		if v, ok := os.LookupEnv(o.env); ok {
+			if err := o.apply(&conf, v); err != nil {
+				return conf, fmt.Errorf("invalid %s=%q: %w", o.env, v, err)
+			}
+		}
+	}
+
+	// コマンドラインフラグによる上書き（明示的に指定されたものだけ）
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if flagErr != nil || f.Name == "config" {
+			return
+		}
+		for _, o := range overrides {
+			if o.flag == f.Name {
+				if err := o.apply(&conf, *flagValues[f.Name]); err != nil {
+					flagErr = fmt.Errorf("invalid -%s=%q: %w", f.Name, *flagValues[f.Name], err)
+				}
+				return
+			}
+		}
+	})
+	if flagErr != nil {
+		return conf, flagErr
+	}
+
+	if err := conf.Validate(); err != nil {
+		return conf, err
+	}
+	return conf, nil
+}
+
+// getConfigPath 設定ファイルのパスを取得
+// -config フラグ、環境変数 CONFIG_PATH の順に参照し、どちらも無ければ config.yaml を探す
+func getConfigPath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		return path
+	}
+	return "config.yaml"
+}
+
+// Validate 設定値を検証する
+func (c Config) Validate() error {
+	if c.BpSocket.LocalNodeNum == 0 {
+		return fmt.Errorf("bp_socket.local_node_num must be set")
+	}
+	if c.BpSocket.RemoteNodeNum == 0 {
+		return fmt.Errorf("bp_socket.remote_node_num must be set")
+	}
+	if c.BpSocket.LocalServiceNum == 0 || c.BpSocket.SendFromSvcNum == 0 || c.BpSocket.RemoteServiceNum == 0 {
+		return fmt.Errorf("bp_socket service numbers must be greater than 0")
+	}
+	if c.BpSocket.LocalServiceNum == c.BpSocket.SendFromSvcNum {
+		return fmt.Errorf("bp_socket.local_service_num and bp_socket.send_from_svc_num must differ (both %d)", c.BpSocket.LocalServiceNum)
+	}
+	if err := c.Transport.validate(c.BpSocket); err != nil {
+		return err
+	}
+	if c.Fetch.Workers <= 0 {
+		return fmt.Errorf("fetch.workers must be greater than 0 (got %d)", c.Fetch.Workers)
+	}
+	if c.Fetch.Timeout <= 0 {
+		return fmt.Errorf("fetch.timeout must be positive (got %s)", c.Fetch.Timeout)
+	}
+	if c.Fetch.MaxBytes <= 0 || c.Fetch.MaxBytes > maxBodyBytes {
+		return fmt.Errorf("fetch.max_bytes must be between 1 and %d (got %d)", maxBodyBytes, c.Fetch.MaxBytes)
+	}
+	if c.Fetch.LargeMaxBytes < c.Fetch.MaxBytes || c.Fetch.LargeMaxBytes > maxBodyBytes {
+		return fmt.Errorf("fetch.large_max_bytes must be between fetch.max_bytes and %d (got %d)", maxBodyBytes, c.Fetch.LargeMaxBytes)
+	}
+	for i, rule := range c.Fetch.Limits {
+		if rule.Type == "" {
+			return fmt.Errorf("fetch.limits[%d].type must be set", i)
+		}
+		if rule.MaxBytes <= 0 || rule.MaxBytes > maxBodyBytes {
+			return fmt.Errorf("fetch.limits[%d].max_bytes must be between 1 and %d (got %d)", i, maxBodyBytes, rule.MaxBytes)
+		}
+	}
+	if c.Crawl.MaxDepth < 0 {
+		return fmt.Errorf("crawl.max_depth must not be negative (got %d)", c.Crawl.MaxDepth)
+	}
+	if c.Send.Workers <= 0 {
+		return fmt.Errorf("send.workers must be greater than 0 (got %d)", c.Send.Workers)
+	}
+	if c.Send.Timeout <= 0 {
+		return fmt.Errorf("send.timeout must be positive (got %s)", c.Send.Timeout)
+	}
+	if c.Send.PriorityAging < 0 {
+		return fmt.Errorf("send.priority_aging must not be negative (got %s)", c.Send.PriorityAging)
+	}
+	if c.Send.Retries < 0 {
+		return fmt.Errorf("send.retries must not be negative (got %d)", c.Send.Retries)
+	}
+	if c.Send.RetryBackoff < 0 {
+		return fmt.Errorf("send.retry_backoff must not be negative (got %s)", c.Send.RetryBackoff)
+	}
+	if c.Pipeline.QueueSize <= 0 {
+		return fmt.Errorf("pipeline.queue_size must be greater than 0 (got %d)", c.Pipeline.QueueSize)
+	}
+	if c.Cache.Enabled {
+		if c.Cache.Dir == "" {
+			return fmt.Errorf("cache.dir must be set when cache is enabled")
+		}
+		if c.Cache.MaxSizeMB <= 0 {
+			return fmt.Errorf("cache.max_size_mb must be greater than 0 (got %d)", c.Cache.MaxSizeMB)
+		}
+		if c.Cache.MaxStale < 0 {
+			return fmt.Errorf("cache.max_stale must not be negative (got %s)", c.Cache.MaxStale)
+		}
+	}
+	if c.Transform.Workers <= 0 {
+		return fmt.Errorf("transform.workers must be greater than 0 (got %d)", c.Transform.Workers)
+	}
+	if c.Transform.Image.Enabled {
+		if c.Transform.Image.MaxDimension < 0 {
+			return fmt.Errorf("transform.image.max_dimension must not be negative (got %d)", c.Transform.Image.MaxDimension)
+		}
+		if c.Transform.Image.MaxPixels < 0 {
+			return fmt.Errorf("transform.image.max_pixels must not be negative (got %d)", c.Transform.Image.MaxPixels)
+		}
+		if c.Transform.Image.Quality < 1 || c.Transform.Image.Quality > 100 {
+			return fmt.Errorf("transform.image.quality must be between 1 and 100 (got %d)", c.Transform.Image.Quality)
+		}
+	}
+	if !validLiteMode(c.Transform.Lite.DefaultMode) {
+		return fmt.Errorf("transform.lite.default_mode must be one of off, lite, text (got %q)", c.Transform.Lite.DefaultMode)
+	}
+	for i, rule := range c.Transform.Lite.Hosts {
+		if rule.Match == "" {
+			return fmt.Errorf("transform.lite.hosts[%d].match must be set", i)
+		}
+		if !validLiteMode(rule.Mode) {
+			return fmt.Errorf("transform.lite.hosts[%d].mode must be one of off, lite, text (got %q)", i, rule.Mode)
+		}
+	}
+	if c.Transform.Lite.InlineCSSMaxBytes < 0 {
+		return fmt.Errorf("transform.lite.inline_css_max_bytes must not be negative (got %d)", c.Transform.Lite.InlineCSSMaxBytes)
+	}
+	if c.Archive.MaxBytes <= 0 || c.Archive.MaxBytes > maxBodyBytes {
+		return fmt.Errorf("archive.max_bytes must be between 1 and %d (got %d)", maxBodyBytes, c.Archive.MaxBytes)
+	}
+	if c.Archive.MaxParts < 1 {
+		return fmt.Errorf("archive.max_parts must be greater than 0 (got %d)", c.Archive.MaxParts)
+	}
+	if c.Archive.Concurrency < 1 {
+		return fmt.Errorf("archive.concurrency must be greater than 0 (got %d)", c.Archive.Concurrency)
+	}
+	if c.Subscription.File == "" {
+		return fmt.Errorf("subscription.file must be set")
+	}
+	if c.Subscription.CheckInterval <= 0 {
+		return fmt.Errorf("subscription.check_interval must be greater than 0 (got %s)", c.Subscription.CheckInterval)
+	}
+	if c.Subscription.MinInterval <= 0 {
+		return fmt.Errorf("subscription.min_interval must be greater than 0 (got %s)", c.Subscription.MinInterval)
+	}
+	if c.Subscription.MaxDepth < 0 {
+		return fmt.Errorf("subscription.max_depth must not be negative (got %d)", c.Subscription.MaxDepth)
+	}
+	if c.Manifest.MaxItems < 1 {
+		return fmt.Errorf("manifest.max_items must be greater than 0 (got %d)", c.Manifest.MaxItems)
+	}
+	if c.Manifest.Concurrency < 1 {
+		return fmt.Errorf("manifest.concurrency must be greater than 0 (got %d)", c.Manifest.Concurrency)
+	}
+	if c.Journal.Enabled {
+		if c.Journal.File == "" {
+			return fmt.Errorf("journal.file must be set when the journal is enabled")
+		}
+		if c.Journal.DedupeWindow < 0 {
+			return fmt.Errorf("journal.dedupe_window must not be negative (got %s)", c.Journal.DedupeWindow)
+		}
+		if c.Journal.CompactBytes < 0 {
+			return fmt.Errorf("journal.compact_bytes must not be negative (got %d)", c.Journal.CompactBytes)
+		}
+	}
+	if _, err := egress.ParsePrefixes(c.Egress.AllowCIDRs); err != nil {
+		return fmt.Errorf("egress.allow_cidrs: %w", err)
+	}
+	if _, err := egress.ParsePrefixes(c.Egress.DenyCIDRs); err != nil {
+		return fmt.Errorf("egress.deny_cidrs: %w", err)
+	}
+	for _, port := range c.Egress.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("egress.ports must be between 1 and 65535 (got %d)", port)
+		}
+	}
+	return nil
+}
+
+func validLiteMode(mode string) bool {
+	return mode == "off" || mode == "lite" || mode == "text"
+}
+
+// Print 有効な設定をYAML形式で出力する
+func (c Config) Print(w io.Writer) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		fmt.Fprintf(w, "failed to marshal config: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "--- effective config ---\n%s------------------------\n", data)
+}
+
+// override 環境変数・フラグで上書き可能な設定項目
+type override struct {
+	flag  string
+	env   string
+	usage string
+	apply func(c *Config, v string) error
+}
+
+var overrides = []override{
+	{"local-node", "EARTH_LOCAL_NODE_NUM", "local (Earth) node number", func(c *Config, v string) error { return setUint(&c.BpSocket.LocalNodeNum, v) }},
+	{"local-svc", "EARTH_LOCAL_SERVICE_NUM", "service number to receive on", func(c *Config, v string) error { return setUint(&c.BpSocket.LocalServiceNum, v) }},
+	{"send-svc", "EARTH_SEND_FROM_SVC_NUM", "service number to send from", func(c *Config, v string) error { return setUint(&c.BpSocket.SendFromSvcNum, v) }},
+	{"remote-node", "EARTH_REMOTE_NODE_NUM", "remote (Space) node number", func(c *Config, v string) error { return setUint(&c.BpSocket.RemoteNodeNum, v) }},
+	{"remote-svc", "EARTH_REMOTE_SERVICE_NUM", "remote service number", func(c *Config, v string) error { return setUint(&c.BpSocket.RemoteServiceNum, v) }},
+	{"transport", "EARTH_TRANSPORT", "transport mode (bp_socket, ion_cli, tcp, udp)", func(c *Config, v string) error { c.Transport.Mode = v; return nil }},
+	{"transport-listen", "EARTH_TRANSPORT_LISTEN", "address to listen on for the tcp and udp transports", func(c *Config, v string) error { c.Transport.Net.Listen = v; return nil }},
+	{"fetch-workers", "EARTH_FETCH_WORKERS", "number of fetch workers", func(c *Config, v string) error { return setInt(&c.Fetch.Workers, v) }},
+	{"fetch-timeout", "EARTH_FETCH_TIMEOUT", "HTTP fetch timeout", func(c *Config, v string) error { return setDuration(&c.Fetch.Timeout, v) }},
+	{"fetch-max-bytes", "EARTH_FETCH_MAX_BYTES", "maximum response size in bytes", func(c *Config, v string) error { return setInt64(&c.Fetch.MaxBytes, v) }},
+	{"max-depth", "EARTH_MAX_DEPTH", "maximum recursive crawl depth", func(c *Config, v string) error { return setInt(&c.Crawl.MaxDepth, v) }},
+	{"send-workers", "EARTH_SEND_WORKERS", "number of send workers", func(c *Config, v string) error { return setInt(&c.Send.Workers, v) }},
+	{"send-timeout", "EARTH_SEND_TIMEOUT", "bundle send timeout", func(c *Config, v string) error { return setDuration(&c.Send.Timeout, v) }},
+	{"send-retries", "EARTH_SEND_RETRIES", "number of retries after a failed send", func(c *Config, v string) error { return setInt(&c.Send.Retries, v) }},
+	{"send-retry-backoff", "EARTH_SEND_RETRY_BACKOFF", "delay before the first send retry (doubled on each retry)", func(c *Config, v string) error { return setDuration(&c.Send.RetryBackoff, v) }},
+	{"queue-size", "EARTH_QUEUE_SIZE", "buffer size of pipeline channels", func(c *Config, v string) error { return setInt(&c.Pipeline.QueueSize, v) }},
+	{"cache", "EARTH_CACHE_ENABLED", "enable the ground-side response cache", func(c *Config, v string) error { return setBool(&c.Cache.Enabled, v) }},
+	{"cache-dir", "EARTH_CACHE_DIR", "ground-side cache directory", func(c *Config, v string) error { c.Cache.Dir = v; return nil }},
+	{"cache-max-mb", "EARTH_CACHE_MAX_SIZE_MB", "ground-side cache size limit in MB", func(c *Config, v string) error { return setInt64(&c.Cache.MaxSizeMB, v) }},
+	{"transform-workers", "EARTH_TRANSFORM_WORKERS", "number of transform workers", func(c *Config, v string) error { return setInt(&c.Transform.Workers, v) }},
+	{"image", "EARTH_IMAGE_ENABLED", "enable image downscaling and re-encoding", func(c *Config, v string) error { return setBool(&c.Transform.Image.Enabled, v) }},
+	{"image-max-dim", "EARTH_IMAGE_MAX_DIMENSION", "maximum image dimension in pixels", func(c *Config, v string) error { return setInt(&c.Transform.Image.MaxDimension, v) }},
+	{"image-max-pixels", "EARTH_IMAGE_MAX_PIXELS", "skip images with more pixels than this (0 for no limit)", func(c *Config, v string) error { return setInt64(&c.Transform.Image.MaxPixels, v) }},
+	{"image-quality", "EARTH_IMAGE_QUALITY", "JPEG re-encode quality (1-100)", func(c *Config, v string) error { return setInt(&c.Transform.Image.Quality, v) }},
+	{"lite-mode", "EARTH_LITE_MODE", "default HTML lite mode (off, lite, text)", func(c *Config, v string) error { c.Transform.Lite.DefaultMode = v; return nil }},
+	{"cache-serve-stale", "EARTH_CACHE_SERVE_STALE", "serve stale entries when the origin is unreachable", func(c *Config, v string) error { return setBool(&c.Cache.ServeStaleOnError, v) }},
+	{"archive", "EARTH_ARCHIVE_ENABLED", "send HTML pages as single-bundle archives", func(c *Config, v string) error { return setBool(&c.Archive.Enabled, v) }},
+	{"archive-max-bytes", "EARTH_ARCHIVE_MAX_BYTES", "maximum archive size in bytes", func(c *Config, v string) error { return setInt(&c.Archive.MaxBytes, v) }},
+	{"subscription-file", "EARTH_SUBSCRIPTION_FILE", "file to persist subscriptions", func(c *Config, v string) error { c.Subscription.File = v; return nil }},
+	{"manifest-max-items", "EARTH_MANIFEST_MAX_ITEMS", "maximum number of items in a page manifest or batch", func(c *Config, v string) error { return setInt(&c.Manifest.MaxItems, v) }},
+	{"journal", "EARTH_JOURNAL_ENABLED", "persist received requests and unsent responses to replay them after a restart", func(c *Config, v string) error { return setBool(&c.Journal.Enabled, v) }},
+	{"journal-file", "EARTH_JOURNAL_FILE", "file to persist unfinished requests and unsent responses", func(c *Config, v string) error { c.Journal.File = v; return nil }},
+	{"egress-allow-private", "EARTH_EGRESS_ALLOW_PRIVATE", "allow fetching private, loopback and link-local addresses", func(c *Config, v string) error { return setBool(&c.Egress.AllowPrivate, v) }},
+}
+
+func setUint(dst *uint64, v string) error {
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setInt64(dst *int64, v string) error {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// validate トランスポートの設定を検証する
+func (t TransportConfig) validate(bp BpSocketConfig) error {
+	switch t.Mode {
+	case TransportBpSocket:
+	case TransportIonCLI:
+		if t.IonCLI.RecvCommand == "" || t.IonCLI.SendCommand == "" {
+			return fmt.Errorf("transport.ion_cli.recv_command and send_command must be set")
+		}
+		if t.IonCLI.WorkDir == "" {
+			return fmt.Errorf("transport.ion_cli.work_dir must be set")
+		}
+	case TransportTCP, TransportUDP:
+		if t.Net.Listen == "" {
+			return fmt.Errorf("transport.net.listen must be set")
+		}
+		for eid, addr := range t.Net.Peers {
+			if _, err := bpsocket.ParseEID(eid); err != nil {
+				return fmt.Errorf("transport.net.peers: %w", err)
+			}
+			if addr == "" {
+				return fmt.Errorf("transport.net.peers[%s] must be an address", eid)
+			}
+		}
+		remote := bpsocket.EID{NodeNum: bp.RemoteNodeNum, SvcNum: bp.RemoteServiceNum}
+		if _, ok := t.Net.Peers[remote.String()]; !ok {
+			return fmt.Errorf("transport.net.peers must include the default remote %s", remote)
+		}
+	default:
+		return fmt.Errorf("transport.mode must be one of %s, %s, %s, %s (got %q)", TransportBpSocket, TransportIonCLI, TransportTCP, TransportUDP, t.Mode)
+	}
+	return nil
+}
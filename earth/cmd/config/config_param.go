@@ -0,0 +1,139 @@
+package config
+
+import "time"
+
+// BpSocketConfig BPのエンドポイントの設定（AF_BP以外のトランスポートでもEIDとして使う）
+type BpSocketConfig struct {
+	LocalNodeNum     uint64 `yaml:"local_node_num"`     // Earthノード番号
+	LocalServiceNum  uint64 `yaml:"local_service_num"`  // 受信用サービス番号 (ipn:150.1)
+	SendFromSvcNum   uint64 `yaml:"send_from_svc_num"`  // 送信元サービス番号 (ipn:150.2)
+	RemoteNodeNum    uint64 `yaml:"remote_node_num"`    // Spaceノード番号（送信元が分からない場合のデフォルトの送信先）
+	RemoteServiceNum uint64 `yaml:"remote_service_num"` // デフォルトの送信先サービス番号
+}
+
+// トランスポートの種類
+const (
+	TransportBpSocket = "bp_socket" // AF_BPソケット（bp-socketカーネルモジュール）
+	TransportIonCLI   = "ion_cli"   // IONのbprecvfile/bpsendfileコマンド
+	TransportTCP      = "tcp"       // TCP（DTNを使わない構成やテスト用）
+	TransportUDP      = "udp"       // UDP（1つのバンドルは64KBまで）
+)
+
+// TransportConfig Space側とバンドルを交換する手段の設定
+// EIDはどのトランスポートでもbp_socketの設定（ノード番号・サービス番号）を使う
+type TransportConfig struct {
+	Mode   string       `yaml:"mode"` // bp_socket, ion_cli, tcp, udp
+	IonCLI IonCLIConfig `yaml:"ion_cli"`
+	Net    NetConfig    `yaml:"net"`
+}
+
+type IonCLIConfig struct {
+	RecvCommand string `yaml:"recv_command"` // 受信コマンド
+	SendCommand string `yaml:"send_command"` // 送信コマンド
+	WorkDir     string `yaml:"work_dir"`     // 受信・送信するファイルを置くディレクトリ
+}
+
+type NetConfig struct {
+	Listen string            `yaml:"listen"` // 受信するアドレス
+	Peers  map[string]string `yaml:"peers"`  // 送信先のEIDごとのアドレス（例: "ipn:149.1": "10.0.0.2:4556"）
+}
+
+type FetchConfig struct {
+	Workers       int             `yaml:"workers"`         // Fetch Stageのワーカー数
+	Timeout       time.Duration   `yaml:"timeout"`         // オリジンへのHTTPリクエストのタイムアウト
+	MaxBytes      int64           `yaml:"max_bytes"`       // レスポンスの最大サイズ（limitsに一致しない場合）
+	LargeMaxBytes int64           `yaml:"large_max_bytes"` // "X-Earth-Allow-Large: 1" で明示的に要求された場合の最大サイズ
+	Limits        []SizeLimitRule `yaml:"limits"`          // Content-Typeごとの最大サイズ（先に一致したものを使用）
+	DenyTypes     []string        `yaml:"deny_types"`      // 取得しないContent-Type（"video/*" の形式）
+}
+
+type SizeLimitRule struct {
+	Type     string `yaml:"type"`      // "image/png" や "image/*" の形式
+	MaxBytes int64  `yaml:"max_bytes"` // 最大サイズ
+}
+
+type CrawlConfig struct {
+	MaxDepth int `yaml:"max_depth"` // 再帰クロールの最大深さ
+}
+
+type SendConfig struct {
+	Workers       int           `yaml:"workers"`        // Send Stageのワーカー数
+	Timeout       time.Duration `yaml:"timeout"`        // バンドル送信のタイムアウト
+	PriorityAging time.Duration `yaml:"priority_aging"` // 送信待ちの時間に応じて優先度を上げる間隔（0で無効）
+	Retries       int           `yaml:"retries"`        // 送信に失敗した場合の再送回数（使い切った場合は再起動時にジャーナルから再送する）
+	RetryBackoff  time.Duration `yaml:"retry_backoff"`  // 最初の再送までの待ち時間（再送ごとに倍にする）
+}
+
+type PipelineConfig struct {
+	QueueSize int `yaml:"queue_size"` // ステージ間チャネルのバッファサイズ
+}
+
+type CacheConfig struct {
+	Enabled           bool          `yaml:"enabled"`              // Earth側キャッシュを使用するか
+	Dir               string        `yaml:"dir"`                  // キャッシュファイルを保存するディレクトリ
+	MaxSizeMB         int64         `yaml:"max_size_mb"`          // キャッシュの最大サイズ(MB)。超過分はLRUで追い出す
+	ServeStaleOnError bool          `yaml:"serve_stale_on_error"` // オリジンに到達できない場合に期限切れのエントリを返すか
+	MaxStale          time.Duration `yaml:"max_stale"`            // 期限切れエントリを返す場合の許容超過時間（0は無制限）
+}
+
+type TransformConfig struct {
+	Workers int         `yaml:"workers"` // Transform Stageのワーカー数
+	Image   ImageConfig `yaml:"image"`   // 画像の縮小・再エンコード
+	Lite    LiteConfig  `yaml:"lite"`    // HTMLのライトモード変換
+}
+
+type ImageConfig struct {
+	Enabled      bool     `yaml:"enabled"`       // 画像の変換を行うか
+	MaxDimension int      `yaml:"max_dimension"` // 長辺の最大ピクセル数
+	MaxPixels    int64    `yaml:"max_pixels"`    // これより画素数の多い画像はデコードせずに送る（0で無制限）
+	Quality      int      `yaml:"quality"`       // JPEG再エンコード時の品質 (1-100)
+	ExcludeHosts []string `yaml:"exclude_hosts"` // 変換しないホスト（".example.com"でサブドメインも対象）
+}
+
+type LiteConfig struct {
+	DefaultMode       string         `yaml:"default_mode"`         // "off", "lite", "text"
+	InlineCSSMaxBytes int            `yaml:"inline_css_max_bytes"` // この大きさ以下の外部CSSをインライン化する（0で無効）
+	TrackerHosts      []string       `yaml:"tracker_hosts"`        // 追加で除去するトラッカーのホスト
+	Hosts             []LiteHostRule `yaml:"hosts"`                // ホストごとのモード指定（先に一致したものを使用）
+}
+
+type LiteHostRule struct {
+	Match string `yaml:"match"` // ホスト名（".example.com"でサブドメインも対象）
+	Mode  string `yaml:"mode"`  // "off", "lite", "text"
+}
+
+type ArchiveConfig struct {
+	Enabled     bool     `yaml:"enabled"`     // すべてのHTMLページをアーカイブとして送信するか
+	Hosts       []string `yaml:"hosts"`       // アーカイブとして送信するホスト（enabledがfalseでも対象になる）
+	MaxBytes    int      `yaml:"max_bytes"`   // アーカイブ1つの最大サイズ（Base64化前）
+	MaxParts    int      `yaml:"max_parts"`   // アーカイブに含める最大リソース数（ページ本体を含む）
+	Concurrency int      `yaml:"concurrency"` // サブリソースを並行して取得する数
+}
+
+type SubscriptionConfig struct {
+	File          string        `yaml:"file"`           // 購読の一覧を保存するファイル
+	CheckInterval time.Duration `yaml:"check_interval"` // 再取得の時刻になった購読を確認する間隔
+	MinInterval   time.Duration `yaml:"min_interval"`   // 購読で指定できる最短の再取得間隔
+	MaxDepth      int           `yaml:"max_depth"`      // 購読で指定できる最大のクロール深さ
+}
+
+type ManifestConfig struct {
+	MaxItems    int `yaml:"max_items"`   // マニフェストの最大項目数（BATCHで要求できる最大URL数も兼ねる）
+	Concurrency int `yaml:"concurrency"` // 大きさを調べるHEADリクエストの並行数
+}
+
+type JournalConfig struct {
+	Enabled      bool          `yaml:"enabled"`       // 受信したリクエストと送信前のレスポンスをディスクに記録し、再起動後に再実行するか
+	File         string        `yaml:"file"`          // 記録するファイル（追記型のログ）
+	DedupeWindow time.Duration `yaml:"dedupe_window"` // 完了したリクエストのIDを覚えておき、同じIDの再送を無視する時間
+	CompactBytes int64         `yaml:"compact_bytes"` // ログがこの大きさを超えたら未完了の記録だけを残して書き直す（0は起動時のみ）
+}
+
+type EgressConfig struct {
+	AllowPrivate bool     `yaml:"allow_private"` // プライベート・ループバック・リンクローカル等の範囲への接続を許可するか
+	AllowCIDRs   []string `yaml:"allow_cidrs"`   // 既定で拒否する範囲のうち、例外として許可する範囲
+	DenyCIDRs    []string `yaml:"deny_cidrs"`    // 追加で拒否する範囲
+	AllowHosts   []string `yaml:"allow_hosts"`   // 空でなければ、これらのホストだけを許可する（".example.com"でサブドメインも対象）
+	DenyHosts    []string `yaml:"deny_hosts"`    // 拒否するホスト
+	Ports        []int    `yaml:"ports"`         // 許可するポート（空の場合はすべて）
+}
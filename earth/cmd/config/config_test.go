@@ -0,0 +1,142 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig 一時ディレクトリにYAMLの設定ファイルを書き出す
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		yaml        string
+		env         map[string]string
+		args        []string
+		wantWorkers int
+		wantTimeout time.Duration
+	}{
+		{name: "defaults", wantWorkers: 5, wantTimeout: 30 * time.Second},
+		{name: "yaml", yaml: "fetch:\n  workers: 7\n", wantWorkers: 7, wantTimeout: 30 * time.Second},
+		{name: "env over yaml", yaml: "fetch:\n  workers: 7\n  timeout: 5s\n", env: map[string]string{"EARTH_FETCH_WORKERS": "8"}, wantWorkers: 8, wantTimeout: 5 * time.Second},
+		{name: "flag over env and yaml", yaml: "fetch:\n  workers: 7\n", env: map[string]string{"EARTH_FETCH_WORKERS": "8"}, args: []string{"-fetch-workers", "9"}, wantWorkers: 9, wantTimeout: 30 * time.Second},
+		{name: "flag over yaml", yaml: "fetch:\n  timeout: 5s\n", args: []string{"-fetch-timeout", "1m"}, wantWorkers: 5, wantTimeout: time.Minute},
+		{name: "env only", env: map[string]string{"EARTH_FETCH_TIMEOUT": "2s"}, wantWorkers: 5, wantTimeout: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_PATH", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.yaml != "" {
+				args = append([]string{"-config", writeConfig(t, tt.yaml)}, args...)
+			}
+			conf, err := LoadConfig(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conf.Fetch.Workers != tt.wantWorkers || conf.Fetch.Timeout != tt.wantTimeout {
+				t.Errorf("fetch = %d workers, %s timeout, want %d, %s", conf.Fetch.Workers, conf.Fetch.Timeout, tt.wantWorkers, tt.wantTimeout)
+			}
+			// 上書きしていない項目はデフォルト値のまま
+			if conf.Send.Workers != DefaultConfig().Send.Workers {
+				t.Errorf("send.workers = %d, want the default", conf.Send.Workers)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFailsFast(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		args    []string
+		missing bool // 存在しない設定ファイルを指定する
+		wantErr string
+	}{
+		{name: "missing explicit file", missing: true, wantErr: "failed to read config file"},
+		{name: "broken yaml", yaml: "fetch: [\n", wantErr: "failed to parse config file"},
+		{name: "invalid yaml value", yaml: "fetch:\n  workers: 0\n", wantErr: "fetch.workers"},
+		{name: "invalid env", env: map[string]string{"EARTH_FETCH_WORKERS": "many"}, wantErr: "EARTH_FETCH_WORKERS"},
+		{name: "invalid flag", args: []string{"-fetch-timeout", "soon"}, wantErr: "-fetch-timeout"},
+		{name: "flag fails validation", args: []string{"-send-workers", "0"}, wantErr: "send.workers"},
+		{name: "unknown flag", args: []string{"-no-such-flag", "1"}, wantErr: "no-such-flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_PATH", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			switch {
+			case tt.missing:
+				args = append([]string{"-config", filepath.Join(t.TempDir(), "none.yaml")}, args...)
+			case tt.yaml != "":
+				args = append([]string{"-config", writeConfig(t, tt.yaml)}, args...)
+			}
+			_, err := LoadConfig(args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string // 空の場合はエラーにならない
+	}{
+		{name: "defaults", modify: func(c *Config) {}},
+		{name: "local node", modify: func(c *Config) { c.BpSocket.LocalNodeNum = 0 }, wantErr: "bp_socket.local_node_num"},
+		{name: "same service numbers", modify: func(c *Config) { c.BpSocket.SendFromSvcNum = c.BpSocket.LocalServiceNum }, wantErr: "must differ"},
+		{name: "unknown transport", modify: func(c *Config) { c.Transport.Mode = "carrier-pigeon" }, wantErr: "transport"},
+		{name: "fetch timeout", modify: func(c *Config) { c.Fetch.Timeout = 0 }, wantErr: "fetch.timeout"},
+		{name: "fetch max bytes", modify: func(c *Config) { c.Fetch.MaxBytes = maxBodyBytes + 1 }, wantErr: "fetch.max_bytes"},
+		{name: "large max bytes below max bytes", modify: func(c *Config) { c.Fetch.LargeMaxBytes = c.Fetch.MaxBytes - 1 }, wantErr: "fetch.large_max_bytes"},
+		{name: "size limit type", modify: func(c *Config) { c.Fetch.Limits = []SizeLimitRule{{MaxBytes: 1}} }, wantErr: "fetch.limits[0].type"},
+		{name: "crawl depth", modify: func(c *Config) { c.Crawl.MaxDepth = -1 }, wantErr: "crawl.max_depth"},
+		{name: "priority aging", modify: func(c *Config) { c.Send.PriorityAging = -time.Second }, wantErr: "send.priority_aging"},
+		{name: "send retries", modify: func(c *Config) { c.Send.Retries = -1 }, wantErr: "send.retries"},
+		{name: "retry backoff", modify: func(c *Config) { c.Send.RetryBackoff = -time.Second }, wantErr: "send.retry_backoff"},
+		{name: "queue size", modify: func(c *Config) { c.Pipeline.QueueSize = 0 }, wantErr: "pipeline.queue_size"},
+		{name: "image quality, disabled", modify: func(c *Config) { c.Transform.Image.Quality = 0 }},
+		{name: "image quality", modify: func(c *Config) { c.Transform.Image.Enabled = true; c.Transform.Image.Quality = 0 }, wantErr: "transform.image.quality"},
+		{name: "image max pixels", modify: func(c *Config) { c.Transform.Image.Enabled = true; c.Transform.Image.MaxPixels = -1 }, wantErr: "transform.image.max_pixels"},
+		{name: "lite mode", modify: func(c *Config) { c.Transform.Lite.DefaultMode = "dark" }, wantErr: "transform.lite.default_mode"},
+		{name: "egress cidr", modify: func(c *Config) { c.Egress.DenyCIDRs = []string{"10.0.0.0/33"} }, wantErr: "egress.deny_cidrs"},
+		{name: "egress port", modify: func(c *Config) { c.Egress.Ports = []int{0} }, wantErr: "egress.ports"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			tt.modify(&c)
+			err := c.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
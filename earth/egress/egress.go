@@ -0,0 +1,219 @@
+// Package egress restricts the destinations the Earth station may fetch so that requests from space cannot reach the ground network
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked ポリシーにより接続を拒否したことを示すエラー
+var ErrBlocked = errors.New("blocked by egress policy")
+
+// reservedPrefixes net/netipの判定メソッドでは拾えない、既定で拒否する範囲
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // CGNAT (RFC 6598)
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETFプロトコル割り当て
+	netip.MustParsePrefix("198.18.0.0/15"),  // ベンチマーク用 (RFC 2544)
+	netip.MustParsePrefix("240.0.0.0/4"),    // 予約済み（ブロードキャストを含む）
+	netip.MustParsePrefix("64:ff9b:1::/48"), // ローカル用NAT64 (RFC 8215)
+	netip.MustParsePrefix("2001:db8::/32"),  // ドキュメント用
+}
+
+// IPv4アドレスを埋め込んだIPv6アドレスの範囲（埋め込まれたIPv4アドレスでも検証する）
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96") // NAT64の既定のプレフィックス (RFC 6052)、下位32ビット
+	sixToFour   = netip.MustParsePrefix("2002::/16")    // 6to4 (RFC 3056)、16ビット目からの32ビット
+)
+
+// Policy 接続先の制限
+// ゼロ値はプライベート・ループバック・リンクローカル等の範囲だけを拒否する
+type Policy struct {
+	AllowPrivate bool           // プライベート・ループバック・リンクローカル等の範囲への接続を許可するか
+	AllowCIDRs   []netip.Prefix // 既定で拒否する範囲のうち、例外として許可する範囲（地上のミラーサーバーなど）
+	DenyCIDRs    []netip.Prefix // 追加で拒否する範囲（AllowCIDRsより優先）
+	AllowHosts   []string       // 空でなければ、これらのホストだけを許可する（".example.com"でサブドメインも対象）
+	DenyHosts    []string       // 拒否するホスト（AllowHostsより優先）
+	Ports        []int          // 許可するポート（空の場合はすべて）
+}
+
+// ParsePrefixes CIDR表記の文字列をパースする（単一のアドレスは/32・/128として扱う）
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// CheckURL URLのスキーム・ホスト・ポートを検証する
+// ホスト名の解決結果は接続時にControlで検証する（DNSの応答が変わっても回避できないようにするため）
+func (p *Policy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrBlocked, u.Scheme)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("%w: host is empty", ErrBlocked)
+	}
+	if matchHost(host, p.DenyHosts) {
+		return fmt.Errorf("%w: host %s is denied", ErrBlocked, host)
+	}
+	if len(p.AllowHosts) > 0 && !matchHost(host, p.AllowHosts) {
+		return fmt.Errorf("%w: host %s is not in the allow list", ErrBlocked, host)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("%w: invalid port %q", ErrBlocked, port)
+	}
+	if err := p.checkPort(n); err != nil {
+		return err
+	}
+
+	// IPアドレスが直接指定されている場合は接続前に拒否する
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.CheckAddr(addr)
+	}
+	return nil
+}
+
+// CheckAddr 接続先のIPアドレスを検証する
+func (p *Policy) CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap().WithZone("")
+	// NAT64・6to4経由で内部のIPv4アドレスに到達できないよう、埋め込まれたアドレスも検証する
+	if v4, ok := embeddedIPv4(addr); ok {
+		if err := p.CheckAddr(v4); err != nil {
+			return fmt.Errorf("%w (embedded in %s)", err, addr)
+		}
+	}
+	for _, prefix := range p.DenyCIDRs {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: address %s is in denied range %s", ErrBlocked, addr, prefix)
+		}
+	}
+	if p.AllowPrivate || !isInternal(addr) {
+		return nil
+	}
+	for _, prefix := range p.AllowCIDRs {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: address %s is private, loopback or reserved", ErrBlocked, addr)
+}
+
+func (p *Policy) checkPort(port int) error {
+	if len(p.Ports) == 0 {
+		return nil
+	}
+	for _, allowed := range p.Ports {
+		if port == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: port %d is not allowed", ErrBlocked, port)
+}
+
+// Control net.Dialer.Controlとして使用し、名前解決後の実際の接続先を検証する
+func (p *Policy) Control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: invalid address %q", ErrBlocked, address)
+	}
+	if err := p.checkPort(int(addrPort.Port())); err != nil {
+		return err
+	}
+	return p.CheckAddr(addrPort.Addr())
+}
+
+// Transport ポリシーを適用したhttp.Transportを返す
+// 環境変数のプロキシ設定は使用しない（プロキシ経由では接続先を検証できないため）
+func (p *Policy) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.Control,
+	}).DialContext
+	return t
+}
+
+// isInternal 地上ネットワーク内部の範囲かどうか
+func isInternal(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedIPv4 NAT64・6to4のアドレスに埋め込まれたIPv4アドレスを返す
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case !addr.Is6():
+		return netip.Addr{}, false
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFour.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
+
+// matchHost ホスト名がパターンのいずれかに一致するか（".example.com"でサブドメインも対象）
+func matchHost(host string, patterns []string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		p = strings.TrimPrefix(p, "*")
+		if p == "" {
+			continue
+		}
+		if strings.HasPrefix(p, ".") {
+			if strings.HasSuffix(host, p) || host == p[1:] {
+				return true
+			}
+			continue
+		}
+		if host == p {
+			return true
+		}
+	}
+	return false
+}
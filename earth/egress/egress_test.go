@@ -0,0 +1,141 @@
+package egress
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	p := &Policy{
+		DenyHosts: []string{".tracker.example"},
+		Ports:     []int{80, 443},
+	}
+	cases := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://example.com/", false},
+		{"http://example.com:80/", false},
+		{"http://example.com:8080/", true},
+		{"ftp://example.com/", true},
+		{"file:///etc/passwd", true},
+		{"http://ads.tracker.example/", true},
+		{"http://tracker.example/", true},
+		{"http://127.0.0.1/", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://10.1.2.3/", true},
+		{"http://[::1]/", true},
+		{"http://[::ffff:192.168.0.1]/", true},
+		{"http://93.184.216.34/", false},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.CheckURL(u)
+		if got := errors.Is(err, ErrBlocked); got != c.blocked {
+			t.Errorf("CheckURL(%s) = %v, want blocked=%v", c.url, err, c.blocked)
+		}
+	}
+}
+
+func TestAllowHosts(t *testing.T) {
+	p := &Policy{AllowHosts: []string{".example.org"}, DenyHosts: []string{"private.example.org"}}
+	for raw, blocked := range map[string]bool{
+		"https://example.org/":         false,
+		"https://www.example.org/":     false,
+		"https://private.example.org/": true,
+		"https://example.com/":         true,
+	} {
+		u, _ := url.Parse(raw)
+		if got := errors.Is(p.CheckURL(u), ErrBlocked); got != blocked {
+			t.Errorf("CheckURL(%s) blocked = %v, want %v", raw, got, blocked)
+		}
+	}
+}
+
+func TestCheckAddr(t *testing.T) {
+	mirror := netip.MustParsePrefix("10.20.0.0/16")
+	p := &Policy{
+		AllowCIDRs: []netip.Prefix{mirror},
+		DenyCIDRs:  []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")},
+	}
+	cases := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"8.8.8.8", false},
+		{"2606:4700::1111", false},
+		{"10.20.3.4", false}, // AllowCIDRsによる例外
+		{"10.21.3.4", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"203.0.113.5", true},
+		// NAT64・6to4は埋め込まれたIPv4アドレスで判定する
+		{"64:ff9b::808:808", false},  // 8.8.8.8
+		{"64:ff9b::7f00:1", true},    // 127.0.0.1
+		{"64:ff9b::a9fe:a9fe", true}, // 169.254.169.254
+		{"64:ff9b::a14:304", false},  // 10.20.3.4（AllowCIDRsによる例外）
+		{"64:ff9b::cb00:7105", true}, // 203.0.113.5（DenyCIDRs）
+		{"2002:808:808::1", false},   // 8.8.8.8
+		{"2002:c0a8:101::1", true},   // 192.168.1.1
+	}
+	for _, c := range cases {
+		err := p.CheckAddr(netip.MustParseAddr(c.addr))
+		if got := errors.Is(err, ErrBlocked); got != c.blocked {
+			t.Errorf("CheckAddr(%s) = %v, want blocked=%v", c.addr, err, c.blocked)
+		}
+	}
+
+	// AllowPrivateでも DenyCIDRs は優先される
+	p.AllowPrivate = true
+	if err := p.CheckAddr(netip.MustParseAddr("192.168.1.1")); err != nil {
+		t.Errorf("AllowPrivate: unexpected error %v", err)
+	}
+	if err := p.CheckAddr(netip.MustParseAddr("203.0.113.5")); !errors.Is(err, ErrBlocked) {
+		t.Errorf("AllowPrivate: DenyCIDRs must still apply, got %v", err)
+	}
+}
+
+func TestTransportBlocksResolvedAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// "localhost"はURLの検証では通るが、接続時に解決後のアドレスで拒否される
+	target := "http://localhost:" + u.Port() + "/"
+	client := &http.Client{Transport: (&Policy{}).Transport()}
+	_, err := client.Get(target)
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("Get(%s) error = %v, want ErrBlocked", target, err)
+	}
+
+	client = &http.Client{Transport: (&Policy{AllowPrivate: true}).Transport()}
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("AllowPrivate: Get(%s) error = %v", target, err)
+	}
+	resp.Body.Close()
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefixes) != 3 || prefixes[1].Bits() != 32 {
+		t.Errorf("ParsePrefixes() = %v", prefixes)
+	}
+	if _, err := ParsePrefixes([]string{"not-a-cidr"}); err == nil {
+		t.Error("ParsePrefixes(invalid) should fail")
+	}
+}
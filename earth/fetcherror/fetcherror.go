@@ -0,0 +1,154 @@
+// Package fetcherror classifies origin fetch failures so that the space side can tell the user why a page is unavailable
+package fetcherror
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Class エラーの分類
+type Class string
+
+const (
+	ClassDNS      Class = "dns"       // 名前解決に失敗した
+	ClassConnect  Class = "connect"   // 接続できない、または接続が切断された
+	ClassTLS      Class = "tls"       // TLSハンドシェイク・証明書の検証に失敗した
+	ClassTimeout  Class = "timeout"   // タイムアウトした
+	ClassTooLarge Class = "too-large" // レスポンスが大きすぎる
+	ClassBlocked  Class = "blocked"   // ポリシーにより取得を拒否した
+	ClassInvalid  Class = "invalid"   // リクエストが不正
+	ClassUnknown  Class = "unknown"   // 上記以外
+)
+
+// エラーレスポンスに付与するヘッダー
+const (
+	ClassHeader   = "X-Earth-Error"
+	MessageHeader = "X-Earth-Error-Message"
+)
+
+// Error 分類付きの取得エラー
+type Error struct {
+	Class Class
+	URL   string
+	Err   error
+
+	// 大きさ・種類の制限により中止した場合の情報（ClassTooLargeなど）
+	ContentType string
+	Size        int64
+	Limit       int64
+}
+
+// New 分類を指定してエラーを作成する
+func New(class Class, url string, err error) *Error {
+	return &Error{Class: class, URL: url, Err: err}
+}
+
+func (e *Error) Error() string {
+	return string(e.Class) + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify エラーを分類する
+func Classify(err error) Class {
+	var fe *Error
+	if errors.As(err, &fe) {
+		return fe.Class
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ClassTimeout
+		}
+		return ClassDNS
+	}
+
+	var (
+		certErr     *tls.CertificateVerificationError
+		recordErr   tls.RecordHeaderError
+		alertErr    tls.AlertError
+		unknownAuth x509.UnknownAuthorityError
+		hostErr     x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+	)
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &unknownAuth) || errors.As(err, &hostErr) || errors.As(err, &invalidErr) {
+		return ClassTLS
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ClassTimeout
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ClassConnect
+	}
+	return ClassUnknown
+}
+
+// Wrap エラーを分類してErrorにする（既にErrorの場合はそのまま返す）
+func Wrap(url string, err error) *Error {
+	var fe *Error
+	if errors.As(err, &fe) {
+		return fe
+	}
+	return New(Classify(err), url, err)
+}
+
+// StatusCode 分類に対応するHTTPステータスコード
+func (c Class) StatusCode() int {
+	switch c {
+	case ClassTimeout:
+		return http.StatusGatewayTimeout
+	case ClassTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ClassBlocked:
+		return http.StatusForbidden
+	case ClassInvalid:
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// Body エラーレスポンスのボディ
+type Body struct {
+	Class       Class  `json:"error_class"`
+	Message     string `json:"message"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Limit       int64  `json:"limit,omitempty"`
+}
+
+// Response エラーレスポンスのステータスコード・ヘッダー・ボディを生成する
+func (e *Error) Response() (int, http.Header, []byte) {
+	body, _ := json.Marshal(Body{
+		Class:       e.Class,
+		Message:     e.Err.Error(),
+		URL:         e.URL,
+		ContentType: e.ContentType,
+		Size:        e.Size,
+		Limit:       e.Limit,
+	})
+	header := http.Header{
+		"Content-Type": {"application/json"},
+		ClassHeader:    {string(e.Class)},
+		MessageHeader:  {strings.Join(strings.Fields(e.Err.Error()), " ")}, // ヘッダーに改行を含めない
+	}
+	return e.Class.StatusCode(), header, body
+}
@@ -0,0 +1,70 @@
+package fetcherror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"dns", &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}, ClassDNS},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, ClassTimeout},
+		{"deadline", fmt.Errorf("HTTP request error: %w", context.DeadlineExceeded), ClassTimeout},
+		{"connect", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ClassConnect},
+		{"classified", fmt.Errorf("wrapped: %w", New(ClassBlocked, "http://10.0.0.1/", errors.New("private address"))), ClassBlocked},
+		{"unknown", errors.New("something else"), ClassUnknown},
+	}
+	for _, c := range cases {
+		if got := Classify(c.err); got != c.want {
+			t.Errorf("%s: Classify() = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestClassifyClientErrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := client.Get(slow.URL); Classify(err) != ClassTimeout {
+		t.Errorf("slow server: got %s (%v), want timeout", Classify(err), err)
+	}
+	// 自己署名証明書はクライアント側で検証に失敗する
+	if _, err := http.Get(tlsSrv.URL); Classify(err) != ClassTLS {
+		t.Errorf("self-signed server: got %s (%v), want tls", Classify(err), err)
+	}
+}
+
+func TestResponseIncludesSizeMetadata(t *testing.T) {
+	e := New(ClassTooLarge, "http://example.com/big.iso", errors.New("response too large"))
+	e.ContentType = "application/octet-stream"
+	e.Size = 700 << 20
+	e.Limit = 2 << 20
+
+	status, header, body := e.Response()
+	if status != http.StatusRequestEntityTooLarge || header.Get(ClassHeader) != string(ClassTooLarge) {
+		t.Fatalf("Response() = %d, %v", status, header)
+	}
+	var b Body
+	if err := json.Unmarshal(body, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Size != e.Size || b.Limit != e.Limit || b.ContentType != e.ContentType {
+		t.Errorf("body = %+v", b)
+	}
+}
@@ -1,4 +1,8 @@
 module earth
 
 go 1.25.4
- 
\ No newline at end of file
+
+require (
+	golang.org/x/net v0.42.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,345 @@
+// Package journal persists received requests and outgoing responses in an append-only log so that unfinished work survives restarts
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 記録の種類
+const (
+	opRequest  = "req"  // 受信したリクエスト
+	opDone     = "done" // リクエストのすべての応答を記録した
+	opResponse = "res"  // 送信するレスポンス
+	opAck      = "ack"  // レスポンスを送信した
+)
+
+// record ログの1行
+type record struct {
+	Op   string    `json:"op"`
+	ID   string    `json:"id,omitempty"`   // リクエストのID
+	Seq  uint64    `json:"seq,omitempty"`  // レスポンスの通し番号
+	From string    `json:"from,omitempty"` // リクエストの送信元
+	Data []byte    `json:"data,omitempty"` // リクエストのバンドル、またはレスポンス
+	At   time.Time `json:"at"`
+}
+
+// Request 完了していないリクエスト
+type Request struct {
+	ID         string
+	From       string
+	Data       []byte
+	ReceivedAt time.Time
+}
+
+// Response 送信していないレスポンス
+type Response struct {
+	Seq       uint64
+	RequestID string
+	Data      []byte
+}
+
+// Journal 受信したリクエストと送信するレスポンスを追記型のログに記録する
+//
+// リクエストは受信時に記録し、そのリクエストのすべてのレスポンスを記録した時点で完了とする。
+// レスポンスは送信キューに入れる時に記録し、送信した時点で確認済みとする。
+// 起動時には完了していないリクエストと送信していないレスポンスを再実行する（少なくとも1回の配送）。
+// 完了したリクエストのIDは一定時間保持し、同じIDのリクエストの再送を取り除く。
+type Journal struct {
+	mu           sync.Mutex
+	path         string
+	file         *os.File
+	size         int64
+	compactBytes int64
+	compactSize  int64 // 前回書き直した直後のログの大きさ
+	retention    time.Duration
+
+	requests  map[string]*Request  // 完了していないリクエスト
+	done      map[string]time.Time // 完了したリクエストのIDと完了時刻
+	responses map[uint64]*Response // 送信していないレスポンス
+	nextSeq   uint64
+	now       func() time.Time
+}
+
+// Open ログを読み込んで未完了の作業を復元し、追記用に開く
+// retention: 完了したリクエストのIDを重複除去のために保持する時間
+// compactBytes: ログがこの大きさを超えたら、未完了の記録だけを残して書き直す
+// （未完了の記録だけでこれを超える場合は、書き直した直後の2倍を超えるまで書き直さない）
+func Open(path string, retention time.Duration, compactBytes int64) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		path:         path,
+		compactBytes: compactBytes,
+		retention:    retention,
+		requests:     make(map[string]*Request),
+		done:         make(map[string]time.Time),
+		responses:    make(map[uint64]*Response),
+		nextSeq:      1,
+		now:          time.Now,
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	// 読み込んだ時点で書き直し、確認済みの記録や途中で切れた行を取り除く
+	if err := j.compactLocked(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// load ログを先頭から再生する
+// 書き込み中に停止した場合の最後の不完全な行は無視する
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		var r record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			log.Printf("[Journal] Skipping corrupt record at line %d: %v", line, err)
+			continue
+		}
+		j.apply(&r)
+	}
+	if err := sc.Err(); err != nil {
+		log.Printf("[Journal] Stopped reading at line %d: %v", line, err)
+	}
+	return nil
+}
+
+// apply 1つの記録を状態に反映する
+func (j *Journal) apply(r *record) {
+	switch r.Op {
+	case opRequest:
+		// 保持期間が過ぎた後に同じIDで再び受信した場合は、新しいリクエストとして扱う
+		delete(j.done, r.ID)
+		j.requests[r.ID] = &Request{ID: r.ID, From: r.From, Data: r.Data, ReceivedAt: r.At}
+	case opDone:
+		delete(j.requests, r.ID)
+		j.done[r.ID] = r.At
+	case opResponse:
+		j.responses[r.Seq] = &Response{Seq: r.Seq, RequestID: r.ID, Data: r.Data}
+		j.nextSeq = max(j.nextSeq, r.Seq+1)
+	case opAck:
+		delete(j.responses, r.Seq)
+		j.nextSeq = max(j.nextSeq, r.Seq+1)
+	}
+}
+
+// Pending 完了していないリクエストと送信していないレスポンスを記録順に返す
+func (j *Journal) Pending() ([]Request, []Response) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.pendingLocked()
+}
+
+func (j *Journal) pendingLocked() ([]Request, []Response) {
+	reqs := make([]Request, 0, len(j.requests))
+	for _, r := range j.requests {
+		reqs = append(reqs, *r)
+	}
+	sort.Slice(reqs, func(a, b int) bool { return reqs[a].ReceivedAt.Before(reqs[b].ReceivedAt) })
+
+	resps := make([]Response, 0, len(j.responses))
+	for _, r := range j.responses {
+		resps = append(resps, *r)
+	}
+	sort.Slice(resps, func(a, b int) bool { return resps[a].Seq < resps[b].Seq })
+	return reqs, resps
+}
+
+// AddRequest 受信したリクエストを記録する
+// 同じIDのリクエストが未完了、または保持期間内に完了している場合は記録せずにfalseを返す
+func (j *Journal) AddRequest(id, from string, data []byte) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.requests[id]; ok {
+		return false, nil
+	}
+	if at, ok := j.done[id]; ok && j.now().Sub(at) < j.retention {
+		return false, nil
+	}
+	r := &record{Op: opRequest, ID: id, From: from, Data: data, At: j.now()}
+	if err := j.appendLocked(r, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CompleteRequest リクエストのすべてのレスポンスを記録したことを記録する（記録していないIDは無視する）
+func (j *Journal) CompleteRequest(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.requests[id]; !ok {
+		return nil
+	}
+	r := &record{Op: opDone, ID: id, At: j.now()}
+	if err := j.appendLocked(r, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddResponse 送信するレスポンスを記録し、送信後にAckで指定する通し番号を返す
+func (j *Journal) AddResponse(requestID string, data []byte) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r := &record{Op: opResponse, ID: requestID, Seq: j.nextSeq, Data: data, At: j.now()}
+	if err := j.appendLocked(r, true); err != nil {
+		return 0, err
+	}
+	return r.Seq, nil
+}
+
+// Ack レスポンスを送信したことを記録する
+func (j *Journal) Ack(seq uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.responses[seq]; !ok {
+		return nil
+	}
+	r := &record{Op: opAck, Seq: seq, At: j.now()}
+	if err := j.appendLocked(r, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close ログを閉じる
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// appendLocked 記録を1行追記して状態に反映する
+// sync: ディスクへの書き込みを待つか（失うと再実行できない記録の場合）
+func (j *Journal) appendLocked(r *record, sync bool) error {
+	if j.file == nil {
+		return fmt.Errorf("journal is closed")
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := j.file.Write(line); err != nil {
+		return fmt.Errorf("journal write error: %w", err)
+	}
+	if sync {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("journal sync error: %w", err)
+		}
+	}
+	j.size += int64(len(line))
+	// 書き直す前に状態に反映する（書き直したログから追記した記録が消えないように）
+	j.apply(r)
+
+	// 送信していないレスポンスが溜まっている間に、追記のたびにログ全体を書き直さないようにする
+	if j.compactBytes > 0 && j.size > max(j.compactBytes, 2*j.compactSize) {
+		if err := j.compactLocked(); err != nil {
+			log.Printf("[Journal] Compaction error: %v", err)
+		}
+	}
+	return nil
+}
+
+// compactLocked 未完了の記録と保持期間内の完了したIDだけを一時ファイルに書き出し、置き換える
+func (j *Journal) compactLocked() error {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return j.reopen(err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	var werr error
+	write := func(r *record) {
+		if werr == nil {
+			werr = enc.Encode(r)
+		}
+	}
+
+	now := j.now()
+	for id, at := range j.done {
+		if now.Sub(at) >= j.retention {
+			delete(j.done, id)
+			continue
+		}
+		write(&record{Op: opDone, ID: id, At: at})
+	}
+	reqs, resps := j.pendingLocked()
+	for _, r := range reqs {
+		write(&record{Op: opRequest, ID: r.ID, From: r.From, Data: r.Data, At: r.ReceivedAt})
+	}
+	for _, r := range resps {
+		write(&record{Op: opResponse, ID: r.RequestID, Seq: r.Seq, Data: r.Data, At: now})
+	}
+	if werr == nil {
+		werr = w.Flush()
+	}
+	if werr == nil {
+		werr = f.Sync()
+	}
+	f.Close()
+	if werr != nil {
+		os.Remove(tmp)
+		return j.reopen(werr)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		os.Remove(tmp)
+		return j.reopen(err)
+	}
+	err = j.reopen(nil)
+	j.compactSize = j.size
+	return err
+}
+
+// reopen ログを追記用に開き直す（書き直しに失敗した場合は元のログに追記を続ける）
+func (j *Journal) reopen(cause error) error {
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.file = f
+	j.size = info.Size()
+	return cause
+}
@@ -0,0 +1,163 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := Open(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if ok, err := j.AddRequest(id, "ipn:149.1", []byte(`{"request_id":"`+id+`"}`)); !ok || err != nil {
+			t.Fatalf("AddRequest(%s) = %v, %v", id, ok, err)
+		}
+	}
+	seq1, _ := j.AddResponse("a", []byte("response a"))
+	seq2, _ := j.AddResponse("b", []byte("response b1"))
+	if err := j.CompleteRequest("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Ack(seq1); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// 再起動: bは未完了、bのレスポンスは未送信、aは完了済みとして重複を取り除く
+	j, err = Open(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	reqs, resps := j.Pending()
+	if len(reqs) != 1 || reqs[0].ID != "b" || reqs[0].From != "ipn:149.1" || string(reqs[0].Data) != `{"request_id":"b"}` {
+		t.Errorf("pending requests = %+v", reqs)
+	}
+	if len(resps) != 1 || resps[0].Seq != seq2 || string(resps[0].Data) != "response b1" {
+		t.Errorf("pending responses = %+v", resps)
+	}
+	if ok, _ := j.AddRequest("a", "", nil); ok {
+		t.Error("a completed request should be deduplicated")
+	}
+	if ok, _ := j.AddRequest("b", "", nil); ok {
+		t.Error("a pending request should be deduplicated")
+	}
+
+	// 通し番号は再起動後も重複しない
+	if seq, _ := j.AddResponse("b", []byte("response b2")); seq <= seq2 {
+		t.Errorf("AddResponse after restart returned seq %d, want > %d", seq, seq2)
+	}
+}
+
+func TestDedupeWindowAndCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := Open(path, time.Minute, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	now := time.Now()
+	j.now = func() time.Time { return now }
+
+	j.AddRequest("x", "", []byte("x"))
+	j.CompleteRequest("x")
+	if ok, _ := j.AddRequest("x", "", []byte("x")); ok {
+		t.Error("request within the window should be deduplicated")
+	}
+	now = now.Add(2 * time.Minute)
+	if ok, _ := j.AddRequest("x", "", []byte("x")); !ok {
+		t.Error("request after the window should be accepted again")
+	}
+
+	// 確認済みの記録は書き直しで消え、ログが大きくなり続けない
+	for i := 0; i < 50; i++ {
+		seq, err := j.AddResponse("x", make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.Ack(seq)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1024 {
+		t.Errorf("journal size = %d, want compacted below 1024", info.Size())
+	}
+	if reqs, resps := j.Pending(); len(reqs) != 1 || len(resps) != 0 {
+		t.Errorf("after compaction: %d requests, %d responses pending", len(reqs), len(resps))
+	}
+}
+
+func TestTruncatedTailIsIgnored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := Open(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.AddRequest("a", "", []byte("a"))
+	j.Close()
+
+	// 書き込み中に停止して最後の行が途中で切れた状態
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"op":"req","id":"b","da`)
+	f.Close()
+
+	j, err = Open(path, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if reqs, _ := j.Pending(); len(reqs) != 1 || reqs[0].ID != "a" {
+		t.Errorf("pending requests = %+v", reqs)
+	}
+	if ok, err := j.AddRequest("c", "", []byte("c")); !ok || err != nil {
+		t.Errorf("AddRequest after recovery = %v, %v", ok, err)
+	}
+}
+
+// 送信していないレスポンスだけでcompactBytesを超えても、追記のたびに書き直さない
+func TestCompactionWithLargePendingBacklog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := Open(path, time.Hour, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.AddRequest("a", "", []byte("a"))
+
+	rewrites := 0
+	prev, _ := os.Stat(path)
+	for i := 0; i < 64; i++ {
+		if _, err := j.AddResponse("a", make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(prev, info) {
+			rewrites++
+		}
+		prev = info
+	}
+	// 64件（約10KB）の追記で、書き直しは大きさが倍になるごとの数回だけ
+	if rewrites == 0 || rewrites > 5 {
+		t.Errorf("journal rewritten %d times for 64 appends, want 1..5", rewrites)
+	}
+	j.Close()
+
+	j, err = Open(path, time.Hour, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if _, resps := j.Pending(); len(resps) != 64 {
+		t.Errorf("pending responses after reopen = %d, want 64", len(resps))
+	}
+}
@@ -0,0 +1,115 @@
+// Package manifest describes the subresources and links of a page so that the space side can choose what to download
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Space側から届くリクエストのメソッド
+const (
+	MethodManifest = "MANIFEST" // ページのマニフェストを要求する
+	MethodBatch    = "BATCH"    // マニフェストから選んだURLをまとめて要求する
+)
+
+// 応答に付与するヘッダー
+const (
+	Header      = "X-Earth-Manifest" // 応答がマニフェストであることを示す（値は項目数）
+	BatchHeader = "X-Earth-Batch"    // BATCHの応答で受け付けたURLの数
+	ContentType = "application/json"
+)
+
+// 項目の種類
+const (
+	KindSubresource = "subresource" // 画像・CSS・スクリプトなどページの表示に使われるリソース
+	KindLink        = "link"        // ページからリンクされているページ
+)
+
+// 大きさの取得方法
+const (
+	SizeFromCache = "cache" // Earth側キャッシュに保存されているボディの大きさ
+	SizeFromHead  = "head"  // HEADリクエストのContent-Length
+)
+
+// Item マニフェストの1項目
+type Item struct {
+	URL         string `json:"url"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`                  // 不明な場合は-1
+	SizeSource  string `json:"size_source,omitempty"` // cache / head
+	Status      int    `json:"status,omitempty"`      // HEADリクエストのステータスコード
+	Error       string `json:"error,omitempty"`       // 大きさを調べられなかった理由
+}
+
+// Manifest ページのマニフェスト
+type Manifest struct {
+	URL         string    `json:"url"`
+	FinalURL    string    `json:"final_url"` // リダイレクト後のURL
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"` // ページ本体の大きさ
+	GeneratedAt time.Time `json:"generated_at"`
+	Truncated   bool      `json:"truncated"` // 項目数の上限により一部を省略したか
+	Items       []Item    `json:"items"`
+}
+
+// Batch BATCHリクエストのボディ
+type Batch struct {
+	URLs []string `json:"urls"`
+}
+
+// Collect サブリソースとリンクを重複なく項目にまとめる（サブリソースを先にする）
+// maxItemsを超える分は省略し、省略したかどうかを返す
+func Collect(subresources, links []string, maxItems int) ([]Item, bool) {
+	seen := make(map[string]bool)
+	items := make([]Item, 0, min(len(subresources)+len(links), maxItems))
+	truncated := false
+	add := func(urls []string, kind string) {
+		for _, u := range urls {
+			if seen[u] {
+				continue
+			}
+			seen[u] = true
+			if len(items) >= maxItems {
+				truncated = true
+				return
+			}
+			items = append(items, Item{URL: u, Kind: kind, Size: -1})
+		}
+	}
+	add(subresources, KindSubresource)
+	add(links, KindLink)
+	return items, truncated
+}
+
+// ParseBatch BATCHリクエストのボディを検証し、重複を除いたURLを返す
+func ParseBatch(body []byte, maxItems int) ([]string, error) {
+	var b Batch
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, fmt.Errorf("invalid batch body: %w", err)
+	}
+	if len(b.URLs) == 0 {
+		return nil, fmt.Errorf("batch has no URLs")
+	}
+
+	seen := make(map[string]bool)
+	urls := make([]string, 0, len(b.URLs))
+	for _, raw := range b.URLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL in batch: %q", raw)
+		}
+		if seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		urls = append(urls, raw)
+	}
+	if len(urls) > maxItems {
+		return nil, fmt.Errorf("batch has %d URLs (maximum %d)", len(urls), maxItems)
+	}
+	return urls, nil
+}
@@ -0,0 +1,47 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	subresources := []string{"https://example.com/a.css", "https://example.com/b.png"}
+	links := []string{"https://example.com/about", "https://example.com/b.png", "https://example.com/news"}
+
+	items, truncated := Collect(subresources, links, 10)
+	if truncated || len(items) != 4 {
+		t.Fatalf("Collect() = %+v, truncated=%v", items, truncated)
+	}
+	if items[1].Kind != KindSubresource || items[2].Kind != KindLink || items[0].Size != -1 {
+		t.Errorf("unexpected items: %+v", items)
+	}
+
+	items, truncated = Collect(subresources, links, 3)
+	if !truncated || len(items) != 3 || items[2].URL != "https://example.com/about" {
+		t.Errorf("Collect(max=3) = %+v, truncated=%v", items, truncated)
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	urls, err := ParseBatch([]byte(`{"urls":["https://example.com/a","https://example.com/a","http://example.com/b"]}`), 10)
+	if err != nil || len(urls) != 2 {
+		t.Fatalf("ParseBatch() = %v, %v", urls, err)
+	}
+
+	for _, body := range []string{
+		`{"urls":[]}`,
+		`{"urls":["file:///etc/passwd"]}`,
+		`{"urls":["https://"]}`,
+		`not json`,
+	} {
+		if _, err := ParseBatch([]byte(body), 10); err == nil {
+			t.Errorf("ParseBatch(%s) should fail", body)
+		}
+	}
+
+	many := `{"urls":["https://example.com/1","https://example.com/2","https://example.com/3"]}`
+	if _, err := ParseBatch([]byte(many), 2); err == nil || !strings.Contains(err.Error(), "maximum") {
+		t.Errorf("ParseBatch over the limit: err = %v", err)
+	}
+}
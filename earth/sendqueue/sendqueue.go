@@ -0,0 +1,159 @@
+// Package sendqueue schedules outgoing responses fairly across the space nodes they are addressed to
+package sendqueue
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// priorityWeight 優先度1段階分のスコア（サイズによる差がこれを超えないようにする）
+	priorityWeight = 16
+
+	// smallSize この大きさ以下のレスポンスはサイズによるスコアの加算をしない
+	smallSize = 16 * 1024
+)
+
+// entry キューに入っている要素
+type entry[T any] struct {
+	value    T
+	priority int
+	size     int
+	enqueued time.Time
+}
+
+// score 小さいほど先に送信する
+// 優先度が同じなら小さいレスポンスを先にし、待ち時間に応じてスコアを下げて大きなレスポンスが送信されないままになるのを防ぐ
+func (e *entry[T]) score(now time.Time, aging time.Duration) int {
+	s := e.priority*priorityWeight + sizeCost(e.size)
+	if aging > 0 {
+		s -= int(now.Sub(e.enqueued) / aging)
+	}
+	return s
+}
+
+// sizeCost smallSizeから何回2倍した大きさか（16KB以下は0、1MBで6）
+func sizeCost(size int) int {
+	if size <= smallSize {
+		return 0
+	}
+	return bits.Len(uint((size - 1) / smallSize))
+}
+
+// Queue 宛先ごとにレスポンスを保持し、宛先を順番に巡回して取り出すキュー
+// 1つのノードが大量のレスポンスを発生させても、他のノードへの送信が待たされないようにする
+// 同じ宛先の中では、優先度・大きさ・待ち時間から求めたスコアの小さいものから取り出す
+type Queue[T any] struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	capacity int
+	aging    time.Duration
+	queues   map[string][]*entry[T]
+	ring     []string // レスポンスが残っている宛先（次に取り出す順）
+	size     int
+	closed   bool
+	now      func() time.Time
+}
+
+// New 全体でcapacity件まで保持するキューを作成する
+// aging: この時間待つごとにスコアを1下げる（0の場合は待ち時間を考慮しない）
+func New[T any](capacity int, aging time.Duration) *Queue[T] {
+	q := &Queue[T]{
+		capacity: max(capacity, 1),
+		aging:    aging,
+		queues:   make(map[string][]*entry[T]),
+		now:      time.Now,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push 宛先keyのキューに追加する。満杯の場合は空きができるまで待つ
+// priority: 小さいほど優先する（0が最優先）、size: 送信するデータの大きさ
+// Close後はfalseを返す
+func (q *Queue[T]) Push(key string, priority, size int, v T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.size >= q.capacity && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return false
+	}
+
+	if len(q.queues[key]) == 0 {
+		q.ring = append(q.ring, key)
+	}
+	q.queues[key] = append(q.queues[key], &entry[T]{
+		value:    v,
+		priority: priority,
+		size:     size,
+		enqueued: q.now(),
+	})
+	q.size++
+	q.notEmpty.Signal()
+	return true
+}
+
+// Pop 次の宛先のキューから最もスコアの小さいものを取り出す。空の場合は追加されるまで待つ
+// Close後にキューが空になるとfalseを返す
+func (q *Queue[T]) Pop() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.size == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.size == 0 {
+		var zero T
+		return zero, false
+	}
+
+	key := q.ring[0]
+	q.ring = q.ring[1:]
+	items := q.queues[key]
+
+	// スコアが同じ場合は先に追加されたものを選ぶ
+	now := q.now()
+	best := 0
+	bestScore := items[0].score(now, q.aging)
+	for i := 1; i < len(items); i++ {
+		if s := items[i].score(now, q.aging); s < bestScore {
+			best, bestScore = i, s
+		}
+	}
+	v := items[best].value
+
+	copy(items[best:], items[best+1:])
+	items[len(items)-1] = nil // 取り出した要素を参照し続けないようにする
+	items = items[:len(items)-1]
+	if len(items) > 0 {
+		q.queues[key] = items
+		q.ring = append(q.ring, key) // 残りがあれば最後尾に回す
+	} else {
+		delete(q.queues, key)
+	}
+	q.size--
+	q.notFull.Signal()
+	return v, true
+}
+
+// Len キュー全体の件数
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Close 新たな追加を締め切る（残っている要素はPopで取り出せる）
+func (q *Queue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
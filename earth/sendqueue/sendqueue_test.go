@@ -0,0 +1,137 @@
+package sendqueue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoundRobinAcrossKeys(t *testing.T) {
+	q := New[string](100, 0)
+	for _, v := range []string{"a1", "a2", "a3", "a4"} {
+		q.Push("ipn:149.1", 0, 0, v)
+	}
+	q.Push("ipn:151.1", 0, 0, "b1")
+	q.Push("ipn:151.1", 0, 0, "b2")
+	q.Push("ipn:152.1", 0, 0, "c1")
+	q.Close()
+
+	var got []string
+	for {
+		v, ok := q.Pop()
+		if !ok {
+			break
+		}
+		got = append(got, v)
+	}
+	want := []string{"a1", "b1", "c1", "a2", "b2", "a3", "a4"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPushBlocksWhenFull(t *testing.T) {
+	q := New[int](2, 0)
+	q.Push("a", 0, 0, 1)
+	q.Push("a", 0, 0, 2)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push("b", 0, 0, 3)
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Push should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if v, _ := q.Pop(); v != 1 {
+		t.Errorf("Pop() = %d, want 1", v)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push did not resume after Pop")
+	}
+}
+
+func TestCloseWakesWaiters(t *testing.T) {
+	q := New[int](1, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := q.Pop(); ok {
+				t.Error("Pop on a closed empty queue should return false")
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	q.Close()
+	wg.Wait()
+
+	if q.Push("a", 0, 0, 1) {
+		t.Error("Push after Close should return false")
+	}
+}
+
+func drain(q *Queue[string]) []string {
+	q.Close()
+	var got []string
+	for {
+		v, ok := q.Pop()
+		if !ok {
+			return got
+		}
+		got = append(got, v)
+	}
+}
+
+func TestPriorityAndSizeOrdering(t *testing.T) {
+	q := New[string](100, 0)
+	q.Push("n", 3, 10*1024, "crawled page")
+	q.Push("n", 2, 2*1024*1024, "large image")
+	q.Push("n", 2, 4*1024, "icon")
+	q.Push("n", 1, 30*1024, "style.css")
+	q.Push("n", 0, 200*1024, "index.html")
+
+	got := drain(q)
+	want := []string{"index.html", "style.css", "icon", "large image", "crawled page"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAgingPreventsStarvation(t *testing.T) {
+	now := time.Unix(0, 0)
+	q := New[string](100, time.Second)
+	q.now = func() time.Time { return now }
+
+	q.Push("n", 2, 2*1024*1024, "large image")
+	// 大きな画像より優先される小さなレスポンスが次々に届いても、待ち時間に応じて画像が先になる
+	var got []string
+	for i := 0; i < 60; i++ {
+		now = now.Add(time.Second)
+		q.Push("n", 1, 1024, "script")
+		v, _ := q.Pop()
+		got = append(got, v)
+		if v == "large image" {
+			break
+		}
+	}
+	if got[len(got)-1] != "large image" {
+		t.Fatalf("large image was starved: %v", got)
+	}
+	if len(got) < 2 {
+		t.Errorf("large image should wait behind higher-priority responses first, got %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+// Package sizelimit enforces per-content-type response size caps so that a single large or endless response cannot exhaust the Earth station
+package sizelimit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RequestHeader 上限を超える大きなレスポンスの取得を明示的に要求するリクエストヘッダー（"1"で有効）
+const RequestHeader = "X-Earth-Allow-Large"
+
+var (
+	// ErrTooLarge レスポンスが上限を超えた
+	ErrTooLarge = errors.New("response too large")
+
+	// ErrDeniedType 取得しないContent-Typeだった
+	ErrDeniedType = errors.New("content type denied")
+)
+
+// Rule Content-Typeごとの上限
+type Rule struct {
+	Type     string // "image/png" や "image/*" の形式
+	MaxBytes int64
+}
+
+// Policy レスポンスの大きさと種類の制限
+type Policy struct {
+	MaxBytes      int64    // Rulesに一致しない場合の上限
+	LargeMaxBytes int64    // 大きなレスポンスの取得を明示的に要求された場合の上限（種類によらない）
+	Rules         []Rule   // Content-Typeごとの上限（先に一致したものを使用）
+	DenyTypes     []string // 取得しないContent-Type（"video/*" の形式）
+}
+
+// Error 制限により取得を中止した理由
+type Error struct {
+	Err         error  // ErrTooLarge または ErrDeniedType
+	ContentType string // レスポンスのContent-Type
+	Size        int64  // Content-Lengthで判明したレスポンスの大きさ（読み込み中に中止した場合は0）
+	Limit       int64  // 適用した上限
+}
+
+func (e *Error) Error() string {
+	if errors.Is(e.Err, ErrDeniedType) {
+		return fmt.Sprintf("%v: %s", e.Err, e.ContentType)
+	}
+	if e.Size == 0 {
+		return fmt.Sprintf("%v: exceeds limit of %d bytes (%s)", e.Err, e.Limit, e.ContentType)
+	}
+	return fmt.Sprintf("%v: %d bytes exceeds limit of %d bytes (%s)", e.Err, e.Size, e.Limit, e.ContentType)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Requested リクエストヘッダーで大きなレスポンスの取得が要求されているか
+func Requested(header http.Header) bool {
+	b, err := strconv.ParseBool(header.Get(RequestHeader))
+	return err == nil && b
+}
+
+// Limit Content-Typeに適用する上限を返す
+func (p *Policy) Limit(contentType string, large bool) int64 {
+	if large && p.LargeMaxBytes > 0 {
+		return p.LargeMaxBytes
+	}
+	mediaType := mediaType(contentType)
+	for _, rule := range p.Rules {
+		if MatchType(mediaType, rule.Type) {
+			return rule.MaxBytes
+		}
+	}
+	return p.MaxBytes
+}
+
+// Check レスポンスヘッダーを検証し、ボディの読み込みに適用する上限を返す
+// Content-Lengthが分かっている場合は、ボディを読む前に上限を超えるかを判定する
+func (p *Policy) Check(header http.Header, large bool) (int64, error) {
+	contentType := header.Get("Content-Type")
+	mt := mediaType(contentType)
+	for _, denied := range p.DenyTypes {
+		if MatchType(mt, denied) {
+			return 0, &Error{Err: ErrDeniedType, ContentType: contentType}
+		}
+	}
+
+	limit := p.Limit(contentType, large)
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && limit > 0 && n > limit {
+		return limit, &Error{Err: ErrTooLarge, ContentType: contentType, Size: n, Limit: limit}
+	}
+	return limit, nil
+}
+
+// ReadAll 上限までボディを読み込む（0以下は無制限）
+// 上限を超えた時点で読み込みを中止し、ErrTooLargeを返す
+func ReadAll(r io.Reader, limit int64, contentType string) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, &Error{Err: ErrTooLarge, ContentType: contentType, Limit: limit}
+	}
+	return body, nil
+}
+
+// MatchType メディアタイプがパターンに一致するか（"image/*" でimage全体に一致する）
+func MatchType(mediaType, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return mediaType == pattern
+}
+
+// mediaType Content-Typeからパラメータを除いたメディアタイプを返す
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt, _, _ = strings.Cut(contentType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(mt))
+}
@@ -0,0 +1,97 @@
+package sizelimit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testPolicy() *Policy {
+	return &Policy{
+		MaxBytes:      100,
+		LargeMaxBytes: 1000,
+		Rules: []Rule{
+			{Type: "image/*", MaxBytes: 50},
+			{Type: "text/html", MaxBytes: 200},
+		},
+		DenyTypes: []string{"video/*", "application/vnd.apple.mpegurl"},
+	}
+}
+
+func TestLimit(t *testing.T) {
+	p := testPolicy()
+	cases := []struct {
+		contentType string
+		large       bool
+		want        int64
+	}{
+		{"image/png", false, 50},
+		{"text/html; charset=utf-8", false, 200},
+		{"TEXT/HTML", false, 200},
+		{"application/json", false, 100},
+		{"", false, 100},
+		{"image/png", true, 1000},
+	}
+	for _, c := range cases {
+		if got := p.Limit(c.contentType, c.large); got != c.want {
+			t.Errorf("Limit(%q, %v) = %d, want %d", c.contentType, c.large, got, c.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := testPolicy()
+
+	_, err := p.Check(http.Header{"Content-Type": {"video/mp4"}}, true)
+	if !errors.Is(err, ErrDeniedType) {
+		t.Errorf("video/mp4: err = %v, want ErrDeniedType", err)
+	}
+	_, err = p.Check(http.Header{"Content-Type": {"application/vnd.apple.mpegurl"}}, false)
+	if !errors.Is(err, ErrDeniedType) {
+		t.Errorf("HLS playlist: err = %v, want ErrDeniedType", err)
+	}
+
+	_, err = p.Check(http.Header{"Content-Type": {"image/jpeg"}, "Content-Length": {"51"}}, false)
+	var se *Error
+	if !errors.As(err, &se) || !errors.Is(err, ErrTooLarge) || se.Size != 51 || se.Limit != 50 {
+		t.Errorf("image over limit: err = %#v", err)
+	}
+
+	limit, err := p.Check(http.Header{"Content-Type": {"image/jpeg"}, "Content-Length": {"51"}}, true)
+	if err != nil || limit != 1000 {
+		t.Errorf("large request: limit = %d, err = %v", limit, err)
+	}
+}
+
+// endless 終わりのないストリーム
+type endless struct{ read int64 }
+
+func (e *endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	e.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestReadAllAbortsEarly(t *testing.T) {
+	r := &endless{}
+	_, err := ReadAll(r, 1024, "audio/mpeg")
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+	if r.read > 64*1024 {
+		t.Errorf("read %d bytes from an endless stream, want early abort", r.read)
+	}
+
+	body, err := ReadAll(strings.NewReader("hello"), 5, "text/plain")
+	if err != nil || string(body) != "hello" {
+		t.Errorf("ReadAll at limit = %q, %v", body, err)
+	}
+	body, err = ReadAll(io.LimitReader(&endless{}, 10), 0, "")
+	if err != nil || len(body) != 10 {
+		t.Errorf("ReadAll without limit = %d bytes, %v", len(body), err)
+	}
+}
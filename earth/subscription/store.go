@@ -0,0 +1,178 @@
+// Package subscription persists watched URLs that the Earth station refreshes on a schedule
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Space側から届く購読リクエストのメソッドとヘッダー
+const (
+	MethodSubscribe   = "SUBSCRIBE"
+	MethodUnsubscribe = "UNSUBSCRIBE"
+	IntervalHeader    = "X-Earth-Subscribe-Interval"
+	DepthHeader       = "X-Earth-Subscribe-Depth"
+	StatusHeader      = "X-Earth-Subscription" // 応答で購読状態を返すヘッダー（"active" / "removed"）
+)
+
+// Subscription 定期的に再取得するURL
+type Subscription struct {
+	URL         string            `json:"url"`
+	Interval    time.Duration     `json:"interval"`
+	Depth       int               `json:"depth"`
+	ReplyTo     string            `json:"reply_to,omitempty"` // 再取得した内容を送信するEID（空の場合はデフォルトの送信先）
+	CreatedAt   time.Time         `json:"created_at"`
+	LastFetched time.Time         `json:"last_fetched"`
+	Hashes      map[string]string `json:"hashes"` // 取得したURLごとの最後に送信したボディのハッシュ
+}
+
+// Due 再取得の時刻になっているか
+func (s *Subscription) Due(now time.Time) bool {
+	return s.LastFetched.IsZero() || now.Sub(s.LastFetched) >= s.Interval
+}
+
+// Store 購読の一覧をJSONファイルに保存する
+type Store struct {
+	mu   sync.Mutex
+	path string
+	subs map[string]*Subscription
+}
+
+// Open ファイルから購読の一覧を読み込む（ファイルが無い場合は空で開始する）
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, subs: make(map[string]*Subscription)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions %s: %w", path, err)
+	}
+
+	var list []*Subscription
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions %s: %w", path, err)
+	}
+	for _, sub := range list {
+		if sub.Hashes == nil {
+			sub.Hashes = make(map[string]string)
+		}
+		s.subs[sub.URL] = sub
+	}
+	return s, nil
+}
+
+// Add 購読を追加する。既に存在する場合は間隔・深さ・送信先だけを更新する
+// 同じURLの購読は1つだけなので、別のノードから登録し直すと送信先はそのノードに移る
+func (s *Store) Add(url string, interval time.Duration, depth int, replyTo string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub, ok := s.subs[url]; ok {
+		sub.Interval = interval
+		sub.Depth = depth
+		sub.ReplyTo = replyTo
+	} else {
+		s.subs[url] = &Subscription{
+			URL:       url,
+			Interval:  interval,
+			Depth:     depth,
+			ReplyTo:   replyTo,
+			CreatedAt: time.Now(),
+			Hashes:    make(map[string]string),
+		}
+	}
+	return s.save()
+}
+
+// Remove 購読を削除する
+func (s *Store) Remove(url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subs, url)
+	return s.save()
+}
+
+// List 購読の一覧をURL順に返す
+func (s *Store) List() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		list = append(list, *sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+	return list
+}
+
+// TakeDue 再取得の時刻になった購読を返し、取得時刻を記録する
+func (s *Store) TakeDue(now time.Time) ([]Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Subscription
+	for _, sub := range s.subs {
+		if sub.Due(now) {
+			sub.LastFetched = now
+			due = append(due, *sub)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due, s.save()
+}
+
+// Changed 取得したボディのハッシュが前回送信時から変化したかを判定する（記録はCommitで行う）
+// 購読が削除されている場合はfalseを返す
+func (s *Store) Changed(subURL, contentURL, hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[subURL]
+	return ok && sub.Hashes[contentURL] != hash
+}
+
+// Commit 送信したボディのハッシュを記録する
+// 送信に成功してから記録し、送信できなかった内容は次の再取得で再び変化したと判定されるようにする
+func (s *Store) Commit(subURL, contentURL, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[subURL]
+	if !ok || sub.Hashes[contentURL] == hash {
+		return nil
+	}
+	sub.Hashes[contentURL] = hash
+	return s.save()
+}
+
+// save 一時ファイルに書き込んでからリネームする（ロックを保持した状態で呼び出す）
+func (s *Store) save() error {
+	list := make([]*Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		list = append(list, sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,67 @@
+package subscription
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorePersistsAndDetectsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subs.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("https://example.com/news", time.Hour, 1, "ipn:151.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	due, err := s.TakeDue(now)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("expected 1 due subscription, got %d (%v)", len(due), err)
+	}
+	if due, _ := s.TakeDue(now.Add(time.Minute)); len(due) != 0 {
+		t.Errorf("subscription should not be due again before its interval")
+	}
+
+	if !s.Changed("https://example.com/news", "https://example.com/news", "aaa") {
+		t.Errorf("first content should be reported as changed")
+	}
+	// 送信に成功するまでは記録しない
+	if !s.Changed("https://example.com/news", "https://example.com/news", "aaa") {
+		t.Errorf("content should stay changed until it is committed")
+	}
+	if err := s.Commit("https://example.com/news", "https://example.com/news", "aaa"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Changed("https://example.com/news", "https://example.com/news", "aaa") {
+		t.Errorf("same content should not be reported as changed")
+	}
+
+	// 再起動後も購読とハッシュが残っている
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := reopened.List()
+	if len(list) != 1 || list[0].Interval != time.Hour || list[0].Depth != 1 || list[0].ReplyTo != "ipn:151.1" {
+		t.Fatalf("unexpected subscriptions after reopen: %+v", list)
+	}
+	if reopened.Changed("https://example.com/news", "https://example.com/news", "aaa") {
+		t.Errorf("hash should survive a restart")
+	}
+	if due, _ := reopened.TakeDue(now.Add(2 * time.Hour)); len(due) != 1 {
+		t.Errorf("subscription should be due after its interval")
+	}
+
+	if err := reopened.Remove("https://example.com/news"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Commit("https://example.com/news", "https://example.com/news", "bbb"); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Changed("https://example.com/news", "https://example.com/news", "bbb") {
+		t.Errorf("removed subscription should not report changes")
+	}
+}
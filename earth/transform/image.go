@@ -0,0 +1,131 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// ImageTranscoder JPEG/PNG/GIF画像を縮小・再エンコードしてリンクのバイト数を削減する
+// 再エンコード結果が元より小さい場合のみ置き換える
+type ImageTranscoder struct {
+	MaxDimension int      // 長辺の最大ピクセル数（0の場合は縮小しない）
+	MaxPixels    int64    // デコードする画像の最大画素数（0の場合は制限しない）
+	Quality      int      // JPEGの品質 (1-100)
+	ExcludeHosts []string // 変換しないホスト（科学画像など忠実度が重要な場合）
+}
+
+func (t *ImageTranscoder) Name() string {
+	return "image"
+}
+
+func (t *ImageTranscoder) Transform(res *Response, opts Options) (bool, error) {
+	contentType := res.ContentType()
+	switch contentType {
+	case "image/jpeg", "image/jpg", "image/png", "image/gif":
+	default:
+		return false, nil
+	}
+	if len(res.Body) == 0 || MatchHost(res.Host(), t.ExcludeHosts) {
+		return false, nil
+	}
+
+	// 展開後に巨大になる画像（decompression bomb）でメモリを使い切らないよう、デコード前に大きさを確認する
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(res.Body))
+	if err != nil {
+		return false, fmt.Errorf("image decode failed (%s): %w", res.URL, err)
+	}
+	if t.MaxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > t.MaxPixels {
+		return false, nil
+	}
+
+	var img image.Image
+	if format == "gif" {
+		// アニメーションGIFはフレームごとの処理が必要になるため対象外
+		g, err := gif.DecodeAll(bytes.NewReader(res.Body))
+		if err != nil {
+			return false, fmt.Errorf("gif decode failed (%s): %w", res.URL, err)
+		}
+		if len(g.Image) != 1 {
+			return false, nil
+		}
+		img = g.Image[0]
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(res.Body))
+		if err != nil {
+			return false, fmt.Errorf("image decode failed (%s): %w", res.URL, err)
+		}
+	}
+
+	img = downscale(img, t.MaxDimension)
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: t.Quality})
+	case "png":
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("image encode failed (%s): %w", res.URL, err)
+	}
+
+	if buf.Len() >= len(res.Body) {
+		return false, nil
+	}
+	res.setBody(buf.Bytes())
+	return true, nil
+}
+
+// downscale 長辺がmaxDimension以下になるように面積平均法で縮小する
+func downscale(src image.Image, maxDimension int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxDimension <= 0 || (w <= maxDimension && h <= maxDimension) {
+		return src
+	}
+
+	var dw, dh int
+	if w >= h {
+		dw = maxDimension
+		dh = max(1, h*maxDimension/w)
+	} else {
+		dh = maxDimension
+		dw = max(1, w*maxDimension/h)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0, sy1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			sx0, sx1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				off := rgba.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					r += uint32(rgba.Pix[off])
+					g += uint32(rgba.Pix[off+1])
+					bl += uint32(rgba.Pix[off+2])
+					a += uint32(rgba.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), uint8(a / n)})
+		}
+	}
+	return dst
+}
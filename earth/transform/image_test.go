@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"net/http"
+	"testing"
+)
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 13), uint8((x + y) * 3), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageTranscoderDownscales(t *testing.T) {
+	body := testJPEG(t, 800, 400)
+	res := &Response{
+		URL:    "https://example.com/a.jpg",
+		Header: http.Header{"Content-Type": {"image/jpeg"}},
+		Body:   body,
+	}
+	tr := &ImageTranscoder{MaxDimension: 200, Quality: 50}
+
+	applied, errs := Pipeline{tr}.Apply(res, Options{})
+	if len(errs) > 0 || len(applied) != 1 {
+		t.Fatalf("expected transform to apply, applied=%v errs=%v", applied, errs)
+	}
+	if len(res.Body) >= len(body) {
+		t.Errorf("transformed body (%d bytes) is not smaller than original (%d bytes)", len(res.Body), len(body))
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(res.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 200 || cfg.Height != 100 {
+		t.Errorf("got %dx%d, want 200x100", cfg.Width, cfg.Height)
+	}
+	if res.Header.Get(OriginalSizeHeader) == "" {
+		t.Errorf("%s header is not set", OriginalSizeHeader)
+	}
+}
+
+func TestImageTranscoderOptOut(t *testing.T) {
+	body := testJPEG(t, 400, 400)
+	tr := &ImageTranscoder{MaxDimension: 100, Quality: 50, ExcludeHosts: []string{".nasa.gov"}}
+
+	cases := []struct {
+		name   string
+		url    string
+		header http.Header
+		opts   Options
+	}{
+		{"excluded host", "https://images.nasa.gov/x.jpg", http.Header{"Content-Type": {"image/jpeg"}}, Options{}},
+		{"request opt-out", "https://example.com/x.jpg", http.Header{"Content-Type": {"image/jpeg"}}, ParseOptions(http.Header{"Cache-Control": {"no-transform"}})},
+		{"origin no-transform", "https://example.com/x.jpg", http.Header{"Content-Type": {"image/jpeg"}, "Cache-Control": {"public, no-transform"}}, Options{}},
+	}
+	for _, c := range cases {
+		res := &Response{URL: c.url, Header: c.header, Body: body}
+		if applied, _ := (Pipeline{tr}).Apply(res, c.opts); len(applied) != 0 {
+			t.Errorf("%s: transform should not be applied", c.name)
+		}
+	}
+}
+
+func TestImageTranscoderPixelBudget(t *testing.T) {
+	body := testJPEG(t, 800, 400)
+	cases := []struct {
+		name      string
+		maxPixels int64
+		want      bool
+	}{
+		{"unlimited", 0, true},
+		{"within budget", 800 * 400, true},
+		{"over budget", 800*400 - 1, false},
+	}
+	for _, c := range cases {
+		res := &Response{URL: "https://example.com/a.jpg", Header: http.Header{"Content-Type": {"image/jpeg"}}, Body: body}
+		tr := &ImageTranscoder{MaxDimension: 200, MaxPixels: c.maxPixels, Quality: 50}
+		applied, errs := Pipeline{tr}.Apply(res, Options{})
+		if len(errs) > 0 {
+			t.Fatalf("%s: errs=%v", c.name, errs)
+		}
+		if got := len(applied) == 1; got != c.want {
+			t.Errorf("%s: applied=%v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestImageTranscoderGIF(t *testing.T) {
+	frame := func() *image.Paletted {
+		img := image.NewPaletted(image.Rect(0, 0, 400, 400), palette.Plan9)
+		for y := 0; y < 400; y++ {
+			for x := 0; x < 400; x++ {
+				img.SetColorIndex(x, y, uint8((x/4+y/4)%256))
+			}
+		}
+		return img
+	}
+	encode := func(frames int) []byte {
+		g := &gif.GIF{}
+		for i := 0; i < frames; i++ {
+			g.Image = append(g.Image, frame())
+			g.Delay = append(g.Delay, 10)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	tr := &ImageTranscoder{MaxDimension: 100, Quality: 50}
+
+	res := &Response{URL: "https://example.com/a.gif", Header: http.Header{"Content-Type": {"image/gif"}}, Body: encode(1)}
+	if applied, errs := (Pipeline{tr}).Apply(res, Options{}); len(errs) > 0 || len(applied) != 1 {
+		t.Fatalf("still gif: applied=%v errs=%v", applied, errs)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(res.Body))
+	if err != nil || format != "gif" || cfg.Width != 100 || cfg.Height != 100 {
+		t.Errorf("got %s %dx%d, %v, want gif 100x100", format, cfg.Width, cfg.Height, err)
+	}
+
+	// アニメーションGIFは変換しない
+	res = &Response{URL: "https://example.com/b.gif", Header: http.Header{"Content-Type": {"image/gif"}}, Body: encode(2)}
+	if applied, errs := (Pipeline{tr}).Apply(res, Options{}); len(errs) > 0 || len(applied) != 0 {
+		t.Errorf("animated gif: applied=%v errs=%v", applied, errs)
+	}
+}
@@ -0,0 +1,442 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// LiteModeHeader リクエストでライトモードを指定するヘッダー、およびレスポンスで適用したモードを示すヘッダー
+const LiteModeHeader = "X-Earth-Lite-Mode"
+
+// ライトモードの種類
+const (
+	LiteOff  = "off"  // 変換しない
+	LiteLite = "lite" // スクリプト・iframe・トラッカー・コメント・余分な空白を除去し、小さなCSSをインライン化
+	LiteText = "text" // 本文テキストだけを抜き出した簡易ページを生成（readability風）
+)
+
+// ValidLiteMode ライトモードの値として有効かどうか
+func ValidLiteMode(mode string) bool {
+	switch mode {
+	case LiteOff, LiteLite, LiteText:
+		return true
+	}
+	return false
+}
+
+// defaultTrackerHosts 除去する既知のトラッカーのホスト
+var defaultTrackerHosts = []string{
+	".google-analytics.com",
+	".googletagmanager.com",
+	".googlesyndication.com",
+	".doubleclick.net",
+	".facebook.net",
+	".hotjar.com",
+	".scorecardresearch.com",
+	".quantserve.com",
+	".adnxs.com",
+	".criteo.com",
+	".taboola.com",
+	".outbrain.com",
+	".newrelic.com",
+	".nr-data.net",
+	".segment.com",
+	".segment.io",
+	".mixpanel.com",
+	".clarity.ms",
+}
+
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+// CSS中の参照（url(...) と文字列で指定した @import）
+var (
+	cssURLRegex    = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)"'\s]*))\s*\)`)
+	cssImportRegex = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+)
+
+// LiteHostRule ホストごとのライトモード指定
+type LiteHostRule struct {
+	Match string // ホストのパターン（MatchHostの形式）
+	Mode  string
+}
+
+// LiteRewriter HTMLを解析して軽量化する
+// 適用するモードは リクエスト指定 > ホストごとの規則 > デフォルト の順に決まる
+type LiteRewriter struct {
+	DefaultMode       string
+	HostRules         []LiteHostRule
+	TrackerHosts      []string // 追加で除去するトラッカーのホスト
+	InlineCSSMaxBytes int      // この大きさ以下の外部CSSは<style>としてインライン化する（0で無効）
+
+	// FetchCSS 外部CSSを取得する関数（nilの場合はインライン化しない）
+	FetchCSS func(cssURL string) ([]byte, error)
+}
+
+func (l *LiteRewriter) Name() string {
+	return "lite"
+}
+
+// mode このレスポンスに適用するモードを決定する
+func (l *LiteRewriter) mode(res *Response, opts Options) string {
+	if opts.LiteMode != "" {
+		return opts.LiteMode
+	}
+	host := res.Host()
+	for _, rule := range l.HostRules {
+		if MatchHost(host, []string{rule.Match}) {
+			return rule.Mode
+		}
+	}
+	if l.DefaultMode == "" {
+		return LiteOff
+	}
+	return l.DefaultMode
+}
+
+func (l *LiteRewriter) Transform(res *Response, opts Options) (bool, error) {
+	if res.ContentType() != "text/html" || len(res.Body) == 0 {
+		return false, nil
+	}
+	mode := l.mode(res, opts)
+	if mode == LiteOff {
+		return false, nil
+	}
+
+	// x/net/html はUTF-8を前提とするため、他の文字コードのページは変換しない
+	if cs := charsetOf(res.Header.Get("Content-Type")); cs != "" && cs != "utf-8" && cs != "utf8" {
+		return false, nil
+	}
+
+	doc, err := html.Parse(bytes.NewReader(res.Body))
+	if err != nil {
+		return false, fmt.Errorf("html parse failed (%s): %w", res.URL, err)
+	}
+	baseURL, _ := url.Parse(res.URL)
+
+	switch mode {
+	case LiteLite:
+		l.rewriteLite(doc, baseURL)
+	case LiteText:
+		doc = extractArticle(doc)
+	default:
+		return false, fmt.Errorf("unknown lite mode %q", mode)
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return false, fmt.Errorf("html render failed (%s): %w", res.URL, err)
+	}
+
+	res.setBody(buf.Bytes())
+	res.Header.Set("Content-Type", "text/html; charset=utf-8")
+	res.Header.Set(LiteModeHeader, mode)
+	return true, nil
+}
+
+// rewriteLite 不要な要素を除去し、小さなCSSをインライン化する
+func (l *LiteRewriter) rewriteLite(doc *html.Node, baseURL *url.URL) {
+	trackers := append(append([]string{}, defaultTrackerHosts...), l.TrackerHosts...)
+
+	var walk func(n *html.Node, preformatted bool)
+	walk = func(n *html.Node, preformatted bool) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.Type == html.CommentNode:
+				n.RemoveChild(c)
+			case c.Type == html.TextNode:
+				if !preformatted {
+					c.Data = whitespaceRegex.ReplaceAllString(c.Data, " ")
+					if strings.TrimSpace(c.Data) == "" && (c.PrevSibling == nil || c.NextSibling == nil) {
+						n.RemoveChild(c)
+					}
+				}
+			case c.Type == html.ElementNode && l.shouldRemove(c, baseURL, trackers):
+				n.RemoveChild(c)
+			case c.Type == html.ElementNode:
+				stripEventHandlers(c)
+				if c.DataAtom == atom.Link && l.inlineStylesheet(c, baseURL) {
+					break
+				}
+				walk(c, preformatted || c.DataAtom == atom.Pre || c.DataAtom == atom.Textarea)
+			}
+			c = next
+		}
+	}
+	walk(doc, false)
+}
+
+// shouldRemove ライトモードで除去する要素かどうか
+func (l *LiteRewriter) shouldRemove(n *html.Node, baseURL *url.URL, trackers []string) bool {
+	switch n.DataAtom {
+	case atom.Script, atom.Noscript, atom.Iframe, atom.Frame, atom.Embed:
+		return true
+	case atom.Link:
+		rel := strings.ToLower(attr(n, "rel"))
+		if strings.Contains(rel, "modulepreload") || (strings.Contains(rel, "preload") && attr(n, "as") == "script") {
+			return true
+		}
+		if strings.Contains(rel, "dns-prefetch") || strings.Contains(rel, "preconnect") {
+			return true
+		}
+	case atom.Img:
+		// トラッキングピクセル（1x1画像）
+		if attr(n, "width") == "1" && attr(n, "height") == "1" {
+			return true
+		}
+	}
+	for _, name := range []string{"src", "href"} {
+		if v := attr(n, name); v != "" {
+			if u, err := baseURL.Parse(v); err == nil && MatchHost(u.Hostname(), trackers) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inlineStylesheet 小さな外部CSSを<style>要素に置き換える
+func (l *LiteRewriter) inlineStylesheet(n *html.Node, baseURL *url.URL) bool {
+	if l.FetchCSS == nil || l.InlineCSSMaxBytes <= 0 || baseURL == nil {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(attr(n, "rel")), "stylesheet") {
+		return false
+	}
+	href := attr(n, "href")
+	if href == "" {
+		return false
+	}
+	cssURL, err := baseURL.Parse(href)
+	if err != nil {
+		return false
+	}
+	css, err := l.FetchCSS(cssURL.String())
+	if err != nil || len(css) == 0 || len(css) > l.InlineCSSMaxBytes {
+		return false
+	}
+	// <style>の中身はエスケープされないため、要素を閉じてしまうCSSはインライン化しない
+	if strings.Contains(strings.ToLower(string(css)), "</style") {
+		return false
+	}
+
+	style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+	if media := attr(n, "media"); media != "" {
+		style.Attr = []html.Attribute{{Key: "media", Val: media}}
+	}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: rewriteCSSURLs(string(css), cssURL)})
+	n.Parent.InsertBefore(style, n)
+	n.Parent.RemoveChild(n)
+	return true
+}
+
+// rewriteCSSURLs CSS中の相対的な参照をCSSのURLを基準にした絶対URLに書き換える
+// インライン化するとページのURLが基準になるため、画像やフォント、@importの参照先が変わってしまう
+func rewriteCSSURLs(css string, cssURL *url.URL) string {
+	resolve := func(ref string) (string, bool) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(strings.ToLower(ref), "data:") {
+			return "", false
+		}
+		u, err := cssURL.Parse(ref)
+		if err != nil {
+			return "", false
+		}
+		return u.String(), true
+	}
+	replace := func(re *regexp.Regexp, format string) {
+		css = re.ReplaceAllStringFunc(css, func(m string) string {
+			sub := re.FindStringSubmatch(m)
+			ref := strings.Join(sub[1:], "") // 一致した引用符の形式のものだけが空でない
+			abs, ok := resolve(ref)
+			if !ok {
+				return m
+			}
+			return fmt.Sprintf(format, strings.ReplaceAll(abs, `"`, "%22"))
+		})
+	}
+	replace(cssURLRegex, `url("%s")`)
+	replace(cssImportRegex, `@import "%s"`)
+	return css
+}
+
+// stripEventHandlers onclickなどのイベントハンドラ属性を除去する（スクリプトを除去したため不要）
+func stripEventHandlers(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if strings.HasPrefix(strings.ToLower(a.Key), "on") {
+			continue
+		}
+		if (a.Key == "href" || a.Key == "src") && strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:") {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
+// extractArticle 本文と思われる部分のテキストだけを含む簡易ページを生成する
+// <article> / <main> があればそれを、無ければ段落テキストが最も多い要素を本文とみなす
+func extractArticle(doc *html.Node) *html.Node {
+	title := strings.TrimSpace(textContent(findFirst(doc, atom.Title)))
+
+	content := findFirst(doc, atom.Article)
+	if content == nil {
+		content = findFirst(doc, atom.Main)
+	}
+	if content == nil {
+		content = bestScoringNode(doc)
+	}
+	if content == nil {
+		content = findFirst(doc, atom.Body)
+	}
+
+	out := &html.Node{Type: html.DocumentNode}
+	out.AppendChild(&html.Node{Type: html.DoctypeNode, Data: "html"})
+	htmlNode := element(atom.Html)
+	head := element(atom.Head)
+	meta := element(atom.Meta)
+	meta.Attr = []html.Attribute{{Key: "charset", Val: "utf-8"}}
+	head.AppendChild(meta)
+	if title != "" {
+		head.AppendChild(textElement(atom.Title, title))
+	}
+	body := element(atom.Body)
+	if title != "" {
+		body.AppendChild(textElement(atom.H1, title))
+	}
+	htmlNode.AppendChild(head)
+	htmlNode.AppendChild(body)
+	out.AppendChild(htmlNode)
+
+	if content == nil {
+		return out
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Nav, atom.Aside, atom.Footer, atom.Form, atom.Iframe:
+				continue
+			case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Li, atom.Blockquote, atom.Pre:
+				text := textContent(c)
+				if c.DataAtom != atom.Pre {
+					text = strings.TrimSpace(whitespaceRegex.ReplaceAllString(text, " "))
+				}
+				if text != "" {
+					body.AppendChild(textElement(c.DataAtom, text))
+				}
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(content)
+	return out
+}
+
+// bestScoringNode 直下の<p>のテキスト量が最も多い要素を探す
+func bestScoringNode(doc *html.Node) *html.Node {
+	var best *html.Node
+	bestScore := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		score := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.DataAtom == atom.P {
+				score += len(strings.TrimSpace(textContent(c)))
+			}
+		}
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				walk(c)
+			}
+		}
+	}
+	walk(doc)
+	return best
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findFirst(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			return
+		}
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style) {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func element(a atom.Atom) *html.Node {
+	return &html.Node{Type: html.ElementNode, Data: a.String(), DataAtom: a}
+}
+
+func textElement(a atom.Atom, text string) *html.Node {
+	n := element(a)
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+	return n
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// charsetOf Content-Typeのcharsetパラメータを小文字で返す
+func charsetOf(contentType string) string {
+	_, params, found := strings.Cut(contentType, ";")
+	if !found {
+		return ""
+	}
+	for _, p := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if strings.EqualFold(k, "charset") {
+			return strings.ToLower(strings.Trim(v, `"' `))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package transform
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testPage = `<!DOCTYPE html>
+<html><head><title>Mission News</title>
+<!-- build 1234 -->
+<script src="/app.js"></script>
+<script async src="https://www.googletagmanager.com/gtag/js"></script>
+<link rel="stylesheet" href="/small.css">
+</head>
+<body onload="init()">
+  <nav><a href="/">Home</a></nav>
+  <iframe src="https://ads.example.net/"></iframe>
+  <article>
+    <h2>Launch   update</h2>
+    <p>The   vehicle reached orbit.</p>
+    <p>All systems nominal.</p>
+  </article>
+  <img src="https://www.google-analytics.com/collect" width="1" height="1">
+  <pre>  keep   spacing  </pre>
+</body></html>`
+
+func newTestRewriter() *LiteRewriter {
+	return &LiteRewriter{
+		DefaultMode:       LiteOff,
+		InlineCSSMaxBytes: 1024,
+		HostRules:         []LiteHostRule{{Match: ".news.example", Mode: LiteText}},
+		FetchCSS: func(cssURL string) ([]byte, error) {
+			return []byte("body{margin:0}"), nil
+		},
+	}
+}
+
+func TestLiteRewriterLite(t *testing.T) {
+	res := &Response{
+		URL:    "https://example.com/index.html",
+		Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:   []byte(testPage),
+	}
+	changed, err := newTestRewriter().Transform(res, Options{LiteMode: LiteLite})
+	if err != nil || !changed {
+		t.Fatalf("expected lite rewrite, changed=%v err=%v", changed, err)
+	}
+	out := string(res.Body)
+	for _, unwanted := range []string{"<script", "<iframe", "googletagmanager", "google-analytics", "build 1234", "onload", `href="/small.css"`} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("output still contains %q:\n%s", unwanted, out)
+		}
+	}
+	for _, wanted := range []string{"<style>body{margin:0}</style>", "The vehicle reached orbit.", "<pre>  keep   spacing  </pre>"} {
+		if !strings.Contains(out, wanted) {
+			t.Errorf("output does not contain %q:\n%s", wanted, out)
+		}
+	}
+	if res.Header.Get(LiteModeHeader) != LiteLite {
+		t.Errorf("%s = %q, want %q", LiteModeHeader, res.Header.Get(LiteModeHeader), LiteLite)
+	}
+}
+
+func TestLiteRewriterTextByHostRule(t *testing.T) {
+	res := &Response{
+		URL:    "https://www.news.example/today",
+		Header: http.Header{"Content-Type": {"text/html"}},
+		Body:   []byte(testPage),
+	}
+	changed, err := newTestRewriter().Transform(res, Options{})
+	if err != nil || !changed {
+		t.Fatalf("expected text rewrite, changed=%v err=%v", changed, err)
+	}
+	out := string(res.Body)
+	if strings.Contains(out, "Home") || strings.Contains(out, "<img") {
+		t.Errorf("text mode output contains non-article content:\n%s", out)
+	}
+	if !strings.Contains(out, "<h1>Mission News</h1>") || !strings.Contains(out, "<h2>Launch update</h2>") {
+		t.Errorf("text mode output is missing title or headings:\n%s", out)
+	}
+	if res.Header.Get(LiteModeHeader) != LiteText {
+		t.Errorf("%s = %q, want %q", LiteModeHeader, res.Header.Get(LiteModeHeader), LiteText)
+	}
+}
+
+func TestLiteRewriterOffByDefault(t *testing.T) {
+	res := &Response{
+		URL:    "https://example.com/",
+		Header: http.Header{"Content-Type": {"text/html"}},
+		Body:   []byte(testPage),
+	}
+	if changed, _ := newTestRewriter().Transform(res, Options{}); changed {
+		t.Error("page should not be rewritten when mode is off")
+	}
+}
+
+func TestLiteRewriterInlineCSSRewritesURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		css     string
+		wanted  []string
+		inlined bool
+	}{
+		{
+			name: "relative references",
+			css:  `@import "base.css"; @import url(print.css) print; body{background:url('../img/bg.png')} @font-face{src:url(/fonts/a.woff2)}`,
+			wanted: []string{
+				`@import "https://cdn.example.com/css/base.css"`,
+				`@import url("https://cdn.example.com/css/print.css") print`,
+				`url("https://cdn.example.com/img/bg.png")`,
+				`url("https://cdn.example.com/fonts/a.woff2")`,
+			},
+			inlined: true,
+		},
+		{
+			name:    "absolute and data references are kept",
+			css:     `a{background:url(https://img.example.org/a.png)} b{background:url(data:image/png;base64,AAAA)} c{filter:url(#blur)}`,
+			wanted:  []string{`url("https://img.example.org/a.png")`, `url(data:image/png;base64,AAAA)`, `url(#blur)`},
+			inlined: true,
+		},
+		{
+			name:   "closing style tag",
+			css:    `body{margin:0}</STYLE><script>alert(1)</script>`,
+			wanted: []string{`href="https://cdn.example.com/css/site.css"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LiteRewriter{
+				DefaultMode:       LiteLite,
+				InlineCSSMaxBytes: 1024,
+				FetchCSS: func(cssURL string) ([]byte, error) {
+					if cssURL != "https://cdn.example.com/css/site.css" {
+						t.Errorf("fetched %s", cssURL)
+					}
+					return []byte(tt.css), nil
+				},
+			}
+			res := &Response{
+				URL:    "https://example.com/news/index.html",
+				Header: http.Header{"Content-Type": {"text/html"}},
+				Body:   []byte(`<html><head><link rel="stylesheet" href="https://cdn.example.com/css/site.css"></head><body><p>hi</p></body></html>`),
+			}
+			if _, err := l.Transform(res, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			out := string(res.Body)
+			if got := strings.Contains(out, "<style>"); got != tt.inlined {
+				t.Errorf("inlined = %v, want %v:\n%s", got, tt.inlined, out)
+			}
+			for _, wanted := range tt.wanted {
+				if !strings.Contains(out, wanted) {
+					t.Errorf("output does not contain %q:\n%s", wanted, out)
+				}
+			}
+			if strings.Contains(out, "<script") {
+				t.Errorf("output contains a script:\n%s", out)
+			}
+		})
+	}
+}
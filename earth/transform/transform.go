@@ -0,0 +1,138 @@
+// Package transform provides response body transformations applied on the Earth station before sending
+package transform
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// OriginalSizeHeader 変換前のボディサイズを記録するレスポンスヘッダー
+const OriginalSizeHeader = "X-Earth-Original-Size"
+
+// NoTransformHeader 変換を無効にするリクエストヘッダー（Cache-Control: no-transform と同じ意味）
+const NoTransformHeader = "X-Earth-No-Transform"
+
+// Options リクエストごとの変換オプション
+// クロールで見つかったリソースにも元のリクエストのオプションが引き継がれる
+type Options struct {
+	NoTransform bool   // すべての変換を行わない
+	LiteMode    string // リクエストで指定されたライトモード（空の場合はホスト規則・デフォルトに従う）
+}
+
+// ParseOptions リクエストヘッダーから変換オプションを読み取る
+func ParseOptions(h http.Header) Options {
+	var opts Options
+	if v := h.Get(NoTransformHeader); v != "" {
+		opts.NoTransform, _ = strconv.ParseBool(v)
+	}
+	for _, line := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), "no-transform") {
+				opts.NoTransform = true
+			}
+		}
+	}
+	if mode := strings.ToLower(strings.TrimSpace(h.Get(LiteModeHeader))); ValidLiteMode(mode) {
+		opts.LiteMode = mode
+	}
+	return opts
+}
+
+// Response 変換対象のレスポンス
+type Response struct {
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// ContentType メディアタイプ部分（パラメータを除いた小文字）を返す
+func (r *Response) ContentType() string {
+	mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// Host レスポンスのURLのホスト名を返す
+func (r *Response) Host() string {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// forbidsTransform オリジンが Cache-Control: no-transform を指定しているか
+func (r *Response) forbidsTransform() bool {
+	for _, line := range r.Header.Values("Cache-Control") {
+		for _, d := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), "no-transform") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setBody 変換後のボディを設定し、元のサイズをヘッダーに記録する
+func (r *Response) setBody(body []byte) {
+	if r.Header.Get(OriginalSizeHeader) == "" {
+		r.Header.Set(OriginalSizeHeader, strconv.Itoa(len(r.Body)))
+	}
+	r.Body = body
+	r.Header.Del("Content-Length")
+	r.Header.Add("Warning", `214 - "Transformation Applied"`)
+}
+
+// Transformer レスポンスボディの変換器
+type Transformer interface {
+	// Name ログ出力用の名前
+	Name() string
+	// Transform レスポンスを変換する。変換した場合は true を返す
+	Transform(res *Response, opts Options) (bool, error)
+}
+
+// Pipeline 複数の変換器を順に適用する
+type Pipeline []Transformer
+
+// Apply すべての変換器を適用し、適用された変換器の名前を返す
+// 変換器のエラーはそのレスポンスを変換しなかったものとして扱い、errsに集める
+func (p Pipeline) Apply(res *Response, opts Options) (applied []string, errs []error) {
+	if opts.NoTransform || res.forbidsTransform() {
+		return nil, nil
+	}
+	for _, t := range p {
+		changed, err := t.Transform(res, opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if changed {
+			applied = append(applied, t.Name())
+		}
+	}
+	return applied, errs
+}
+
+// MatchHost ホスト名がパターンのいずれかに一致するか判定する
+// パターンは完全一致、または ".example.com" / "*.example.com" 形式のサフィックス一致
+func MatchHost(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		p = strings.TrimPrefix(p, "*")
+		if p == "" {
+			continue
+		}
+		if strings.HasPrefix(p, ".") {
+			if strings.HasSuffix(host, p) || host == p[1:] {
+				return true
+			}
+			continue
+		}
+		if host == p {
+			return true
+		}
+	}
+	return false
+}
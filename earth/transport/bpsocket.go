@@ -0,0 +1,52 @@
+package transport
+
+import (
+	"context"
+
+	"earth/bpsocket"
+)
+
+// BpSocket AF_BPソケット（bp-socketカーネルモジュール）を使うトランスポート
+type BpSocket struct {
+	receiver *bpsocket.BpReceiver
+	sender   *bpsocket.BpSender
+}
+
+// NewBpSocket 受信用（ipn:localNode.localSvc）と送信用（ipn:localNode.sendFromSvc）のソケットを作成する
+func NewBpSocket(localNode, localSvc, sendFromSvc uint64, remote bpsocket.EID) (*BpSocket, error) {
+	receiver, err := bpsocket.NewBpReceiver(localNode, localSvc)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := bpsocket.NewBpSender(localNode, sendFromSvc, remote.NodeNum, remote.SvcNum)
+	if err != nil {
+		receiver.Close()
+		return nil, err
+	}
+	return &BpSocket{receiver: receiver, sender: sender}, nil
+}
+
+func (t *BpSocket) Start() error {
+	t.receiver.Start()
+	return nil
+}
+
+func (t *BpSocket) Bundles() <-chan bpsocket.Bundle {
+	return t.receiver.GetDataChannel()
+}
+
+func (t *BpSocket) Send(ctx context.Context, data []byte, to bpsocket.EID) error {
+	return t.sender.SendBytes(ctx, data, to)
+}
+
+func (t *BpSocket) DefaultRemote() bpsocket.EID {
+	return t.sender.DefaultRemote()
+}
+
+func (t *BpSocket) Close() error {
+	err := t.receiver.Close()
+	if serr := t.sender.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"earth/bpsocket"
+)
+
+// recvFilePattern bprecvfileが作成するファイル名（testfile1, testfile2, ...）
+const recvFilePattern = "testfile*"
+
+// retryInterval 受信コマンドが失敗した場合に再実行するまでの待機時間
+const retryInterval = time.Second
+
+// sentFileTTL 送信したファイルを残しておく時間
+// bpsendfileはファイルを参照して送信するため、コマンドの終了直後には削除しない
+const sentFileTTL = time.Hour
+
+// IonCLIConfig IONのCLIを使うトランスポートの設定
+type IonCLIConfig struct {
+	RecvCommand string       // 受信コマンド（bprecvfile）
+	SendCommand string       // 送信コマンド（bpsendfile）
+	WorkDir     string       // 受信・送信するファイルを置くディレクトリ
+	Local       bpsocket.EID // 受信するEID
+	Source      bpsocket.EID // 送信元のEID
+	Remote      bpsocket.EID // デフォルトの送信先
+}
+
+// IonCLI IONのbprecvfile/bpsendfileコマンドでファイルとしてバンドルを交換するトランスポート
+// bp-socketカーネルモジュールが無い環境でも、IONがインストールされていれば動作する
+// 受信したバンドルの送信元は分からないため、応答はreply_toまたはデフォルトの送信先に返す
+type IonCLI struct {
+	conf    IonCLIConfig
+	recvDir string
+	sendDir string
+	bundles chan bpsocket.Bundle
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	seq     atomic.Uint64
+}
+
+func NewIonCLI(conf IonCLIConfig) (*IonCLI, error) {
+	for _, name := range []string{conf.RecvCommand, conf.SendCommand} {
+		if _, err := exec.LookPath(name); err != nil {
+			return nil, fmt.Errorf("ION command not found: %w", err)
+		}
+	}
+	t := &IonCLI{
+		conf:    conf,
+		recvDir: filepath.Join(conf.WorkDir, "recv"),
+		sendDir: filepath.Join(conf.WorkDir, "send"),
+		bundles: make(chan bpsocket.Bundle, 100),
+	}
+	for _, dir := range []string{t.recvDir, t.sendDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	log.Printf("[IonCLI] Receiving on %s with %s, sending from %s with %s", conf.Local, conf.RecvCommand, conf.Source, conf.SendCommand)
+	return t, nil
+}
+
+func (t *IonCLI) Start() error {
+	t.wg.Add(1)
+	go t.receiveLoop()
+	return nil
+}
+
+func (t *IonCLI) Bundles() <-chan bpsocket.Bundle {
+	return t.bundles
+}
+
+// receiveLoop bprecvfileで1つずつバンドルを受信し、作成されたファイルを読み込んで削除する
+func (t *IonCLI) receiveLoop() {
+	defer t.wg.Done()
+	defer close(t.bundles)
+
+	for t.ctx.Err() == nil {
+		t.removeReceived()
+
+		cmd := exec.CommandContext(t.ctx, t.conf.RecvCommand, t.conf.Local.String(), "1")
+		cmd.Dir = t.recvDir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if t.ctx.Err() != nil {
+				return
+			}
+			log.Printf("[IonCLI] %s error: %v, output: %s", t.conf.RecvCommand, err, output)
+			select {
+			case <-t.ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+
+		files, _ := filepath.Glob(filepath.Join(t.recvDir, recvFilePattern))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			_ = os.Remove(file)
+			if err != nil {
+				log.Printf("[IonCLI] Read error: %v", err)
+				continue
+			}
+			log.Printf("[IonCLI] Received %d bytes", len(data))
+			select {
+			case t.bundles <- bpsocket.Bundle{Data: data}:
+			case <-t.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// removeReceived 前回の受信で残ったファイルを削除する（bprecvfileは同じ名前で上書きしないため）
+func (t *IonCLI) removeReceived() {
+	files, _ := filepath.Glob(filepath.Join(t.recvDir, recvFilePattern))
+	for _, file := range files {
+		_ = os.Remove(file)
+	}
+}
+
+// Send データをファイルに書き出してbpsendfileで送信する
+func (t *IonCLI) Send(ctx context.Context, data []byte, to bpsocket.EID) error {
+	if to.IsZero() {
+		to = t.conf.Remote
+	}
+	if len(data) > MaxBundleSize {
+		return fmt.Errorf("bundle size %d exceeds max %d", len(data), MaxBundleSize)
+	}
+
+	t.removeSent(time.Now().Add(-sentFileTTL))
+	file := filepath.Join(t.sendDir, fmt.Sprintf("bundle_%d_%d.json", time.Now().UnixNano(), t.seq.Add(1)))
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("file write error: %w", err)
+	}
+
+	output, err := exec.CommandContext(ctx, t.conf.SendCommand, t.conf.Source.String(), to.String(), file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s error: %w, output: %s", t.conf.SendCommand, err, output)
+	}
+	log.Printf("[IonCLI] Sent %d bytes to %s", len(data), to)
+	return nil
+}
+
+// removeSent 送信してから時間が経ったファイルを削除する
+func (t *IonCLI) removeSent(before time.Time) {
+	entries, err := os.ReadDir(t.sendDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.ModTime().Before(before) {
+			_ = os.Remove(filepath.Join(t.sendDir, e.Name()))
+		}
+	}
+}
+
+func (t *IonCLI) DefaultRemote() bpsocket.EID {
+	return t.conf.Remote
+}
+
+func (t *IonCLI) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
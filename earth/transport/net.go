@@ -0,0 +1,303 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"earth/bpsocket"
+)
+
+// maxDatagramSize UDPで送信できる1つのフレームの最大サイズ
+const maxDatagramSize = 65507
+
+// NetConfig TCP/UDPを使うトランスポートの設定
+type NetConfig struct {
+	Network string                  // "tcp" または "udp"
+	Listen  string                  // 受信するアドレス（"host:port"）
+	Local   bpsocket.EID            // 送信するフレームに付ける送信元のEID
+	Remote  bpsocket.EID            // デフォルトの送信先
+	Peers   map[bpsocket.EID]string // 送信先のEIDごとのアドレス
+}
+
+// Net TCPまたはUDPでバンドルを交換するトランスポート
+// DTNの無い地上局の構成や、カーネルモジュール無しでパイプラインを動かすテストで使う
+//
+// 各フレームは送信元のEIDとデータからなる:
+//
+//	[2バイト: EIDの長さ][EID ("ipn:N.S")][4バイト: データの長さ][データ]
+//
+// TCPは1つの接続で複数のフレームを続けて送れる。UDPは1つのデータグラムに1つのフレームを入れる
+type Net struct {
+	conf     NetConfig
+	listener net.Listener   // TCP
+	packet   net.PacketConn // UDP
+	bundles  chan bpsocket.Bundle
+	closed   chan struct{}
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{} // 受信中のTCP接続（Closeで切断する）
+}
+
+// NewNet 受信するアドレスでリッスンを開始する（受信したフレームはStartの後にチャネルに渡される）
+func NewNet(conf NetConfig) (*Net, error) {
+	t := &Net{
+		conf:    conf,
+		bundles: make(chan bpsocket.Bundle, 100),
+		closed:  make(chan struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	var err error
+	switch conf.Network {
+	case "tcp":
+		t.listener, err = net.Listen("tcp", conf.Listen)
+	case "udp":
+		t.packet, err = net.ListenPacket("udp", conf.Listen)
+	default:
+		return nil, fmt.Errorf("unsupported network: %q", conf.Network)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", conf.Listen, err)
+	}
+	log.Printf("[Net] Listening on %s/%s as %s", t.Addr(), conf.Network, conf.Local)
+	return t, nil
+}
+
+// Addr 受信しているアドレス（ポートに0を指定した場合の実際のポートを知るため）
+func (t *Net) Addr() net.Addr {
+	if t.listener != nil {
+		return t.listener.Addr()
+	}
+	return t.packet.LocalAddr()
+}
+
+func (t *Net) Start() error {
+	t.wg.Add(1)
+	if t.listener != nil {
+		go t.acceptLoop()
+	} else {
+		go t.packetLoop()
+	}
+	return nil
+}
+
+func (t *Net) Bundles() <-chan bpsocket.Bundle {
+	return t.bundles
+}
+
+func (t *Net) acceptLoop() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.closed:
+				return
+			default:
+				log.Printf("[Net] Accept error: %v", err)
+				continue
+			}
+		}
+		// Closeが接続を切断した後に登録されないよう、ロック中に閉じられていないか確認する
+		t.mu.Lock()
+		select {
+		case <-t.closed:
+			t.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		t.conns[conn] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+
+		go t.serveConn(conn)
+	}
+}
+
+// serveConn 接続が閉じられるまでフレームを読み込む
+func (t *Net) serveConn(conn net.Conn) {
+	defer t.wg.Done()
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		from, data, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("[Net] Read error from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if !t.deliver(from, data) {
+			return
+		}
+	}
+}
+
+func (t *Net) packetLoop() {
+	defer t.wg.Done()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := t.packet.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-t.closed:
+				return
+			default:
+				log.Printf("[Net] Read error: %v", err)
+				continue
+			}
+		}
+		from, data, err := decodeFrame(buf[:n])
+		if err != nil {
+			log.Printf("[Net] Invalid datagram from %s: %v", addr, err)
+			continue
+		}
+		if !t.deliver(from, data) {
+			return
+		}
+	}
+}
+
+// deliver 受信したバンドルをチャネルに渡す（閉じられた場合はfalse）
+func (t *Net) deliver(from bpsocket.EID, data []byte) bool {
+	log.Printf("[Net] Received %d bytes from %s", len(data), from)
+	select {
+	case t.bundles <- bpsocket.Bundle{Data: data, From: from}:
+		return true
+	case <-t.closed:
+		return false
+	}
+}
+
+// Send 宛先のEIDに対応するアドレスにフレームを送信する
+func (t *Net) Send(ctx context.Context, data []byte, to bpsocket.EID) error {
+	if to.IsZero() {
+		to = t.conf.Remote
+	}
+	addr, ok := t.conf.Peers[to]
+	if !ok {
+		return fmt.Errorf("no address configured for %s", to)
+	}
+	if len(data) > MaxBundleSize {
+		return fmt.Errorf("bundle size %d exceeds max %d", len(data), MaxBundleSize)
+	}
+	frame := encodeFrame(t.conf.Local, data)
+	if t.conf.Network == "udp" && len(frame) > maxDatagramSize {
+		return fmt.Errorf("frame size %d exceeds UDP datagram max %d", len(frame), maxDatagramSize)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, t.conf.Network, addr)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+	if _, err := conn.Write(frame); err != nil {
+		return fmt.Errorf("write to %s: %w", addr, err)
+	}
+	log.Printf("[Net] Sent %d bytes to %s (%s)", len(data), to, addr)
+	return nil
+}
+
+func (t *Net) DefaultRemote() bpsocket.EID {
+	return t.conf.Remote
+}
+
+func (t *Net) Close() error {
+	close(t.closed)
+	var err error
+	if t.listener != nil {
+		err = t.listener.Close()
+	} else {
+		err = t.packet.Close()
+	}
+	t.mu.Lock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+	close(t.bundles)
+	return err
+}
+
+// encodeFrame 送信元のEIDとデータを1つのフレームにする
+func encodeFrame(from bpsocket.EID, data []byte) []byte {
+	eid := from.String()
+	if from.IsZero() {
+		eid = ""
+	}
+	frame := make([]byte, 0, 2+len(eid)+4+len(data))
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(eid)))
+	frame = append(frame, eid...)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(data)))
+	return append(frame, data...)
+}
+
+// readFrame ストリームから1つのフレームを読み込む
+func readFrame(r io.Reader) (bpsocket.EID, []byte, error) {
+	var eidLen uint16
+	if err := binary.Read(r, binary.BigEndian, &eidLen); err != nil {
+		return bpsocket.EID{}, nil, err
+	}
+	eid := make([]byte, eidLen)
+	if _, err := io.ReadFull(r, eid); err != nil {
+		return bpsocket.EID{}, nil, err
+	}
+	from, err := parseFrameEID(string(eid))
+	if err != nil {
+		return bpsocket.EID{}, nil, err
+	}
+
+	var dataLen uint32
+	if err := binary.Read(r, binary.BigEndian, &dataLen); err != nil {
+		return bpsocket.EID{}, nil, err
+	}
+	if dataLen > MaxBundleSize {
+		return bpsocket.EID{}, nil, fmt.Errorf("bundle size %d exceeds max %d", dataLen, MaxBundleSize)
+	}
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return bpsocket.EID{}, nil, err
+	}
+	return from, data, nil
+}
+
+// decodeFrame データグラム全体を1つのフレームとして読み込む
+func decodeFrame(b []byte) (bpsocket.EID, []byte, error) {
+	r := bytes.NewReader(b)
+	from, data, err := readFrame(r)
+	if err != nil {
+		return bpsocket.EID{}, nil, err
+	}
+	if r.Len() > 0 {
+		return bpsocket.EID{}, nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+	return from, data, nil
+}
+
+// parseFrameEID フレームの送信元のEIDを解釈する（空の場合は送信元不明）
+func parseFrameEID(s string) (bpsocket.EID, error) {
+	if s == "" {
+		return bpsocket.EID{}, nil
+	}
+	return bpsocket.ParseEID(s)
+}
@@ -0,0 +1,30 @@
+// Package transport abstracts how the Earth station exchanges bundles with space nodes
+package transport
+
+import (
+	"context"
+
+	"earth/bpsocket"
+)
+
+// MaxBundleSize 1つのバンドルの最大サイズ
+const MaxBundleSize = 4 * 1024 * 1024
+
+// Transport Space側のノードとバンドルを交換する手段
+// bp_socket（AF_BP）、IONのCLI（bprecvfile/bpsendfile）、TCP/UDPのいずれでも同じパイプラインを動かせるようにする
+type Transport interface {
+	// Start 受信を開始する
+	Start() error
+
+	// Bundles 受信したバンドルを受け取るチャネルを返す
+	Bundles() <-chan bpsocket.Bundle
+
+	// Send データを1つのバンドルとして送信する（宛先がゼロ値の場合はデフォルトの送信先）
+	Send(ctx context.Context, data []byte, to bpsocket.EID) error
+
+	// DefaultRemote 宛先を指定しない場合の送信先
+	DefaultRemote() bpsocket.EID
+
+	// Close 受信を止めて資源を解放する
+	Close() error
+}
@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"earth/bpsocket"
+)
+
+var (
+	earthEID = bpsocket.EID{NodeNum: 150, SvcNum: 2}
+	spaceEID = bpsocket.EID{NodeNum: 149, SvcNum: 1}
+)
+
+func receive(t *testing.T, ch <-chan bpsocket.Bundle) bpsocket.Bundle {
+	t.Helper()
+	select {
+	case b, ok := <-ch:
+		if !ok {
+			t.Fatal("bundle channel closed")
+		}
+		return b
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a bundle")
+	}
+	return bpsocket.Bundle{}
+}
+
+func TestNetRoundTrip(t *testing.T) {
+	for _, network := range []string{"tcp", "udp"} {
+		t.Run(network, func(t *testing.T) {
+			space, err := NewNet(NetConfig{Network: network, Listen: "127.0.0.1:0", Local: spaceEID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer space.Close()
+			space.Start()
+
+			earth, err := NewNet(NetConfig{
+				Network: network,
+				Listen:  "127.0.0.1:0",
+				Local:   earthEID,
+				Remote:  spaceEID,
+				Peers:   map[bpsocket.EID]string{spaceEID: space.Addr().String()},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer earth.Close()
+			earth.Start()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for _, msg := range []string{`{"request_id":"1"}`, `{"request_id":"2"}`} {
+				if err := earth.Send(ctx, []byte(msg), bpsocket.EID{}); err != nil {
+					t.Fatal(err)
+				}
+				got := receive(t, space.Bundles())
+				if string(got.Data) != msg || got.From != earthEID {
+					t.Errorf("received %q from %s, want %q from %s", got.Data, got.From, msg, earthEID)
+				}
+			}
+
+			if err := earth.Send(ctx, []byte("x"), bpsocket.EID{NodeNum: 200, SvcNum: 1}); err == nil {
+				t.Error("sending to an unknown peer should fail")
+			}
+		})
+	}
+}
+
+func TestNetLimits(t *testing.T) {
+	space, err := NewNet(NetConfig{Network: "udp", Listen: "127.0.0.1:0", Local: spaceEID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer space.Close()
+	earth, err := NewNet(NetConfig{
+		Network: "udp",
+		Listen:  "127.0.0.1:0",
+		Local:   earthEID,
+		Remote:  spaceEID,
+		Peers:   map[bpsocket.EID]string{spaceEID: space.Addr().String()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer earth.Close()
+
+	if err := earth.Send(context.Background(), make([]byte, maxDatagramSize), bpsocket.EID{}); err == nil {
+		t.Error("a frame larger than a UDP datagram should be rejected")
+	}
+
+	// 不正なフレーム
+	frame := encodeFrame(earthEID, []byte("hello"))
+	if _, _, err := decodeFrame(append(frame, 0)); err == nil {
+		t.Error("trailing bytes should be rejected")
+	}
+	if _, _, err := decodeFrame(frame[:len(frame)-1]); err == nil {
+		t.Error("a truncated frame should be rejected")
+	}
+	from, data, err := decodeFrame(encodeFrame(bpsocket.EID{}, []byte("anon")))
+	if err != nil || !from.IsZero() || string(data) != "anon" {
+		t.Errorf("decodeFrame(anonymous) = %v, %q, %v", from, data, err)
+	}
+}
+
+func TestIonCLI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	sentDir := filepath.Join(dir, "sent")
+	if err := os.Mkdir(sentDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// bprecvfile/bpsendfileの代わりに、ファイルを作成・コピーするだけのスクリプトを使う
+	recv := writeScript(t, dir, "fake-bprecvfile", `[ -e "$0.done" ] && exec sleep 60
+touch "$0.done"
+printf '{"url":"https://example.com/"}' > testfile1`)
+	send := writeScript(t, dir, "fake-bpsendfile", `printf '%s %s ' "$1" "$2" > "`+sentDir+`/out"
+cat "$3" >> "`+sentDir+`/out"`)
+
+	tr, err := NewIonCLI(IonCLIConfig{
+		RecvCommand: recv,
+		SendCommand: send,
+		WorkDir:     filepath.Join(dir, "work"),
+		Local:       bpsocket.EID{NodeNum: 150, SvcNum: 1},
+		Source:      earthEID,
+		Remote:      spaceEID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Start()
+
+	got := receive(t, tr.Bundles())
+	if string(got.Data) != `{"url":"https://example.com/"}` || !got.From.IsZero() {
+		t.Errorf("received %q from %s", got.Data, got.From)
+	}
+
+	if err := tr.Send(context.Background(), []byte(`{"status_code":200}`), bpsocket.EID{}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(filepath.Join(sentDir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `ipn:150.2 ipn:149.1 {"status_code":200}`; string(out) != want {
+		t.Errorf("bpsendfile called with %q, want %q", out, want)
+	}
+
+	// Closeは実行中の受信コマンドを止める
+	done := make(chan struct{})
+	go func() {
+		tr.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the receive command")
+	}
+}
+
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	var b bytes.Buffer
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString(strings.TrimSpace(body))
+	b.WriteString("\n")
+	if err := os.WriteFile(path, b.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}